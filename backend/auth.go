@@ -2,30 +2,53 @@ package main
 
 import (
 	"context"
+	"crypto/subtle"
 	"encoding/json"
 	"errors"
 	"log/slog"
 	"net/http"
 	"os"
+	"slices"
 	"strings"
 	"time"
 
 	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 
+	"restaurant-backend/internal/apikey"
 	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/oidc"
 	"restaurant-backend/internal/repository"
 )
 
-var jwtSecret []byte
+// adminRequires2FA forces admin-role users to log in with a second factor.
+// It can only be switched off explicitly, e.g. for local development.
+var adminRequires2FA bool
 
-func init() {
-	// Load JWT private/server secret from environment variable
-	secret := os.Getenv("JWT_SECRET")
-	if secret == "" {
-		secret = "dev-secret-change-in-production" // Fallback for development
-	} // think an error would be better
-	jwtSecret = []byte(secret)
+const (
+	// purposeTwoFactor marks an interim token awaiting a TOTP/recovery code
+	purposeTwoFactor = "2fa"
+	// purposeEnroll marks an interim token that may only enroll in 2FA
+	purposeEnroll = "2fa_enroll"
+
+	interimTokenTTL = 5 * time.Minute
+
+	// maxTwoFactorAttempts is how many codes a user may try before two-factor
+	// login is locked for twoFactorLockout
+	maxTwoFactorAttempts = 5
+	twoFactorLockout     = 15 * time.Minute
+)
+
+// initAuth loads auth settings. It must run after the .env file is loaded.
+func initAuth() error {
+	adminRequires2FA = os.Getenv("ADMIN_2FA_REQUIRED") != "false"
+
+	var err error
+	if oidcProviders, err = oidc.LoadProviders(); err != nil {
+		return err
+	}
+
+	return initKeys()
 }
 
 func hashPassword(password string) (string, error) {
@@ -44,24 +67,54 @@ func checkPassword(password, hash string) (bool, error) {
 	return true, nil
 }
 
-func generateToken(user *models.User) (string, error) {
+// generateToken issues a full access token. amr lists the authentication
+// methods used and defaults to password only.
+func generateToken(user *models.User, amr ...string) (string, error) {
+	if len(amr) == 0 {
+		amr = []string{"pwd"}
+	}
+	return signClaims(user, amr, "", 4*time.Hour)
+}
+
+// generateInterimToken issues a short-lived token that is only accepted by
+// the login step named by purpose
+func generateInterimToken(user *models.User, purpose string) (string, error) {
+	return signClaims(user, []string{"pwd"}, purpose, interimTokenTTL)
+}
+
+func signClaims(user *models.User, amr []string, purpose string,
+	ttl time.Duration) (string, error) {
 	claims := models.Claims{
-		UserID: user.ID,
-		Email:  user.Email,
-		Role:   user.Role,
+		UserID:  user.ID,
+		Email:   user.Email,
+		Role:    user.Role,
+		AMR:     amr,
+		Purpose: purpose,
 		RegisteredClaims: jwt.RegisteredClaims{
-			ExpiresAt: jwt.NewNumericDate(time.Now().Add(4 * time.Hour)),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(ttl)),
 			IssuedAt:  jwt.NewNumericDate(time.Now()),
 		},
 	}
 
-	return jwt.NewWithClaims(jwt.SigningMethodHS256, claims).
-		SignedString(jwtSecret)
+	kr := keys.Load()
+	token := jwt.NewWithClaims(kr.signingMethod, claims)
+	token.Header["kid"] = kr.signingKID
+	return token.SignedString(kr.signingKey)
 }
 
 func validateToken(tokenString string) (*models.Claims, error) {
+	kr := keys.Load()
 	keyFunc := func(t *jwt.Token) (any, error) {
-		return jwtSecret, nil
+		kid, _ := t.Header["kid"].(string)
+		if kid == "" {
+			// Tokens issued before kids were introduced
+			kid = "hs256"
+		}
+		vk, ok := kr.verify[kid]
+		if !ok || vk.method.Alg() != t.Method.Alg() {
+			return nil, jwt.ErrTokenUnverifiable
+		}
+		return vk.public, nil
 	}
 
 	token, err := jwt.ParseWithClaims(tokenString, &models.Claims{}, keyFunc)
@@ -77,26 +130,155 @@ func validateToken(tokenString string) (*models.Claims, error) {
 	return claims, nil
 }
 
+// validateAPIKey looks up an API key and returns claims acting as its owner,
+// limited to the key's scopes
+func validateAPIKey(key string) (*models.Claims, error) {
+	prefix, ok := apikey.Parse(key)
+	if !ok {
+		return nil, errors.New("malformed API key")
+	}
+
+	stored, err := repository.GetActiveAPIKeyByPrefix(prefix)
+	if err != nil {
+		return nil, err
+	}
+	if subtle.ConstantTimeCompare([]byte(stored.KeyHash),
+		[]byte(apikey.Hash(key))) != 1 {
+		return nil, errors.New("API key mismatch")
+	}
+
+	if err := repository.TouchAPIKey(stored.ID); err != nil {
+		slog.Warn("failed to record API key use", "error", err, "key_id", stored.ID)
+	}
+
+	return &models.Claims{
+		UserID: stored.UserID,
+		AMR:    []string{"apikey"},
+		Scopes: stored.Scopes,
+	}, nil
+}
+
 // authMiddleware validates JWT token and adds user to context
 func authMiddleware(next http.Handler) http.Handler {
+	return authenticate(next, false, "")
+}
+
+// enrollmentMiddleware is authMiddleware that additionally accepts the
+// interim token handed to admins who still have to set up 2FA
+func enrollmentMiddleware(next http.Handler) http.Handler {
+	return authenticate(next, false, "", purposeEnroll)
+}
+
+// passwordChangeMiddleware is authMiddleware that also lets in users who
+// must change their password, for the endpoint where they do so
+func passwordChangeMiddleware(next http.Handler) http.Handler {
+	return authenticate(next, true, "")
+}
+
+// authenticate validates the bearer token, which must carry one of the
+// given purposes ("" being a normal access token). Users who must change
+// their password are refused unless passwordChange is set.
+func authenticate(next http.Handler, passwordChange bool, purposes ...string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		authHeader := r.Header.Get("Authorization")
-		if authHeader == "" {
-			http.Error(w, "Authorization header required", http.StatusUnauthorized)
+		credential := r.Header.Get("X-API-Key")
+		if credential == "" {
+			authHeader := r.Header.Get("Authorization")
+			if authHeader == "" {
+				http.Error(w, "Authorization header required", http.StatusUnauthorized)
+				return
+			}
+
+			parts := strings.Split(authHeader, " ")
+			if len(parts) != 2 || parts[0] != "Bearer" {
+				http.Error(w, "Invalid authorization header", http.StatusUnauthorized)
+				return
+			}
+			credential = parts[1]
+		}
+
+		var claims *models.Claims
+		var err error
+		viaAPIKey := strings.HasPrefix(credential, apikey.Marker)
+		if viaAPIKey {
+			claims, err = validateAPIKey(credential)
+			if err != nil || !slices.Contains(purposes, "") {
+				http.Error(w, "Invalid API key", http.StatusUnauthorized)
+				return
+			}
+			scope := apikey.RequiredScope(r.Method, r.URL.Path)
+			if scope == "" {
+				http.Error(w, "API keys cannot be used here", http.StatusForbidden)
+				return
+			}
+			if !apikey.Allows(claims.Scopes, scope) {
+				http.Error(w, "API key lacks scope "+scope, http.StatusForbidden)
+				return
+			}
+		} else {
+			claims, err = validateToken(credential)
+			if err != nil || !slices.Contains(purposes, claims.Purpose) {
+				http.Error(w, "Invalid token", http.StatusUnauthorized)
+				return
+			}
+		}
+
+		// Check the account on every request so that disabling a user or
+		// changing their role takes effect without waiting for token expiry
+		user, err := repository.GetUserByID(claims.UserID)
+		if err != nil || (!viaAPIKey && tokenRevoked(claims, user)) {
+			http.Error(w, "Invalid token", http.StatusUnauthorized)
+			return
+		}
+		if user.Disabled {
+			http.Error(w, "Account is disabled", http.StatusForbidden)
+			return
+		}
+		if user.MustChangePassword && !passwordChange && claims.Purpose == "" {
+			http.Error(w, "You must change your password before continuing",
+				http.StatusForbidden)
 			return
 		}
+		claims.Role = user.Role
+		claims.Email = user.Email
+
+		ctx := context.WithValue(r.Context(), models.UserContextKey, claims)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// tokenRevoked reports whether a session token was issued before the user's
+// password last changed
+func tokenRevoked(claims *models.Claims, user *models.User) bool {
+	return claims.IssuedAt == nil || claims.IssuedAt.Unix() < user.PasswordChangedAt
+}
 
-		parts := strings.Split(authHeader, " ")
-		if len(parts) != 2 || parts[0] != "Bearer" {
-			http.Error(w, "Invalid authorization header", http.StatusUnauthorized)
+// optionalAuthMiddleware identifies the user on public routes when a valid
+// session token is sent, and otherwise lets the request through anonymously.
+// The token may also be passed as ?token= since EventSource cannot set
+// headers.
+func optionalAuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		token := strings.TrimPrefix(r.Header.Get("Authorization"), "Bearer ")
+		if token == "" {
+			token = r.URL.Query().Get("token")
+		}
+		if token == "" || strings.HasPrefix(token, apikey.Marker) {
+			next.ServeHTTP(w, r)
 			return
 		}
 
-		claims, err := validateToken(parts[1])
-		if err != nil {
-			http.Error(w, "Invalid token", http.StatusUnauthorized)
+		claims, err := validateToken(token)
+		if err != nil || claims.Purpose != "" {
+			next.ServeHTTP(w, r)
 			return
 		}
+		user, err := repository.GetUserByID(claims.UserID)
+		if err != nil || user.Disabled || tokenRevoked(claims, user) {
+			next.ServeHTTP(w, r)
+			return
+		}
+		claims.Role = user.Role
+		claims.Email = user.Email
 
 		ctx := context.WithValue(r.Context(), models.UserContextKey, claims)
 		next.ServeHTTP(w, r.WithContext(ctx))
@@ -111,6 +293,13 @@ func adminMiddleware(next http.Handler) http.Handler {
 			http.Error(w, "Admin access required", http.StatusForbidden)
 			return
 		}
+		// API keys are minted by an admin who already passed 2FA
+		if adminRequires2FA && !slices.Contains(claims.AMR, "otp") &&
+			!slices.Contains(claims.AMR, "apikey") {
+			http.Error(w, "Two-factor authentication required for admin access",
+				http.StatusForbidden)
+			return
+		}
 		next.ServeHTTP(w, r)
 	})
 }
@@ -196,6 +385,12 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if user.Disabled {
+		slog.Warn("login attempt on disabled account", "email", req.Email)
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+		return
+	}
+
 	match, err := checkPassword(req.Password, user.Password)
 	if err != nil {
 		slog.Error("password check error", "error", err, "email", req.Email)
@@ -208,15 +403,49 @@ func loginHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	token, err := generateToken(user)
+	writeLoginResult(w, user)
+}
+
+// loginResult decides how a user who has proven their first factor
+// continues: either with a full token or, when 2FA applies, with an interim
+// token for the next step. It returns the response body and status code.
+func loginResult(user *models.User, amr ...string) (any, int, error) {
+	if user.TwoFactorEnabled || (adminRequires2FA && user.Role == "admin") {
+		challenge := models.LoginChallenge{TwoFactorRequired: true}
+		purpose := purposeTwoFactor
+		if !user.TwoFactorEnabled {
+			challenge = models.LoginChallenge{EnrollmentRequired: true}
+			purpose = purposeEnroll
+		}
+
+		token, err := generateInterimToken(user, purpose)
+		if err != nil {
+			return nil, 0, err
+		}
+		challenge.InterimToken = token
+		return challenge, http.StatusAccepted, nil
+	}
+
+	token, err := generateToken(user, amr...)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	user.Password = "" // Don't send password back
+	return models.AuthResponse{Token: token, User: *user}, http.StatusOK, nil
+}
+
+// writeLoginResult sends the loginResult for a user as JSON
+func writeLoginResult(w http.ResponseWriter, user *models.User, amr ...string) {
+	body, status, err := loginResult(user, amr...)
 	if err != nil {
 		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
 		return
 	}
 
-	user.Password = "" // Don't send password back
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(models.AuthResponse{Token: token, User: *user})
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(body)
 }
 
 // getMeHandler handles GET /api/auth/me
@@ -0,0 +1,104 @@
+package apikey
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestGenerateAndParse(t *testing.T) {
+	key, prefix, hash, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(key, Marker+prefix+"_") {
+		t.Errorf("key %q does not start with its prefix %q", key, prefix)
+	}
+	if got, ok := Parse(key); !ok || got != prefix {
+		t.Errorf("Parse(key) = %q, %v; want %q, true", got, ok, prefix)
+	}
+	if Hash(key) != hash {
+		t.Error("Hash(key) does not match the hash from Generate")
+	}
+
+	other, _, _, err := Generate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if other == key || Hash(other) == hash {
+		t.Error("two generated keys are the same")
+	}
+}
+
+func TestParse(t *testing.T) {
+	secret := strings.Repeat("a", 48)
+	tests := []struct {
+		name   string
+		key    string
+		prefix string
+		ok     bool
+	}{
+		{"valid", "rsk_0123abcd_" + secret, "0123abcd", true},
+		{"missing marker", "0123abcd_" + secret, "", false},
+		{"jwt", "eyJhbGciOiJIUzI1NiJ9.e30.sig", "", false},
+		{"short prefix", "rsk_0123abc_" + secret, "", false},
+		{"short secret", "rsk_0123abcd_" + secret[1:], "", false},
+		{"no secret", "rsk_0123abcd", "", false},
+		{"empty", "", "", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			prefix, ok := Parse(tt.key)
+			if prefix != tt.prefix || ok != tt.ok {
+				t.Errorf("Parse = %q, %v; want %q, %v", prefix, ok, tt.prefix, tt.ok)
+			}
+		})
+	}
+}
+
+func TestAllows(t *testing.T) {
+	tests := []struct {
+		name     string
+		granted  []string
+		required string
+		want     bool
+	}{
+		{"exact scope", []string{"orders:read", "products:write"}, "products:write", true},
+		{"all scopes", []string{ScopeAll}, "users:write", true},
+		{"read does not grant write", []string{"products:read"}, "products:write", false},
+		{"write does not grant read", []string{"products:write"}, "products:read", false},
+		{"other resource", []string{"orders:write"}, "users:write", false},
+		{"no scopes", nil, "orders:read", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := Allows(tt.granted, tt.required); got != tt.want {
+				t.Errorf("Allows(%v, %q) = %v, want %v", tt.granted, tt.required, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRequiredScope(t *testing.T) {
+	tests := []struct {
+		method string
+		path   string
+		want   string
+	}{
+		{"GET", "/api/products", "products:read"},
+		{"HEAD", "/api/products/4", "products:read"},
+		{"POST", "/api/products/4/supply", "products:write"},
+		{"DELETE", "/api/orders/7", "orders:write"},
+		{"GET", "/api/admin/users", "users:read"},
+		{"PUT", "/api/admin/users/3/role", "users:write"},
+		{"POST", "/api/admin/suppliers", "suppliers:write"},
+		{"GET", "/api/admin/purchase-orders/2", "purchase-orders:read"},
+		{"GET", "/api/admin/api-keys", ""},
+		{"POST", "/api/admin/api-keys", ""},
+		{"DELETE", "/api/admin/api-keys/1", ""},
+	}
+	for _, tt := range tests {
+		if got := RequiredScope(tt.method, tt.path); got != tt.want {
+			t.Errorf("RequiredScope(%s, %s) = %q, want %q", tt.method, tt.path, got, tt.want)
+		}
+	}
+}
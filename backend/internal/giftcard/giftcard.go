@@ -0,0 +1,60 @@
+// Package giftcard defines the format of gift card codes.
+//
+// A code looks like "GIFT-XXXX-XXXX-XXXX-XXXX" using letters and digits that
+// cannot be confused when read aloud or typed from a printed card. Like API
+// keys, only a SHA-256 hash and the last four characters are stored.
+package giftcard
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"strings"
+)
+
+// Marker starts every gift card code
+const Marker = "GIFT"
+
+// alphabet leaves out 0/O and 1/I
+const alphabet = "ABCDEFGHJKLMNPQRSTUVWXYZ23456789"
+
+// codeLength is the number of random characters in a code
+const codeLength = 16
+
+// Generate returns a new code, the hash to store and its last four
+// characters
+func Generate() (code, hash, last4 string, err error) {
+	buf := make([]byte, codeLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", "", "", err
+	}
+
+	groups := []string{Marker}
+	for i := 0; i < codeLength; i += 4 {
+		var group [4]byte
+		for j := range group {
+			group[j] = alphabet[int(buf[i+j])%len(alphabet)]
+		}
+		groups = append(groups, string(group[:]))
+	}
+	code = strings.Join(groups, "-")
+	return code, Hash(code), code[len(code)-4:], nil
+}
+
+// Normalize uppercases a code and drops spaces and dashes, so codes match
+// however they were typed
+func Normalize(code string) string {
+	code = strings.ToUpper(code)
+	return strings.Map(func(r rune) rune {
+		if r == ' ' || r == '-' {
+			return -1
+		}
+		return r
+	}, code)
+}
+
+// Hash returns the stored form of a code
+func Hash(code string) string {
+	sum := sha256.Sum256([]byte(Normalize(code)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"restaurant-backend/internal/apikey"
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+// scopePattern matches "<resource>:read" or "<resource>:write"
+var scopePattern = regexp.MustCompile(`^[a-z][a-z-]*:(read|write)$`)
+
+// CreateAPIKey handles POST /api/admin/api-keys. The key acts as the admin
+// who created it, restricted to the requested scopes.
+func CreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.CreateAPIKeyRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" || len(req.Scopes) == 0 {
+		http.Error(w, "Name and at least one scope are required",
+			http.StatusBadRequest)
+		return
+	}
+	for _, s := range req.Scopes {
+		if s != apikey.ScopeAll && !scopePattern.MatchString(s) {
+			http.Error(w, fmt.Sprintf("Invalid scope %q, expected e.g. products:write or *", s),
+				http.StatusBadRequest)
+			return
+		}
+	}
+	if req.ExpiresInDays < 0 {
+		http.Error(w, "expiresInDays cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	key, prefix, hash, err := apikey.Generate()
+	if err != nil {
+		http.Error(w, "Failed to generate key", http.StatusInternalServerError)
+		return
+	}
+
+	stored := &models.APIKey{
+		UserID:  claims.UserID,
+		Name:    req.Name,
+		Prefix:  prefix,
+		Scopes:  req.Scopes,
+		KeyHash: hash,
+	}
+	if err := repository.CreateAPIKey(stored, req.ExpiresInDays); err != nil {
+		slog.Error("failed to create api key", "error", err)
+		http.Error(w, "Failed to create API key", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "api_key.created", nil, fmt.Sprintf("id=%d prefix=%s scopes=%s",
+		stored.ID, prefix, strings.Join(req.Scopes, ",")))
+
+	stored.Key = key
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(stored)
+}
+
+// ListAPIKeys handles GET /api/admin/api-keys
+func ListAPIKeys(w http.ResponseWriter, r *http.Request) {
+	keys, err := repository.ListAPIKeys()
+	if err != nil {
+		http.Error(w, "Failed to fetch API keys", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(keys)
+}
+
+// RevokeAPIKey handles DELETE /api/admin/api-keys/{id}
+func RevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid API key ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := repository.RevokeAPIKey(id); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "API key not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to revoke API key", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "api_key.revoked", nil, fmt.Sprintf("id=%d", id))
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,347 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+	"time"
+
+	"restaurant-backend/internal/loyalty"
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/pricing"
+	"restaurant-backend/internal/repository"
+	"restaurant-backend/internal/tax"
+)
+
+// errBadCart is wrapped by problems with the items in a cart
+var errBadCart = errors.New("invalid cart")
+
+// customizationOption is an extra offered with products in some categories
+type customizationOption struct {
+	models.CustomizationOption
+	categories []models.ProductCategory
+}
+
+// customizationOptions are the extras on the menu pages, by ID
+var customizationOptions = map[string]customizationOption{
+	"extra-spicy": {models.CustomizationOption{ID: "extra-spicy", Name: "Extra Spicy",
+		Price: 1}, []models.ProductCategory{models.CategoryEastern, models.CategoryWestern}},
+	"extra-cheese": {models.CustomizationOption{ID: "extra-cheese", Name: "Extra Cheese",
+		Price: 3}, []models.ProductCategory{models.CategoryEastern, models.CategoryWestern}},
+	"extra-rice": {models.CustomizationOption{ID: "extra-rice", Name: "Extra Rice",
+		Price: 3}, []models.ProductCategory{models.CategoryEastern}},
+}
+
+// priceItems prices cart items from the catalogue. Customizations are
+// looked up by ID and replaced with the server's name and price, so the
+// client's prices are never used.
+func priceItems(items []models.OrderItem) ([]pricing.Line, error) {
+	lines := make([]pricing.Line, 0, len(items))
+	for i := range items {
+		item := &items[i]
+		if item.Quantity <= 0 {
+			return nil, fmt.Errorf("%w: quantity must be positive", errBadCart)
+		}
+
+		product, err := repository.FetchProductByID(item.ProductID)
+		if err == sql.ErrNoRows {
+			return nil, fmt.Errorf("%w: product %d does not exist", errBadCart,
+				item.ProductID)
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		unitPrice := product.Price
+		seen := map[string]bool{}
+		for j, c := range item.Customizations {
+			option, ok := customizationOptions[c.ID]
+			if !ok || !slices.Contains(option.categories, product.Category) {
+				return nil, fmt.Errorf("%w: %s cannot be customized with %q",
+					errBadCart, product.Name, c.ID)
+			}
+			if seen[c.ID] {
+				return nil, fmt.Errorf("%w: customization %q is listed twice",
+					errBadCart, c.ID)
+			}
+			seen[c.ID] = true
+			item.Customizations[j] = option.CustomizationOption
+			unitPrice += option.Price
+		}
+
+		lines = append(lines, pricing.Line{
+			ProductID: product.ID,
+			Name:      product.Name,
+			Category:  string(product.Category),
+			BasePrice: product.Price,
+			UnitPrice: pricing.Round(unitPrice),
+			Quantity:  item.Quantity,
+		})
+	}
+	return lines, nil
+}
+
+// couponDiscount looks up and applies a coupon code. A *pricing.CouponError
+// is returned when the customer can fix the problem.
+func couponDiscount(code string, lines []pricing.Line, userID int) (*models.OrderDiscount, error) {
+	coupon, err := repository.GetCouponByCode(strings.TrimSpace(code))
+	if err == sql.ErrNoRows {
+		return nil, &pricing.CouponError{Message: "Unknown coupon code"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var usage pricing.CouponUsage
+	usage.Total, usage.ForUser, err = repository.CountCouponRedemptions(coupon.ID,
+		userID)
+	if err != nil {
+		return nil, err
+	}
+
+	amount, err := pricing.ApplyCoupon(coupon, lines, usage, time.Now())
+	if err != nil {
+		return nil, err
+	}
+
+	description := coupon.Description
+	if description == "" {
+		description = "Coupon " + coupon.Code
+	}
+	return &models.OrderDiscount{
+		CouponID:    &coupon.ID,
+		Code:        coupon.Code,
+		Description: description,
+		Amount:      amount,
+	}, nil
+}
+
+// quoteCart prices a cart with an optional coupon, points redemption and
+// gift card payments. Coupon, points and gift card problems are reported in
+// the quote rather than as an error so the cart still shows its prices.
+func quoteCart(req models.CartQuoteRequest, userID int) (*models.CartQuote, error) {
+	if len(req.Items) == 0 && len(req.GiftCardPurchases) == 0 {
+		return nil, fmt.Errorf("%w: the cart is empty", errBadCart)
+	}
+	if len(req.GiftCardPurchases) > maxGiftCardsPerOrder {
+		return nil, fmt.Errorf("%w: at most %d gift cards per order", errBadCart,
+			maxGiftCardsPerOrder)
+	}
+
+	if req.OrderType == "" {
+		req.OrderType = tax.Takeaway
+	}
+	if !tax.ValidOrderType(req.OrderType) {
+		return nil, fmt.Errorf("%w: orderType must be %s or %s", errBadCart,
+			tax.DineIn, tax.Takeaway)
+	}
+	if req.PartySize < 0 || req.PartySize > maxPartySize {
+		return nil, fmt.Errorf("%w: partySize must be between 0 and %d",
+			errBadCart, maxPartySize)
+	}
+
+	lines, err := priceItems(req.Items)
+	if err != nil {
+		return nil, err
+	}
+
+	quote := &models.CartQuote{
+		Items:        make([]models.QuoteLine, len(lines)),
+		Subtotal:     pricing.Subtotal(lines),
+		Discounts:    []models.OrderDiscount{},
+		OrderType:    req.OrderType,
+		TaxInclusive: tax.Settings.PricesIncludeTax,
+	}
+	for i, l := range lines {
+		quote.Items[i] = models.QuoteLine{
+			ProductID: l.ProductID,
+			Name:      l.Name,
+			Quantity:  l.Quantity,
+			UnitPrice: l.UnitPrice,
+			LineTotal: l.Total(),
+		}
+	}
+
+	if strings.TrimSpace(req.CouponCode) != "" {
+		discount, err := couponDiscount(req.CouponCode, lines, userID)
+		switch {
+		case pricing.IsCouponError(err):
+			quote.CouponError = err.Error()
+		case err != nil:
+			return nil, err
+		default:
+			quote.Discounts = append(quote.Discounts, *discount)
+		}
+	}
+
+	// Discounts only apply to food, so gift cards are added after them
+	total := quote.Subtotal
+	for _, d := range quote.Discounts {
+		total -= d.Amount
+	}
+
+	// Points are applied last, on what is left to pay
+	if req.RedeemPoints != 0 {
+		discount, problem, err := pointsDiscount(req.RedeemPoints, max(total, 0),
+			userID)
+		if err != nil {
+			return nil, err
+		}
+		if problem != "" {
+			quote.PointsError = problem
+		} else if discount != nil {
+			quote.Discounts = append(quote.Discounts, *discount)
+			total -= discount.Amount
+		}
+	}
+
+	total = max(total, 0)
+	food := total
+	if err := taxQuote(quote, lines, food); err != nil {
+		return nil, err
+	}
+	if !quote.TaxInclusive {
+		total += quote.Tax
+	}
+
+	// Service charges and tips are on the food after discounts, are not
+	// taxed and cannot be paid with points
+	if len(lines) > 0 {
+		rules, err := repository.FetchServiceChargeRules()
+		if err != nil {
+			return nil, err
+		}
+		rule, charge := pricing.ServiceCharge(rules, req.OrderType, req.PartySize,
+			food)
+		if rule != nil {
+			quote.ServiceCharge, quote.ServiceChargeName = charge, rule.Name
+		}
+	}
+	if quote.TipAmount, err = pricing.Tip(req.Tip, food); err != nil {
+		return nil, fmt.Errorf("%w: %v", errBadCart, err)
+	}
+	total += quote.ServiceCharge + quote.TipAmount
+
+	for _, p := range req.GiftCardPurchases {
+		if err := validateGiftCardPurchase(&p); err != nil {
+			return nil, fmt.Errorf("%w: %v", errBadCart, err)
+		}
+		quote.GiftCardPurchases = append(quote.GiftCardPurchases, p)
+		quote.Subtotal = pricing.Round(quote.Subtotal + p.Amount)
+		total += p.Amount
+	}
+	quote.Total = pricing.Round(total)
+
+	quote.AmountDue = quote.Total
+	if len(req.GiftCardCodes) > 0 {
+		tenders, problem, err := giftCardTenders(req.GiftCardCodes, quote.Total)
+		if err != nil {
+			return nil, err
+		}
+		quote.GiftCardError = problem
+		quote.Tenders = tenders
+		for _, t := range tenders {
+			quote.AmountDue -= t.Amount
+		}
+		quote.AmountDue = pricing.Round(max(quote.AmountDue, 0))
+	}
+	return quote, nil
+}
+
+// taxQuote works out the tax on the food in a quote. food is what the
+// lines cost after discounts, which are shared across the lines in
+// proportion to their totals. Gift cards are not taxed.
+func taxQuote(quote *models.CartQuote, lines []pricing.Line, food float64) error {
+	if len(lines) == 0 {
+		return nil
+	}
+	rates, err := repository.FetchTaxRates()
+	if err != nil {
+		return err
+	}
+
+	subtotal := pricing.Subtotal(lines)
+	taxLines := make([]tax.Line, len(lines))
+	left := pricing.Round(food)
+	for i, l := range lines {
+		amount := left
+		if i < len(lines)-1 && subtotal > 0 {
+			amount = pricing.Round(food * l.Total() / subtotal)
+		}
+		left = pricing.Round(left - amount)
+		taxLines[i] = tax.Line{Category: l.Category, Amount: amount}
+	}
+
+	taxes := tax.Calculate(taxLines, rates, quote.OrderType, quote.TaxInclusive)
+	for i, t := range taxes {
+		quote.Items[i].TaxRate = t.Rate
+		quote.Items[i].Taxable = t.Taxable
+		quote.Items[i].TaxAmount = t.Tax
+	}
+	quote.Tax = tax.Total(taxes)
+	return nil
+}
+
+// pointsDiscount turns a points redemption into a discount line. Points
+// beyond what is needed to cover due are not used. The returned message
+// describes a problem the customer can fix.
+func pointsDiscount(points int, due float64, userID int) (*models.OrderDiscount, string, error) {
+	if points < 0 {
+		return nil, "Points to redeem cannot be negative", nil
+	}
+	if userID == 0 {
+		return nil, "Sign in to redeem loyalty points", nil
+	}
+
+	balance, err := repository.GetLoyaltyBalance(userID)
+	if err != nil {
+		return nil, "", err
+	}
+	if points > balance {
+		return nil, fmt.Sprintf("You have %d points available", balance), nil
+	}
+
+	points = min(points, loyalty.PointsFor(due))
+	if points == 0 {
+		return nil, "", nil
+	}
+	return &models.OrderDiscount{
+		Description: fmt.Sprintf("%d loyalty points", points),
+		Amount:      min(loyalty.Value(points), pricing.Round(due)),
+		Points:      points,
+	}, "", nil
+}
+
+// QuoteCart handles POST /api/cart/quote. Signed-in customers also get
+// their per-user coupon limits checked and can redeem loyalty points.
+func QuoteCart(w http.ResponseWriter, r *http.Request) {
+	var req models.CartQuoteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	var userID int
+	if claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims); ok {
+		userID = claims.UserID
+	}
+
+	quote, err := quoteCart(req, userID)
+	if errors.Is(err, errBadCart) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to quote cart", "error", err)
+		http.Error(w, "Failed to price cart", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(quote)
+}
@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+// testProduct stores a product with stock, failing the test on error
+func testProduct(t *testing.T, category models.ProductCategory, price float64, stock int) *models.Product {
+	t.Helper()
+	p := &models.Product{Name: t.Name(), Price: price, Category: category,
+		StockQuantity: stock}
+	if err := repository.InsertProduct(p, nil); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// stockOf is a product's stock, failing the test on error
+func stockOf(t *testing.T, productID int) int {
+	t.Helper()
+	p, err := repository.FetchProductByID(productID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return p.StockQuantity
+}
+
+// postOrder places an order as the default user
+func postOrder(t *testing.T, body string) *httptest.ResponseRecorder {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/orders", strings.NewReader(body))
+	req = req.WithContext(context.WithValue(req.Context(), models.UserContextKey,
+		&models.Claims{UserID: 1, Role: "customer"}))
+	w := httptest.NewRecorder()
+	CreateOrder(w, req)
+	return w
+}
+
+func TestPriceItemsCustomizations(t *testing.T) {
+	eastern := testProduct(t, models.CategoryEastern, 10, 5)
+	western := testProduct(t, models.CategoryWestern, 8, 5)
+
+	tests := []struct {
+		name      string
+		product   *models.Product
+		options   []models.CustomizationOption
+		wantPrice float64
+		wantErr   bool
+	}{
+		{"none", eastern, nil, 10, false},
+		{"priced by the server", eastern, []models.CustomizationOption{
+			{ID: "extra-cheese", Price: 0}, {ID: "extra-spicy", Price: 0.01}}, 14, false},
+		{"offered in the category", eastern, []models.CustomizationOption{
+			{ID: "extra-rice", Price: 3}}, 13, false},
+		{"not offered in the category", western, []models.CustomizationOption{
+			{ID: "extra-rice", Price: 3}}, 0, true},
+		{"unknown", western, []models.CustomizationOption{
+			{ID: "gold-leaf", Name: "Gold Leaf", Price: -8}}, 0, true},
+		{"listed twice", western, []models.CustomizationOption{
+			{ID: "extra-spicy", Price: 1}, {ID: "extra-spicy", Price: 1}}, 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			items := []models.OrderItem{{ProductID: tt.product.ID, Quantity: 2,
+				Customizations: tt.options}}
+			lines, err := priceItems(items)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("priced at %v, want an error", lines[0].UnitPrice)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if lines[0].UnitPrice != tt.wantPrice {
+				t.Errorf("unit price = %v, want %v", lines[0].UnitPrice, tt.wantPrice)
+			}
+			for _, c := range items[0].Customizations {
+				if c != customizationOptions[c.ID].CustomizationOption {
+					t.Errorf("customization kept the client's %+v", c)
+				}
+			}
+		})
+	}
+}
+
+func TestCreateOrder(t *testing.T) {
+	withProvider(t)
+	p := testProduct(t, models.CategoryEastern, 10, 5)
+
+	w := postOrder(t, `{"items":[{"productId":`+strconv.Itoa(p.ID)+`,"quantity":2,
+		"customizations":[{"id":"extra-cheese","name":"Cheese","price":0}]}],
+		"totalPrice":1,"orderType":"takeaway","paymentMethod":"pm_card_visa"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("status = %d: %s", w.Code, w.Body)
+	}
+	var order models.Order
+	if err := json.NewDecoder(w.Body).Decode(&order); err != nil {
+		t.Fatal(err)
+	}
+	if order.Subtotal != 26 || order.Items[0].UnitPrice != 13 {
+		t.Errorf("subtotal = %v at %v each, want 26 at 13", order.Subtotal,
+			order.Items[0].UnitPrice)
+	}
+	if order.TotalPrice < order.Subtotal {
+		t.Errorf("total = %v, below the subtotal %v", order.TotalPrice, order.Subtotal)
+	}
+	if got := stockOf(t, p.ID); got != 3 {
+		t.Errorf("stock = %d, want 3", got)
+	}
+
+	stored, err := repository.GetOrderByID(order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c := stored.Items[0].Customizations; len(c) != 1 || c[0].Price != 3 {
+		t.Errorf("stored customizations = %+v, want extra cheese at 3", c)
+	}
+}
+
+func TestCreateOrderRefused(t *testing.T) {
+	withProvider(t)
+	p := testProduct(t, models.CategoryWestern, 10, 2)
+	item := `{"productId":` + strconv.Itoa(p.ID) + `,"quantity":1}`
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"declined card", `{"items":[` + item + `],"paymentMethod":"pm_card_chargeDeclined"}`,
+			http.StatusPaymentRequired},
+		{"no payment method", `{"items":[` + item + `]}`, http.StatusBadRequest},
+		{"unknown customization", `{"items":[{"productId":` + strconv.Itoa(p.ID) +
+			`,"quantity":1,"customizations":[{"id":"free-lunch","price":-10}]}],
+			"paymentMethod":"pm_card_visa"}`, http.StatusBadRequest},
+		{"no quantity", `{"items":[{"productId":` + strconv.Itoa(p.ID) +
+			`,"quantity":0}],"paymentMethod":"pm_card_visa"}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := postOrder(t, tt.body); w.Code != tt.want {
+				t.Errorf("status = %d, want %d: %s", w.Code, tt.want, w.Body)
+			}
+			// Nothing is taken, or it is given back when the card fails
+			if got := stockOf(t, p.ID); got != 2 {
+				t.Errorf("stock = %d, want 2", got)
+			}
+		})
+	}
+}
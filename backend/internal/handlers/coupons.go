@@ -0,0 +1,210 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/pricing"
+	"restaurant-backend/internal/repository"
+)
+
+// couponCodePattern matches codes customers can type, e.g. EAST20
+var couponCodePattern = regexp.MustCompile(`^[A-Z0-9][A-Z0-9_-]{2,31}$`)
+
+// ListCoupons handles GET /api/admin/coupons
+func ListCoupons(w http.ResponseWriter, r *http.Request) {
+	coupons, err := repository.FetchCoupons()
+	if err != nil {
+		http.Error(w, "Failed to fetch coupons", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(coupons)
+}
+
+// GetCoupon handles GET /api/admin/coupons/{id}
+func GetCoupon(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid coupon ID", http.StatusBadRequest)
+		return
+	}
+
+	c, err := repository.GetCoupon(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Coupon not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to fetch coupon", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// CreateCoupon handles POST /api/admin/coupons
+func CreateCoupon(w http.ResponseWriter, r *http.Request) {
+	c, ok := decodeCoupon(w, r)
+	if !ok {
+		return
+	}
+
+	if err := repository.CreateCoupon(c); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			http.Error(w, "A coupon with this code already exists",
+				http.StatusConflict)
+			return
+		}
+		slog.Error("failed to create coupon", "error", err)
+		http.Error(w, "Failed to create coupon", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "coupon.created", nil, fmt.Sprintf("id=%d code=%s", c.ID, c.Code))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(c)
+}
+
+// UpdateCoupon handles PUT /api/admin/coupons/{id}
+func UpdateCoupon(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid coupon ID", http.StatusBadRequest)
+		return
+	}
+
+	c, ok := decodeCoupon(w, r)
+	if !ok {
+		return
+	}
+	c.ID = id
+
+	if err := repository.UpdateCoupon(c); err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			http.Error(w, "Coupon not found", http.StatusNotFound)
+		case strings.Contains(err.Error(), "UNIQUE"):
+			http.Error(w, "A coupon with this code already exists",
+				http.StatusConflict)
+		default:
+			slog.Error("failed to update coupon", "error", err)
+			http.Error(w, "Failed to update coupon", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	recordAudit(r, "coupon.updated", nil, fmt.Sprintf("id=%d code=%s", c.ID, c.Code))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(c)
+}
+
+// DeleteCoupon handles DELETE /api/admin/coupons/{id}
+func DeleteCoupon(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid coupon ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := repository.DeleteCoupon(id); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Coupon not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete coupon", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "coupon.deleted", nil, fmt.Sprintf("id=%d", id))
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodeCoupon reads and validates a coupon from the request body.
+// Omitted fields default to an active coupon without limits.
+func decodeCoupon(w http.ResponseWriter, r *http.Request) (*models.Coupon, bool) {
+	c := &models.Coupon{Active: true}
+	if err := json.NewDecoder(r.Body).Decode(c); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if err := validateCoupon(c); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return c, true
+}
+
+// validateCoupon checks a coupon and normalizes its fields
+func validateCoupon(c *models.Coupon) error {
+	c.Code = strings.ToUpper(strings.TrimSpace(c.Code))
+	if !couponCodePattern.MatchString(c.Code) {
+		return errors.New("code must be 3 to 32 letters, digits, dashes or underscores")
+	}
+	c.Description = strings.TrimSpace(c.Description)
+	c.Category = strings.TrimSpace(c.Category)
+
+	switch c.Type {
+	case pricing.CouponPercentage:
+		if c.Value <= 0 || c.Value > 100 {
+			return errors.New("percentage coupons need a value between 0 and 100")
+		}
+	case pricing.CouponFixed:
+		if c.Value <= 0 {
+			return errors.New("fixed coupons need a positive value")
+		}
+	case pricing.CouponBOGO:
+		c.Value = 0
+	case pricing.CouponFreeItem:
+		if c.FreeProductID == nil {
+			return errors.New("free_item coupons need a freeProductId")
+		}
+		if _, err := repository.FetchProductByID(*c.FreeProductID); err != nil {
+			return fmt.Errorf("product %d does not exist", *c.FreeProductID)
+		}
+		c.Value = 0
+	default:
+		return errors.New("type must be percentage, fixed, bogo or free_item")
+	}
+	if c.Type != pricing.CouponFreeItem {
+		c.FreeProductID = nil
+	}
+
+	if c.MinSpend < 0 || c.MaxUses < 0 || c.MaxUsesPerUser < 0 {
+		return errors.New("minSpend, maxUses and maxUsesPerUser cannot be negative")
+	}
+	if c.ProductIDs == nil {
+		c.ProductIDs = []int{}
+	}
+
+	start, err := parseScheduleTime(c.StartsAt, false)
+	if err != nil {
+		return fmt.Errorf("startsAt: %w", err)
+	}
+	end, err := parseScheduleTime(c.EndsAt, true)
+	if err != nil {
+		return fmt.Errorf("endsAt: %w", err)
+	}
+	if start != nil && end != nil && !end.After(*start) {
+		return errors.New("endsAt must be after startsAt")
+	}
+	c.StartsAt, c.EndsAt = formatScheduleTime(start), formatScheduleTime(end)
+	return nil
+}
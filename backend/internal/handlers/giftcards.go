@@ -0,0 +1,269 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"restaurant-backend/internal/giftcard"
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/pricing"
+	"restaurant-backend/internal/repository"
+)
+
+const (
+	minGiftCardAmount    = 5.0
+	maxGiftCardAmount    = 500.0
+	maxGiftCardsPerOrder = 10
+	maxGiftCardMessage   = 280
+)
+
+// validateGiftCardPurchase checks and normalizes a gift card being bought
+// or issued
+func validateGiftCardPurchase(p *models.GiftCardPurchase) error {
+	p.Amount = pricing.Round(p.Amount)
+	if p.Amount < minGiftCardAmount || p.Amount > maxGiftCardAmount {
+		return fmt.Errorf("gift card amounts must be between %.2f and %.2f",
+			minGiftCardAmount, maxGiftCardAmount)
+	}
+	p.RecipientEmail = strings.TrimSpace(p.RecipientEmail)
+	if p.RecipientEmail != "" {
+		if _, err := mail.ParseAddress(p.RecipientEmail); err != nil {
+			return fmt.Errorf("invalid recipient email %q", p.RecipientEmail)
+		}
+	}
+	p.Message = strings.TrimSpace(p.Message)
+	if len(p.Message) > maxGiftCardMessage {
+		return fmt.Errorf("gift card messages are limited to %d characters",
+			maxGiftCardMessage)
+	}
+	p.GiftCardID, p.Code, p.Last4 = 0, "", ""
+	return nil
+}
+
+// giftCardTenders works out what each gift card pays towards due, in the
+// order given. The returned message describes a problem the customer can
+// fix.
+func giftCardTenders(codes []string, due float64) ([]models.OrderTender, string, error) {
+	var tenders []models.OrderTender
+	seen := map[int]bool{}
+	for _, code := range codes {
+		if strings.TrimSpace(code) == "" {
+			continue
+		}
+		card, err := repository.GetGiftCardByCodeHash(giftcard.Hash(code))
+		if err == sql.ErrNoRows {
+			return nil, "Unknown gift card code", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		if seen[card.ID] {
+			continue
+		}
+		seen[card.ID] = true
+
+		if card.Status != "active" {
+			return nil, fmt.Sprintf("Gift card ending %s is no longer valid",
+				card.Last4), nil
+		}
+		if card.Balance <= 0 {
+			return nil, fmt.Sprintf("Gift card ending %s has no balance left",
+				card.Last4), nil
+		}
+
+		amount := pricing.Round(min(card.Balance, due))
+		if amount <= 0 {
+			continue
+		}
+		tenders = append(tenders, models.OrderTender{
+			Type:       "gift_card",
+			GiftCardID: card.ID,
+			Last4:      card.Last4,
+			Amount:     amount,
+		})
+		due -= amount
+	}
+	return tenders, "", nil
+}
+
+// CheckGiftCardBalance handles POST /api/gift-cards/balance. The code is
+// sent in the body so it does not end up in access logs.
+func CheckGiftCardBalance(w http.ResponseWriter, r *http.Request) {
+	var req models.GiftCardBalanceRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if strings.TrimSpace(req.Code) == "" {
+		http.Error(w, "Code is required", http.StatusBadRequest)
+		return
+	}
+
+	card, err := repository.GetGiftCardByCodeHash(giftcard.Hash(req.Code))
+	if err == sql.ErrNoRows {
+		http.Error(w, "Gift card not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to check gift card", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.GiftCardBalance{
+		Last4:   card.Last4,
+		Balance: card.Balance,
+		Status:  card.Status,
+	})
+}
+
+// ListGiftCards handles GET /api/admin/gift-cards
+func ListGiftCards(w http.ResponseWriter, r *http.Request) {
+	cards, err := repository.FetchGiftCards()
+	if err != nil {
+		http.Error(w, "Failed to fetch gift cards", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(cards)
+}
+
+// GetGiftCard handles GET /api/admin/gift-cards/{id}
+func GetGiftCard(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid gift card ID", http.StatusBadRequest)
+		return
+	}
+
+	card, err := repository.GetGiftCard(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Gift card not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to fetch gift card", http.StatusInternalServerError)
+		return
+	}
+	transactions, err := repository.FetchGiftCardTransactions(id)
+	if err != nil {
+		http.Error(w, "Failed to fetch gift card", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.GiftCardDetail{
+		GiftCard:     *card,
+		Transactions: transactions,
+	})
+}
+
+// IssueGiftCard handles POST /api/admin/gift-cards, e.g. for goodwill or
+// cards sold at the counter. The code is only returned in this response.
+func IssueGiftCard(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.IssueGiftCardRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	p := models.GiftCardPurchase{
+		Amount:         req.Amount,
+		RecipientEmail: req.RecipientEmail,
+		Message:        req.Message,
+	}
+	if err := validateGiftCardPurchase(&p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	code, hash, last4, err := giftcard.Generate()
+	if err != nil {
+		http.Error(w, "Failed to generate gift card", http.StatusInternalServerError)
+		return
+	}
+
+	card := &models.GiftCard{
+		Last4:          last4,
+		InitialValue:   p.Amount,
+		RecipientEmail: p.RecipientEmail,
+		Message:        p.Message,
+	}
+	if err := repository.CreateGiftCard(card, hash, &claims.UserID); err != nil {
+		slog.Error("failed to issue gift card", "error", err)
+		http.Error(w, "Failed to issue gift card", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "gift_card.issued", nil, fmt.Sprintf("id=%d last4=%s amount=%.2f",
+		card.ID, card.Last4, card.InitialValue))
+
+	card.Code = code
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(card)
+}
+
+// VoidGiftCard handles POST /api/admin/gift-cards/{id}/void
+func VoidGiftCard(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid gift card ID", http.StatusBadRequest)
+		return
+	}
+
+	var req struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(r.Body).Decode(&req)
+	req.Reason = strings.TrimSpace(req.Reason)
+
+	claims, _ := r.Context().Value(models.UserContextKey).(*models.Claims)
+	if err := repository.VoidGiftCard(id, claims.UserID, req.Reason); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Gift card not found or already void", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to void gift card", "error", err)
+		http.Error(w, "Failed to void gift card", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "gift_card.voided", nil, fmt.Sprintf("id=%d reason=%s", id,
+		req.Reason))
+
+	card, err := repository.GetGiftCard(id)
+	if err != nil {
+		http.Error(w, "Failed to fetch gift card", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(card)
+}
+
+// GetGiftCardLiability handles GET /api/admin/gift-cards/liability
+func GetGiftCardLiability(w http.ResponseWriter, r *http.Request) {
+	liability, err := repository.GetGiftCardLiability()
+	if err != nil {
+		http.Error(w, "Failed to fetch gift card liability",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(liability)
+}
@@ -3,96 +3,24 @@ package handlers
 import (
 	"database/sql"
 	"encoding/json"
+	"errors"
 	"fmt"
+	"log/slog"
 	"net/http"
 	"strconv"
-	"sync"
+	"strings"
 	"time"
 
 	"github.com/gorilla/mux"
 
+	"restaurant-backend/internal/giftcard"
+	"restaurant-backend/internal/inventory"
+	"restaurant-backend/internal/loyalty"
 	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/payments"
 	"restaurant-backend/internal/repository"
 )
 
-var (
-	promos = []string{
-		"🎉 Weekend Special: 20% off all Eastern Eats! Use code EAST20",
-		"🍔 Burger Tuesday: Buy one get one free on all Western meals!",
-		"🍜 Free Kimchi with any Eastern order over $30",
-		"🍟 Friday Deal: Free large fries with any combo",
-		"🍰 Dessert Sunday: 50% off all sweet treats!",
-	}
-	promosLock sync.RWMutex
-)
-
-// GetPromosSSE handles GET /api/promos for Server-Sent Events
-func GetPromosSSE(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "text/event-stream")
-	w.Header().Set("Cache-Control", "no-cache")
-	w.Header().Set("Connection", "keep-alive")
-	// Make sure we allow CORS for this specific endpoint just in case
-	w.Header().Set("Access-Control-Allow-Origin", "*")
-
-	flusher, ok := w.(http.Flusher)
-	if !ok {
-		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
-		return
-	}
-
-	ticker := time.NewTicker(10 * time.Second)
-	defer ticker.Stop()
-
-	// Send initial promo immediately
-	promosLock.RLock()
-	if len(promos) > 0 {
-		fmt.Fprintf(w, "data: %s\n\n", promos[0])
-	}
-	promosLock.RUnlock()
-	flusher.Flush()
-
-	i := 1
-	for {
-		select {
-		case <-r.Context().Done():
-			return
-		case <-ticker.C:
-			promosLock.RLock()
-			if len(promos) > 0 {
-				fmt.Fprintf(w, "data: %s\n\n", promos[i%len(promos)])
-			}
-			promosLock.RUnlock()
-			flusher.Flush()
-			i++
-		}
-	}
-}
-
-// GetPromos handles GET /api/promos/list (for admin)
-func GetPromos(w http.ResponseWriter, r *http.Request) {
-	promosLock.RLock()
-	defer promosLock.RUnlock()
-
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(promos)
-}
-
-// UpdatePromos handles PUT /api/promos/list (for admin)
-func UpdatePromos(w http.ResponseWriter, r *http.Request) {
-	var newPromos []string
-	if err := json.NewDecoder(r.Body).Decode(&newPromos); err != nil {
-		http.Error(w, "Invalid request body", http.StatusBadRequest)
-		return
-	}
-
-	promosLock.Lock()
-	promos = newPromos
-	promosLock.Unlock()
-
-	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": "Promos updated successfully"})
-}
-
 // GetProducts handles GET /api/products
 func GetProducts(w http.ResponseWriter, r *http.Request) {
 	products, err := repository.FetchProducts()
@@ -199,8 +127,16 @@ func CreateProduct(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Name and category are required", http.StatusBadRequest)
 		return
 	}
+	if product.StockQuantity < 0 {
+		http.Error(w, "Stock quantity cannot be negative", http.StatusBadRequest)
+		return
+	}
 
-	if err := repository.InsertProduct(&product); err != nil {
+	var actorID *int
+	if claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims); ok {
+		actorID = &claims.UserID
+	}
+	if err := repository.InsertProduct(&product, actorID); err != nil {
 		http.Error(w, "Failed to create product", http.StatusInternalServerError)
 		return
 	}
@@ -226,7 +162,12 @@ func UpdateProduct(w http.ResponseWriter, r *http.Request) {
 	}
 
 	product.ID = id
-	if err := repository.UpdateProduct(&product); err != nil {
+	err = repository.UpdateProduct(&product)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
 		http.Error(w, "Failed to update product", http.StatusInternalServerError)
 		return
 	}
@@ -267,12 +208,139 @@ func CreateOrder(w http.ResponseWriter, r *http.Request) {
 	}
 	order.UserID = claims.UserID
 
+	order.Note = strings.TrimSpace(order.Note)
+	tooLong := len(order.Note) > maxOrderNoteLength
+	for i := range order.Items {
+		order.Items[i].Note = strings.TrimSpace(order.Items[i].Note)
+		tooLong = tooLong || len(order.Items[i].Note) > maxOrderNoteLength
+	}
+	if tooLong {
+		http.Error(w, fmt.Sprintf("notes must be at most %d characters",
+			maxOrderNoteLength), http.StatusBadRequest)
+		return
+	}
+
+	// Totals are worked out here; the client's totalPrice is only a hint
+	quote, err := quoteCart(models.CartQuoteRequest{
+		Items:             order.Items,
+		CouponCode:        order.CouponCode,
+		RedeemPoints:      order.RedeemPoints,
+		GiftCardPurchases: order.GiftCardPurchases,
+		GiftCardCodes:     order.GiftCardCodes,
+		OrderType:         order.OrderType,
+		PartySize:         order.PartySize,
+		Tip:               order.Tip,
+	}, order.UserID)
+	if errors.Is(err, errBadCart) {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to price order", "error", err)
+		http.Error(w, "Failed to create order", http.StatusInternalServerError)
+		return
+	}
+	if quote.CouponError != "" {
+		http.Error(w, quote.CouponError, http.StatusBadRequest)
+		return
+	}
+	if quote.PointsError != "" {
+		http.Error(w, quote.PointsError, http.StatusBadRequest)
+		return
+	}
+	if quote.GiftCardError != "" {
+		http.Error(w, quote.GiftCardError, http.StatusBadRequest)
+		return
+	}
+	paymentMethod := order.PaymentMethod
+	order.PaymentMethod = ""
+	if quote.AmountDue > 0 && paymentMethod == "" {
+		http.Error(w, "paymentMethod is required", http.StatusBadRequest)
+		return
+	}
+
+	// Items keep the price they were sold at for refunds and reports
+	for i := range order.Items {
+		line := quote.Items[i]
+		order.Items[i].UnitPrice = line.UnitPrice
+		order.Items[i].RefundedQuantity = 0
+		order.Items[i].TaxRate = line.TaxRate
+		order.Items[i].Taxable = line.Taxable
+		order.Items[i].TaxAmount = line.TaxAmount
+	}
+	order.OrderType = quote.OrderType
+	order.Tax = quote.Tax
+	order.TaxInclusive = quote.TaxInclusive
+	order.TipAmount = quote.TipAmount
+	order.ServiceCharge = quote.ServiceCharge
+	order.ServiceChargeName = quote.ServiceChargeName
+	order.Subtotal = quote.Subtotal
+	order.Discounts = quote.Discounts
+	order.TotalPrice = quote.Total
+	order.Tenders = quote.Tenders
+	order.AmountDue = quote.AmountDue
+	order.GiftCardCodes = nil
+	order.CouponCode, order.RedeemPoints = "", 0
+	for _, d := range order.Discounts {
+		if d.Code != "" {
+			order.CouponCode = d.Code
+		}
+		order.RedeemPoints += d.Points
+	}
+
+	// Codes for gift cards bought with the order are only shown in this
+	// response
+	order.GiftCardPurchases = quote.GiftCardPurchases
+	for i := range order.GiftCardPurchases {
+		p := &order.GiftCardPurchases[i]
+		if p.Code, _, p.Last4, err = giftcard.Generate(); err != nil {
+			http.Error(w, "Failed to create order", http.StatusInternalServerError)
+			return
+		}
+	}
+
 	order.Status = "pending"
+	order.PaymentStatus = "not_required"
+	if order.AmountDue > 0 {
+		order.PaymentStatus = string(payments.StatusPending)
+	}
 	if err := repository.CreateOrder(&order); err != nil {
+		if err == repository.ErrCouponUsedUp {
+			http.Error(w, "Coupon "+order.CouponCode+" is no longer available",
+				http.StatusConflict)
+			return
+		}
+		if err == repository.ErrInsufficientPoints {
+			http.Error(w, "Not enough loyalty points", http.StatusConflict)
+			return
+		}
+		if err == repository.ErrGiftCardBalance {
+			http.Error(w, "A gift card no longer covers its payment",
+				http.StatusConflict)
+			return
+		}
+		if err == repository.ErrStockLocked {
+			http.Error(w, "An item is being stock counted, please try again later",
+				http.StatusConflict)
+			return
+		}
 		http.Error(w, "Failed to create order", http.StatusInternalServerError)
 		return
 	}
 
+	// The order is only accepted once the card payment is authorized
+	if order.AmountDue > 0 {
+		if err := authorizeOrderPayment(r.Context(), &order, paymentMethod); err != nil {
+			if !writePaymentError(w, err) {
+				slog.Error("failed to authorize payment", "error", err,
+					"order", order.ID)
+				http.Error(w, "Failed to create order", http.StatusInternalServerError)
+			}
+			return
+		}
+	}
+	queueKitchenTickets(order.ID)
+
 	w.Header().Set("Content-Type", "application/json")
 	w.WriteHeader(http.StatusCreated)
 	json.NewEncoder(w).Encode(order)
@@ -309,6 +377,110 @@ func GetUserOrders(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(orders)
 }
 
+// UpdateOrderStatus handles PUT /api/admin/orders/{id}/status. Completing
+// an order captures its card payment and credits the customer's loyalty
+// points; cancelling it voids or refunds the payment and gives back
+// redeemed points and stock.
+func UpdateOrderStatus(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.UpdateOrderStatusRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	order, err := repository.GetOrderByID(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch order", http.StatusInternalServerError)
+		return
+	}
+
+	if req.Status != "completed" && req.Status != "cancelled" {
+		http.Error(w, "Status must be completed or cancelled", http.StatusBadRequest)
+		return
+	}
+	if order.Status != "pending" {
+		http.Error(w, "Order is already "+order.Status, http.StatusConflict)
+		return
+	}
+
+	// Money moves before the order does, so a failed capture leaves the
+	// order pending
+	switch req.Status {
+	case "completed":
+		err = captureOrderPayment(r.Context(), id)
+	case "cancelled":
+		err = releaseOrderPayment(r.Context(), id)
+	}
+	if err != nil {
+		if !writePaymentError(w, err) {
+			slog.Error("failed to update order payment", "error", err, "order", id)
+			http.Error(w, "Failed to update order", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	switch req.Status {
+	case "completed":
+		var points int
+		if order.UserID > 0 {
+			qualifying, qerr := repository.GetQualifyingPoints(order.UserID,
+				loyalty.TierWindowDays)
+			if qerr != nil {
+				http.Error(w, "Failed to update order", http.StatusInternalServerError)
+				return
+			}
+			// Buying a gift card earns nothing; spending it does. Tax added
+			// at checkout and tips earn nothing either.
+			earning := order.TotalPrice - order.TipAmount
+			for _, p := range order.GiftCardPurchases {
+				earning -= p.Amount
+			}
+			if !order.TaxInclusive {
+				earning -= order.Tax
+			}
+			tier, _ := loyalty.TierFor(qualifying)
+			points = loyalty.PointsEarned(max(earning, 0), tier)
+		}
+		err = repository.CompleteOrder(id, order.UserID, points,
+			loyalty.Settings.ExpiryDays)
+	case "cancelled":
+		var actorID *int
+		if claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims); ok {
+			actorID = &claims.UserID
+		}
+		err = repository.CancelOrder(id, loyalty.Settings.ExpiryDays, actorID)
+	}
+	if err == repository.ErrOrderNotPending {
+		http.Error(w, "Order is already "+order.Status, http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to update order status", "error", err, "order", id)
+		http.Error(w, "Failed to update order", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "order."+req.Status, nil, fmt.Sprintf("id=%d", id))
+
+	order, err = repository.GetOrderByID(id)
+	if err != nil {
+		http.Error(w, "Failed to fetch order", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(order)
+}
+
 // GetDashboardStats handles GET /api/dashboard
 func GetDashboardStats(w http.ResponseWriter, r *http.Request) {
 	stats, err := repository.GetDashboardStats()
@@ -316,6 +488,12 @@ func GetDashboardStats(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Failed to fetch dashboard stats", http.StatusInternalServerError)
 		return
 	}
+	stats.ExpiringLots, err = repository.FetchExpiringLots(
+		inventory.Settings.ExpiryWarningDays)
+	if err != nil {
+		http.Error(w, "Failed to fetch dashboard stats", http.StatusInternalServerError)
+		return
+	}
 
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(stats)
@@ -333,7 +511,10 @@ func GetSalesReport(w http.ResponseWriter, r *http.Request) {
 	json.NewEncoder(w).Encode(report)
 }
 
-// OrderSupplies handles POST /api/products/{id}/supply
+// OrderSupplies handles POST /api/products/{id}/supply, a shortcut for
+// purchase orders of a single product. Ordering places a one-line purchase
+// order; receiving books the quantity against the product's open purchase
+// orders, oldest first.
 func OrderSupplies(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
 	id, err := strconv.Atoi(vars["id"])
@@ -352,17 +533,89 @@ func OrderSupplies(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Quantity must be positive", http.StatusBadRequest)
 		return
 	}
+	if _, err := repository.FetchProductByID(id); err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	var actorID *int
+	if claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims); ok {
+		actorID = &claims.UserID
+	}
+
+	if req.Received {
+		if req.ExpiresAt != "" {
+			if _, err := time.Parse(time.DateOnly, req.ExpiresAt); err != nil {
+				http.Error(w, "expiresAt must be YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+		}
+		if err := repository.ReceiveProductSupplies(id, req.Quantity, req.ExpiresAt,
+			actorID); err != nil {
+			if err == repository.ErrStockLocked {
+				http.Error(w, "The product is in an open stock count",
+					http.StatusConflict)
+				return
+			}
+			slog.Error("failed to receive supplies", "error", err)
+			http.Error(w, "Failed to update supplies", http.StatusInternalServerError)
+			return
+		}
+		recordAudit(r, "supplies.received", nil,
+			fmt.Sprintf("product=%d quantity=%d", id, req.Quantity))
+
+		w.WriteHeader(http.StatusOK)
+		json.NewEncoder(w).Encode(map[string]string{
+			"message": "Supplies received successfully",
+		})
+		return
+	}
 
-	if err := repository.OrderSupplies(id, req.Quantity, req.Received); err != nil {
+	supplierID, unitCost, err := repository.LastPurchase(id)
+	if err != nil {
 		http.Error(w, "Failed to update supplies", http.StatusInternalServerError)
 		return
 	}
+	if req.SupplierID != nil {
+		if problem := checkSupplier(*req.SupplierID); problem != "" {
+			http.Error(w, problem, http.StatusBadRequest)
+			return
+		}
+		supplierID = req.SupplierID
+	}
+	if req.UnitCost != nil {
+		if *req.UnitCost < 0 {
+			http.Error(w, "Unit costs cannot be negative", http.StatusBadRequest)
+			return
+		}
+		unitCost = *req.UnitCost
+	}
+	if req.ExpectedDate != "" {
+		if _, err := time.Parse(time.DateOnly, req.ExpectedDate); err != nil {
+			http.Error(w, "expectedDate must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
 
-	message := "Supply order placed successfully"
-	if req.Received {
-		message = "Supplies received successfully"
+	po := &models.PurchaseOrder{
+		SupplierID:   supplierID,
+		Status:       "ordered",
+		ExpectedDate: req.ExpectedDate,
+		CreatedBy:    actorID,
+		Lines: []models.PurchaseOrderLine{{ProductID: id, Quantity: req.Quantity,
+			UnitCost: unitCost}},
+	}
+	if err := repository.CreatePurchaseOrder(po); err != nil {
+		slog.Error("failed to order supplies", "error", err)
+		http.Error(w, "Failed to update supplies", http.StatusInternalServerError)
+		return
 	}
+	recordAudit(r, "purchase_order.created", nil,
+		fmt.Sprintf("id=%d status=%s lines=1", po.ID, po.Status))
 
 	w.WriteHeader(http.StatusOK)
-	json.NewEncoder(w).Encode(map[string]string{"message": message})
+	json.NewEncoder(w).Encode(map[string]any{
+		"message":         "Supply order placed successfully",
+		"purchaseOrderId": po.ID,
+	})
 }
@@ -0,0 +1,357 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+// maxRecipeLines limits the lines in one product's recipe
+const maxRecipeLines = 100
+
+// ingredientUnits are the units ingredients are kept in
+var ingredientUnits = map[string]bool{
+	"g": true, "kg": true, "ml": true, "l": true, "each": true,
+}
+
+// ListIngredients handles GET /api/admin/ingredients
+func ListIngredients(w http.ResponseWriter, r *http.Request) {
+	ingredients, err := repository.FetchIngredients()
+	if err != nil {
+		http.Error(w, "Failed to fetch ingredients", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ingredients)
+}
+
+// CreateIngredient handles POST /api/admin/ingredients. A starting
+// stockQuantity is recorded as an adjustment.
+func CreateIngredient(w http.ResponseWriter, r *http.Request) {
+	ing, ok := decodeIngredient(w, r)
+	if !ok {
+		return
+	}
+	if ing.StockQuantity < 0 {
+		http.Error(w, "stockQuantity cannot be negative", http.StatusBadRequest)
+		return
+	}
+
+	var actorID *int
+	if claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims); ok {
+		actorID = &claims.UserID
+	}
+	if err := repository.CreateIngredient(ing, actorID); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			http.Error(w, "An ingredient with this name already exists",
+				http.StatusConflict)
+			return
+		}
+		slog.Error("failed to create ingredient", "error", err)
+		http.Error(w, "Failed to create ingredient", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "ingredient.created", nil, fmt.Sprintf("id=%d name=%q unit=%s",
+		ing.ID, ing.Name, ing.Unit))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(ing)
+}
+
+// UpdateIngredient handles PUT /api/admin/ingredients/{id}. Stock is only
+// changed with adjustments, and the unit can't change while recipes use
+// the ingredient.
+func UpdateIngredient(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ingredient ID", http.StatusBadRequest)
+		return
+	}
+
+	ing, ok := decodeIngredient(w, r)
+	if !ok {
+		return
+	}
+	ing.ID = id
+
+	current, err := repository.GetIngredient(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Ingredient not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to update ingredient", http.StatusInternalServerError)
+		return
+	}
+	if ing.Unit != current.Unit {
+		used, err := repository.IngredientInRecipes(id)
+		if err != nil {
+			http.Error(w, "Failed to update ingredient", http.StatusInternalServerError)
+			return
+		}
+		if used {
+			http.Error(w, "The unit can't change while recipes use the ingredient",
+				http.StatusConflict)
+			return
+		}
+	}
+
+	if err := repository.UpdateIngredient(ing); err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			http.Error(w, "Ingredient not found", http.StatusNotFound)
+		case strings.Contains(err.Error(), "UNIQUE"):
+			http.Error(w, "An ingredient with this name already exists",
+				http.StatusConflict)
+		default:
+			slog.Error("failed to update ingredient", "error", err)
+			http.Error(w, "Failed to update ingredient", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	recordAudit(r, "ingredient.updated", nil, fmt.Sprintf("id=%d name=%q unit=%s",
+		ing.ID, ing.Name, ing.Unit))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ing)
+}
+
+// decodeIngredient reads and validates an ingredient from the request body
+func decodeIngredient(w http.ResponseWriter, r *http.Request) (*models.Ingredient, bool) {
+	var ing models.Ingredient
+	if err := json.NewDecoder(r.Body).Decode(&ing); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	ing.Name = strings.TrimSpace(ing.Name)
+	ing.Unit = strings.ToLower(strings.TrimSpace(ing.Unit))
+	if ing.Name == "" || len(ing.Name) > 100 {
+		http.Error(w, "name is required and at most 100 characters",
+			http.StatusBadRequest)
+		return nil, false
+	}
+	if !ingredientUnits[ing.Unit] {
+		http.Error(w, "unit must be g, kg, ml, l or each", http.StatusBadRequest)
+		return nil, false
+	}
+	if ing.LowStockThreshold < 0 || ing.UnitCost < 0 {
+		http.Error(w, "lowStockThreshold and unitCost cannot be negative",
+			http.StatusBadRequest)
+		return nil, false
+	}
+	return &ing, true
+}
+
+// GetIngredientMovements handles
+// GET /api/admin/ingredients/{id}/movements?reason=&limit=, an ingredient's
+// stock history, newest first
+func GetIngredientMovements(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ingredient ID", http.StatusBadRequest)
+		return
+	}
+	reason := r.URL.Query().Get("reason")
+	if reason != "" && !stockMovementReasons[reason] {
+		http.Error(w, "reason must be sale, receipt, adjustment, waste or return",
+			http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = min(l, 1000)
+	}
+
+	if _, err := repository.GetIngredient(id); err != nil {
+		http.Error(w, "Ingredient not found", http.StatusNotFound)
+		return
+	}
+
+	movements, err := repository.FetchIngredientMovements(id, reason, limit)
+	if err != nil {
+		http.Error(w, "Failed to fetch stock movements", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(movements)
+}
+
+// AdjustIngredientStock handles POST /api/admin/ingredients/{id}/adjustments.
+// Ingredients have no purchase orders, so deliveries are recorded here
+// with the receipt reason, as well as adjustment, waste and return.
+func AdjustIngredientStock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ingredient ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.IngredientAdjustmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if req.Reason == "" {
+		req.Reason = "adjustment"
+	}
+	switch {
+	case req.Reason == "sale" || !stockMovementReasons[req.Reason]:
+		http.Error(w, "reason must be receipt, adjustment, waste or return",
+			http.StatusBadRequest)
+		return
+	case req.Quantity == 0 || math.IsNaN(req.Quantity) || math.IsInf(req.Quantity, 0):
+		http.Error(w, "A quantity is required", http.StatusBadRequest)
+		return
+	case req.Note == "" && req.Reason != "receipt":
+		http.Error(w, "A note is required", http.StatusBadRequest)
+		return
+	case len(req.Note) > maxStockNoteLength:
+		http.Error(w, fmt.Sprintf("Note must be at most %d characters",
+			maxStockNoteLength), http.StatusBadRequest)
+		return
+	}
+
+	movement := models.IngredientMovement{
+		IngredientID: id,
+		Quantity:     req.Quantity,
+		Reason:       req.Reason,
+		Note:         req.Note,
+	}
+	if claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims); ok {
+		movement.ActorID = &claims.UserID
+	}
+	err = repository.AdjustIngredientStock(&movement)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Ingredient not found", http.StatusNotFound)
+		return
+	}
+	if err == repository.ErrStockBelowZero {
+		http.Error(w, "Stock cannot go below zero", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to adjust ingredient stock", "error", err, "ingredient", id)
+		http.Error(w, "Failed to adjust stock", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "ingredient.adjusted", nil, fmt.Sprintf(
+		"ingredient=%d quantity=%g balance=%g reason=%s note=%s", id,
+		movement.Quantity, movement.Balance, movement.Reason, movement.Note))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(movement)
+}
+
+// GetRecipe handles GET /api/products/{id}/recipe
+func GetRecipe(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	recipe, err := repository.GetRecipe(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch recipe", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recipe)
+}
+
+// SetRecipe handles PUT /api/products/{id}/recipe, replacing the product's
+// recipe. Lines without a portionSize are used for portion sizes without
+// lines of their own; an empty recipe takes the product back to its own
+// stock.
+func SetRecipe(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.Recipe
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Lines) > maxRecipeLines {
+		http.Error(w, fmt.Sprintf("A recipe can have at most %d lines",
+			maxRecipeLines), http.StatusBadRequest)
+		return
+	}
+
+	seen := map[string]bool{}
+	for i := range req.Lines {
+		l := &req.Lines[i]
+		l.PortionSize = strings.TrimSpace(l.PortionSize)
+		if len(l.PortionSize) > 50 {
+			http.Error(w, "portionSize must be at most 50 characters",
+				http.StatusBadRequest)
+			return
+		}
+		if l.Quantity <= 0 || math.IsInf(l.Quantity, 0) {
+			http.Error(w, "Each line needs a quantity above zero",
+				http.StatusBadRequest)
+			return
+		}
+		key := fmt.Sprintf("%s/%d", strings.ToLower(l.PortionSize), l.IngredientID)
+		if seen[key] {
+			http.Error(w, "An ingredient is listed twice for the same portion size",
+				http.StatusBadRequest)
+			return
+		}
+		seen[key] = true
+		if _, err := repository.GetIngredient(l.IngredientID); err != nil {
+			http.Error(w, fmt.Sprintf("Ingredient %d not found", l.IngredientID),
+				http.StatusBadRequest)
+			return
+		}
+	}
+
+	err = repository.SetRecipe(id, req.Lines)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to set recipe", "error", err, "product", id)
+		http.Error(w, "Failed to save recipe", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "recipe.updated", nil, fmt.Sprintf("product=%d lines=%d", id,
+		len(req.Lines)))
+
+	recipe, err := repository.GetRecipe(id)
+	if err != nil {
+		http.Error(w, "Failed to fetch recipe", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(recipe)
+}
@@ -0,0 +1,212 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+
+	"restaurant-backend/internal/inventory"
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+const (
+	// defaultReorderDays is how far ahead reorder suggestions look
+	defaultReorderDays = 7
+	// maxReorderDays limits how far ahead they can look
+	maxReorderDays = 90
+)
+
+// GetReorderSuggestions handles GET /api/inventory/reorder-suggestions?days=,
+// the products that should be reordered within days (7 by default, 0 for
+// only those due today), soonest first
+func GetReorderSuggestions(w http.ResponseWriter, r *http.Request) {
+	days := defaultReorderDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 || n > maxReorderDays {
+			http.Error(w, fmt.Sprintf("days must be between 0 and %d", maxReorderDays),
+				http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	suggestions, err := reorderSuggestions(days, time.Now())
+	if err != nil {
+		slog.Error("failed to work out reorder suggestions", "error", err)
+		http.Error(w, "Failed to fetch reorder suggestions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suggestions)
+}
+
+// ConvertReorderSuggestions handles
+// POST /api/inventory/reorder-suggestions/convert, placing a purchase order
+// with each supplier for the suggested quantities. Without productIds it
+// orders everything due within days, by default only what is due today.
+// Products without a supplier go on one order with none.
+func ConvertReorderSuggestions(w http.ResponseWriter, r *http.Request) {
+	var req models.ReorderRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Status == "" {
+		req.Status = "ordered"
+	}
+	if req.Status != "ordered" && req.Status != "draft" {
+		http.Error(w, "status must be ordered or draft", http.StatusBadRequest)
+		return
+	}
+	if req.Days < 0 || req.Days > maxReorderDays {
+		http.Error(w, fmt.Sprintf("days must be between 0 and %d", maxReorderDays),
+			http.StatusBadRequest)
+		return
+	}
+	if len(req.ProductIDs) > 0 {
+		// Products picked from the list are ordered even if not due yet
+		req.Days = maxReorderDays
+	}
+
+	now := time.Now()
+	suggestions, err := reorderSuggestions(req.Days, now)
+	if err != nil {
+		slog.Error("failed to work out reorder suggestions", "error", err)
+		http.Error(w, "Failed to reorder", http.StatusInternalServerError)
+		return
+	}
+	if len(req.ProductIDs) > 0 {
+		byProduct := map[int]models.ReorderSuggestion{}
+		for _, s := range suggestions {
+			byProduct[s.ProductID] = s
+		}
+		picked := make([]models.ReorderSuggestion, 0, len(req.ProductIDs))
+		for _, id := range req.ProductIDs {
+			s, ok := byProduct[id]
+			if !ok {
+				http.Error(w, fmt.Sprintf("Product %d has no reorder suggestion", id),
+					http.StatusBadRequest)
+				return
+			}
+			picked = append(picked, s)
+			delete(byProduct, id)
+		}
+		suggestions = picked
+	}
+	if len(suggestions) == 0 {
+		http.Error(w, "Nothing needs reordering", http.StatusBadRequest)
+		return
+	}
+
+	var createdBy *int
+	if claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims); ok {
+		createdBy = &claims.UserID
+	}
+	bySupplier := map[int]*models.PurchaseOrder{}
+	var pos []*models.PurchaseOrder
+	for _, s := range suggestions {
+		key := 0
+		if s.SupplierID != nil {
+			key = *s.SupplierID
+		}
+		po, ok := bySupplier[key]
+		if !ok {
+			po = &models.PurchaseOrder{
+				SupplierID:   s.SupplierID,
+				Status:       req.Status,
+				ExpectedDate: now.AddDate(0, 0, s.LeadTimeDays).Format("2006-01-02"),
+				Notes:        "From reorder suggestions",
+				CreatedBy:    createdBy,
+			}
+			bySupplier[key] = po
+			pos = append(pos, po)
+		}
+		po.Lines = append(po.Lines, models.PurchaseOrderLine{
+			ProductID: s.ProductID,
+			Quantity:  s.SuggestedQuantity,
+			UnitCost:  s.UnitCost,
+		})
+	}
+
+	if err := repository.CreatePurchaseOrders(pos); err != nil {
+		slog.Error("failed to create purchase orders from reorder suggestions",
+			"error", err)
+		http.Error(w, "Failed to reorder", http.StatusInternalServerError)
+		return
+	}
+
+	created := make([]*models.PurchaseOrder, 0, len(pos))
+	for _, po := range pos {
+		recordAudit(r, "purchase_order.created", nil,
+			fmt.Sprintf("id=%d status=%s lines=%d source=reorder_suggestions", po.ID,
+				po.Status, len(po.Lines)))
+		full, err := repository.GetPurchaseOrder(po.ID)
+		if err != nil {
+			http.Error(w, "Failed to fetch purchase order", http.StatusInternalServerError)
+			return
+		}
+		created = append(created, full)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(created)
+}
+
+// reorderSuggestions works out the products to reorder within days of now,
+// soonest first
+func reorderSuggestions(days int, now time.Time) ([]models.ReorderSuggestion, error) {
+	window := inventory.Settings.WindowDays
+	data, err := repository.FetchReorderData(window)
+	if err != nil {
+		return nil, err
+	}
+
+	horizon := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0,
+		now.Location()).AddDate(0, 0, days)
+	suggestions := []models.ReorderSuggestion{}
+	for _, s := range data {
+		if s.LeadTimeDays < 0 {
+			s.LeadTimeDays = inventory.Settings.LeadTimeDays
+		}
+		// Drafts count as on order, so converting the suggestions twice
+		// does not order the same stock twice
+		plan := inventory.Reorder(inventory.Stock{
+			OnHand:       s.StockQuantity,
+			OnOrder:      s.OrderedQuantity + s.DraftQuantity,
+			Threshold:    s.LowStockThreshold,
+			Sold:         s.UnitsSold,
+			WindowDays:   window,
+			LeadTimeDays: s.LeadTimeDays,
+		}, now)
+		if plan.ReorderDate.IsZero() || plan.ReorderDate.After(horizon) {
+			continue
+		}
+
+		s.DailySales = math.Round(plan.DailySales*100) / 100
+		s.ReorderPoint = plan.ReorderPoint
+		s.SuggestedQuantity = plan.Quantity
+		s.EstimatedCost = math.Round(float64(plan.Quantity)*s.UnitCost*100) / 100
+		s.ReorderDate = plan.ReorderDate.Format("2006-01-02")
+		s.ExpectedDate = plan.ReorderDate.AddDate(0, 0, s.LeadTimeDays).
+			Format("2006-01-02")
+		if plan.StockoutDate != nil {
+			out := plan.StockoutDate.Format("2006-01-02")
+			s.StockoutDate = &out
+		}
+		suggestions = append(suggestions, s)
+	}
+
+	sort.SliceStable(suggestions, func(i, j int) bool {
+		return suggestions[i].ReorderDate < suggestions[j].ReorderDate
+	})
+	return suggestions, nil
+}
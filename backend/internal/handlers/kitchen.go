@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"restaurant-backend/internal/kitchen"
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+const (
+	// maxOrderNoteLength limits the kitchen notes on orders and items
+	maxOrderNoteLength = 200
+	// kitchenPollInterval is how often the print queue checks for retries
+	kitchenPollInterval = 5 * time.Second
+	// kitchenBatchSize is how many tickets are printed per check
+	kitchenBatchSize = 20
+	// maxKitchenTickets limits the ticket list
+	maxKitchenTickets = 200
+)
+
+// kitchenWake starts the print queue straight away when tickets are added
+var kitchenWake = make(chan struct{}, 1)
+
+// StartKitchenPrinting starts the print queue when kitchen printers are
+// configured. Tickets that fail to print are retried with backoff until
+// kitchen.MaxAttempts is reached.
+func StartKitchenPrinting() {
+	if !kitchen.Enabled() {
+		return
+	}
+	go func() {
+		ticker := time.NewTicker(kitchenPollInterval)
+		defer ticker.Stop()
+		for {
+			printKitchenTickets()
+			select {
+			case <-ticker.C:
+			case <-kitchenWake:
+			}
+		}
+	}()
+}
+
+// printKitchenTickets prints the tickets that are due
+func printKitchenTickets() {
+	tickets, err := repository.FetchDueKitchenTickets(kitchenBatchSize)
+	if err != nil {
+		slog.Error("failed to fetch kitchen tickets", "error", err)
+		return
+	}
+	for _, t := range tickets {
+		err := fmt.Errorf("no printer for station %q", t.Station)
+		if p, ok := kitchen.Settings.Printers[t.Station]; ok {
+			err = p.Print(context.Background(),
+				fmt.Sprintf("order-%d-%s", t.OrderID, t.Station), t.Data)
+		}
+		if err == nil {
+			if err := repository.MarkKitchenTicketPrinted(t.ID); err != nil {
+				slog.Error("failed to mark kitchen ticket printed", "ticket", t.ID,
+					"error", err)
+			}
+			continue
+		}
+
+		delay, retry := kitchen.RetryDelay(t.Attempts + 1)
+		if retry {
+			slog.Warn("kitchen ticket failed to print, will retry", "ticket", t.ID,
+				"station", t.Station, "error", err, "retry_in", delay.String())
+		} else {
+			slog.Error("kitchen ticket failed to print, giving up", "ticket", t.ID,
+				"station", t.Station, "error", err)
+		}
+		if err := repository.MarkKitchenTicketFailed(t.ID, err.Error(), retry,
+			delay); err != nil {
+			slog.Error("failed to record kitchen ticket failure", "ticket", t.ID,
+				"error", err)
+		}
+	}
+}
+
+// wakeKitchenPrinting has the print queue check for tickets now
+func wakeKitchenPrinting() {
+	select {
+	case kitchenWake <- struct{}{}:
+	default:
+	}
+}
+
+// queueKitchenTickets queues a ticket for each station that prepares part
+// of an accepted order. Problems are logged rather than failing the order.
+func queueKitchenTickets(orderID int) {
+	if !kitchen.Enabled() {
+		return
+	}
+	order, err := repository.GetOrderByID(orderID)
+	if err != nil {
+		slog.Error("failed to load order for kitchen tickets", "order", orderID,
+			"error", err)
+		return
+	}
+
+	byStation := map[string][]models.OrderItem{}
+	var stations []string
+	for _, item := range order.Items {
+		station := kitchen.Station(item.Category)
+		if _, ok := byStation[station]; !ok {
+			stations = append(stations, station)
+		}
+		byStation[station] = append(byStation[station], item)
+	}
+
+	now := time.Now()
+	tickets := make([]models.KitchenTicket, len(stations))
+	for i, station := range stations {
+		tickets[i] = models.KitchenTicket{
+			OrderID: order.ID,
+			Station: station,
+			Data:    kitchen.Ticket(order, station, byStation[station], now),
+		}
+	}
+	if len(tickets) == 0 {
+		return
+	}
+	if err := repository.CreateKitchenTickets(tickets); err != nil {
+		slog.Error("failed to queue kitchen tickets", "order", orderID, "error", err)
+		return
+	}
+
+	wakeKitchenPrinting()
+}
+
+// ListKitchenTickets handles GET /api/admin/kitchen/tickets?status=, the
+// newest tickets first
+func ListKitchenTickets(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && status != "pending" && status != "printed" &&
+		status != "failed" {
+		http.Error(w, "status must be pending, printed or failed",
+			http.StatusBadRequest)
+		return
+	}
+
+	tickets, err := repository.FetchKitchenTickets(status, maxKitchenTickets)
+	if err != nil {
+		http.Error(w, "Failed to fetch kitchen tickets", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(tickets)
+}
+
+// ReprintKitchenTicket handles POST /api/admin/kitchen/tickets/{id}/reprint,
+// queueing a ticket to print again
+func ReprintKitchenTicket(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid ticket ID", http.StatusBadRequest)
+		return
+	}
+	if !kitchen.Enabled() {
+		http.Error(w, "Kitchen printing is not configured",
+			http.StatusServiceUnavailable)
+		return
+	}
+
+	ticket, err := repository.RequeueKitchenTicket(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Ticket not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to reprint ticket", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "kitchen_ticket.reprinted", nil,
+		fmt.Sprintf("ticket=%d order=%d station=%s", ticket.ID, ticket.OrderID,
+			ticket.Station))
+	wakeKitchenPrinting()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(ticket)
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"restaurant-backend/internal/repository"
+)
+
+// lotExpiryInterval is how often lots past their expiry are written off
+const lotExpiryInterval = time.Hour
+
+// StartLotExpiry writes off the stock left in expired lots as waste, now
+// and then every lotExpiryInterval
+func StartLotExpiry() {
+	go func() {
+		ticker := time.NewTicker(lotExpiryInterval)
+		defer ticker.Stop()
+		for {
+			expireLots()
+			<-ticker.C
+		}
+	}()
+}
+
+// expireLots writes off the lots that have expired
+func expireLots() {
+	n, err := repository.ExpireLots()
+	if err != nil {
+		slog.Error("failed to write off expired lots", "error", err)
+	}
+	if n > 0 {
+		slog.Info("wrote off expired lots", "lots", n)
+	}
+}
+
+// ListStockLots handles GET /api/products/{id}/lots?all=, a product's lots
+// in the order they are sold from. Only lots with stock left are listed
+// unless all is true.
+func ListStockLots(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	all := r.URL.Query().Get("all") == "true"
+
+	if _, err := repository.FetchProductByID(id); err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	lots, err := repository.FetchStockLots(id, all)
+	if err != nil {
+		http.Error(w, "Failed to fetch lots", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(lots)
+}
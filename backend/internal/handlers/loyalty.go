@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"restaurant-backend/internal/loyalty"
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+const (
+	// loyaltyHistoryLimit is how many ledger entries the summary includes
+	loyaltyHistoryLimit = 50
+	// expiringSoonDays is how far ahead the summary warns about expiring
+	// points
+	expiringSoonDays = 30
+)
+
+// loyaltySummary builds a user's standing in the points program
+func loyaltySummary(userID int) (*models.LoyaltySummary, error) {
+	balance, err := repository.GetLoyaltyBalance(userID)
+	if err != nil {
+		return nil, err
+	}
+	qualifying, err := repository.GetQualifyingPoints(userID, loyalty.TierWindowDays)
+	if err != nil {
+		return nil, err
+	}
+	expiring, err := repository.FetchExpiringPoints(userID, expiringSoonDays)
+	if err != nil {
+		return nil, err
+	}
+	history, err := repository.FetchLoyaltyLedger(userID, loyaltyHistoryLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	tier, next := loyalty.TierFor(qualifying)
+	summary := &models.LoyaltySummary{
+		Balance:          balance,
+		BalanceValue:     loyalty.Value(balance),
+		PointValue:       loyalty.Settings.PointValue,
+		Tier:             tier,
+		NextTier:         next,
+		QualifyingPoints: qualifying,
+		Expiring:         expiring,
+		History:          history,
+	}
+	if next != nil {
+		summary.PointsToNextTier = next.MinPoints - qualifying
+	}
+	return summary, nil
+}
+
+// GetLoyalty handles GET /api/loyalty
+func GetLoyalty(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	summary, err := loyaltySummary(claims.UserID)
+	if err != nil {
+		slog.Error("failed to fetch loyalty summary", "error", err)
+		http.Error(w, "Failed to fetch loyalty points", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// GetUserLoyaltyAdmin handles GET /api/admin/users/{id}/loyalty
+func GetUserLoyaltyAdmin(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDFromPath(w, r, true)
+	if !ok {
+		return
+	}
+
+	if _, err := repository.GetUserByID(id); err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	summary, err := loyaltySummary(id)
+	if err != nil {
+		slog.Error("failed to fetch loyalty summary", "error", err)
+		http.Error(w, "Failed to fetch loyalty points", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
+
+// AdjustUserLoyalty handles POST /api/admin/users/{id}/loyalty/adjust.
+// Positive points are added as a new lot; negative points are taken from
+// the balance.
+func AdjustUserLoyalty(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDFromPath(w, r, false)
+	if !ok {
+		return
+	}
+
+	var req models.LoyaltyAdjustRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Points == 0 || req.Reason == "" {
+		http.Error(w, "Points and a reason are required", http.StatusBadRequest)
+		return
+	}
+
+	if _, err := repository.GetUserByID(id); err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	claims, _ := r.Context().Value(models.UserContextKey).(*models.Claims)
+	err := repository.AdjustLoyaltyPoints(id, req.Points, loyalty.Settings.ExpiryDays,
+		req.Reason, claims.UserID)
+	if err == repository.ErrInsufficientPoints {
+		http.Error(w, "The user does not have that many points", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to adjust loyalty points", "error", err)
+		http.Error(w, "Failed to adjust loyalty points", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "loyalty.adjusted", &id,
+		fmt.Sprintf("points=%d reason=%s", req.Points, req.Reason))
+
+	summary, err := loyaltySummary(id)
+	if err != nil {
+		http.Error(w, "Failed to fetch loyalty points", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
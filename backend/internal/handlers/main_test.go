@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"database/sql"
+	"log"
+	"os"
+	"testing"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+// testDB is a second connection to the test database, for setting up
+// fixtures and checking what the handlers stored
+var testDB *sql.DB
+
+// TestMain runs the tests against a fresh database in a temporary directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "handlers-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		log.Fatal(err)
+	}
+	repository.InitDB()
+	testDB, err = sql.Open("sqlite", "./restaurant_v4.db?_pragma=busy_timeout(5000)")
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	code := m.Run()
+	testDB.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// exec runs fixture SQL, failing the test on error
+func exec(t *testing.T, query string, args ...any) {
+	t.Helper()
+	if _, err := testDB.Exec(query, args...); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// failWrites makes writes to table fail with a trigger until the test ends
+func failWrites(t *testing.T, table, op string) {
+	t.Helper()
+	name := "fail_" + op + "_" + table
+	exec(t, `CREATE TRIGGER `+name+` BEFORE `+op+` ON `+table+`
+		BEGIN SELECT RAISE(ABORT, 'write failed'); END`)
+	t.Cleanup(func() { testDB.Exec("DROP TRIGGER " + name) })
+}
+
+// pendingOrder stores an order with nothing on it but an amount to pay
+func pendingOrder(t *testing.T, amount float64) *models.Order {
+	t.Helper()
+	order := &models.Order{UserID: 1, TotalPrice: amount, Subtotal: amount,
+		AmountDue: amount, OrderType: "takeaway", Status: "pending"}
+	if err := repository.CreateOrder(order); err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+// orderStatus is an order's stored status
+func orderStatus(t *testing.T, id int) string {
+	t.Helper()
+	var status string
+	if err := testDB.QueryRow("SELECT status FROM orders WHERE id = ?",
+		id).Scan(&status); err != nil {
+		t.Fatal(err)
+	}
+	return status
+}
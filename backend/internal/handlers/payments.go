@@ -0,0 +1,381 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+
+	"restaurant-backend/internal/loyalty"
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/payments"
+	"restaurant-backend/internal/repository"
+)
+
+// maxWebhookBody limits webhook payloads
+const maxWebhookBody = 1 << 20
+
+// paymentProvider takes card payments, see SetPaymentProvider
+var paymentProvider payments.Provider = payments.NewMock("")
+
+// SetPaymentProvider sets the provider used for card payments
+func SetPaymentProvider(p payments.Provider) {
+	paymentProvider = p
+}
+
+var (
+	// errPaymentDeclined is wrapped by payment failures the customer can fix,
+	// such as a declined card
+	errPaymentDeclined = errors.New("payment declined")
+	// errPaymentProvider is wrapped when the provider could not be reached
+	// or refused the request
+	errPaymentProvider = errors.New("payment provider error")
+)
+
+// authorizeOrderPayment holds an order's amount due on the customer's card.
+// If the card is declined, or the payment cannot be stored, the order is
+// cancelled, which also gives back points, gift card payments and stock.
+func authorizeOrderPayment(ctx context.Context, order *models.Order, method string) error {
+	pi := &models.PaymentIntent{
+		OrderID:  order.ID,
+		Provider: paymentProvider.Name(),
+		Amount:   order.AmountDue,
+		Currency: payments.Currency,
+		Status:   string(payments.StatusPending),
+	}
+	if err := repository.CreatePaymentIntent(pi); err != nil {
+		cancelUnpaidOrder(order)
+		return err
+	}
+
+	result, err := paymentProvider.Authorize(ctx, payments.AuthorizeRequest{
+		Amount:         payments.ToMinor(order.AmountDue),
+		Currency:       payments.Currency,
+		PaymentMethod:  method,
+		OrderID:        order.ID,
+		IdempotencyKey: fmt.Sprintf("order-%d-authorize-%d", order.ID, pi.ID),
+	})
+	recordPaymentAttempt(pi, "authorize", order.AmountDue, result, err)
+
+	if err == nil && (result.Status == payments.StatusAuthorized ||
+		result.Status == payments.StatusCaptured) {
+		pi.ProviderRef, pi.Status = result.ProviderRef, string(result.Status)
+		if result.Status == payments.StatusCaptured {
+			pi.CapturedAmount = payments.FromMinor(result.Amount)
+		}
+		err := repository.UpdatePaymentIntent(pi)
+		if err == nil {
+			order.PaymentStatus = pi.Status
+			return nil
+		}
+		// A payment that is not stored could never be captured or refunded,
+		// so it goes back to the card along with the order
+		releasePayment(ctx, pi)
+		if uerr := repository.UpdatePaymentIntent(pi); uerr != nil {
+			slog.Error("failed to record released payment", "error", uerr,
+				"order", order.ID)
+		}
+		cancelUnpaidOrder(order)
+		order.PaymentStatus = pi.Status
+		return err
+	}
+
+	pi.Status = string(payments.StatusFailed)
+	message := "Payment could not be processed"
+	if result != nil {
+		pi.ProviderRef = result.ProviderRef
+		pi.FailureCode, pi.FailureMessage = result.FailureCode, result.FailureMessage
+		if result.FailureMessage != "" {
+			message = result.FailureMessage
+		}
+	}
+	if uerr := repository.UpdatePaymentIntent(pi); uerr != nil {
+		slog.Error("failed to record payment failure", "error", uerr, "order", order.ID)
+	}
+	cancelUnpaidOrder(order)
+	order.PaymentStatus = pi.Status
+
+	if err != nil {
+		slog.Error("payment authorization failed", "error", err, "order", order.ID)
+		return fmt.Errorf("%w: %v", errPaymentProvider, err)
+	}
+	return fmt.Errorf("%w: %s", errPaymentDeclined, message)
+}
+
+// cancelUnpaidOrder cancels an order whose payment did not go through
+func cancelUnpaidOrder(order *models.Order) {
+	if err := repository.CancelOrder(order.ID, loyalty.Settings.ExpiryDays, nil); err != nil {
+		slog.Error("failed to cancel unpaid order", "error", err, "order", order.ID)
+	}
+	order.Status = "cancelled"
+}
+
+// releasePayment voids an authorized payment, or refunds a captured one,
+// setting pi's status to match when the provider accepts
+func releasePayment(ctx context.Context, pi *models.PaymentIntent) {
+	var result *payments.Result
+	var err error
+	if pi.Status == string(payments.StatusCaptured) {
+		result, err = paymentProvider.Refund(ctx, pi.ProviderRef,
+			payments.ToMinor(pi.CapturedAmount),
+			fmt.Sprintf("order-%d-release-%d", pi.OrderID, pi.ID))
+		recordPaymentAttempt(pi, "refund", pi.CapturedAmount, result, err)
+	} else {
+		result, err = paymentProvider.Void(ctx, pi.ProviderRef)
+		recordPaymentAttempt(pi, "void", pi.Amount, result, err)
+	}
+	if err != nil || result.Status == payments.StatusFailed {
+		slog.Error("failed to release payment", "error", err, "intent", pi.ID,
+			"ref", pi.ProviderRef)
+		return
+	}
+	pi.Status = string(result.Status)
+	if result.Status == payments.StatusRefunded {
+		pi.RefundedAmount = payments.FromMinor(result.Amount)
+	}
+}
+
+// captureOrderPayment takes the authorized payment for an order. Orders
+// without a card payment have nothing to capture.
+func captureOrderPayment(ctx context.Context, orderID int) error {
+	pi, err := repository.GetPaymentIntentByOrderID(orderID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if pi.Status == string(payments.StatusCaptured) {
+		return nil
+	}
+	if pi.Status != string(payments.StatusAuthorized) {
+		return fmt.Errorf("%w: the payment is %s", errPaymentDeclined, pi.Status)
+	}
+
+	result, err := paymentProvider.Capture(ctx, pi.ProviderRef,
+		payments.ToMinor(pi.Amount))
+	recordPaymentAttempt(pi, "capture", pi.Amount, result, err)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPaymentProvider, err)
+	}
+	if result.Status != payments.StatusCaptured {
+		pi.Status = string(payments.StatusFailed)
+		pi.FailureCode, pi.FailureMessage = result.FailureCode, result.FailureMessage
+		if err := repository.UpdatePaymentIntent(pi); err != nil {
+			return err
+		}
+		return fmt.Errorf("%w: capture failed: %s", errPaymentDeclined,
+			result.FailureMessage)
+	}
+
+	pi.Status = string(payments.StatusCaptured)
+	pi.CapturedAmount = payments.FromMinor(result.Amount)
+	return repository.UpdatePaymentIntent(pi)
+}
+
+// releaseOrderPayment gives back the card payment for a cancelled order:
+// authorizations are voided and captured payments refunded in full
+func releaseOrderPayment(ctx context.Context, orderID int) error {
+	pi, err := repository.GetPaymentIntentByOrderID(orderID)
+	if err == sql.ErrNoRows {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	switch payments.Status(pi.Status) {
+	case payments.StatusAuthorized:
+		result, err := paymentProvider.Void(ctx, pi.ProviderRef)
+		recordPaymentAttempt(pi, "void", pi.Amount, result, err)
+		if err != nil {
+			return fmt.Errorf("%w: %v", errPaymentProvider, err)
+		}
+		pi.Status = string(payments.StatusVoided)
+		return repository.UpdatePaymentIntent(pi)
+	case payments.StatusCaptured, payments.StatusPartiallyRefunded:
+		return refundPayment(ctx, pi, pi.CapturedAmount-pi.RefundedAmount,
+			fmt.Sprintf("order-%d-release-%d", orderID, pi.ID))
+	default:
+		return nil
+	}
+}
+
+// refundPayment returns amount of a captured payment to the customer. The
+// provider refunds once per idempotencyKey, so a call repeated with the same
+// key after an error cannot refund twice.
+func refundPayment(ctx context.Context, pi *models.PaymentIntent, amount float64,
+	idempotencyKey string) error {
+	if amount <= 0 {
+		return nil
+	}
+
+	result, err := paymentProvider.Refund(ctx, pi.ProviderRef,
+		payments.ToMinor(amount), idempotencyKey)
+	recordPaymentAttempt(pi, "refund", amount, result, err)
+	if err != nil {
+		return fmt.Errorf("%w: %v", errPaymentProvider, err)
+	}
+	if result.Status == payments.StatusFailed {
+		return fmt.Errorf("%w: refund failed: %s", errPaymentProvider,
+			result.FailureMessage)
+	}
+
+	return repository.AddPaymentIntentRefund(pi, amount)
+}
+
+// recordPaymentAttempt logs a provider call; logging failures are not
+// fatal to the payment
+func recordPaymentAttempt(pi *models.PaymentIntent, action string, amount float64,
+	result *payments.Result, callErr error) {
+	a := &models.PaymentAttempt{IntentID: pi.ID, Action: action, Amount: amount}
+	switch {
+	case callErr != nil:
+		a.Detail = callErr.Error()
+	case result != nil:
+		a.ProviderRef = result.ProviderRef
+		a.Succeeded = result.Status != payments.StatusFailed
+		a.Detail = string(result.Status)
+		if result.FailureCode != "" {
+			a.Detail += ": " + result.FailureCode
+		}
+	}
+	if err := repository.RecordPaymentAttempt(a); err != nil {
+		slog.Error("failed to record payment attempt", "error", err, "intent", pi.ID)
+	}
+}
+
+// writePaymentError maps payment errors to responses, returning false for
+// other errors
+func writePaymentError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, errPaymentDeclined):
+		http.Error(w, err.Error(), http.StatusPaymentRequired)
+	case errors.Is(err, errPaymentProvider):
+		http.Error(w, "Payment provider unavailable, please try again",
+			http.StatusBadGateway)
+	default:
+		return false
+	}
+	return true
+}
+
+// PaymentWebhook handles POST /api/payments/webhook. Verified events move
+// the payment forward; a failed or cancelled payment cancels its order.
+func PaymentWebhook(w http.ResponseWriter, r *http.Request) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, maxWebhookBody))
+	if err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	event, err := paymentProvider.VerifyWebhook(body, r.Header)
+	if err != nil {
+		slog.Warn("rejected payment webhook", "error", err)
+		http.Error(w, "Invalid webhook", http.StatusBadRequest)
+		return
+	}
+	if event.Status == "" || event.ProviderRef == "" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	pi, err := repository.GetPaymentIntentByProviderRef(paymentProvider.Name(),
+		event.ProviderRef)
+	if err == sql.ErrNoRows {
+		// Not one of ours, e.g. another application on the same account
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to process webhook", http.StatusInternalServerError)
+		return
+	}
+
+	err = repository.RecordPaymentAttempt(&models.PaymentAttempt{
+		IntentID:    pi.ID,
+		Action:      "webhook",
+		Amount:      payments.FromMinor(event.Amount),
+		Succeeded:   event.Status != payments.StatusFailed,
+		ProviderRef: event.ID,
+		Detail:      event.Type,
+	})
+	if err != nil {
+		// The provider sends the event again
+		slog.Error("failed to record payment webhook", "error", err, "intent", pi.ID)
+		http.Error(w, "Failed to process webhook", http.StatusInternalServerError)
+		return
+	}
+
+	current := payments.Status(pi.Status)
+	if !payments.CanTransition(current, event.Status) {
+		slog.Info("ignoring payment webhook", "type", event.Type, "intent", pi.ID,
+			"status", pi.Status)
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+
+	pi.Status = string(event.Status)
+	switch event.Status {
+	case payments.StatusCaptured:
+		pi.CapturedAmount = payments.FromMinor(event.Amount)
+	case payments.StatusPartiallyRefunded, payments.StatusRefunded:
+		pi.RefundedAmount = payments.FromMinor(event.Amount)
+	}
+	if err := repository.UpdatePaymentIntent(pi); err != nil {
+		http.Error(w, "Failed to process webhook", http.StatusInternalServerError)
+		return
+	}
+
+	if event.Status == payments.StatusFailed || event.Status == payments.StatusVoided {
+		err := repository.CancelOrder(pi.OrderID, loyalty.Settings.ExpiryDays,
+			nil)
+		if err != nil && err != repository.ErrOrderNotPending {
+			slog.Error("failed to cancel order after payment webhook", "error", err,
+				"order", pi.OrderID)
+		}
+	}
+	w.WriteHeader(http.StatusOK)
+}
+
+// GetPaymentConfig handles GET /api/payments/config, what checkout needs to
+// collect a payment method for the provider in use
+func GetPaymentConfig(w http.ResponseWriter, r *http.Request) {
+	config := models.PaymentConfig{
+		Provider: paymentProvider.Name(),
+		Currency: payments.Currency,
+	}
+	if _, ok := paymentProvider.(*payments.Mock); ok {
+		config.TestPaymentMethods = payments.MockPaymentMethods
+	} else {
+		config.PublishableKey = payments.PublishableKey
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(config)
+}
+
+// GetOrderPayments handles GET /api/admin/orders/{id}/payments
+func GetOrderPayments(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	intents, err := repository.FetchPaymentIntentsByOrderID(id)
+	if err != nil {
+		http.Error(w, "Failed to fetch payments", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(intents)
+}
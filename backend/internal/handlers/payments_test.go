@@ -0,0 +1,205 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"restaurant-backend/internal/payments"
+	"restaurant-backend/internal/repository"
+)
+
+// testPayments is shared by the tests so payment references stay unique
+// in the test database
+var testPayments = payments.NewMock("")
+
+// recordingProvider is the mock provider, noting what it was asked to do
+type recordingProvider struct {
+	*payments.Mock
+	authorized int
+	voided     []string
+}
+
+func (p *recordingProvider) Authorize(ctx context.Context, req payments.AuthorizeRequest) (*payments.Result, error) {
+	p.authorized++
+	return p.Mock.Authorize(ctx, req)
+}
+
+func (p *recordingProvider) Void(ctx context.Context, ref string) (*payments.Result, error) {
+	p.voided = append(p.voided, ref)
+	return p.Mock.Void(ctx, ref)
+}
+
+// withProvider takes payments with a recording provider until the test ends
+func withProvider(t *testing.T) *recordingProvider {
+	p := &recordingProvider{Mock: testPayments}
+	saved := paymentProvider
+	paymentProvider = p
+	t.Cleanup(func() { paymentProvider = saved })
+	return p
+}
+
+func TestAuthorizeOrderPayment(t *testing.T) {
+	tests := []struct {
+		name          string
+		method        string
+		fail          string // table whose writes fail, and how
+		wantErr       error  // nil for any error when the order is cancelled
+		wantStatus    string
+		wantPayment   string // stored payment status, empty when none is stored
+		wantVoided    bool
+		wantAuthorize bool
+	}{
+		{name: "approved", method: "pm_card_visa", wantStatus: "pending",
+			wantPayment: "authorized", wantAuthorize: true},
+		{name: "declined", method: "pm_card_chargeDeclined", wantErr: errPaymentDeclined,
+			wantStatus: "cancelled", wantPayment: "failed", wantAuthorize: true},
+		{name: "provider error", method: "tok_unknown", wantErr: errPaymentProvider,
+			wantStatus: "cancelled", wantPayment: "failed", wantAuthorize: true},
+		{name: "intent not stored", method: "pm_card_visa", fail: "payment_intents INSERT",
+			wantStatus: "cancelled"},
+		{name: "authorization not stored", method: "pm_card_visa",
+			fail: "payment_intents UPDATE", wantStatus: "cancelled",
+			wantPayment: "pending", wantVoided: true, wantAuthorize: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			provider := withProvider(t)
+			order := pendingOrder(t, 12.5)
+			if tt.fail != "" {
+				table, op, _ := strings.Cut(tt.fail, " ")
+				failWrites(t, table, op)
+			}
+
+			err := authorizeOrderPayment(context.Background(), order, tt.method)
+			switch {
+			case tt.wantStatus == "pending" && err != nil:
+				t.Fatalf("authorizeOrderPayment: %v", err)
+			case tt.wantStatus != "pending" && err == nil:
+				t.Fatal("authorizeOrderPayment succeeded, want an error")
+			case tt.wantErr != nil && !errors.Is(err, tt.wantErr):
+				t.Errorf("error = %v, want %v", err, tt.wantErr)
+			}
+			if got := orderStatus(t, order.ID); got != tt.wantStatus || order.Status != got {
+				t.Errorf("order status = %s (returned %s), want %s", got, order.Status,
+					tt.wantStatus)
+			}
+
+			pi, err := repository.GetPaymentIntentByOrderID(order.ID)
+			switch {
+			case tt.wantPayment == "" && err != sql.ErrNoRows:
+				t.Errorf("payment stored: %+v, %v", pi, err)
+			case tt.wantPayment != "" && err != nil:
+				t.Fatal(err)
+			case tt.wantPayment != "" && pi.Status != tt.wantPayment:
+				t.Errorf("payment status = %s, want %s", pi.Status, tt.wantPayment)
+			}
+
+			if got := len(provider.voided) > 0; got != tt.wantVoided {
+				t.Errorf("voided %v, want voided: %v", provider.voided, tt.wantVoided)
+			}
+			if got := provider.authorized > 0; got != tt.wantAuthorize {
+				t.Errorf("authorized: %v, want %v", got, tt.wantAuthorize)
+			}
+		})
+	}
+}
+
+// sendWebhook posts a webhook signed by the mock provider
+func sendWebhook(t *testing.T, provider *recordingProvider, body string) int {
+	t.Helper()
+	req := httptest.NewRequest(http.MethodPost, "/api/payments/webhook",
+		strings.NewReader(body))
+	req.Header.Set(payments.MockSignatureHeader, provider.Sign([]byte(body)))
+	w := httptest.NewRecorder()
+	PaymentWebhook(w, req)
+	return w.Code
+}
+
+// authorizedOrder is a pending order with an authorized card payment
+func authorizedOrder(t *testing.T) (orderID int, ref string) {
+	t.Helper()
+	order := pendingOrder(t, 20)
+	if err := authorizeOrderPayment(context.Background(), order, "pm_card_visa"); err != nil {
+		t.Fatal(err)
+	}
+	pi, err := repository.GetPaymentIntentByOrderID(order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order.ID, pi.ProviderRef
+}
+
+func TestPaymentWebhook(t *testing.T) {
+	event := func(id, kind, ref string) string {
+		return fmt.Sprintf(`{"id":%q,"type":%q,"data":{"object":{"id":%q,
+			"amount":2000,"amount_received":2000}}}`, id, kind, ref)
+	}
+
+	t.Run("bad signature", func(t *testing.T) {
+		withProvider(t)
+		req := httptest.NewRequest(http.MethodPost, "/api/payments/webhook",
+			strings.NewReader(event("evt_1", "payment_intent.succeeded", "mock_pi_1")))
+		req.Header.Set(payments.MockSignatureHeader, "00")
+		w := httptest.NewRecorder()
+		PaymentWebhook(w, req)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+	})
+
+	t.Run("unknown payment", func(t *testing.T) {
+		provider := withProvider(t)
+		if code := sendWebhook(t, provider, event("evt_2", "payment_intent.succeeded",
+			"pi_elsewhere")); code != http.StatusOK {
+			t.Errorf("status = %d, want %d", code, http.StatusOK)
+		}
+	})
+
+	t.Run("captured", func(t *testing.T) {
+		provider := withProvider(t)
+		orderID, ref := authorizedOrder(t)
+		if code := sendWebhook(t, provider, event("evt_3", "payment_intent.succeeded",
+			ref)); code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", code, http.StatusOK)
+		}
+		pi, err := repository.GetPaymentIntentByOrderID(orderID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pi.Status != "captured" || pi.CapturedAmount != 20 {
+			t.Errorf("payment = %s %v, want captured 20", pi.Status, pi.CapturedAmount)
+		}
+	})
+
+	t.Run("failed payment cancels the order", func(t *testing.T) {
+		provider := withProvider(t)
+		orderID, ref := authorizedOrder(t)
+		if code := sendWebhook(t, provider, event("evt_4",
+			"payment_intent.payment_failed", ref)); code != http.StatusOK {
+			t.Fatalf("status = %d, want %d", code, http.StatusOK)
+		}
+		if got := orderStatus(t, orderID); got != "cancelled" {
+			t.Errorf("order status = %s, want cancelled", got)
+		}
+	})
+
+	t.Run("attempt not recorded", func(t *testing.T) {
+		provider := withProvider(t)
+		orderID, ref := authorizedOrder(t)
+		failWrites(t, "payment_attempts", "INSERT")
+		if code := sendWebhook(t, provider, event("evt_5",
+			"payment_intent.payment_failed", ref)); code != http.StatusInternalServerError {
+			t.Fatalf("status = %d, want %d", code, http.StatusInternalServerError)
+		}
+		// Nothing changes until the provider sends the event again
+		if got := orderStatus(t, orderID); got != "pending" {
+			t.Errorf("order status = %s, want pending", got)
+		}
+	})
+}
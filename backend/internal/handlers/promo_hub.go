@@ -0,0 +1,201 @@
+package handlers
+
+import (
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+const (
+	defaultMaxPromoClients = 1000
+	promoKeepAlive         = 15 * time.Second
+	promoClientBuffer      = 4
+)
+
+// promoEvent is one message for one client
+type promoEvent struct {
+	id      string
+	message string
+}
+
+// promoClient is a connected promo bar
+type promoClient struct {
+	viewer promoViewer
+	events chan promoEvent
+}
+
+// promoHubStats is what admins see about connected promo bars
+type promoHubStats struct {
+	Clients    int `json:"clients"`
+	LoggedIn   int `json:"loggedIn"`
+	MaxClients int `json:"maxClients"`
+}
+
+// promoHub rotates promos on a single ticker and pushes them to every
+// connected client, each filtered by the client's audience. Event IDs are
+// "<hub start>-<sequence>" so a client resuming with Last-Event-ID after a
+// restart is recognised as stale.
+type promoHub struct {
+	mu         sync.Mutex
+	clients    map[*promoClient]struct{}
+	maxClients int
+	promotions []models.Promotion
+	started    int64
+	seq        int
+	tick       int
+	reload     chan struct{}
+}
+
+var promoBroadcaster = &promoHub{
+	clients: map[*promoClient]struct{}{},
+	reload:  make(chan struct{}, 1),
+}
+
+// StartPromoHub loads the promotions and starts the rotation. The client
+// cap is read from PROMO_SSE_MAX_CLIENTS.
+func StartPromoHub() {
+	promoBroadcaster.maxClients = defaultMaxPromoClients
+	if v := os.Getenv("PROMO_SSE_MAX_CLIENTS"); v != "" {
+		if n, err := strconv.Atoi(v); err == nil && n > 0 {
+			promoBroadcaster.maxClients = n
+		} else {
+			slog.Warn("ignoring invalid PROMO_SSE_MAX_CLIENTS", "value", v)
+		}
+	}
+	promoBroadcaster.started = time.Now().Unix()
+	promoBroadcaster.load()
+
+	go promoBroadcaster.run()
+}
+
+// notifyPromosChanged pushes edited promotions to all clients right away
+func notifyPromosChanged() {
+	select {
+	case promoBroadcaster.reload <- struct{}{}:
+	default:
+		// A reload is already pending
+	}
+}
+
+func (h *promoHub) run() {
+	ticker := time.NewTicker(promoRotateInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			h.mu.Lock()
+			h.tick++
+			h.mu.Unlock()
+		case <-h.reload:
+		}
+		// Reloading on every tick also picks up schedule boundaries
+		h.load()
+		h.broadcast()
+	}
+}
+
+// load refreshes the cached promotions from the database
+func (h *promoHub) load() {
+	promotions, err := repository.FetchActivePromotions()
+	if err != nil {
+		slog.Error("failed to fetch promotions", "error", err)
+		return
+	}
+	h.mu.Lock()
+	h.promotions = promotions
+	h.mu.Unlock()
+}
+
+// broadcast sends every client its current promo under a new event ID
+func (h *promoHub) broadcast() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.seq++
+	id := h.eventID()
+	now := time.Now()
+	for c := range h.clients {
+		message, ok := h.current(c.viewer, now)
+		if !ok {
+			continue
+		}
+		select {
+		case c.events <- promoEvent{id: id, message: message}:
+		default:
+			// Slow client; it catches up on the next rotation
+		}
+	}
+}
+
+// subscribe registers a client and returns the promo it should show now,
+// or ok=false if the hub is full. Nothing is returned when lastEventID shows
+// the client already has the current promo.
+func (h *promoHub) subscribe(viewer promoViewer, lastEventID string) (*promoClient, *promoEvent, bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if len(h.clients) >= h.maxClients {
+		return nil, nil, false
+	}
+
+	c := &promoClient{
+		viewer: viewer,
+		events: make(chan promoEvent, promoClientBuffer),
+	}
+	h.clients[c] = struct{}{}
+
+	id := h.eventID()
+	if lastEventID == id {
+		return c, nil, true
+	}
+	message, ok := h.current(viewer, time.Now())
+	if !ok {
+		return c, nil, true
+	}
+	return c, &promoEvent{id: id, message: message}, true
+}
+
+func (h *promoHub) unsubscribe(c *promoClient) {
+	h.mu.Lock()
+	delete(h.clients, c)
+	h.mu.Unlock()
+}
+
+func (h *promoHub) stats() promoHubStats {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	s := promoHubStats{Clients: len(h.clients), MaxClients: h.maxClients}
+	for c := range h.clients {
+		if c.viewer.loggedIn {
+			s.LoggedIn++
+		}
+	}
+	return s
+}
+
+// current picks the viewer's promo for this rotation. h.mu must be held.
+func (h *promoHub) current(viewer promoViewer, now time.Time) (string, bool) {
+	var messages []string
+	for _, p := range h.promotions {
+		if promotionInEffect(p, now) && viewer.sees(p) {
+			messages = append(messages, p.Message)
+		}
+	}
+	if len(messages) == 0 {
+		return "", false
+	}
+	return messages[h.tick%len(messages)], true
+}
+
+// eventID returns the ID of the latest broadcast. h.mu must be held.
+func (h *promoHub) eventID() string {
+	return fmt.Sprintf("%d-%d", h.started, h.seq)
+}
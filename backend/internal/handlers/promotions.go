@@ -0,0 +1,387 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"regexp"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"github.com/gorilla/mux"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+const (
+	promoRotateInterval = 10 * time.Second
+	maxPromoLength      = 280
+)
+
+// audiencePattern matches the audiences a promotion can target
+var audiencePattern = regexp.MustCompile(`^(all|logged_in|category:[a-z][a-z-]*)$`)
+
+// promoViewer is who is watching the promo bar
+type promoViewer struct {
+	loggedIn   bool
+	categories []string
+}
+
+// viewerFromRequest identifies the viewer. The promo stream is public, so
+// claims are only present when the client sent a valid token.
+func viewerFromRequest(r *http.Request) promoViewer {
+	claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims)
+	if !ok {
+		return promoViewer{}
+	}
+
+	categories, err := repository.FetchOrderedCategories(claims.UserID)
+	if err != nil {
+		slog.Error("failed to fetch ordered categories", "error", err)
+	}
+	return promoViewer{loggedIn: true, categories: categories}
+}
+
+// sees reports whether a promotion's audience includes the viewer
+func (v promoViewer) sees(p models.Promotion) bool {
+	switch {
+	case p.Audience == "" || p.Audience == "all":
+		return true
+	case p.Audience == "logged_in":
+		return v.loggedIn
+	default:
+		category, ok := strings.CutPrefix(p.Audience, "category:")
+		return ok && slices.Contains(v.categories, category)
+	}
+}
+
+// promotionInEffect reports whether an active promotion is scheduled for now
+func promotionInEffect(p models.Promotion, now time.Time) bool {
+	if !p.Active {
+		return false
+	}
+	if p.StartsAt != nil {
+		if start, err := time.Parse(time.RFC3339, *p.StartsAt); err == nil &&
+			now.Before(start) {
+			return false
+		}
+	}
+	if p.EndsAt != nil {
+		if end, err := time.Parse(time.RFC3339, *p.EndsAt); err == nil &&
+			!now.Before(end) {
+			return false
+		}
+	}
+	return len(p.DaysOfWeek) == 0 ||
+		slices.Contains(p.DaysOfWeek, int(now.Weekday()))
+}
+
+// GetPromosSSE handles GET /api/promos for Server-Sent Events. Promos are
+// pushed by the promo hub as "promo" events; a comment is sent periodically
+// to keep proxies from closing idle connections.
+func GetPromosSSE(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+
+	client, initial, ok := promoBroadcaster.subscribe(viewerFromRequest(r),
+		r.Header.Get("Last-Event-ID"))
+	if !ok {
+		w.Header().Set("Retry-After", "30")
+		http.Error(w, "Too many promo connections", http.StatusServiceUnavailable)
+		return
+	}
+	defer promoBroadcaster.unsubscribe(client)
+
+	// The stream outlives the server's write timeout
+	if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+		slog.Warn("failed to clear write deadline for promo stream", "error", err)
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// Make sure we allow CORS for this specific endpoint just in case
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+
+	fmt.Fprintf(w, "retry: %d\n\n", (5 * time.Second).Milliseconds())
+	if initial != nil {
+		writePromoEvent(w, *initial)
+	}
+	flusher.Flush()
+
+	keepAlive := time.NewTicker(promoKeepAlive)
+	defer keepAlive.Stop()
+
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-client.events:
+			writePromoEvent(w, event)
+			flusher.Flush()
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+			flusher.Flush()
+		}
+	}
+}
+
+func writePromoEvent(w http.ResponseWriter, e promoEvent) {
+	fmt.Fprintf(w, "id: %s\nevent: promo\n", e.id)
+	for _, line := range strings.Split(e.message, "\n") {
+		fmt.Fprintf(w, "data: %s\n", line)
+	}
+	fmt.Fprint(w, "\n")
+}
+
+// GetPromoClients handles GET /api/admin/promotions/clients
+func GetPromoClients(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promoBroadcaster.stats())
+}
+
+// GetPromos handles GET /api/promos/list (for admin). It returns the
+// messages of all active promotions, whatever their schedule.
+func GetPromos(w http.ResponseWriter, r *http.Request) {
+	promotions, err := repository.FetchActivePromotions()
+	if err != nil {
+		http.Error(w, "Failed to fetch promos", http.StatusInternalServerError)
+		return
+	}
+
+	messages := make([]string, len(promotions))
+	for i, p := range promotions {
+		messages[i] = p.Message
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(messages)
+}
+
+// UpdatePromos handles PUT /api/promos/list (for admin). Promotions that
+// keep their message keep their schedule; see SyncPromotionMessages.
+func UpdatePromos(w http.ResponseWriter, r *http.Request) {
+	var newPromos []string
+	if err := json.NewDecoder(r.Body).Decode(&newPromos); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	for i, message := range newPromos {
+		message = strings.TrimSpace(message)
+		if message == "" || utf8.RuneCountInString(message) > maxPromoLength {
+			http.Error(w, fmt.Sprintf("Promos must be 1 to %d characters",
+				maxPromoLength), http.StatusBadRequest)
+			return
+		}
+		newPromos[i] = message
+	}
+
+	if err := repository.SyncPromotionMessages(newPromos); err != nil {
+		slog.Error("failed to update promos", "error", err)
+		http.Error(w, "Failed to update promos", http.StatusInternalServerError)
+		return
+	}
+	notifyPromosChanged()
+
+	w.WriteHeader(http.StatusOK)
+	json.NewEncoder(w).Encode(map[string]string{"message": "Promos updated successfully"})
+}
+
+// ListPromotions handles GET /api/admin/promotions
+func ListPromotions(w http.ResponseWriter, r *http.Request) {
+	promotions, err := repository.FetchPromotions()
+	if err != nil {
+		http.Error(w, "Failed to fetch promotions", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(promotions)
+}
+
+// GetPromotion handles GET /api/admin/promotions/{id}
+func GetPromotion(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid promotion ID", http.StatusBadRequest)
+		return
+	}
+
+	p, err := repository.GetPromotion(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Promotion not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to fetch promotion", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// CreatePromotion handles POST /api/admin/promotions
+func CreatePromotion(w http.ResponseWriter, r *http.Request) {
+	p, ok := decodePromotion(w, r)
+	if !ok {
+		return
+	}
+
+	if err := repository.CreatePromotion(p); err != nil {
+		slog.Error("failed to create promotion", "error", err)
+		http.Error(w, "Failed to create promotion", http.StatusInternalServerError)
+		return
+	}
+	notifyPromosChanged()
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(p)
+}
+
+// UpdatePromotion handles PUT /api/admin/promotions/{id}
+func UpdatePromotion(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid promotion ID", http.StatusBadRequest)
+		return
+	}
+
+	p, ok := decodePromotion(w, r)
+	if !ok {
+		return
+	}
+	p.ID = id
+
+	if err := repository.UpdatePromotion(p); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Promotion not found", http.StatusNotFound)
+			return
+		}
+		slog.Error("failed to update promotion", "error", err)
+		http.Error(w, "Failed to update promotion", http.StatusInternalServerError)
+		return
+	}
+	notifyPromosChanged()
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(p)
+}
+
+// DeletePromotion handles DELETE /api/admin/promotions/{id}
+func DeletePromotion(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid promotion ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := repository.DeletePromotion(id); err != nil {
+		if err == sql.ErrNoRows {
+			http.Error(w, "Promotion not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, "Failed to delete promotion", http.StatusInternalServerError)
+		return
+	}
+	notifyPromosChanged()
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// decodePromotion reads and validates a promotion from the request body.
+// Omitted fields default to an active promotion for everyone, every day.
+func decodePromotion(w http.ResponseWriter, r *http.Request) (*models.Promotion, bool) {
+	p := &models.Promotion{Audience: "all", Active: true}
+	if err := json.NewDecoder(r.Body).Decode(p); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if err := validatePromotion(p); err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return nil, false
+	}
+	return p, true
+}
+
+// validatePromotion checks a promotion and normalizes its fields
+func validatePromotion(p *models.Promotion) error {
+	p.Message = strings.TrimSpace(p.Message)
+	if p.Message == "" || utf8.RuneCountInString(p.Message) > maxPromoLength {
+		return fmt.Errorf("message must be 1 to %d characters", maxPromoLength)
+	}
+
+	if !audiencePattern.MatchString(p.Audience) {
+		return errors.New("audience must be all, logged_in or category:<name>")
+	}
+
+	seen := map[int]bool{}
+	days := []int{}
+	for _, d := range p.DaysOfWeek {
+		if d < 0 || d > 6 {
+			return errors.New("daysOfWeek must be between 0 (Sunday) and 6 (Saturday)")
+		}
+		if !seen[d] {
+			seen[d] = true
+			days = append(days, d)
+		}
+	}
+	slices.Sort(days)
+	p.DaysOfWeek = days
+
+	start, err := parseScheduleTime(p.StartsAt, false)
+	if err != nil {
+		return fmt.Errorf("startsAt: %w", err)
+	}
+	end, err := parseScheduleTime(p.EndsAt, true)
+	if err != nil {
+		return fmt.Errorf("endsAt: %w", err)
+	}
+	if start != nil && end != nil && !end.After(*start) {
+		return errors.New("endsAt must be after startsAt")
+	}
+	p.StartsAt, p.EndsAt = formatScheduleTime(start), formatScheduleTime(end)
+	return nil
+}
+
+// parseScheduleTime accepts RFC 3339 or a plain date in server local time. A
+// plain end date includes the whole day.
+func parseScheduleTime(s *string, isEnd bool) (*time.Time, error) {
+	if s == nil || strings.TrimSpace(*s) == "" {
+		return nil, nil
+	}
+	value := strings.TrimSpace(*s)
+
+	if t, err := time.Parse(time.RFC3339, value); err == nil {
+		return &t, nil
+	}
+	t, err := time.ParseInLocation("2006-01-02", value, time.Local)
+	if err != nil {
+		return nil, errors.New("expected RFC 3339 or YYYY-MM-DD")
+	}
+	if isEnd {
+		t = t.AddDate(0, 0, 1)
+	}
+	return &t, nil
+}
+
+func formatScheduleTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.Format(time.RFC3339)
+	return &s
+}
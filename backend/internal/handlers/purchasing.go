@@ -0,0 +1,434 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+const (
+	// maxLeadTimeDays bounds a supplier's delivery time
+	maxLeadTimeDays = 365
+	// maxPurchaseOrderLines limits the lines on one purchase order
+	maxPurchaseOrderLines = 200
+	// maxSupplierNoteLength limits free-text notes on suppliers and orders
+	maxSupplierNoteLength = 1000
+)
+
+// purchaseOrderStatuses are the statuses purchase orders can be listed by
+var purchaseOrderStatuses = map[string]bool{
+	"draft":              true,
+	"ordered":            true,
+	"partially_received": true,
+	"received":           true,
+	"cancelled":          true,
+}
+
+// ListSuppliers handles GET /api/admin/suppliers
+func ListSuppliers(w http.ResponseWriter, r *http.Request) {
+	suppliers, err := repository.FetchSuppliers()
+	if err != nil {
+		http.Error(w, "Failed to fetch suppliers", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(suppliers)
+}
+
+// CreateSupplier handles POST /api/admin/suppliers
+func CreateSupplier(w http.ResponseWriter, r *http.Request) {
+	s, ok := decodeSupplier(w, r)
+	if !ok {
+		return
+	}
+
+	if err := repository.CreateSupplier(s); err != nil {
+		if strings.Contains(err.Error(), "UNIQUE") {
+			http.Error(w, "A supplier with this name already exists",
+				http.StatusConflict)
+			return
+		}
+		slog.Error("failed to create supplier", "error", err)
+		http.Error(w, "Failed to create supplier", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "supplier.created", nil, fmt.Sprintf("id=%d name=%q", s.ID, s.Name))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(s)
+}
+
+// UpdateSupplier handles PUT /api/admin/suppliers/{id}. Set active to
+// false to stop new purchase orders going to a supplier.
+func UpdateSupplier(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+		return
+	}
+
+	s, ok := decodeSupplier(w, r)
+	if !ok {
+		return
+	}
+	s.ID = id
+
+	if err := repository.UpdateSupplier(s); err != nil {
+		switch {
+		case err == sql.ErrNoRows:
+			http.Error(w, "Supplier not found", http.StatusNotFound)
+		case strings.Contains(err.Error(), "UNIQUE"):
+			http.Error(w, "A supplier with this name already exists",
+				http.StatusConflict)
+		default:
+			slog.Error("failed to update supplier", "error", err)
+			http.Error(w, "Failed to update supplier", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	recordAudit(r, "supplier.updated", nil, fmt.Sprintf("id=%d name=%q", s.ID, s.Name))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s)
+}
+
+// decodeSupplier reads and validates a supplier from the request body.
+// Suppliers are active unless active is false.
+func decodeSupplier(w http.ResponseWriter, r *http.Request) (*models.Supplier, bool) {
+	var req struct {
+		models.Supplier
+		Active *bool `json:"active"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	s := req.Supplier
+	s.Active = req.Active == nil || *req.Active
+	s.Name = strings.TrimSpace(s.Name)
+	s.Email = strings.TrimSpace(s.Email)
+	if s.Name == "" || len(s.Name) > 100 {
+		http.Error(w, "name is required and at most 100 characters",
+			http.StatusBadRequest)
+		return nil, false
+	}
+	if s.Email != "" && !strings.Contains(s.Email, "@") {
+		http.Error(w, "Invalid email", http.StatusBadRequest)
+		return nil, false
+	}
+	if s.LeadTimeDays < 0 || s.LeadTimeDays > maxLeadTimeDays {
+		http.Error(w, fmt.Sprintf("leadTimeDays must be between 0 and %d",
+			maxLeadTimeDays), http.StatusBadRequest)
+		return nil, false
+	}
+	if len(s.Notes) > maxSupplierNoteLength {
+		http.Error(w, fmt.Sprintf("notes must be at most %d characters",
+			maxSupplierNoteLength), http.StatusBadRequest)
+		return nil, false
+	}
+	return &s, true
+}
+
+// ListPurchaseOrders handles GET /api/admin/purchase-orders?status=&supplierId=
+func ListPurchaseOrders(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && !purchaseOrderStatuses[status] {
+		http.Error(w, "Invalid status", http.StatusBadRequest)
+		return
+	}
+	supplierID := 0
+	if v := r.URL.Query().Get("supplierId"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			http.Error(w, "Invalid supplier ID", http.StatusBadRequest)
+			return
+		}
+		supplierID = id
+	}
+
+	orders, err := repository.FetchPurchaseOrders(status, supplierID)
+	if err != nil {
+		http.Error(w, "Failed to fetch purchase orders", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+// GetPurchaseOrder handles GET /api/admin/purchase-orders/{id}, including
+// the deliveries received against it
+func GetPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+	writePurchaseOrder(w, id, http.StatusOK)
+}
+
+// CreatePurchaseOrder handles POST /api/admin/purchase-orders. The order is
+// a draft unless status is "ordered".
+func CreatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	po, ok := decodePurchaseOrder(w, r)
+	if !ok {
+		return
+	}
+	if claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims); ok {
+		po.CreatedBy = &claims.UserID
+	}
+
+	if err := repository.CreatePurchaseOrder(po); err != nil {
+		slog.Error("failed to create purchase order", "error", err)
+		http.Error(w, "Failed to create purchase order", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "purchase_order.created", nil,
+		fmt.Sprintf("id=%d status=%s lines=%d", po.ID, po.Status, len(po.Lines)))
+	writePurchaseOrder(w, po.ID, http.StatusCreated)
+}
+
+// UpdatePurchaseOrder handles PUT /api/admin/purchase-orders/{id}, which
+// replaces a draft's details and lines
+func UpdatePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+
+	po, ok := decodePurchaseOrder(w, r)
+	if !ok {
+		return
+	}
+	po.ID = id
+
+	if err := repository.UpdatePurchaseOrder(po); err != nil {
+		writePurchaseOrderError(w, err, "Failed to update purchase order")
+		return
+	}
+
+	recordAudit(r, "purchase_order.updated", nil,
+		fmt.Sprintf("id=%d lines=%d", po.ID, len(po.Lines)))
+	writePurchaseOrder(w, id, http.StatusOK)
+}
+
+// SubmitPurchaseOrder handles POST /api/admin/purchase-orders/{id}/submit,
+// placing a draft with the supplier
+func SubmitPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := repository.SubmitPurchaseOrder(id); err != nil {
+		writePurchaseOrderError(w, err, "Failed to submit purchase order")
+		return
+	}
+
+	recordAudit(r, "purchase_order.submitted", nil, fmt.Sprintf("id=%d", id))
+	writePurchaseOrder(w, id, http.StatusOK)
+}
+
+// ReceivePurchaseOrder handles POST /api/admin/purchase-orders/{id}/receive.
+// Lines may be received in several deliveries, each with an expiry date
+// for its lot; with no lines everything still outstanding is received.
+func ReceivePurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.ReceiveRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	seen := map[int]bool{}
+	for _, l := range req.Lines {
+		if l.Quantity <= 0 {
+			http.Error(w, "Quantities must be positive", http.StatusBadRequest)
+			return
+		}
+		if seen[l.LineID] {
+			http.Error(w, "Each line can only be listed once", http.StatusBadRequest)
+			return
+		}
+		if l.ExpiresAt != "" {
+			if _, err := time.Parse(time.DateOnly, l.ExpiresAt); err != nil {
+				http.Error(w, "expiresAt must be YYYY-MM-DD", http.StatusBadRequest)
+				return
+			}
+		}
+		seen[l.LineID] = true
+	}
+
+	var actorID *int
+	if claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims); ok {
+		actorID = &claims.UserID
+	}
+	if err := repository.ReceivePurchaseOrder(id, req.Lines, actorID); err != nil {
+		writePurchaseOrderError(w, err, "Failed to receive purchase order")
+		return
+	}
+
+	details := make([]string, len(req.Lines))
+	for i, l := range req.Lines {
+		details[i] = fmt.Sprintf("line%d=%d", l.LineID, l.Quantity)
+	}
+	if len(details) == 0 {
+		details = []string{"all"}
+	}
+	recordAudit(r, "purchase_order.received", nil,
+		fmt.Sprintf("id=%d %s", id, strings.Join(details, " ")))
+	writePurchaseOrder(w, id, http.StatusOK)
+}
+
+// CancelPurchaseOrder handles POST /api/admin/purchase-orders/{id}/cancel
+func CancelPurchaseOrder(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid purchase order ID", http.StatusBadRequest)
+		return
+	}
+
+	if err := repository.CancelPurchaseOrder(id); err != nil {
+		writePurchaseOrderError(w, err, "Failed to cancel purchase order")
+		return
+	}
+
+	recordAudit(r, "purchase_order.cancelled", nil, fmt.Sprintf("id=%d", id))
+	writePurchaseOrder(w, id, http.StatusOK)
+}
+
+// decodePurchaseOrder reads and validates a purchase order from the
+// request body
+func decodePurchaseOrder(w http.ResponseWriter, r *http.Request) (*models.PurchaseOrder, bool) {
+	var po models.PurchaseOrder
+	if err := json.NewDecoder(r.Body).Decode(&po); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	if po.SupplierID == nil {
+		http.Error(w, "supplierId is required", http.StatusBadRequest)
+		return nil, false
+	}
+	if problem := checkSupplier(*po.SupplierID); problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return nil, false
+	}
+	po.ExpectedDate = strings.TrimSpace(po.ExpectedDate)
+	if po.ExpectedDate != "" {
+		if _, err := time.Parse(time.DateOnly, po.ExpectedDate); err != nil {
+			http.Error(w, "expectedDate must be YYYY-MM-DD", http.StatusBadRequest)
+			return nil, false
+		}
+	}
+	if len(po.Notes) > maxSupplierNoteLength {
+		http.Error(w, fmt.Sprintf("notes must be at most %d characters",
+			maxSupplierNoteLength), http.StatusBadRequest)
+		return nil, false
+	}
+
+	if len(po.Lines) == 0 || len(po.Lines) > maxPurchaseOrderLines {
+		http.Error(w, fmt.Sprintf("A purchase order needs 1 to %d lines",
+			maxPurchaseOrderLines), http.StatusBadRequest)
+		return nil, false
+	}
+	seen := map[int]bool{}
+	for i := range po.Lines {
+		l := &po.Lines[i]
+		if l.Quantity <= 0 {
+			http.Error(w, "Quantities must be positive", http.StatusBadRequest)
+			return nil, false
+		}
+		if l.UnitCost < 0 {
+			http.Error(w, "Unit costs cannot be negative", http.StatusBadRequest)
+			return nil, false
+		}
+		if seen[l.ProductID] {
+			http.Error(w, "Each product can only be on one line", http.StatusBadRequest)
+			return nil, false
+		}
+		seen[l.ProductID] = true
+		if _, err := repository.FetchProductByID(l.ProductID); err != nil {
+			http.Error(w, fmt.Sprintf("Unknown product %d", l.ProductID),
+				http.StatusBadRequest)
+			return nil, false
+		}
+		l.ReceivedQuantity = 0
+	}
+	return &po, true
+}
+
+// checkSupplier describes why a supplier cannot take new orders, or
+// returns "" when it can
+func checkSupplier(id int) string {
+	s, err := repository.GetSupplier(id)
+	if err != nil {
+		return fmt.Sprintf("Unknown supplier %d", id)
+	}
+	if !s.Active {
+		return fmt.Sprintf("Supplier %q is inactive", s.Name)
+	}
+	return ""
+}
+
+// writePurchaseOrder responds with a purchase order as stored
+func writePurchaseOrder(w http.ResponseWriter, id, status int) {
+	po, err := repository.GetPurchaseOrder(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Purchase order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch purchase order", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(po)
+}
+
+// writePurchaseOrderError maps purchase order errors to responses
+func writePurchaseOrderError(w http.ResponseWriter, err error, message string) {
+	switch err {
+	case sql.ErrNoRows:
+		http.Error(w, "Purchase order not found", http.StatusNotFound)
+	case repository.ErrPurchaseOrderStatus:
+		http.Error(w, "The purchase order's status does not allow this",
+			http.StatusConflict)
+	case repository.ErrOverReceipt:
+		http.Error(w, "Cannot receive more than is outstanding on a line",
+			http.StatusBadRequest)
+	case repository.ErrUnknownPurchaseOrderLine:
+		http.Error(w, "A line is not on this purchase order", http.StatusBadRequest)
+	case repository.ErrStockLocked:
+		http.Error(w, "A product is in an open stock count", http.StatusConflict)
+	default:
+		slog.Error("purchase order change failed", "error", err)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
@@ -0,0 +1,193 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"restaurant-backend/internal/mailer"
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/receipt"
+	"restaurant-backend/internal/repository"
+)
+
+// MailTimeout bounds sending one email
+const MailTimeout = 30 * time.Second
+
+// outbox sends email, see SetMailer. It is nil when no mailer is set up.
+var outbox mailer.Mailer
+
+// SetMailer sets the mailer used for emailing receipts, temporary
+// passwords and account email
+func SetMailer(m mailer.Mailer) {
+	outbox = m
+}
+
+// Mailer returns the mailer set by SetMailer, nil when none is set up
+func Mailer() mailer.Mailer {
+	return outbox
+}
+
+// orderReceipt loads the receipt for the order in the URL, writing an
+// error and returning nil unless the caller placed the order or is an admin
+func orderReceipt(w http.ResponseWriter, r *http.Request) (*receipt.Receipt, *models.Claims) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return nil, nil
+	}
+	claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, nil
+	}
+
+	order, err := repository.GetOrderByID(id)
+	// Other customers' orders are reported as missing rather than forbidden
+	if err == sql.ErrNoRows || (err == nil && order.UserID != claims.UserID &&
+		claims.Role != "admin") {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return nil, nil
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch order", http.StatusInternalServerError)
+		return nil, nil
+	}
+
+	pi, err := repository.GetPaymentIntentByOrderID(order.ID)
+	if err == sql.ErrNoRows {
+		pi = nil
+	} else if err != nil {
+		http.Error(w, "Failed to fetch payment", http.StatusInternalServerError)
+		return nil, nil
+	}
+	refunds, err := repository.FetchRefundsByOrderID(order.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch refunds", http.StatusInternalServerError)
+		return nil, nil
+	}
+
+	return &receipt.Receipt{
+		Branding: receipt.Settings,
+		Order:    order,
+		Payment:  pi,
+		Refunds:  refunds,
+	}, claims
+}
+
+// GetReceipt handles GET /api/orders/{id}/receipt?format=pdf|text. The PDF
+// is the default; text is sized for 80mm receipt printers.
+func GetReceipt(w http.ResponseWriter, r *http.Request) {
+	format := r.URL.Query().Get("format")
+	if format == "" {
+		format = "pdf"
+	}
+	if format != "pdf" && format != "text" {
+		http.Error(w, "format must be pdf or text", http.StatusBadRequest)
+		return
+	}
+
+	rec, _ := orderReceipt(w, r)
+	if rec == nil {
+		return
+	}
+
+	name := fmt.Sprintf("receipt-%d", rec.Order.ID)
+	if format == "text" {
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Header().Set("Content-Disposition", `inline; filename="`+name+`.txt"`)
+		w.Write([]byte(rec.Text()))
+		return
+	}
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", `inline; filename="`+name+`.pdf"`)
+	w.Write(rec.PDF())
+}
+
+// EmailReceipt handles POST /api/orders/{id}/receipt/email. Customers can
+// only send to the email on their account; admins may give another
+// address, which guest orders need.
+func EmailReceipt(w http.ResponseWriter, r *http.Request) {
+	var req struct {
+		Email string `json:"email"`
+	}
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	req.Email = strings.TrimSpace(req.Email)
+
+	if outbox == nil {
+		http.Error(w, "Email is not configured", http.StatusServiceUnavailable)
+		return
+	}
+
+	rec, claims := orderReceipt(w, r)
+	if rec == nil {
+		return
+	}
+
+	to := req.Email
+	if to == "" || claims.Role != "admin" {
+		var account string
+		if rec.Order.UserID > 0 {
+			user, err := repository.GetUserByID(rec.Order.UserID)
+			if err != nil && err != sql.ErrNoRows {
+				http.Error(w, "Failed to fetch user", http.StatusInternalServerError)
+				return
+			}
+			if user != nil {
+				account = user.Email
+			}
+		}
+		if req.Email != "" && !strings.EqualFold(req.Email, account) {
+			http.Error(w, "Receipts can only be sent to your account email",
+				http.StatusForbidden)
+			return
+		}
+		to = account
+	}
+	if to == "" {
+		http.Error(w, "email is required for this order", http.StatusBadRequest)
+		return
+	}
+
+	id := rec.Order.ID
+	ctx, cancel := context.WithTimeout(r.Context(), MailTimeout)
+	defer cancel()
+	err := outbox.Send(ctx, mailer.Message{
+		To:      to,
+		Subject: fmt.Sprintf("Your receipt from %s (order #%d)", rec.Branding.Name, id),
+		Text:    rec.Text(),
+		Attachments: []mailer.Attachment{{
+			Filename:    fmt.Sprintf("receipt-%d.pdf", id),
+			ContentType: "application/pdf",
+			Data:        rec.PDF(),
+		}},
+	})
+	if errors.Is(err, mailer.ErrInvalidAddress) {
+		http.Error(w, "Invalid email address", http.StatusBadRequest)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to email receipt", "order_id", id, "error", err)
+		http.Error(w, "Failed to send email", http.StatusBadGateway)
+		return
+	}
+
+	recordAudit(r, "receipt.emailed", nil, fmt.Sprintf("order=%d to=%s", id, to))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"sentTo": to})
+}
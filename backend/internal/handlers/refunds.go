@@ -0,0 +1,349 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"restaurant-backend/internal/loyalty"
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/payments"
+	"restaurant-backend/internal/pricing"
+	"restaurant-backend/internal/repository"
+)
+
+// maxRefundNoteLength limits the free-text note on a refund
+const maxRefundNoteLength = 500
+
+// refundReasons are the accepted refund reason codes; "other" needs a note
+var refundReasons = map[string]bool{
+	"customer_request": true,
+	"wrong_item":       true,
+	"quality_issue":    true,
+	"late_delivery":    true,
+	"duplicate_order":  true,
+	"other":            true,
+}
+
+// refundLines works out what a refund request returns. Line amounts are
+// the items' prices less their share of the order's discounts, with tax.
+// With no lines everything not yet refunded is returned. full reports
+// whether nothing will be left to refund afterwards.
+func refundLines(order *models.Order, req []models.RefundLine) (lines []models.RefundLine, amount float64, full bool, problem string) {
+	var subtotal, purchased float64
+	items := make(map[int]models.OrderItem, len(order.Items))
+	for _, item := range order.Items {
+		subtotal += item.UnitPrice * float64(item.Quantity)
+		items[item.ID] = item
+	}
+	for _, p := range order.GiftCardPurchases {
+		purchased += p.Amount
+	}
+	// Gift cards bought with the order are not refunded here. Lines refund
+	// food; the tip and service charge only go back with a full refund.
+	extras := order.TipAmount + order.ServiceCharge
+	foodTotal := order.TotalPrice - purchased - extras
+	remaining := pricing.Round(foodTotal + extras - order.RefundedAmount)
+	ratio := 0.0
+	if subtotal > 0 {
+		ratio = foodTotal / subtotal
+	}
+
+	if len(req) == 0 {
+		for _, item := range order.Items {
+			if left := item.Quantity - item.RefundedQuantity; left > 0 {
+				req = append(req, models.RefundLine{OrderItemID: item.ID, Quantity: left})
+			}
+		}
+		if len(req) == 0 {
+			return nil, 0, false, "Nothing is left to refund on this order"
+		}
+	}
+
+	refunding := map[int]int{}
+	for _, l := range req {
+		item, ok := items[l.OrderItemID]
+		if !ok {
+			return nil, 0, false, fmt.Sprintf("Order item %d is not on this order",
+				l.OrderItemID)
+		}
+		if l.Quantity <= 0 {
+			return nil, 0, false, "Refund quantities must be positive"
+		}
+		if _, dup := refunding[item.ID]; dup {
+			return nil, 0, false, fmt.Sprintf("Order item %d is listed twice", item.ID)
+		}
+		if l.Quantity > item.Quantity-item.RefundedQuantity {
+			return nil, 0, false, fmt.Sprintf(
+				"Only %d of order item %d can still be refunded",
+				item.Quantity-item.RefundedQuantity, item.ID)
+		}
+		refunding[item.ID] = l.Quantity
+
+		// Items store what the line cost after discounts and with tax;
+		// older items share out the order total instead
+		lineAmount := pricing.Round(item.UnitPrice * float64(l.Quantity) * ratio)
+		if item.Taxable > 0 || item.TaxAmount > 0 {
+			lineAmount = pricing.Round((item.Taxable + item.TaxAmount) *
+				float64(l.Quantity) / float64(item.Quantity))
+		}
+		lines = append(lines, models.RefundLine{
+			OrderItemID: item.ID,
+			ProductID:   item.ProductID,
+			Quantity:    l.Quantity,
+			Amount:      lineAmount,
+		})
+		amount += lineAmount
+	}
+
+	full = true
+	for _, item := range order.Items {
+		if item.Quantity-item.RefundedQuantity > refunding[item.ID] {
+			full = false
+			break
+		}
+	}
+	// The last refund takes whatever is left so rounding never strands
+	// or overshoots a cent
+	if full {
+		amount = remaining
+	} else if amount > remaining-extras {
+		amount = remaining - extras
+	}
+	return lines, pricing.Round(max(amount, 0)), full, ""
+}
+
+// CreateRefund handles POST /api/orders/{id}/refunds. The money goes back
+// to the card first, then to the gift cards that paid for the order; what
+// neither covers, such as older orders taken before card payments, is
+// recorded as returned outside the system. The refund is stored before the
+// card is refunded, and a card refund that fails can be retried with
+// RetryRefund.
+func CreateRefund(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.RefundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	req.Note = strings.TrimSpace(req.Note)
+	if !refundReasons[req.Reason] {
+		http.Error(w, "reason must be one of customer_request, wrong_item, "+
+			"quality_issue, late_delivery, duplicate_order or other",
+			http.StatusBadRequest)
+		return
+	}
+	if req.Reason == "other" && req.Note == "" {
+		http.Error(w, "A note is required when the reason is other",
+			http.StatusBadRequest)
+		return
+	}
+	if len(req.Note) > maxRefundNoteLength {
+		http.Error(w, fmt.Sprintf("note must be at most %d characters",
+			maxRefundNoteLength), http.StatusBadRequest)
+		return
+	}
+
+	order, err := repository.GetOrderByID(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Order not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch order", http.StatusInternalServerError)
+		return
+	}
+	if order.Status != "completed" {
+		http.Error(w, "Only completed orders can be refunded", http.StatusConflict)
+		return
+	}
+
+	lines, amount, full, problem := refundLines(order, req.Lines)
+	if problem != "" {
+		http.Error(w, problem, http.StatusBadRequest)
+		return
+	}
+
+	claims, _ := r.Context().Value(models.UserContextKey).(*models.Claims)
+	refund := &models.Refund{
+		OrderID:   order.ID,
+		Amount:    amount,
+		Reason:    req.Reason,
+		Note:      req.Note,
+		Restocked: req.Restock,
+		Full:      full,
+		Lines:     lines,
+		ActorID:   &claims.UserID,
+	}
+
+	pi, err := repository.GetPaymentIntentByOrderID(order.ID)
+	if err != nil && err != sql.ErrNoRows {
+		http.Error(w, "Failed to fetch payment", http.StatusInternalServerError)
+		return
+	}
+	giftCards, err := repository.FetchRefundableGiftCardPayments(order.ID)
+	if err != nil {
+		http.Error(w, "Failed to fetch gift card payments",
+			http.StatusInternalServerError)
+		return
+	}
+
+	left := amount
+	if pi != nil && (pi.Status == string(payments.StatusCaptured) ||
+		pi.Status == string(payments.StatusPartiallyRefunded)) {
+		refund.PaymentAmount = pricing.Round(min(left,
+			pi.CapturedAmount-pi.RefundedAmount))
+		left = pricing.Round(left - refund.PaymentAmount)
+	}
+	var giftCardRefunds []models.OrderTender
+	for _, t := range giftCards {
+		if left <= 0 {
+			break
+		}
+		t.Amount = pricing.Round(min(left, t.Amount))
+		giftCardRefunds = append(giftCardRefunds, t)
+		refund.GiftCardAmount = pricing.Round(refund.GiftCardAmount + t.Amount)
+		left = pricing.Round(left - t.Amount)
+	}
+	refund.ExternalAmount = max(left, 0)
+
+	if err := repository.CreateRefund(refund, giftCardRefunds,
+		loyalty.Settings.ExpiryDays); err != nil {
+		switch err {
+		case repository.ErrOrderNotRefundable:
+			http.Error(w, "Only completed orders can be refunded",
+				http.StatusConflict)
+		case repository.ErrRefundExceedsOrder:
+			http.Error(w, "The order was refunded in the meantime",
+				http.StatusConflict)
+		default:
+			slog.Error("failed to record refund", "error", err, "order", order.ID)
+			http.Error(w, "Failed to record refund", http.StatusInternalServerError)
+		}
+		return
+	}
+
+	var target *int
+	if order.UserID > 0 {
+		target = &order.UserID
+	}
+	recordAudit(r, "order.refunded", target, fmt.Sprintf(
+		"id=%d refund=%d amount=%.2f reason=%s restock=%t", order.ID, refund.ID,
+		refund.Amount, refund.Reason, refund.Restocked))
+
+	if err := refundCard(r, pi, refund); err != nil {
+		writeRefundPaymentError(w, err, refund)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(refund)
+}
+
+// RetryRefund handles POST /api/orders/{id}/refunds/{refundId}/retry,
+// sending the card part of a refund to the provider again after it failed
+func RetryRefund(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+	refundID, err := strconv.Atoi(vars["refundId"])
+	if err != nil {
+		http.Error(w, "Invalid refund ID", http.StatusBadRequest)
+		return
+	}
+
+	refund, err := repository.RetryRefundPayment(id, refundID)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		http.Error(w, "Refund not found", http.StatusNotFound)
+		return
+	case repository.ErrRefundPaymentStatus:
+		http.Error(w, "Only failed card refunds can be retried", http.StatusConflict)
+		return
+	default:
+		http.Error(w, "Failed to fetch refund", http.StatusInternalServerError)
+		return
+	}
+	pi, err := repository.GetPaymentIntentByOrderID(id)
+	if err != nil {
+		repository.SetRefundPaymentStatus(refund.ID, repository.RefundPaymentFailed)
+		http.Error(w, "Failed to fetch payment", http.StatusInternalServerError)
+		return
+	}
+
+	if err := refundCard(r, pi, refund); err != nil {
+		writeRefundPaymentError(w, err, refund)
+		return
+	}
+	recordAudit(r, "order.refund_retried", nil, fmt.Sprintf(
+		"id=%d refund=%d amount=%.2f", id, refund.ID, refund.PaymentAmount))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(refund)
+}
+
+// refundCard sends the pending card part of a stored refund to the
+// provider, keyed by the refund so it is never refunded twice, and records
+// whether it went through
+func refundCard(r *http.Request, pi *models.PaymentIntent, refund *models.Refund) error {
+	if refund.PaymentStatus != repository.RefundPaymentPending {
+		return nil
+	}
+	err := refundPayment(r.Context(), pi, refund.PaymentAmount,
+		fmt.Sprintf("refund-%d", refund.ID))
+	refund.PaymentStatus = repository.RefundPaymentSucceeded
+	if err != nil {
+		refund.PaymentStatus = repository.RefundPaymentFailed
+	}
+	if serr := repository.SetRefundPaymentStatus(refund.ID,
+		refund.PaymentStatus); serr != nil {
+		slog.Error("failed to record refund payment status", "error", serr,
+			"refund", refund.ID, "status", refund.PaymentStatus)
+	}
+	return err
+}
+
+// writeRefundPaymentError reports a card refund that failed after its
+// refund was stored
+func writeRefundPaymentError(w http.ResponseWriter, err error, refund *models.Refund) {
+	slog.Error("failed to refund payment", "error", err, "order", refund.OrderID,
+		"refund", refund.ID)
+	http.Error(w, fmt.Sprintf("Refund #%d was recorded but the card could not "+
+		"be refunded; retry it with POST /api/orders/%d/refunds/%d/retry",
+		refund.ID, refund.OrderID, refund.ID), http.StatusBadGateway)
+}
+
+// ListRefunds handles GET /api/orders/{id}/refunds
+func ListRefunds(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid order ID", http.StatusBadRequest)
+		return
+	}
+
+	refunds, err := repository.FetchRefundsByOrderID(id)
+	if err != nil {
+		http.Error(w, "Failed to fetch refunds", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(refunds)
+}
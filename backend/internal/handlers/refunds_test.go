@@ -0,0 +1,184 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+// asAdmin calls handler as the admin, with vars as the route's variables
+func asAdmin(handler http.HandlerFunc, method, body string, vars map[string]string) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, "/", strings.NewReader(body))
+	req = req.WithContext(context.WithValue(req.Context(), models.UserContextKey,
+		&models.Claims{UserID: 1, Email: "admin@admin.com", Role: "admin"}))
+	w := httptest.NewRecorder()
+	handler(w, mux.SetURLVars(req, vars))
+	return w
+}
+
+func TestRefundLines(t *testing.T) {
+	// Two of A at 11 with tax, one of B at 5.5, a 3 tip and a 25 gift card
+	order := &models.Order{
+		Items: []models.OrderItem{
+			{ID: 1, ProductID: 1, Quantity: 2, UnitPrice: 10, Taxable: 20, TaxAmount: 2},
+			{ID: 2, ProductID: 2, Quantity: 1, UnitPrice: 5, Taxable: 5, TaxAmount: 0.5},
+		},
+		TipAmount:         3,
+		TotalPrice:        55.5,
+		GiftCardPurchases: []models.GiftCardPurchase{{Amount: 25}},
+	}
+	line := func(id, quantity int) models.RefundLine {
+		return models.RefundLine{OrderItemID: id, Quantity: quantity}
+	}
+
+	tests := []struct {
+		name        string
+		refunded    [2]int // already refunded of each item
+		refundedAmt float64
+		lines       []models.RefundLine
+		wantAmount  float64
+		wantFull    bool
+		wantProblem bool
+	}{
+		{name: "one item", lines: []models.RefundLine{line(1, 1)}, wantAmount: 11},
+		{name: "everything listed", lines: []models.RefundLine{line(1, 2), line(2, 1)},
+			wantAmount: 30.5, wantFull: true},
+		{name: "everything by default", wantAmount: 30.5, wantFull: true},
+		{name: "the rest", refunded: [2]int{1, 0}, refundedAmt: 11,
+			wantAmount: 19.5, wantFull: true},
+		{name: "more than is left", refunded: [2]int{1, 0}, refundedAmt: 11,
+			lines: []models.RefundLine{line(1, 2)}, wantProblem: true},
+		{name: "nothing left", refunded: [2]int{2, 1}, refundedAmt: 30.5,
+			wantProblem: true},
+		{name: "not on the order", lines: []models.RefundLine{line(9, 1)},
+			wantProblem: true},
+		{name: "listed twice", lines: []models.RefundLine{line(1, 1), line(1, 1)},
+			wantProblem: true},
+		{name: "no quantity", lines: []models.RefundLine{line(2, 0)},
+			wantProblem: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			o := *order
+			o.Items = append([]models.OrderItem(nil), order.Items...)
+			o.Items[0].RefundedQuantity, o.Items[1].RefundedQuantity = tt.refunded[0],
+				tt.refunded[1]
+			o.RefundedAmount = tt.refundedAmt
+
+			lines, amount, full, problem := refundLines(&o, tt.lines)
+			if tt.wantProblem {
+				if problem == "" {
+					t.Errorf("refunded %v (%v), want a problem", amount, lines)
+				}
+				return
+			}
+			if problem != "" {
+				t.Fatal(problem)
+			}
+			if amount != tt.wantAmount || full != tt.wantFull {
+				t.Errorf("refundLines = %v, full %v; want %v, full %v", amount, full,
+					tt.wantAmount, tt.wantFull)
+			}
+		})
+	}
+}
+
+func TestCreateRefund(t *testing.T) {
+	withProvider(t)
+	p := testProduct(t, models.CategoryWestern, 10, 10)
+
+	w := postOrder(t, `{"items":[{"productId":`+strconv.Itoa(p.ID)+`,"quantity":3}],
+		"tip":{"type":"fixed","value":2},"paymentMethod":"pm_card_visa"}`)
+	if w.Code != http.StatusCreated {
+		t.Fatalf("placing the order: %d %s", w.Code, w.Body)
+	}
+	var order models.Order
+	if err := json.NewDecoder(w.Body).Decode(&order); err != nil {
+		t.Fatal(err)
+	}
+	vars := map[string]string{"id": strconv.Itoa(order.ID)}
+
+	refund := func(body string) (*models.Refund, int) {
+		t.Helper()
+		w := asAdmin(CreateRefund, http.MethodPost, body, vars)
+		if w.Code != http.StatusCreated {
+			return nil, w.Code
+		}
+		var r models.Refund
+		if err := json.NewDecoder(w.Body).Decode(&r); err != nil {
+			t.Fatal(err)
+		}
+		return &r, w.Code
+	}
+
+	if _, code := refund(`{"reason":"customer_request"}`); code != http.StatusConflict {
+		t.Errorf("refunding a pending order: status %d, want %d", code,
+			http.StatusConflict)
+	}
+	if w := asAdmin(UpdateOrderStatus, http.MethodPut, `{"status":"completed"}`,
+		vars); w.Code != http.StatusOK {
+		t.Fatalf("completing the order: %d %s", w.Code, w.Body)
+	}
+
+	line := `{"orderItemId":` + strconv.Itoa(order.Items[0].ID) + `,"quantity":1}`
+	if _, code := refund(`{"lines":[` + line + `],"reason":"other"}`); code !=
+		http.StatusBadRequest {
+		t.Errorf("other without a note: status %d, want %d", code,
+			http.StatusBadRequest)
+	}
+
+	first, code := refund(`{"lines":[` + line + `],"reason":"quality_issue","restock":true}`)
+	if first == nil {
+		t.Fatalf("partial refund: status %d", code)
+	}
+	perItem := (order.TotalPrice - order.TipAmount) / 3
+	if first.Full || first.Amount != perItem || first.PaymentAmount != first.Amount ||
+		first.PaymentStatus != repository.RefundPaymentSucceeded {
+		t.Errorf("partial refund = %+v, want %v back on the card", first, perItem)
+	}
+	if got := stockOf(t, p.ID); got != 8 {
+		t.Errorf("stock after restocking one = %d, want 8", got)
+	}
+
+	rest, code := refund(`{"reason":"late_delivery"}`)
+	if rest == nil {
+		t.Fatalf("full refund: status %d", code)
+	}
+	if !rest.Full || rest.Amount+first.Amount != order.TotalPrice {
+		t.Errorf("refunded %v and %v of %v", first.Amount, rest.Amount,
+			order.TotalPrice)
+	}
+	if got := stockOf(t, p.ID); got != 8 {
+		t.Errorf("stock after refunding without restocking = %d, want 8", got)
+	}
+
+	stored, err := repository.GetOrderByID(order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored.Status != "refunded" || stored.RefundedAmount != order.TotalPrice {
+		t.Errorf("order is %s with %v refunded, want refunded with %v",
+			stored.Status, stored.RefundedAmount, order.TotalPrice)
+	}
+	pi, err := repository.GetPaymentIntentByOrderID(order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pi.Status != "refunded" || pi.RefundedAmount != order.TotalPrice {
+		t.Errorf("payment is %s with %v refunded, want refunded with %v", pi.Status,
+			pi.RefundedAmount, order.TotalPrice)
+	}
+	if _, code := refund(`{"reason":"customer_request"}`); code != http.StatusConflict {
+		t.Errorf("refunding a refunded order: status %d, want %d", code,
+			http.StatusConflict)
+	}
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+// maxStockNoteLength limits the note on a stock adjustment
+const maxStockNoteLength = 500
+
+// stockMovementReasons are the reasons stock moves for. Sales and receipts
+// only come from orders and purchase orders.
+var stockMovementReasons = map[string]bool{
+	"sale": true, "receipt": true, "adjustment": true, "waste": true,
+	"return": true,
+}
+
+// GetStockMovements handles GET /api/products/{id}/stock-movements?reason=&limit=,
+// a product's stock history, newest first
+func GetStockMovements(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+	reason := r.URL.Query().Get("reason")
+	if reason != "" && !stockMovementReasons[reason] {
+		http.Error(w, "reason must be sale, receipt, adjustment, waste or return",
+			http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = min(l, 1000)
+	}
+
+	if _, err := repository.FetchProductByID(id); err != nil {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+
+	movements, err := repository.FetchStockMovements(id, reason, limit)
+	if err != nil {
+		http.Error(w, "Failed to fetch stock movements", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(movements)
+}
+
+// AdjustStock handles POST /api/products/{id}/stock-adjustments, changing a
+// product's stock by hand. The reason is adjustment, waste or return and a
+// note explaining the change is required.
+func AdjustStock(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid product ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.StockAdjustmentRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	if req.Reason == "" {
+		req.Reason = "adjustment"
+	}
+	switch {
+	case req.Reason != "adjustment" && req.Reason != "waste" && req.Reason != "return":
+		http.Error(w, "reason must be adjustment, waste or return",
+			http.StatusBadRequest)
+		return
+	case req.Quantity == 0 || req.Note == "":
+		http.Error(w, "A quantity and a note are required", http.StatusBadRequest)
+		return
+	case len(req.Note) > maxStockNoteLength:
+		http.Error(w, fmt.Sprintf("Note must be at most %d characters",
+			maxStockNoteLength), http.StatusBadRequest)
+		return
+	case req.ExpiresAt != "" && req.Quantity < 0:
+		http.Error(w, "expiresAt is only for stock added", http.StatusBadRequest)
+		return
+	}
+	if req.ExpiresAt != "" {
+		if _, err := time.Parse(time.DateOnly, req.ExpiresAt); err != nil {
+			http.Error(w, "expiresAt must be YYYY-MM-DD", http.StatusBadRequest)
+			return
+		}
+	}
+
+	movement := models.StockMovement{
+		ProductID: id,
+		Quantity:  req.Quantity,
+		Reason:    req.Reason,
+		Note:      req.Note,
+	}
+	if req.ExpiresAt != "" {
+		movement.Lot = &models.StockLot{ExpiresAt: req.ExpiresAt}
+	}
+	if claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims); ok {
+		movement.ActorID = &claims.UserID
+	}
+	err = repository.AdjustStock(&movement)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Product not found", http.StatusNotFound)
+		return
+	}
+	if err == repository.ErrStockBelowZero {
+		http.Error(w, "Stock cannot go below zero", http.StatusConflict)
+		return
+	}
+	if err == repository.ErrStockLocked {
+		http.Error(w, "The product is in an open stock count", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to adjust stock", "error", err, "product", id)
+		http.Error(w, "Failed to adjust stock", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "stock.adjusted", nil, fmt.Sprintf(
+		"product=%d quantity=%d balance=%d reason=%s note=%s", id,
+		movement.Quantity, movement.Balance, movement.Reason, movement.Note))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(movement)
+}
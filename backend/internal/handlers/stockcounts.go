@@ -0,0 +1,247 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+// maxStockCountProducts limits the products listed when opening a stock
+// count
+const maxStockCountProducts = 1000
+
+// ListStockCounts handles GET /api/admin/stock-counts?status=, newest first
+func ListStockCounts(w http.ResponseWriter, r *http.Request) {
+	status := r.URL.Query().Get("status")
+	if status != "" && status != "open" && status != "posted" &&
+		status != "cancelled" {
+		http.Error(w, "status must be open, posted or cancelled",
+			http.StatusBadRequest)
+		return
+	}
+
+	counts, err := repository.FetchStockCounts(status)
+	if err != nil {
+		http.Error(w, "Failed to fetch stock counts", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(counts)
+}
+
+// CreateStockCount handles POST /api/admin/stock-counts, opening a count
+// of some products, a category or everything. Its products are locked
+// against stock changes until it is posted or cancelled.
+func CreateStockCount(w http.ResponseWriter, r *http.Request) {
+	var req models.StockCountRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Note = strings.TrimSpace(req.Note)
+	req.Category = strings.TrimSpace(req.Category)
+	if len(req.Note) > maxStockNoteLength {
+		http.Error(w, fmt.Sprintf("note must be at most %d characters",
+			maxStockNoteLength), http.StatusBadRequest)
+		return
+	}
+	if len(req.ProductIDs) > maxStockCountProducts {
+		http.Error(w, fmt.Sprintf("At most %d products can be listed",
+			maxStockCountProducts), http.StatusBadRequest)
+		return
+	}
+	if len(req.ProductIDs) > 0 && req.Category != "" {
+		http.Error(w, "Give productIds or a category, not both", http.StatusBadRequest)
+		return
+	}
+	seen := map[int]bool{}
+	for _, id := range req.ProductIDs {
+		if seen[id] {
+			http.Error(w, fmt.Sprintf("Product %d is listed twice", id),
+				http.StatusBadRequest)
+			return
+		}
+		seen[id] = true
+	}
+
+	count := models.StockCount{Note: req.Note}
+	if claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims); ok {
+		count.CreatedBy = &claims.UserID
+	}
+	err := repository.CreateStockCount(&count, req.ProductIDs, req.Category)
+	switch err {
+	case nil:
+	case sql.ErrNoRows:
+		http.Error(w, "A product was not found", http.StatusBadRequest)
+		return
+	case repository.ErrEmptyStockCount:
+		http.Error(w, "There are no products to count", http.StatusBadRequest)
+		return
+	case repository.ErrStockLocked:
+		http.Error(w, "A product is already in an open stock count",
+			http.StatusConflict)
+		return
+	default:
+		slog.Error("failed to open stock count", "error", err)
+		http.Error(w, "Failed to open stock count", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "stock_count.opened", nil, fmt.Sprintf("id=%d", count.ID))
+	writeStockCount(w, count.ID, http.StatusCreated)
+}
+
+// GetStockCount handles GET /api/admin/stock-counts/{id}, the count with
+// each product's counted quantity and variance
+func GetStockCount(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock count ID", http.StatusBadRequest)
+		return
+	}
+	writeStockCount(w, id, http.StatusOK)
+}
+
+// RecordStockCounts handles PUT /api/admin/stock-counts/{id}/lines,
+// setting counted quantities while the count is open. A null
+// countedQuantity clears it.
+func RecordStockCounts(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock count ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.StockCountEntriesRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if len(req.Lines) == 0 {
+		http.Error(w, "At least one line is required", http.StatusBadRequest)
+		return
+	}
+	for _, e := range req.Lines {
+		if e.CountedQuantity != nil && *e.CountedQuantity < 0 {
+			http.Error(w, "Counted quantities cannot be negative",
+				http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := repository.RecordStockCounts(id, req.Lines); err != nil {
+		writeStockCountError(w, err, "Failed to record counts")
+		return
+	}
+	writeStockCount(w, id, http.StatusOK)
+}
+
+// PostStockCount handles POST /api/admin/stock-counts/{id}/post, setting
+// the stock of every counted product to its counted quantity at once. The
+// reason is required and goes on the stock movements.
+func PostStockCount(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock count ID", http.StatusBadRequest)
+		return
+	}
+
+	var req models.StockCountPostRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	if req.Reason == "" {
+		http.Error(w, "A reason is required", http.StatusBadRequest)
+		return
+	}
+	if len(req.Reason) > maxStockNoteLength {
+		http.Error(w, fmt.Sprintf("reason must be at most %d characters",
+			maxStockNoteLength), http.StatusBadRequest)
+		return
+	}
+
+	var actorID *int
+	if claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims); ok {
+		actorID = &claims.UserID
+	}
+	if err := repository.PostStockCount(id, req.Reason, actorID); err != nil {
+		writeStockCountError(w, err, "Failed to post stock count")
+		return
+	}
+
+	count, err := repository.GetStockCount(id)
+	if err != nil {
+		http.Error(w, "Failed to fetch stock count", http.StatusInternalServerError)
+		return
+	}
+	recordAudit(r, "stock_count.posted", nil, fmt.Sprintf(
+		"id=%d counted=%d variance_cost=%.2f reason=%s", id, count.Counted,
+		count.VarianceCost, req.Reason))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(count)
+}
+
+// CancelStockCount handles POST /api/admin/stock-counts/{id}/cancel,
+// closing the count without changing any stock
+func CancelStockCount(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid stock count ID", http.StatusBadRequest)
+		return
+	}
+
+	var actorID *int
+	if claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims); ok {
+		actorID = &claims.UserID
+	}
+	if err := repository.CancelStockCount(id, actorID); err != nil {
+		writeStockCountError(w, err, "Failed to cancel stock count")
+		return
+	}
+
+	recordAudit(r, "stock_count.cancelled", nil, fmt.Sprintf("id=%d", id))
+	writeStockCount(w, id, http.StatusOK)
+}
+
+func writeStockCount(w http.ResponseWriter, id, status int) {
+	count, err := repository.GetStockCount(id)
+	if err == sql.ErrNoRows {
+		http.Error(w, "Stock count not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		http.Error(w, "Failed to fetch stock count", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(count)
+}
+
+func writeStockCountError(w http.ResponseWriter, err error, message string) {
+	switch err {
+	case sql.ErrNoRows:
+		http.Error(w, "Stock count not found", http.StatusNotFound)
+	case repository.ErrStockCountStatus:
+		http.Error(w, "The stock count is no longer open", http.StatusConflict)
+	case repository.ErrUnknownStockCountLine:
+		http.Error(w, "A product is not in this stock count", http.StatusBadRequest)
+	default:
+		slog.Error("stock count change failed", "error", err)
+		http.Error(w, message, http.StatusInternalServerError)
+	}
+}
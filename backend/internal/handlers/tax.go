@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strings"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+	"restaurant-backend/internal/tax"
+)
+
+// maxTaxRate is the highest accepted rate in percent
+const maxTaxRate = 100
+
+// taxRatesResponse is the tax configuration shown to admins
+type taxRatesResponse struct {
+	PricesIncludeTax bool             `json:"pricesIncludeTax"`
+	Rates            []models.TaxRate `json:"rates"`
+}
+
+// GetTaxRates handles GET /api/admin/tax-rates
+func GetTaxRates(w http.ResponseWriter, r *http.Request) {
+	rates, err := repository.FetchTaxRates()
+	if err != nil {
+		http.Error(w, "Failed to fetch tax rates", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(taxRatesResponse{
+		PricesIncludeTax: tax.Settings.PricesIncludeTax,
+		Rates:            rates,
+	})
+}
+
+// UpdateTaxRates handles PUT /api/admin/tax-rates, replacing every rate.
+// A rate with an empty category is the default for other categories.
+func UpdateTaxRates(w http.ResponseWriter, r *http.Request) {
+	var rates []models.TaxRate
+	if err := json.NewDecoder(r.Body).Decode(&rates); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	seen := map[string]bool{}
+	for i := range rates {
+		t := &rates[i]
+		t.Category = strings.TrimSpace(t.Category)
+		t.Name = strings.TrimSpace(t.Name)
+		if seen[t.Category] {
+			http.Error(w, fmt.Sprintf("Category %q has more than one rate",
+				t.Category), http.StatusBadRequest)
+			return
+		}
+		seen[t.Category] = true
+		if t.DineInRate < 0 || t.DineInRate >= maxTaxRate ||
+			t.TakeawayRate < 0 || t.TakeawayRate >= maxTaxRate {
+			http.Error(w, fmt.Sprintf("Rates must be at least 0 and below %d%%",
+				maxTaxRate), http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := repository.ReplaceTaxRates(rates); err != nil {
+		slog.Error("failed to update tax rates", "error", err)
+		http.Error(w, "Failed to update tax rates", http.StatusInternalServerError)
+		return
+	}
+
+	details := make([]string, len(rates))
+	for i, t := range rates {
+		details[i] = fmt.Sprintf("%s=%g/%g", t.Category, t.DineInRate,
+			t.TakeawayRate)
+	}
+	recordAudit(r, "tax_rates.updated", nil, strings.Join(details, " "))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(taxRatesResponse{
+		PricesIncludeTax: tax.Settings.PricesIncludeTax,
+		Rates:            rates,
+	})
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+	"restaurant-backend/internal/tax"
+)
+
+const (
+	// maxServiceChargeRate is the highest service charge in percent
+	maxServiceChargeRate = 50
+	// maxPartySize limits the party size on an order
+	maxPartySize = 100
+	// defaultTipDays and maxTipDays bound the tip summary
+	defaultTipDays = 14
+	maxTipDays     = 366
+)
+
+// GetServiceChargeRules handles GET /api/admin/service-charges
+func GetServiceChargeRules(w http.ResponseWriter, r *http.Request) {
+	rules, err := repository.FetchServiceChargeRules()
+	if err != nil {
+		http.Error(w, "Failed to fetch service charges", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// UpdateServiceChargeRules handles PUT /api/admin/service-charges,
+// replacing every rule
+func UpdateServiceChargeRules(w http.ResponseWriter, r *http.Request) {
+	var rules []models.ServiceChargeRule
+	if err := json.NewDecoder(r.Body).Decode(&rules); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	for i := range rules {
+		rule := &rules[i]
+		rule.Name = strings.TrimSpace(rule.Name)
+		if rule.Name == "" {
+			http.Error(w, "Service charges need a name", http.StatusBadRequest)
+			return
+		}
+		if rule.OrderType != "" && !tax.ValidOrderType(rule.OrderType) {
+			http.Error(w, fmt.Sprintf("orderType must be empty, %s or %s",
+				tax.DineIn, tax.Takeaway), http.StatusBadRequest)
+			return
+		}
+		if rule.Rate <= 0 || rule.Rate > maxServiceChargeRate {
+			http.Error(w, fmt.Sprintf("rate must be above 0 and at most %d%%",
+				maxServiceChargeRate), http.StatusBadRequest)
+			return
+		}
+		if rule.MinPartySize < 0 || rule.MinSubtotal < 0 {
+			http.Error(w, "Minimums cannot be negative", http.StatusBadRequest)
+			return
+		}
+	}
+
+	if err := repository.ReplaceServiceChargeRules(rules); err != nil {
+		slog.Error("failed to update service charges", "error", err)
+		http.Error(w, "Failed to update service charges",
+			http.StatusInternalServerError)
+		return
+	}
+
+	details := make([]string, len(rules))
+	for i, rule := range rules {
+		details[i] = fmt.Sprintf("%q=%g%%", rule.Name, rule.Rate)
+	}
+	recordAudit(r, "service_charges.updated", nil, strings.Join(details, " "))
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(rules)
+}
+
+// GetTipSummary handles GET /api/reports/tips?days=N, the tips on
+// completed orders per day for paying out to staff
+func GetTipSummary(w http.ResponseWriter, r *http.Request) {
+	days := defaultTipDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxTipDays {
+			http.Error(w, fmt.Sprintf("days must be between 1 and %d", maxTipDays),
+				http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	summary, err := repository.FetchTipSummary(days)
+	if err != nil {
+		http.Error(w, "Failed to fetch tip summary", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(summary)
+}
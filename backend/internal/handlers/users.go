@@ -0,0 +1,323 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"database/sql"
+	"encoding/base64"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"strconv"
+
+	"github.com/gorilla/mux"
+	"golang.org/x/crypto/bcrypt"
+
+	"restaurant-backend/internal/mailer"
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+// recordAudit writes an admin action to the audit trail. Failures are logged
+// but never block the action itself.
+func recordAudit(r *http.Request, action string, targetUserID *int, details string) {
+	claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims)
+	if !ok {
+		return
+	}
+
+	entry := &models.AuditEntry{
+		ActorID:      claims.UserID,
+		ActorEmail:   claims.Email,
+		Action:       action,
+		TargetUserID: targetUserID,
+		Details:      details,
+	}
+	if err := repository.InsertAuditEntry(entry); err != nil {
+		slog.Error("failed to write audit entry", "error", err, "action", action)
+	}
+}
+
+// isValidRole checks if the role is one we know about
+func isValidRole(role string) bool {
+	return role == "customer" || role == "admin"
+}
+
+// userIDFromPath parses {id} from the route. Unless allowSelf is set, admins
+// are prevented from acting on their own account.
+func userIDFromPath(w http.ResponseWriter, r *http.Request, allowSelf bool) (int, bool) {
+	id, err := strconv.Atoi(mux.Vars(r)["id"])
+	if err != nil {
+		http.Error(w, "Invalid user ID", http.StatusBadRequest)
+		return 0, false
+	}
+
+	if !allowSelf {
+		claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims)
+		if ok && claims.UserID == id {
+			http.Error(w, "Cannot perform this action on your own account",
+				http.StatusBadRequest)
+			return 0, false
+		}
+	}
+	return id, true
+}
+
+// ListUsers handles GET /api/admin/users?q=&role=
+func ListUsers(w http.ResponseWriter, r *http.Request) {
+	users, err := repository.ListUsers(r.URL.Query().Get("q"),
+		r.URL.Query().Get("role"))
+	if err != nil {
+		http.Error(w, "Failed to fetch users", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(users)
+}
+
+// GetUserDetail handles GET /api/admin/users/{id}
+func GetUserDetail(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDFromPath(w, r, true)
+	if !ok {
+		return
+	}
+
+	user, err := repository.GetUserByID(id)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	user.Password = ""
+
+	orders, err := repository.FetchOrdersByUserID(id)
+	if err != nil {
+		http.Error(w, "Failed to fetch orders", http.StatusInternalServerError)
+		return
+	}
+
+	feedback, err := repository.FetchFeedbackByEmail(user.Email)
+	if err != nil {
+		http.Error(w, "Failed to fetch feedback", http.StatusInternalServerError)
+		return
+	}
+
+	detail := models.UserDetail{User: *user, Orders: orders, Feedback: feedback}
+	if detail.Orders == nil {
+		detail.Orders = []models.Order{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(detail)
+}
+
+// GetUserOrdersAdmin handles GET /api/admin/users/{id}/orders
+func GetUserOrdersAdmin(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDFromPath(w, r, true)
+	if !ok {
+		return
+	}
+
+	orders, err := repository.FetchOrdersByUserID(id)
+	if err != nil {
+		http.Error(w, "Failed to fetch orders", http.StatusInternalServerError)
+		return
+	}
+	if orders == nil {
+		orders = []models.Order{}
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(orders)
+}
+
+// GetUserFeedbackAdmin handles GET /api/admin/users/{id}/feedback
+func GetUserFeedbackAdmin(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDFromPath(w, r, true)
+	if !ok {
+		return
+	}
+
+	user, err := repository.GetUserByID(id)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	feedback, err := repository.FetchFeedbackByEmail(user.Email)
+	if err != nil {
+		http.Error(w, "Failed to fetch feedback", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(feedback)
+}
+
+// UpdateUserRole handles PUT /api/admin/users/{id}/role
+func UpdateUserRole(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDFromPath(w, r, false)
+	if !ok {
+		return
+	}
+
+	var req models.UpdateRoleRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if !isValidRole(req.Role) {
+		http.Error(w, "Role must be 'customer' or 'admin'", http.StatusBadRequest)
+		return
+	}
+
+	if err := repository.UpdateUserRole(id, req.Role); err != nil {
+		writeUserUpdateError(w, err)
+		return
+	}
+
+	recordAudit(r, "user.role_changed", &id, "role="+req.Role)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": "Role updated successfully"})
+}
+
+// DisableUser handles POST /api/admin/users/{id}/disable
+func DisableUser(w http.ResponseWriter, r *http.Request) {
+	setUserDisabled(w, r, true)
+}
+
+// EnableUser handles POST /api/admin/users/{id}/enable
+func EnableUser(w http.ResponseWriter, r *http.Request) {
+	setUserDisabled(w, r, false)
+}
+
+func setUserDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	id, ok := userIDFromPath(w, r, false)
+	if !ok {
+		return
+	}
+
+	if err := repository.SetUserDisabled(id, disabled); err != nil {
+		writeUserUpdateError(w, err)
+		return
+	}
+
+	action, message := "user.enabled", "User enabled successfully"
+	if disabled {
+		action, message = "user.disabled", "User disabled successfully"
+	}
+	recordAudit(r, action, &id, "")
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// ForcePasswordReset handles POST /api/admin/users/{id}/reset-password.
+// The user's password is replaced with a one-time temporary password,
+// emailed to them, which they must change before doing anything else.
+func ForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDFromPath(w, r, false)
+	if !ok {
+		return
+	}
+	if outbox == nil {
+		http.Error(w, "Email is not configured, so no temporary password can be sent",
+			http.StatusServiceUnavailable)
+		return
+	}
+	user, err := repository.GetUserByID(id)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	buf := make([]byte, 12)
+	if _, err := rand.Read(buf); err != nil {
+		http.Error(w, "Failed to generate password", http.StatusInternalServerError)
+		return
+	}
+	tempPassword := base64.RawURLEncoding.EncodeToString(buf)
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(tempPassword), 14)
+	if err != nil {
+		http.Error(w, "Failed to process password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := repository.SetUserPassword(id, string(hash), true); err != nil {
+		writeUserUpdateError(w, err)
+		return
+	}
+	recordAudit(r, "user.password_reset", &id, "")
+
+	ctx, cancel := context.WithTimeout(r.Context(), MailTimeout)
+	defer cancel()
+	err = outbox.Send(ctx, mailer.Message{
+		To:      user.Email,
+		Subject: "Your password has been reset",
+		Text: "An administrator has reset your password. Log in with this " +
+			"temporary password and choose a new one:\n\n" + tempPassword + "\n",
+	})
+	if err != nil {
+		slog.Error("failed to email temporary password", "user_id", id, "error", err)
+		http.Error(w, "The password was reset but the email could not be sent; "+
+			"reset it again", http.StatusBadGateway)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.PasswordResetResponse{SentTo: user.Email})
+}
+
+// DeleteUser handles DELETE /api/admin/users/{id}
+func DeleteUser(w http.ResponseWriter, r *http.Request) {
+	id, ok := userIDFromPath(w, r, false)
+	if !ok {
+		return
+	}
+
+	user, err := repository.GetUserByID(id)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	if err := repository.DeleteUser(id); err != nil {
+		writeUserUpdateError(w, err)
+		return
+	}
+
+	recordAudit(r, "user.deleted", &id, "email="+user.Email)
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// GetAuditLog handles GET /api/admin/audit?userId=&limit=
+func GetAuditLog(w http.ResponseWriter, r *http.Request) {
+	targetUserID, _ := strconv.Atoi(r.URL.Query().Get("userId"))
+
+	limit := 100
+	if l, err := strconv.Atoi(r.URL.Query().Get("limit")); err == nil && l > 0 {
+		limit = min(l, 1000)
+	}
+
+	entries, err := repository.FetchAuditLog(targetUserID, limit)
+	if err != nil {
+		http.Error(w, "Failed to fetch audit log", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+func writeUserUpdateError(w http.ResponseWriter, err error) {
+	if err == sql.ErrNoRows {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	slog.Error("failed to update user", "error", err)
+	http.Error(w, "Failed to update user", http.StatusInternalServerError)
+}
@@ -0,0 +1,206 @@
+package handlers
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+const (
+	// maxWasteNoteLength limits the note on a waste entry
+	maxWasteNoteLength = 500
+	// defaultWasteDays and maxWasteDays bound the waste report
+	defaultWasteDays = 30
+	maxWasteDays     = 366
+)
+
+// wasteReasons are the accepted waste reason codes; "other" needs a note
+var wasteReasons = map[string]bool{
+	"spoiled":           true,
+	"expired":           true,
+	"damaged":           true,
+	"overproduction":    true,
+	"preparation_error": true,
+	"returned":          true,
+	"other":             true,
+}
+
+// RecordWaste handles POST /api/admin/waste, recording a product or an
+// ingredient thrown away and taking it out of stock. Products are taken
+// from lotId if given, and products made from a recipe use up its
+// ingredients.
+func RecordWaste(w http.ResponseWriter, r *http.Request) {
+	var req models.WasteRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	req.Reason = strings.TrimSpace(req.Reason)
+	req.Note = strings.TrimSpace(req.Note)
+	req.PortionSize = strings.TrimSpace(req.PortionSize)
+	switch {
+	case (req.ProductID == nil) == (req.IngredientID == nil):
+		http.Error(w, "Either productId or ingredientId is required",
+			http.StatusBadRequest)
+		return
+	case req.Quantity <= 0:
+		http.Error(w, "Quantity must be positive", http.StatusBadRequest)
+		return
+	case req.ProductID != nil && req.Quantity != math.Trunc(req.Quantity):
+		http.Error(w, "Products are wasted in whole units", http.StatusBadRequest)
+		return
+	case req.IngredientID != nil && (req.PortionSize != "" || req.LotID != nil):
+		http.Error(w, "portionSize and lotId are only for products",
+			http.StatusBadRequest)
+		return
+	case len(req.PortionSize) > 50:
+		http.Error(w, "portionSize must be at most 50 characters",
+			http.StatusBadRequest)
+		return
+	case !wasteReasons[req.Reason]:
+		http.Error(w, "reason must be one of spoiled, expired, damaged, "+
+			"overproduction, preparation_error, returned or other",
+			http.StatusBadRequest)
+		return
+	case req.Reason == "other" && req.Note == "":
+		http.Error(w, "A note is required when the reason is other",
+			http.StatusBadRequest)
+		return
+	case len(req.Note) > maxWasteNoteLength:
+		http.Error(w, fmt.Sprintf("note must be at most %d characters",
+			maxWasteNoteLength), http.StatusBadRequest)
+		return
+	}
+
+	var actorID *int
+	if claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims); ok {
+		actorID = &claims.UserID
+	}
+	if req.StaffID == nil {
+		req.StaffID = actorID
+	} else if staff, err := repository.GetUserByID(*req.StaffID); err != nil ||
+		staff.Role != "admin" {
+		http.Error(w, "staffId must be a staff member", http.StatusBadRequest)
+		return
+	}
+
+	entry := models.WasteEntry{
+		ProductID:    req.ProductID,
+		IngredientID: req.IngredientID,
+		LotID:        req.LotID,
+		PortionSize:  req.PortionSize,
+		Quantity:     req.Quantity,
+		Reason:       req.Reason,
+		Note:         req.Note,
+		StaffID:      req.StaffID,
+		RecordedBy:   actorID,
+	}
+	err := repository.RecordWaste(&entry)
+	if err == sql.ErrNoRows {
+		switch {
+		case req.LotID != nil:
+			http.Error(w, "Lot not found for this product", http.StatusNotFound)
+		case req.ProductID != nil:
+			http.Error(w, "Product not found", http.StatusNotFound)
+		default:
+			http.Error(w, "Ingredient not found", http.StatusNotFound)
+		}
+		return
+	}
+	if err == repository.ErrStockBelowZero {
+		http.Error(w, "There is not that much in stock", http.StatusConflict)
+		return
+	}
+	if err == repository.ErrStockLocked {
+		http.Error(w, "The product is in an open stock count", http.StatusConflict)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to record waste", "error", err)
+		http.Error(w, "Failed to record waste", http.StatusInternalServerError)
+		return
+	}
+
+	recordAudit(r, "waste.recorded", nil, fmt.Sprintf(
+		"id=%d name=%s quantity=%g reason=%s cost=%.2f", entry.ID, entry.Name,
+		entry.Quantity, entry.Reason, entry.Cost))
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(entry)
+}
+
+// ListWaste handles
+// GET /api/admin/waste?productId=&ingredientId=&reason=&limit=, the newest
+// waste entries first
+func ListWaste(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	var productID, ingredientID int
+	for _, f := range []struct {
+		name string
+		dest *int
+	}{{"productId", &productID}, {"ingredientId", &ingredientID}} {
+		v := q.Get(f.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			http.Error(w, "Invalid "+f.name, http.StatusBadRequest)
+			return
+		}
+		*f.dest = n
+	}
+	reason := q.Get("reason")
+	if reason != "" && !wasteReasons[reason] {
+		http.Error(w, "Unknown reason", http.StatusBadRequest)
+		return
+	}
+	limit := 100
+	if l, err := strconv.Atoi(q.Get("limit")); err == nil && l > 0 {
+		limit = min(l, 1000)
+	}
+
+	entries, err := repository.FetchWasteEntries(productID, ingredientID, reason, limit)
+	if err != nil {
+		http.Error(w, "Failed to fetch waste", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(entries)
+}
+
+// GetWasteReport handles GET /api/reports/waste?days=, the cost of waste
+// over the last days days (30 by default) by reason and by product or
+// ingredient, with each as a percent of sales
+func GetWasteReport(w http.ResponseWriter, r *http.Request) {
+	days := defaultWasteDays
+	if v := r.URL.Query().Get("days"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 || n > maxWasteDays {
+			http.Error(w, fmt.Sprintf("days must be between 1 and %d", maxWasteDays),
+				http.StatusBadRequest)
+			return
+		}
+		days = n
+	}
+
+	report, err := repository.FetchWasteReport(days)
+	if err != nil {
+		slog.Error("failed to fetch waste report", "error", err)
+		http.Error(w, "Failed to fetch waste report", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(report)
+}
@@ -0,0 +1,119 @@
+// Package inventory works out when to reorder stock and how much, from how
+// fast it has been selling and how long suppliers take to deliver, and
+// holds the other stock settings.
+package inventory
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+	"time"
+)
+
+// Config is the stock configuration
+type Config struct {
+	WindowDays   int // days of sales the sales rate is taken over
+	SafetyDays   int // extra days of stock kept in case deliveries are late
+	CoverDays    int // days of sales a reorder should last
+	LeadTimeDays int // delivery time for products without a supplier
+	// ExpiryWarningDays is how far ahead the dashboard shows lots expiring
+	ExpiryWarningDays int
+}
+
+// Settings is the active configuration, see LoadConfig
+var Settings = Config{
+	WindowDays:   28,
+	SafetyDays:   3,
+	CoverDays:    14,
+	LeadTimeDays: 7,
+
+	ExpiryWarningDays: 3,
+}
+
+// LoadConfig reads REORDER_WINDOW_DAYS, REORDER_SAFETY_DAYS,
+// REORDER_COVER_DAYS, REORDER_LEAD_TIME_DAYS and STOCK_EXPIRY_WARNING_DAYS,
+// keeping the defaults for unset variables
+func LoadConfig() error {
+	for _, v := range []struct {
+		name string
+		dest *int
+		min  int
+	}{
+		{"REORDER_WINDOW_DAYS", &Settings.WindowDays, 1},
+		{"REORDER_SAFETY_DAYS", &Settings.SafetyDays, 0},
+		{"REORDER_COVER_DAYS", &Settings.CoverDays, 1},
+		{"REORDER_LEAD_TIME_DAYS", &Settings.LeadTimeDays, 0},
+		{"STOCK_EXPIRY_WARNING_DAYS", &Settings.ExpiryWarningDays, 0},
+	} {
+		s := os.Getenv(v.name)
+		if s == "" {
+			continue
+		}
+		n, err := strconv.Atoi(s)
+		if err != nil || n < v.min || n > 365 {
+			return fmt.Errorf("invalid %s %q", v.name, s)
+		}
+		*v.dest = n
+	}
+	return nil
+}
+
+// Stock is what is known about a product when planning a reorder
+type Stock struct {
+	OnHand       int // in stock
+	OnOrder      int // ordered and not yet received
+	Threshold    int // the product's low stock threshold
+	Sold         int // sold over the window
+	WindowDays   int
+	LeadTimeDays int
+}
+
+// Plan is when and how much to reorder
+type Plan struct {
+	DailySales   float64
+	ReorderPoint int // reorder once stock and orders fall to this
+	Quantity     int
+	ReorderDate  time.Time
+	StockoutDate *time.Time // when stock runs out at the current rate
+}
+
+// Reorder plans the next reorder of a product. Stock is reordered when
+// what is in stock and on order falls to the reorder point: the sales
+// expected over the lead time and safety days, and never below the low
+// stock threshold. The quantity brings it up to the reorder point plus
+// CoverDays of sales, and always above the reorder point so that once it
+// is ordered the product is no longer due. The reorder date is when that is expected to
+// happen, which may be today.
+func Reorder(s Stock, now time.Time) Plan {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	var p Plan
+	if s.WindowDays > 0 {
+		p.DailySales = float64(s.Sold) / float64(s.WindowDays)
+	}
+	p.ReorderPoint = max(int(math.Ceil(p.DailySales*
+		float64(s.LeadTimeDays+Settings.SafetyDays))), s.Threshold)
+	target := p.ReorderPoint + max(int(math.Ceil(p.DailySales*
+		float64(Settings.CoverDays))), 1)
+
+	position := s.OnHand + s.OnOrder
+	p.ReorderDate = today
+	if position > p.ReorderPoint {
+		if p.DailySales == 0 {
+			// Nothing is selling, so there is no date to reorder by
+			p.ReorderDate = time.Time{}
+			return p
+		}
+		days := int(float64(position-p.ReorderPoint) / p.DailySales)
+		p.ReorderDate = today.AddDate(0, 0, days)
+		// The quantity is worked out for the stock left by then
+		position = p.ReorderPoint
+	}
+	p.Quantity = target - position
+
+	if p.DailySales > 0 {
+		out := today.AddDate(0, 0, int(float64(s.OnHand)/p.DailySales))
+		p.StockoutDate = &out
+	}
+	return p
+}
@@ -0,0 +1,132 @@
+package inventory
+
+import (
+	"testing"
+	"time"
+)
+
+func TestReorder(t *testing.T) {
+	saved := Settings
+	Settings.SafetyDays, Settings.CoverDays = 3, 14
+	t.Cleanup(func() { Settings = saved })
+
+	now := time.Date(2026, 3, 10, 15, 30, 0, 0, time.UTC)
+	today := time.Date(2026, 3, 10, 0, 0, 0, 0, time.UTC)
+	day := func(n int) time.Time { return today.AddDate(0, 0, n) }
+
+	tests := []struct {
+		name         string
+		stock        Stock
+		reorderPoint int
+		quantity     int
+		reorderDate  time.Time // zero when there is nothing to reorder
+		stockoutDate time.Time // zero when nothing is selling
+	}{
+		{
+			name:         "no sales, above the threshold",
+			stock:        Stock{OnHand: 10, Threshold: 5, WindowDays: 28, LeadTimeDays: 7},
+			reorderPoint: 5,
+		},
+		{
+			name:         "no sales, at the threshold",
+			stock:        Stock{OnHand: 5, Threshold: 5, WindowDays: 28, LeadTimeDays: 7},
+			reorderPoint: 5,
+			quantity:     1,
+			reorderDate:  today,
+		},
+		{
+			name:         "no sales, below the threshold",
+			stock:        Stock{OnHand: 2, Threshold: 5, WindowDays: 28, LeadTimeDays: 7},
+			reorderPoint: 5,
+			quantity:     4,
+			reorderDate:  today,
+		},
+		{
+			name:         "no sales, covered by what is on order",
+			stock:        Stock{OnHand: 0, OnOrder: 6, Threshold: 5, WindowDays: 28, LeadTimeDays: 7},
+			reorderPoint: 5,
+		},
+		{
+			name:         "no sales window",
+			stock:        Stock{OnHand: 0, Sold: 50, Threshold: 2},
+			reorderPoint: 2,
+			quantity:     3,
+			reorderDate:  today,
+		},
+		{
+			name:         "selling, at the reorder point",
+			stock:        Stock{OnHand: 10, Sold: 28, WindowDays: 28, LeadTimeDays: 7},
+			reorderPoint: 10, // a unit a day over 7 lead and 3 safety days
+			quantity:     14,
+			reorderDate:  today,
+			stockoutDate: day(10),
+		},
+		{
+			name:         "selling, above the reorder point",
+			stock:        Stock{OnHand: 30, Sold: 28, WindowDays: 28, LeadTimeDays: 7},
+			reorderPoint: 10,
+			quantity:     14, // for the stock left on the reorder date
+			reorderDate:  day(20),
+			stockoutDate: day(30),
+		},
+		{
+			name:         "selling, above the reorder point with stock on order",
+			stock:        Stock{OnHand: 5, OnOrder: 10, Sold: 28, WindowDays: 28, LeadTimeDays: 7},
+			reorderPoint: 10,
+			quantity:     14,
+			reorderDate:  day(5),
+			stockoutDate: day(5),
+		},
+		{
+			name:         "selling, out of stock",
+			stock:        Stock{OnHand: 0, Sold: 56, WindowDays: 28, LeadTimeDays: 2},
+			reorderPoint: 10,
+			quantity:     38,
+			reorderDate:  today,
+			stockoutDate: today,
+		},
+		{
+			name:         "threshold above the sales over the lead time",
+			stock:        Stock{OnHand: 8, Threshold: 20, Sold: 28, WindowDays: 28, LeadTimeDays: 7},
+			reorderPoint: 20,
+			quantity:     26,
+			reorderDate:  today,
+			stockoutDate: day(8),
+		},
+		{
+			name:         "slow seller rounds up to whole units",
+			stock:        Stock{OnHand: 1, Sold: 1, WindowDays: 28, LeadTimeDays: 7},
+			reorderPoint: 1,
+			quantity:     1,
+			reorderDate:  today,
+			stockoutDate: day(28),
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := Reorder(tt.stock, now)
+			if p.ReorderPoint != tt.reorderPoint {
+				t.Errorf("reorder point = %d, want %d", p.ReorderPoint, tt.reorderPoint)
+			}
+			if !p.ReorderDate.Equal(tt.reorderDate) {
+				t.Errorf("reorder date = %v, want %v", p.ReorderDate, tt.reorderDate)
+			}
+			if !tt.reorderDate.IsZero() && p.Quantity != tt.quantity {
+				t.Errorf("quantity = %d, want %d", p.Quantity, tt.quantity)
+			}
+			if !tt.reorderDate.IsZero() &&
+				tt.stock.OnHand+tt.stock.OnOrder+p.Quantity <= p.ReorderPoint &&
+				p.ReorderDate.Equal(today) {
+				t.Errorf("ordering %d leaves the product due again", p.Quantity)
+			}
+			switch {
+			case tt.stockoutDate.IsZero() && p.StockoutDate != nil:
+				t.Errorf("stockout date = %v, want none", *p.StockoutDate)
+			case !tt.stockoutDate.IsZero() &&
+				(p.StockoutDate == nil || !p.StockoutDate.Equal(tt.stockoutDate)):
+				t.Errorf("stockout date = %v, want %v", p.StockoutDate, tt.stockoutDate)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package kitchen
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/tax"
+)
+
+// ticketWidth is the characters per line on an 80mm printer in its
+// standard font
+const ticketWidth = 48
+
+// ESC/POS commands
+var (
+	escInit      = []byte{0x1b, 0x40}             // ESC @
+	escCodePage  = []byte{0x1b, 0x74, 0x10}       // ESC t 16, Windows-1252
+	escCenter    = []byte{0x1b, 0x61, 0x01}       // ESC a 1
+	escLeft      = []byte{0x1b, 0x61, 0x00}       // ESC a 0
+	escBoldOn    = []byte{0x1b, 0x45, 0x01}       // ESC E 1
+	escBoldOff   = []byte{0x1b, 0x45, 0x00}       // ESC E 0
+	gsSizeNormal = []byte{0x1d, 0x21, 0x00}       // GS ! 0
+	gsSizeTall   = []byte{0x1d, 0x21, 0x01}       // GS ! double height
+	gsSizeLarge  = []byte{0x1d, 0x21, 0x11}       // GS ! double width and height
+	escFeed      = []byte{0x1b, 0x64, 0x04}       // ESC d 4, feed four lines
+	gsPartialCut = []byte{0x1d, 0x56, 0x42, 0x00} // GS V B 0, feed and cut
+)
+
+var ticketRule = strings.Repeat("-", ticketWidth)
+
+// Ticket renders the kitchen ticket for a station's items of an order in
+// ESC/POS: the order number in large text, then each item with its
+// portion size, customizations and note, then the order's note.
+func Ticket(order *models.Order, station string, items []models.OrderItem, now time.Time) []byte {
+	var b bytes.Buffer
+	b.Write(escInit)
+	b.Write(escCodePage)
+
+	b.Write(escCenter)
+	b.Write(gsSizeLarge)
+	line(&b, fmt.Sprintf("ORDER #%d", order.ID))
+	b.Write(gsSizeNormal)
+	b.Write(escBoldOn)
+	line(&b, strings.ToUpper(station))
+	b.Write(escBoldOff)
+	kind := "TAKEAWAY"
+	if order.OrderType == tax.DineIn {
+		kind = "DINE IN"
+		if order.PartySize > 0 {
+			kind += fmt.Sprintf(" - PARTY OF %d", order.PartySize)
+		}
+	}
+	line(&b, kind)
+	line(&b, now.Format("2006-01-02 15:04"))
+
+	b.Write(escLeft)
+	line(&b, ticketRule)
+	for _, item := range items {
+		name := item.ProductName
+		if name == "" {
+			name = fmt.Sprintf("Product #%d", item.ProductID)
+		}
+		b.Write(gsSizeTall)
+		b.Write(escBoldOn)
+		for _, l := range wrap(fmt.Sprintf("%d x %s", item.Quantity, name), ticketWidth) {
+			line(&b, l)
+		}
+		b.Write(escBoldOff)
+		b.Write(gsSizeNormal)
+		if item.PortionSize != "" {
+			line(&b, "   Portion: "+item.PortionSize)
+		}
+		for _, c := range item.Customizations {
+			for _, l := range wrap("+ "+c.Name, ticketWidth-3) {
+				line(&b, "   "+l)
+			}
+		}
+		if item.Note != "" {
+			b.Write(escBoldOn)
+			for _, l := range wrap("NOTE: "+item.Note, ticketWidth-3) {
+				line(&b, "   "+l)
+			}
+			b.Write(escBoldOff)
+		}
+	}
+	if order.Note != "" {
+		line(&b, ticketRule)
+		b.Write(escBoldOn)
+		for _, l := range wrap("ORDER NOTE: "+order.Note, ticketWidth) {
+			line(&b, l)
+		}
+		b.Write(escBoldOff)
+	}
+	line(&b, ticketRule)
+
+	b.Write(escFeed)
+	b.Write(gsPartialCut)
+	return b.Bytes()
+}
+
+// line writes text in Windows-1252 followed by a line feed. Characters the
+// code page lacks print as "?".
+func line(b *bytes.Buffer, text string) {
+	for _, r := range text {
+		switch {
+		case r >= 0x20 && r < 0x7f, r >= 0xa0 && r <= 0xff:
+			b.WriteByte(byte(r))
+		case r == '€':
+			b.WriteByte(0x80)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	b.WriteByte('\n')
+}
+
+// wrap breaks text into lines of at most width characters at spaces,
+// splitting words that are too long
+func wrap(text string, width int) []string {
+	var lines []string
+	cur := ""
+	for _, word := range strings.Fields(text) {
+		for utf8.RuneCountInString(word) > width {
+			if cur != "" {
+				lines = append(lines, cur)
+				cur = ""
+			}
+			runes := []rune(word)
+			lines = append(lines, string(runes[:width]))
+			word = string(runes[width:])
+		}
+		switch {
+		case cur == "":
+			cur = word
+		case utf8.RuneCountInString(cur)+1+utf8.RuneCountInString(word) <= width:
+			cur += " " + word
+		default:
+			lines = append(lines, cur)
+			cur = word
+		}
+	}
+	return append(lines, cur)
+}
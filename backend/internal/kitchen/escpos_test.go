@@ -0,0 +1,84 @@
+package kitchen
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+	"time"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/tax"
+)
+
+func TestTicket(t *testing.T) {
+	order := &models.Order{ID: 42, OrderType: tax.DineIn, PartySize: 4,
+		Note: "Birthday, bring the cake last"}
+	items := []models.OrderItem{
+		{ProductID: 1, ProductName: "Beef Rendang", Quantity: 2, PortionSize: "large",
+			Customizations: []models.CustomizationOption{{Name: "Extra Spicy"}},
+			Note:           "No peanuts"},
+		{ProductID: 7, Quantity: 1},
+	}
+	now := time.Date(2026, 3, 14, 18, 30, 0, 0, time.UTC)
+
+	got := Ticket(order, "grill", items, now)
+	if !bytes.HasPrefix(got, escInit) || !bytes.HasSuffix(got, gsPartialCut) {
+		t.Error("ticket does not start by resetting the printer and end with a cut")
+	}
+	for _, want := range []string{
+		"ORDER #42\n", "GRILL\n", "DINE IN - PARTY OF 4\n", "2026-03-14 18:30\n",
+		"2 x Beef Rendang\n", "   Portion: large\n", "   + Extra Spicy\n",
+		"   NOTE: No peanuts\n", "1 x Product #7\n",
+		"ORDER NOTE: Birthday, bring the cake last\n",
+	} {
+		if !bytes.Contains(got, []byte(want)) {
+			t.Errorf("ticket is missing %q", want)
+		}
+	}
+
+	takeaway := Ticket(&models.Order{ID: 43, OrderType: tax.Takeaway}, "cold", nil, now)
+	if !bytes.Contains(takeaway, []byte("TAKEAWAY\n")) ||
+		bytes.Contains(takeaway, []byte("ORDER NOTE")) {
+		t.Errorf("takeaway ticket = %q", takeaway)
+	}
+}
+
+func TestLine(t *testing.T) {
+	tests := []struct {
+		text string
+		want string
+	}{
+		{"Fish & Chips", "Fish & Chips\n"},
+		{"Crème brûlée", "Cr\xe8me br\xfbl\xe9e\n"},
+		{"5€ off", "5\x80 off\n"},
+		{"Ramen 🍜", "Ramen ?\n"},
+		{"tab\there", "tab?here\n"},
+	}
+	for _, tt := range tests {
+		var b bytes.Buffer
+		line(&b, tt.text)
+		if b.String() != tt.want {
+			t.Errorf("line(%q) = %q, want %q", tt.text, b.String(), tt.want)
+		}
+	}
+}
+
+func TestWrap(t *testing.T) {
+	tests := []struct {
+		text  string
+		width int
+		want  []string
+	}{
+		{"short", 10, []string{"short"}},
+		{"one two three four", 9, []string{"one two", "three", "four"}},
+		{"abcdefghijkl xy", 5, []string{"abcde", "fghij", "kl xy"}},
+		{"ünïcödé wörds", 7, []string{"ünïcödé", "wörds"}},
+		{"", 5, []string{""}},
+	}
+	for _, tt := range tests {
+		got := wrap(tt.text, tt.width)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("wrap(%q, %d) = %q, want %q", tt.text, tt.width, got, tt.want)
+		}
+	}
+}
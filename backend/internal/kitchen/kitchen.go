@@ -0,0 +1,183 @@
+// Package kitchen prints kitchen tickets. Order items are routed by menu
+// category to stations, each with a thermal printer reached over raw TCP
+// (port 9100) or, for local testing, a directory that tickets are written
+// to.
+package kitchen
+
+import (
+	"context"
+	"fmt"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DefaultRoute is the route for categories without their own
+const DefaultRoute = "*"
+
+// MaxAttempts is how many times a ticket is tried before it is given up on
+const MaxAttempts = 10
+
+// dialTimeout bounds connecting to a printer
+const dialTimeout = 5 * time.Second
+
+// Printer prints a ticket. name identifies the ticket, for printers that
+// keep copies.
+type Printer interface {
+	Print(ctx context.Context, name string, data []byte) error
+}
+
+// TCPPrinter sends tickets to a network printer's raw port
+type TCPPrinter struct {
+	Addr string
+}
+
+func (p TCPPrinter) Print(ctx context.Context, name string, data []byte) error {
+	ctx, cancel := context.WithTimeout(ctx, dialTimeout)
+	defer cancel()
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp", p.Addr)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+	conn.SetWriteDeadline(time.Now().Add(dialTimeout))
+	_, err = conn.Write(data)
+	return err
+}
+
+// FilePrinter writes each ticket to a file in Dir
+type FilePrinter struct {
+	Dir string
+}
+
+func (p FilePrinter) Print(ctx context.Context, name string, data []byte) error {
+	if err := os.MkdirAll(p.Dir, 0o755); err != nil {
+		return err
+	}
+	file := fmt.Sprintf("%s-%s.bin", time.Now().Format("20060102-150405"), name)
+	return os.WriteFile(filepath.Join(p.Dir, file), data, 0o644)
+}
+
+// Config is the station setup
+type Config struct {
+	// Printers maps station names to their printers
+	Printers map[string]Printer
+	// Routes maps menu categories to stations; DefaultRoute catches the rest
+	Routes map[string]string
+}
+
+// Settings is the active configuration, see LoadConfig
+var Settings = Config{}
+
+// Enabled reports whether any printers are set up
+func Enabled() bool {
+	return len(Settings.Printers) > 0
+}
+
+// Station returns the station that prepares a category
+func Station(category string) string {
+	if s, ok := Settings.Routes[category]; ok {
+		return s
+	}
+	return Settings.Routes[DefaultRoute]
+}
+
+// LoadConfig reads KITCHEN_PRINTERS, a comma-separated list of
+// station=printer where printer is tcp://host[:port] or file://directory,
+// and KITCHEN_ROUTES, a list of category=station. Without printers no
+// tickets are printed.
+func LoadConfig() error {
+	cfg := Config{Printers: map[string]Printer{}, Routes: map[string]string{}}
+	printers, err := pairs("KITCHEN_PRINTERS")
+	if err != nil {
+		return err
+	}
+	routes, err := pairs("KITCHEN_ROUTES")
+	if err != nil {
+		return err
+	}
+	for station, target := range printers {
+		p, err := parsePrinter(target)
+		if err != nil {
+			return fmt.Errorf("invalid printer for station %q: %w", station, err)
+		}
+		cfg.Printers[station] = p
+	}
+	for category, station := range routes {
+		if _, ok := cfg.Printers[station]; !ok {
+			return fmt.Errorf("KITCHEN_ROUTES sends %q to unknown station %q",
+				category, station)
+		}
+		cfg.Routes[category] = station
+	}
+	// With a single station everything goes to it; with more, every
+	// category needs somewhere to go
+	if _, ok := cfg.Routes[DefaultRoute]; !ok {
+		if len(cfg.Printers) > 1 {
+			return fmt.Errorf("KITCHEN_ROUTES needs a %s route for other categories",
+				DefaultRoute)
+		}
+		for station := range cfg.Printers {
+			cfg.Routes[DefaultRoute] = station
+		}
+	}
+	Settings = cfg
+	return nil
+}
+
+// RetryDelay returns how long to wait before the next try after attempts
+// failed ones, and false when the ticket should be given up on
+func RetryDelay(attempts int) (time.Duration, bool) {
+	if attempts >= MaxAttempts {
+		return 0, false
+	}
+	delay := 5 * time.Second << min(max(attempts-1, 0), 6)
+	return min(delay, 5*time.Minute), true
+}
+
+func parsePrinter(target string) (Printer, error) {
+	u, err := url.Parse(target)
+	if err != nil {
+		return nil, err
+	}
+	switch u.Scheme {
+	case "tcp":
+		if u.Host == "" {
+			return nil, fmt.Errorf("%q has no host", target)
+		}
+		addr := u.Host
+		if u.Port() == "" {
+			addr = net.JoinHostPort(u.Hostname(), "9100")
+		}
+		return TCPPrinter{Addr: addr}, nil
+	case "file":
+		dir := u.Host + u.Path
+		if dir == "" {
+			return nil, fmt.Errorf("%q has no directory", target)
+		}
+		return FilePrinter{Dir: dir}, nil
+	default:
+		return nil, fmt.Errorf("%q must start with tcp:// or file://", target)
+	}
+}
+
+// pairs reads an environment variable of the form "a=b,c=d"
+func pairs(env string) (map[string]string, error) {
+	out := map[string]string{}
+	for _, item := range strings.Split(os.Getenv(env), ",") {
+		if strings.TrimSpace(item) == "" {
+			continue
+		}
+		key, value, ok := strings.Cut(item, "=")
+		key, value = strings.TrimSpace(key), strings.TrimSpace(value)
+		if !ok || key == "" || value == "" {
+			return nil, fmt.Errorf("invalid %s entry %q", env, item)
+		}
+		out[key] = value
+	}
+	return out, nil
+}
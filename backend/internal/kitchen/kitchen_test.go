@@ -0,0 +1,160 @@
+package kitchen
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func TestLoadConfig(t *testing.T) {
+	tests := []struct {
+		name       string
+		printers   string
+		routes     string
+		wantErr    bool
+		wantRoutes map[string]string
+	}{
+		{name: "none", wantRoutes: map[string]string{}},
+		{name: "one station takes everything", printers: "grill=tcp://10.0.0.5",
+			wantRoutes: map[string]string{DefaultRoute: "grill"}},
+		{name: "routed", printers: "grill=tcp://10.0.0.5:9101, cold=file://tickets",
+			routes:     "western=grill,*=cold",
+			wantRoutes: map[string]string{"western": "grill", DefaultRoute: "cold"}},
+		{name: "no default with two stations", printers: "a=file://a,b=file://b",
+			routes: "western=a", wantErr: true},
+		{name: "unknown station", printers: "a=file://a", routes: "western=b",
+			wantErr: true},
+		{name: "unknown scheme", printers: "a=lpt://1", wantErr: true},
+		{name: "no host", printers: "a=tcp://", wantErr: true},
+		{name: "not a pair", printers: "tcp://10.0.0.5", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			saved := Settings
+			t.Cleanup(func() { Settings = saved })
+			t.Setenv("KITCHEN_PRINTERS", tt.printers)
+			t.Setenv("KITCHEN_ROUTES", tt.routes)
+
+			err := LoadConfig()
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("loaded %+v, want an error", Settings)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(Settings.Routes) != len(tt.wantRoutes) {
+				t.Fatalf("routes = %v, want %v", Settings.Routes, tt.wantRoutes)
+			}
+			for category, station := range tt.wantRoutes {
+				if Settings.Routes[category] != station {
+					t.Errorf("routes = %v, want %v", Settings.Routes, tt.wantRoutes)
+				}
+			}
+		})
+	}
+}
+
+func TestLoadConfigPrinters(t *testing.T) {
+	saved := Settings
+	t.Cleanup(func() { Settings = saved })
+	t.Setenv("KITCHEN_PRINTERS", "grill=tcp://10.0.0.5,bar=tcp://10.0.0.6:9200,cold=file://tmp/tickets")
+	t.Setenv("KITCHEN_ROUTES", "*=grill,drinks=bar,salads=cold")
+	if err := LoadConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]Printer{
+		"grill": TCPPrinter{Addr: "10.0.0.5:9100"},
+		"bar":   TCPPrinter{Addr: "10.0.0.6:9200"},
+		"cold":  FilePrinter{Dir: "tmp/tickets"},
+	}
+	for station, p := range want {
+		if Settings.Printers[station] != p {
+			t.Errorf("printer for %s = %#v, want %#v", station,
+				Settings.Printers[station], p)
+		}
+	}
+	if !Enabled() {
+		t.Error("not enabled with printers set up")
+	}
+	if got := Station("drinks"); got != "bar" {
+		t.Errorf("drinks go to %s, want bar", got)
+	}
+	if got := Station("desserts"); got != "grill" {
+		t.Errorf("desserts go to %s, want the default grill", got)
+	}
+}
+
+func TestRetryDelay(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+		wantOK   bool
+	}{
+		{0, 5 * time.Second, true},
+		{1, 5 * time.Second, true},
+		{2, 10 * time.Second, true},
+		{4, 40 * time.Second, true},
+		{7, 5 * time.Minute, true},
+		{MaxAttempts - 1, 5 * time.Minute, true},
+		{MaxAttempts, 0, false},
+	}
+	for _, tt := range tests {
+		got, ok := RetryDelay(tt.attempts)
+		if got != tt.want || ok != tt.wantOK {
+			t.Errorf("RetryDelay(%d) = %v, %v; want %v, %v", tt.attempts, got, ok,
+				tt.want, tt.wantOK)
+		}
+	}
+}
+
+func TestTCPPrinter(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+	received := make(chan []byte, 1)
+	go func() {
+		conn, err := ln.Accept()
+		if err != nil {
+			received <- nil
+			return
+		}
+		defer conn.Close()
+		data, _ := io.ReadAll(conn)
+		received <- data
+	}()
+
+	ticket := []byte("ticket\n")
+	if err := (TCPPrinter{Addr: ln.Addr().String()}).Print(context.Background(),
+		"order-1", ticket); err != nil {
+		t.Fatal(err)
+	}
+	if got := <-received; !bytes.Equal(got, ticket) {
+		t.Errorf("printer got %q, want %q", got, ticket)
+	}
+}
+
+func TestFilePrinter(t *testing.T) {
+	dir := filepath.Join(t.TempDir(), "tickets")
+	if err := (FilePrinter{Dir: dir}).Print(context.Background(), "order-1-grill",
+		[]byte("ticket")); err != nil {
+		t.Fatal(err)
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*-order-1-grill.bin"))
+	if err != nil || len(files) != 1 {
+		t.Fatalf("tickets written = %v, %v; want one", files, err)
+	}
+	if data, _ := os.ReadFile(files[0]); string(data) != "ticket" {
+		t.Errorf("ticket file has %q", data)
+	}
+}
@@ -0,0 +1,92 @@
+// Package loyalty holds the rules of the points program: how many points
+// an order earns, what a point is worth and the membership tiers.
+package loyalty
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"restaurant-backend/internal/models"
+)
+
+// Config is the points program configuration
+type Config struct {
+	PointsPerDollar float64 // points earned per dollar paid
+	PointValue      float64 // dollars a point is worth at checkout
+	ExpiryDays      int     // how long earned points stay valid
+}
+
+// Settings is the active configuration, see LoadConfig
+var Settings = Config{
+	PointsPerDollar: 1,
+	PointValue:      0.01,
+	ExpiryDays:      365,
+}
+
+// Tiers are the membership levels, lowest first. Points earned in the last
+// year decide the tier; higher tiers earn more points per dollar.
+var Tiers = []models.LoyaltyTier{
+	{Name: "Bronze", MinPoints: 0, Multiplier: 1},
+	{Name: "Silver", MinPoints: 500, Multiplier: 1.25},
+	{Name: "Gold", MinPoints: 1500, Multiplier: 1.5},
+}
+
+// TierWindowDays is how far back earned points count towards a tier
+const TierWindowDays = 365
+
+// LoadConfig reads LOYALTY_POINTS_PER_DOLLAR, LOYALTY_POINT_VALUE and
+// LOYALTY_EXPIRY_DAYS, keeping the defaults for unset variables
+func LoadConfig() error {
+	if v := os.Getenv("LOYALTY_POINTS_PER_DOLLAR"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f < 0 {
+			return fmt.Errorf("invalid LOYALTY_POINTS_PER_DOLLAR %q", v)
+		}
+		Settings.PointsPerDollar = f
+	}
+	if v := os.Getenv("LOYALTY_POINT_VALUE"); v != "" {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil || f <= 0 {
+			return fmt.Errorf("invalid LOYALTY_POINT_VALUE %q", v)
+		}
+		Settings.PointValue = f
+	}
+	if v := os.Getenv("LOYALTY_EXPIRY_DAYS"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("invalid LOYALTY_EXPIRY_DAYS %q", v)
+		}
+		Settings.ExpiryDays = n
+	}
+	return nil
+}
+
+// TierFor returns the tier for the points earned in the tier window and
+// the next tier up, if any
+func TierFor(qualifyingPoints int) (models.LoyaltyTier, *models.LoyaltyTier) {
+	current := Tiers[0]
+	for i, t := range Tiers {
+		if qualifyingPoints < t.MinPoints {
+			return current, &Tiers[i]
+		}
+		current = t
+	}
+	return current, nil
+}
+
+// PointsEarned returns the points an order paid with amount earns
+func PointsEarned(amount float64, tier models.LoyaltyTier) int {
+	return int(math.Floor(amount * Settings.PointsPerDollar * tier.Multiplier))
+}
+
+// Value returns what points are worth at checkout
+func Value(points int) float64 {
+	return math.Round(float64(points)*Settings.PointValue*100) / 100
+}
+
+// PointsFor returns the fewest points that cover amount
+func PointsFor(amount float64) int {
+	return int(math.Ceil(math.Round(amount/Settings.PointValue*1e6) / 1e6))
+}
@@ -0,0 +1,103 @@
+package loyalty
+
+import (
+	"testing"
+
+	"restaurant-backend/internal/models"
+)
+
+// withSettings runs a test against the default program, whatever the
+// environment configured
+func withSettings(t *testing.T) {
+	saved := Settings
+	Settings = Config{PointsPerDollar: 1, PointValue: 0.01, ExpiryDays: 365}
+	t.Cleanup(func() { Settings = saved })
+}
+
+func TestPointsEarned(t *testing.T) {
+	withSettings(t)
+	silver := models.LoyaltyTier{Name: "Silver", Multiplier: 1.25}
+	bronze := models.LoyaltyTier{Name: "Bronze", Multiplier: 1}
+
+	tests := []struct {
+		amount float64
+		tier   models.LoyaltyTier
+		want   int
+	}{
+		{0, bronze, 0},
+		{0.99, bronze, 0},
+		{10.99, bronze, 10},
+		{10.99, silver, 13}, // 13.74 rounds down
+		{100, silver, 125},
+	}
+	for _, tt := range tests {
+		if got := PointsEarned(tt.amount, tt.tier); got != tt.want {
+			t.Errorf("PointsEarned(%v, %s) = %d, want %d", tt.amount, tt.tier.Name,
+				got, tt.want)
+		}
+	}
+}
+
+func TestValue(t *testing.T) {
+	withSettings(t)
+	tests := []struct {
+		points int
+		want   float64
+	}{
+		{0, 0},
+		{1, 0.01},
+		{150, 1.5},
+		{333, 3.33},
+	}
+	for _, tt := range tests {
+		if got := Value(tt.points); got != tt.want {
+			t.Errorf("Value(%d) = %v, want %v", tt.points, got, tt.want)
+		}
+	}
+}
+
+func TestPointsFor(t *testing.T) {
+	withSettings(t)
+	tests := []struct {
+		amount float64
+		want   int
+	}{
+		{0, 0},
+		{1.5, 150},
+		{0.07, 7},  // not 8 from 7.000000000000001
+		{0.015, 2}, // part of a point rounds up
+		{12.34, 1234},
+	}
+	for _, tt := range tests {
+		if got := PointsFor(tt.amount); got != tt.want {
+			t.Errorf("PointsFor(%v) = %d, want %d", tt.amount, got, tt.want)
+		}
+		if got := Value(PointsFor(tt.amount)); got < tt.amount {
+			t.Errorf("Value(PointsFor(%v)) = %v does not cover it", tt.amount, got)
+		}
+	}
+}
+
+func TestTierFor(t *testing.T) {
+	tests := []struct {
+		points   int
+		want     string
+		wantNext string
+	}{
+		{0, "Bronze", "Silver"},
+		{499, "Bronze", "Silver"},
+		{500, "Silver", "Gold"},
+		{1500, "Gold", ""},
+	}
+	for _, tt := range tests {
+		tier, next := TierFor(tt.points)
+		nextName := ""
+		if next != nil {
+			nextName = next.Name
+		}
+		if tier.Name != tt.want || nextName != tt.wantNext {
+			t.Errorf("TierFor(%d) = %s, %s; want %s, %s", tt.points, tier.Name,
+				nextName, tt.want, tt.wantNext)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Package mailer sends email. Mailer is the extension point: the server
+// ships with a logging mailer for development and an SMTP mailer.
+package mailer
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Attachment is a file sent with a message
+type Attachment struct {
+	Filename    string
+	ContentType string
+	Data        []byte
+}
+
+// Message is a plain-text email with optional attachments
+type Message struct {
+	To          string
+	Subject     string
+	Text        string
+	Attachments []Attachment
+}
+
+// Mailer sends messages
+type Mailer interface {
+	Send(ctx context.Context, msg Message) error
+}
+
+// ErrInvalidAddress is returned for addresses that could inject headers
+var ErrInvalidAddress = errors.New("invalid email address")
+
+// Log writes messages to the log instead of sending them
+type Log struct{}
+
+func (Log) Send(ctx context.Context, msg Message) error {
+	if err := validate(msg); err != nil {
+		return err
+	}
+	names := make([]string, len(msg.Attachments))
+	for i, a := range msg.Attachments {
+		names[i] = fmt.Sprintf("%s (%d bytes)", a.Filename, len(a.Data))
+	}
+	slog.Info("email not sent, logging only", "to", msg.To, "subject", msg.Subject,
+		"attachments", names)
+	return nil
+}
+
+// FromEnv returns the mailer selected by MAIL_PROVIDER: "log" or "smtp".
+// When it is unset the log mailer is used in development and no mailer
+// (nil) otherwise, so email features report they are unavailable.
+func FromEnv(devMode bool) (Mailer, error) {
+	switch provider := os.Getenv("MAIL_PROVIDER"); provider {
+	case "":
+		if devMode {
+			return Log{}, nil
+		}
+		return nil, nil
+	case "log":
+		return Log{}, nil
+	case "smtp":
+		host, from := os.Getenv("SMTP_HOST"), os.Getenv("MAIL_FROM")
+		if host == "" || from == "" {
+			return nil, errors.New("MAIL_PROVIDER=smtp needs SMTP_HOST and MAIL_FROM")
+		}
+		port := 587
+		if v := os.Getenv("SMTP_PORT"); v != "" {
+			p, err := strconv.Atoi(v)
+			if err != nil || p <= 0 || p > 65535 {
+				return nil, fmt.Errorf("invalid SMTP_PORT %q", v)
+			}
+			port = p
+		}
+		return NewSMTP(host, port, os.Getenv("SMTP_USERNAME"),
+			os.Getenv("SMTP_PASSWORD"), from), nil
+	default:
+		return nil, fmt.Errorf("unknown MAIL_PROVIDER %q", provider)
+	}
+}
+
+func validate(msg Message) error {
+	if msg.To == "" || strings.ContainsAny(msg.To, "\r\n,;<>") ||
+		!strings.Contains(msg.To, "@") {
+		return ErrInvalidAddress
+	}
+	return nil
+}
@@ -0,0 +1,135 @@
+package mailer
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"mime"
+	"net"
+	"net/smtp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// SMTP sends mail through an SMTP server, upgrading to TLS with STARTTLS
+// when the server offers it. Credentials are only sent over TLS.
+type SMTP struct {
+	host     string
+	port     int
+	username string
+	password string
+	from     string
+}
+
+// NewSMTP returns an SMTP mailer. username may be empty for servers that
+// do not need authentication.
+func NewSMTP(host string, port int, username, password, from string) *SMTP {
+	return &SMTP{host: host, port: port, username: username, password: password,
+		from: from}
+}
+
+func (s *SMTP) Send(ctx context.Context, msg Message) error {
+	if err := validate(msg); err != nil {
+		return err
+	}
+	body, err := s.build(msg)
+	if err != nil {
+		return err
+	}
+
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "tcp",
+		net.JoinHostPort(s.host, strconv.Itoa(s.port)))
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	deadline, ok := ctx.Deadline()
+	if !ok {
+		deadline = time.Now().Add(30 * time.Second)
+	}
+	conn.SetDeadline(deadline)
+
+	c, err := smtp.NewClient(conn, s.host)
+	if err != nil {
+		conn.Close()
+		return fmt.Errorf("smtp: %w", err)
+	}
+	defer c.Close()
+
+	if ok, _ := c.Extension("STARTTLS"); ok {
+		if err := c.StartTLS(&tls.Config{ServerName: s.host}); err != nil {
+			return fmt.Errorf("smtp: %w", err)
+		}
+	}
+	if s.username != "" {
+		// PlainAuth refuses to send credentials without TLS
+		auth := smtp.PlainAuth("", s.username, s.password, s.host)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("smtp: %w", err)
+		}
+	}
+	if err := c.Mail(s.from); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if err := c.Rcpt(msg.To); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	w, err := c.Data()
+	if err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if _, err := w.Write(body); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	if err := w.Close(); err != nil {
+		return fmt.Errorf("smtp: %w", err)
+	}
+	return c.Quit()
+}
+
+// build writes the message as MIME, with attachments base64 encoded
+func (s *SMTP) build(msg Message) ([]byte, error) {
+	var b bytes.Buffer
+	fmt.Fprintf(&b, "From: %s\r\n", s.from)
+	fmt.Fprintf(&b, "To: %s\r\n", msg.To)
+	fmt.Fprintf(&b, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8",
+		strings.NewReplacer("\r", " ", "\n", " ").Replace(msg.Subject)))
+	fmt.Fprintf(&b, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	b.WriteString("MIME-Version: 1.0\r\n")
+
+	text := strings.ReplaceAll(strings.ReplaceAll(msg.Text, "\r\n", "\n"), "\n", "\r\n")
+	if len(msg.Attachments) == 0 {
+		b.WriteString("Content-Type: text/plain; charset=utf-8\r\n\r\n")
+		b.WriteString(text)
+		return b.Bytes(), nil
+	}
+
+	raw := make([]byte, 12)
+	if _, err := rand.Read(raw); err != nil {
+		return nil, err
+	}
+	boundary := "b-" + hex.EncodeToString(raw)
+	fmt.Fprintf(&b, "Content-Type: multipart/mixed; boundary=%q\r\n\r\n", boundary)
+	fmt.Fprintf(&b, "--%s\r\nContent-Type: text/plain; charset=utf-8\r\n\r\n%s\r\n",
+		boundary, text)
+	for _, a := range msg.Attachments {
+		fmt.Fprintf(&b, "--%s\r\n", boundary)
+		fmt.Fprintf(&b, "Content-Type: %s\r\n", a.ContentType)
+		b.WriteString("Content-Transfer-Encoding: base64\r\n")
+		fmt.Fprintf(&b, "Content-Disposition: attachment; filename=%q\r\n\r\n",
+			a.Filename)
+		encoded := base64.StdEncoding.EncodeToString(a.Data)
+		for len(encoded) > 76 {
+			b.WriteString(encoded[:76] + "\r\n")
+			encoded = encoded[76:]
+		}
+		b.WriteString(encoded + "\r\n")
+	}
+	fmt.Fprintf(&b, "--%s--\r\n", boundary)
+	return b.Bytes(), nil
+}
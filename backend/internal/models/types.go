@@ -6,12 +6,32 @@ import (
 
 // Claims represents the JWT claims
 type Claims struct {
-	UserID int    `json:"userId"`
-	Email  string `json:"email"`
-	Role   string `json:"role"` // customer or admin
+	UserID  int      `json:"userId"`
+	Email   string   `json:"email"`
+	Role    string   `json:"role"`              // customer or admin
+	AMR     []string `json:"amr,omitempty"`     // how the user authenticated, e.g. "pwd", "otp"
+	Purpose string   `json:"purpose,omitempty"` // set on interim tokens that only unlock a login step
+	Scopes  []string `json:"scopes,omitempty"`  // only set for API keys; JWTs are unscoped
 	jwt.RegisteredClaims
 }
 
+// JSONWebKey is a public signing key as published in the JWKS (RFC 7517)
+type JSONWebKey struct {
+	KeyType   string `json:"kty"`
+	KeyID     string `json:"kid"`
+	Use       string `json:"use"`
+	Algorithm string `json:"alg"`
+	N         string `json:"n,omitempty"`   // RSA modulus
+	E         string `json:"e,omitempty"`   // RSA exponent
+	Curve     string `json:"crv,omitempty"` // OKP curve
+	X         string `json:"x,omitempty"`   // OKP public key
+}
+
+// JSONWebKeySet is the body of /.well-known/jwks.json
+type JSONWebKeySet struct {
+	Keys []JSONWebKey `json:"keys"`
+}
+
 // ContextKey is a type for context keys to avoid collisions
 type ContextKey string
 
@@ -61,6 +81,11 @@ type Product struct {
 	StockQuantity       int               `json:"stockQuantity"`
 	LowStockThreshold   int               `json:"lowStockThreshold"`
 	OrderedQuantity     int               `json:"orderedQuantity"`
+	// HasRecipe is set for products made from ingredients. Their
+	// AvailableQuantity is how many the ingredients in stock can make;
+	// for other products it is the stock.
+	HasRecipe         bool `json:"hasRecipe,omitempty"`
+	AvailableQuantity int  `json:"availableQuantity"`
 }
 
 // Feedback represents customer feedback
@@ -84,30 +109,444 @@ type CustomizationOption struct {
 
 // OrderItem represents a single item within an order
 type OrderItem struct {
-	ProductID      int                   `json:"productId"`
+	ID        int `json:"id,omitempty"`
+	ProductID int `json:"productId"`
+	// ProductName and Category are set when reading orders back
+	ProductName    string                `json:"productName,omitempty"`
+	Category       string                `json:"category,omitempty"`
 	Quantity       int                   `json:"quantity"`
 	PortionSize    string                `json:"portionSize"`
 	Customizations []CustomizationOption `json:"customizations,omitempty"`
+	// Note is for the kitchen, such as "no onions"
+	Note string `json:"note,omitempty"`
+	// UnitPrice is what one item cost when ordered, set by the server
+	UnitPrice        float64 `json:"unitPrice,omitempty"`
+	RefundedQuantity int     `json:"refundedQuantity,omitempty"`
+	// TaxRate is the percentage applied to the line; Taxable is the line
+	// after discounts and without tax, and TaxAmount the tax on it
+	TaxRate   float64 `json:"taxRate,omitempty"`
+	Taxable   float64 `json:"taxable,omitempty"`
+	TaxAmount float64 `json:"taxAmount,omitempty"`
 }
 
 // Order represents a customer's order
 type Order struct {
-	ID         int         `json:"id"`
-	UserID     int         `json:"userId"`
-	Items      []OrderItem `json:"items"`
-	TotalPrice float64     `json:"totalPrice"`
-	Status     string      `json:"status"` // "pending", "completed", "cancelled"
-	CreatedAt  string      `json:"createdAt"`
+	ID         int             `json:"id"`
+	UserID     int             `json:"userId"`
+	Items      []OrderItem     `json:"items"`
+	Subtotal   float64         `json:"subtotal"`
+	Discounts  []OrderDiscount `json:"discounts,omitempty"`
+	TotalPrice float64         `json:"totalPrice"`
+	// OrderType is dine_in or takeaway, which may be taxed differently.
+	// Tax is included in TotalPrice, and also in Subtotal when
+	// TaxInclusive is set.
+	OrderType    string  `json:"orderType"`
+	Tax          float64 `json:"tax"`
+	TaxInclusive bool    `json:"taxInclusive"`
+	// PartySize is how many people a dine-in order is for. Tip asks for a
+	// tip; TipAmount and ServiceCharge are worked out by the server and
+	// included in TotalPrice.
+	PartySize         int         `json:"partySize,omitempty"`
+	Tip               *TipRequest `json:"tip,omitempty"`
+	TipAmount         float64     `json:"tipAmount"`
+	ServiceCharge     float64     `json:"serviceCharge"`
+	ServiceChargeName string      `json:"serviceChargeName,omitempty"`
+	Status            string      `json:"status"` // "pending", "completed", "cancelled", "refunded"
+	// Note is for the kitchen and printed on its tickets
+	Note       string `json:"note,omitempty"`
+	CouponCode string `json:"couponCode,omitempty"`
+	// RedeemPoints asks to pay part of the order with loyalty points
+	RedeemPoints int `json:"redeemPoints,omitempty"`
+	// GiftCardPurchases are gift cards bought with the order
+	GiftCardPurchases []GiftCardPurchase `json:"giftCardPurchases,omitempty"`
+	// GiftCardCodes asks to pay with gift cards; Tenders lists what each
+	// card paid and AmountDue what is left for other payment
+	GiftCardCodes []string      `json:"giftCardCodes,omitempty"`
+	Tenders       []OrderTender `json:"tenders,omitempty"`
+	AmountDue     float64       `json:"amountDue"`
+	// PaymentMethod is the provider's card token for the amount due;
+	// PaymentStatus follows the order's card payment
+	PaymentMethod string `json:"paymentMethod,omitempty"`
+	PaymentStatus string `json:"paymentStatus,omitempty"`
+	// RefundedAmount is the total of the order's refunds and RefundedTax
+	// the tax within it
+	RefundedAmount float64 `json:"refundedAmount,omitempty"`
+	RefundedTax    float64 `json:"refundedTax,omitempty"`
+	CreatedAt      string  `json:"createdAt"`
+}
+
+// RefundRequest refunds lines of a completed order, or everything not yet
+// refunded when Lines is empty
+type RefundRequest struct {
+	Lines   []RefundLine `json:"lines"`
+	Restock bool         `json:"restock"`
+	Reason  string       `json:"reason"`
+	Note    string       `json:"note"`
+}
+
+// RefundLine is a quantity of one order item being refunded
+type RefundLine struct {
+	OrderItemID int     `json:"orderItemId"`
+	ProductID   int     `json:"productId,omitempty"`
+	Quantity    int     `json:"quantity"`
+	Amount      float64 `json:"amount,omitempty"`
+}
+
+// Refund is money given back on an order. Amount is split between the
+// card payment, the gift cards that paid for the order and, for orders
+// without either, money returned outside the system (ExternalAmount).
+type Refund struct {
+	ID             int          `json:"id"`
+	OrderID        int          `json:"orderId"`
+	Amount         float64      `json:"amount"`
+	Reason         string       `json:"reason"`
+	Note           string       `json:"note,omitempty"`
+	Restocked      bool         `json:"restocked"`
+	Full           bool         `json:"full"`
+	Lines          []RefundLine `json:"lines"`
+	Tax            float64      `json:"tax"`
+	PaymentAmount  float64      `json:"paymentAmount"`
+	GiftCardAmount float64      `json:"giftCardAmount"`
+	ExternalAmount float64      `json:"externalAmount"`
+	// PaymentStatus is how the card part is going: pending until the
+	// provider has refunded it, then succeeded or failed, or not_required
+	PaymentStatus string `json:"paymentStatus"`
+	// PointsReversed are earned points taken back; PointsReturned are
+	// redeemed points given back on a full refund
+	PointsReversed int    `json:"pointsReversed"`
+	PointsReturned int    `json:"pointsReturned"`
+	ActorID        *int   `json:"actorId,omitempty"`
+	CreatedAt      string `json:"createdAt"`
+}
+
+// PaymentConfig tells the checkout page how to collect a card: with
+// Stripe's card form and PublishableKey, or, with the mock provider, by
+// choosing one of TestPaymentMethods
+type PaymentConfig struct {
+	Provider           string   `json:"provider"`
+	Currency           string   `json:"currency"`
+	PublishableKey     string   `json:"publishableKey,omitempty"`
+	TestPaymentMethods []string `json:"testPaymentMethods,omitempty"`
+}
+
+// PaymentIntent is a card payment for an order. Amounts are in dollars;
+// Status is one of the payments package statuses.
+type PaymentIntent struct {
+	ID             int              `json:"id"`
+	OrderID        int              `json:"orderId"`
+	Provider       string           `json:"provider"`
+	ProviderRef    string           `json:"providerRef,omitempty"`
+	Amount         float64          `json:"amount"`
+	Currency       string           `json:"currency"`
+	Status         string           `json:"status"`
+	CapturedAmount float64          `json:"capturedAmount"`
+	RefundedAmount float64          `json:"refundedAmount"`
+	FailureCode    string           `json:"failureCode,omitempty"`
+	FailureMessage string           `json:"failureMessage,omitempty"`
+	CreatedAt      string           `json:"createdAt"`
+	UpdatedAt      string           `json:"updatedAt"`
+	Attempts       []PaymentAttempt `json:"attempts,omitempty"`
+}
+
+// PaymentAttempt is a call to the payment provider, or a webhook received
+// from it, for a payment intent
+type PaymentAttempt struct {
+	ID          int     `json:"id"`
+	IntentID    int     `json:"intentId"`
+	Action      string  `json:"action"` // authorize, capture, void, refund, webhook
+	Amount      float64 `json:"amount"`
+	Succeeded   bool    `json:"succeeded"`
+	ProviderRef string  `json:"providerRef,omitempty"`
+	Detail      string  `json:"detail,omitempty"`
+	CreatedAt   string  `json:"createdAt"`
+}
+
+// OrderDiscount is a discount line on an order or quote
+type OrderDiscount struct {
+	CouponID    *int    `json:"couponId,omitempty"`
+	Code        string  `json:"code,omitempty"`
+	Description string  `json:"description"`
+	Amount      float64 `json:"amount"`
+	Points      int     `json:"points,omitempty"` // loyalty points redeemed
+}
+
+// CartQuoteRequest is the payload for previewing a cart's price
+type CartQuoteRequest struct {
+	Items             []OrderItem        `json:"items"`
+	CouponCode        string             `json:"couponCode,omitempty"`
+	RedeemPoints      int                `json:"redeemPoints,omitempty"`
+	GiftCardPurchases []GiftCardPurchase `json:"giftCardPurchases,omitempty"`
+	GiftCardCodes     []string           `json:"giftCardCodes,omitempty"`
+	OrderType         string             `json:"orderType,omitempty"`
+	PartySize         int                `json:"partySize,omitempty"`
+	Tip               *TipRequest        `json:"tip,omitempty"`
+}
+
+// TipRequest is a tip as a percentage of the food total or a fixed amount
+type TipRequest struct {
+	Type  string  `json:"type"` // "percentage" or "fixed"
+	Value float64 `json:"value"`
+}
+
+// ServiceChargeRule adds a percentage service charge to orders of
+// OrderType (any when empty) for at least MinPartySize people and
+// MinSubtotal in food
+type ServiceChargeRule struct {
+	Name         string  `json:"name"`
+	OrderType    string  `json:"orderType,omitempty"`
+	MinPartySize int     `json:"minPartySize"`
+	MinSubtotal  float64 `json:"minSubtotal"`
+	Rate         float64 `json:"rate"`
+}
+
+// QuoteLine is a priced cart item
+type QuoteLine struct {
+	ProductID int     `json:"productId"`
+	Name      string  `json:"name"`
+	Quantity  int     `json:"quantity"`
+	UnitPrice float64 `json:"unitPrice"`
+	LineTotal float64 `json:"lineTotal"`
+	TaxRate   float64 `json:"taxRate"`
+	Taxable   float64 `json:"taxable"`
+	TaxAmount float64 `json:"taxAmount"`
+}
+
+// CartQuote is what a cart would cost if ordered now
+type CartQuote struct {
+	Items       []QuoteLine     `json:"items"`
+	Subtotal    float64         `json:"subtotal"`
+	Discounts   []OrderDiscount `json:"discounts"`
+	Total       float64         `json:"total"`
+	CouponError string          `json:"couponError,omitempty"`
+	// Tax is included in Total, and in Subtotal when TaxInclusive is set
+	OrderType    string  `json:"orderType"`
+	Tax          float64 `json:"tax"`
+	TaxInclusive bool    `json:"taxInclusive"`
+	PointsError  string  `json:"pointsError,omitempty"`
+	// TipAmount and ServiceCharge are included in Total
+	TipAmount         float64 `json:"tipAmount"`
+	ServiceCharge     float64 `json:"serviceCharge"`
+	ServiceChargeName string  `json:"serviceChargeName,omitempty"`
+	// GiftCardPurchases add to the total but are never discounted
+	GiftCardPurchases []GiftCardPurchase `json:"giftCardPurchases,omitempty"`
+	Tenders           []OrderTender      `json:"tenders,omitempty"`
+	AmountDue         float64            `json:"amountDue"`
+	GiftCardError     string             `json:"giftCardError,omitempty"`
+}
+
+// GiftCardPurchase is a gift card bought as part of an order. The code is
+// returned once, in the response to the order that bought it.
+type GiftCardPurchase struct {
+	Amount         float64 `json:"amount"`
+	RecipientEmail string  `json:"recipientEmail,omitempty"`
+	Message        string  `json:"message,omitempty"`
+	GiftCardID     int     `json:"giftCardId,omitempty"`
+	Code           string  `json:"code,omitempty"`
+	Last4          string  `json:"last4,omitempty"`
+}
+
+// OrderTender is part of an order paid with something other than the
+// main payment, currently a gift card
+type OrderTender struct {
+	Type       string  `json:"type"` // "gift_card"
+	GiftCardID int     `json:"giftCardId"`
+	Last4      string  `json:"last4"`
+	Amount     float64 `json:"amount"`
+}
+
+// GiftCard is a stored-value card. Status is active or void. The balance
+// is the sum of the card's transactions; Code is only set when the card is
+// issued.
+type GiftCard struct {
+	ID             int     `json:"id"`
+	Code           string  `json:"code,omitempty"`
+	Last4          string  `json:"last4"`
+	InitialValue   float64 `json:"initialValue"`
+	Balance        float64 `json:"balance"`
+	RecipientEmail string  `json:"recipientEmail,omitempty"`
+	Message        string  `json:"message,omitempty"`
+	PurchaserID    *int    `json:"purchaserId,omitempty"`
+	OrderID        *int    `json:"orderId,omitempty"`
+	Status         string  `json:"status"`
+	CreatedAt      string  `json:"createdAt"`
+}
+
+// GiftCardTransaction is a line in a gift card's ledger. Kind is issue,
+// redeem, refund or void; amounts are negative when they leave the card.
+type GiftCardTransaction struct {
+	ID         int     `json:"id"`
+	GiftCardID int     `json:"giftCardId"`
+	Kind       string  `json:"kind"`
+	Amount     float64 `json:"amount"`
+	OrderID    *int    `json:"orderId,omitempty"`
+	ActorID    *int    `json:"actorId,omitempty"`
+	Note       string  `json:"note,omitempty"`
+	CreatedAt  string  `json:"createdAt"`
+}
+
+// GiftCardDetail is a gift card with its ledger
+type GiftCardDetail struct {
+	GiftCard
+	Transactions []GiftCardTransaction `json:"transactions"`
+}
+
+// IssueGiftCardRequest is the payload for an admin issuing a gift card
+type IssueGiftCardRequest struct {
+	Amount         float64 `json:"amount"`
+	RecipientEmail string  `json:"recipientEmail,omitempty"`
+	Message        string  `json:"message,omitempty"`
+}
+
+// GiftCardBalanceRequest is the payload for checking a gift card's balance
+type GiftCardBalanceRequest struct {
+	Code string `json:"code"`
+}
+
+// GiftCardBalance is what a balance check reveals about a card
+type GiftCardBalance struct {
+	Last4   string  `json:"last4"`
+	Balance float64 `json:"balance"`
+	Status  string  `json:"status"`
+}
+
+// GiftCardLiability summarizes the gift card ledger for reconciliation.
+// Outstanding is what is still owed to card holders.
+type GiftCardLiability struct {
+	Issued      float64 `json:"issued"`
+	Redeemed    float64 `json:"redeemed"`
+	Refunded    float64 `json:"refunded"`
+	Voided      float64 `json:"voided"`
+	Outstanding float64 `json:"outstanding"`
+	ActiveCards int     `json:"activeCards"`
+}
+
+// UpdateOrderStatusRequest is the payload for completing or cancelling an
+// order
+type UpdateOrderStatusRequest struct {
+	Status string `json:"status"`
+}
+
+// LoyaltyTier is a membership level of the points program
+type LoyaltyTier struct {
+	Name       string  `json:"name"`
+	MinPoints  int     `json:"minPoints"`
+	Multiplier float64 `json:"multiplier"`
+}
+
+// LoyaltyEntry is a line in the points ledger. Kind is earn, redeem,
+// refund, reversal, adjust or expire; points are negative when they leave
+// the balance.
+type LoyaltyEntry struct {
+	ID          int     `json:"id"`
+	OrderID     *int    `json:"orderId,omitempty"`
+	Kind        string  `json:"kind"`
+	Points      int     `json:"points"`
+	ExpiresAt   *string `json:"expiresAt,omitempty"`
+	Description string  `json:"description"`
+	CreatedAt   string  `json:"createdAt"`
+}
+
+// ExpiringPoints are points that lapse on a given date unless used
+type ExpiringPoints struct {
+	Points    int    `json:"points"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// LoyaltySummary is a customer's standing in the points program
+type LoyaltySummary struct {
+	Balance          int              `json:"balance"`
+	BalanceValue     float64          `json:"balanceValue"`
+	PointValue       float64          `json:"pointValue"`
+	Tier             LoyaltyTier      `json:"tier"`
+	NextTier         *LoyaltyTier     `json:"nextTier,omitempty"`
+	QualifyingPoints int              `json:"qualifyingPoints"`
+	PointsToNextTier int              `json:"pointsToNextTier,omitempty"`
+	Expiring         []ExpiringPoints `json:"expiring"`
+	History          []LoyaltyEntry   `json:"history"`
+}
+
+// LoyaltyAdjustRequest is the payload for an admin points adjustment
+type LoyaltyAdjustRequest struct {
+	Points int    `json:"points"`
+	Reason string `json:"reason"`
+}
+
+// Coupon is a code customers enter at checkout. Type is percentage (Value
+// percent off), fixed (Value off), bogo (every second eligible item free)
+// or free_item (one FreeProductID free). Category and ProductIDs limit
+// which items the discount applies to.
+type Coupon struct {
+	ID             int     `json:"id"`
+	Code           string  `json:"code"`
+	Description    string  `json:"description"`
+	Type           string  `json:"type"`
+	Value          float64 `json:"value"`
+	FreeProductID  *int    `json:"freeProductId,omitempty"`
+	Category       string  `json:"category,omitempty"`
+	ProductIDs     []int   `json:"productIds"`
+	MinSpend       float64 `json:"minSpend"`
+	StartsAt       *string `json:"startsAt,omitempty"`
+	EndsAt         *string `json:"endsAt,omitempty"`
+	MaxUses        int     `json:"maxUses"`        // 0 means unlimited
+	MaxUsesPerUser int     `json:"maxUsesPerUser"` // 0 means unlimited
+	Active         bool    `json:"active"`
+	TimesUsed      int     `json:"timesUsed"`
+	CreatedAt      string  `json:"createdAt"`
+}
+
+// CouponRedemption is one use of a coupon on an order
+type CouponRedemption struct {
+	ID        int     `json:"id"`
+	CouponID  int     `json:"couponId"`
+	Code      string  `json:"code"`
+	OrderID   int     `json:"orderId"`
+	Amount    float64 `json:"amount"`
+	CreatedAt string  `json:"createdAt"`
 }
 
 // User represents an authenticated user
 type User struct {
-	ID       int    `json:"id"`
-	Email    string `json:"email"`
-	Password string `json:"password,omitempty"`
-	Role     string `json:"role"` // "admin" or "customer"
-	Name     string `json:"name"`
-	Phone    string `json:"phone"`
+	ID                 int    `json:"id"`
+	Email              string `json:"email"`
+	Password           string `json:"password,omitempty"`
+	Role               string `json:"role"` // "admin" or "customer"
+	Name               string `json:"name"`
+	Phone              string `json:"phone"`
+	Disabled           bool   `json:"disabled"`
+	MustChangePassword bool   `json:"mustChangePassword"`
+	TwoFactorEnabled   bool   `json:"twoFactorEnabled"`
+	TOTPSecret         string `json:"-"`
+	TOTPLastStep       int64  `json:"-"`
+	PasswordChangedAt  int64  `json:"-"` // Unix time; tokens issued earlier are revoked
+}
+
+// UserDetail is the admin view of a user with their activity
+type UserDetail struct {
+	User     User       `json:"user"`
+	Orders   []Order    `json:"orders"`
+	Feedback []Feedback `json:"feedback"`
+}
+
+// UpdateRoleRequest is the payload for changing a user's role
+type UpdateRoleRequest struct {
+	Role string `json:"role"`
+}
+
+// PasswordResetResponse is returned when an admin forces a password reset.
+// The temporary password is emailed to the user, never returned.
+type PasswordResetResponse struct {
+	SentTo string `json:"sentTo"`
+}
+
+// AuditEntry records an administrative action
+type AuditEntry struct {
+	ID           int    `json:"id"`
+	ActorID      int    `json:"actorId"`
+	ActorEmail   string `json:"actorEmail"`
+	Action       string `json:"action"`
+	TargetUserID *int   `json:"targetUserId,omitempty"`
+	Details      string `json:"details,omitempty"`
+	CreatedAt    string `json:"createdAt"`
 }
 
 // LoginRequest is the payload for login
@@ -124,16 +563,480 @@ type RegisterRequest struct {
 	Phone    string `json:"phone"`
 }
 
+// LoginChallenge is returned instead of AuthResponse when the password was
+// correct but a second step is needed. InterimToken is only accepted by the
+// two-factor endpoints.
+type LoginChallenge struct {
+	TwoFactorRequired  bool   `json:"twoFactorRequired,omitempty"`
+	EnrollmentRequired bool   `json:"enrollmentRequired,omitempty"`
+	InterimToken       string `json:"interimToken"`
+}
+
+// TwoFactorLoginRequest completes a login with a TOTP or recovery code
+type TwoFactorLoginRequest struct {
+	InterimToken string `json:"interimToken"`
+	Code         string `json:"code"`
+	RecoveryCode string `json:"recoveryCode"`
+}
+
+// TOTPEnrollment is returned when starting two-factor enrollment
+type TOTPEnrollment struct {
+	Secret     string `json:"secret"`
+	OTPAuthURI string `json:"otpauthUri"`
+}
+
+// TOTPCodeRequest carries a TOTP code, plus the password where required
+type TOTPCodeRequest struct {
+	Code     string `json:"code"`
+	Password string `json:"password,omitempty"`
+}
+
+// RecoveryCodesResponse lists freshly generated recovery codes. A full
+// token is included when enrollment completed a login.
+type RecoveryCodesResponse struct {
+	RecoveryCodes []string `json:"recoveryCodes"`
+	Token         string   `json:"token,omitempty"`
+}
+
+// APIKey is a long-lived credential for scripts and integrations. The key
+// itself is only returned once, when it is created.
+type APIKey struct {
+	ID         int      `json:"id"`
+	UserID     int      `json:"userId"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	CreatedAt  string   `json:"createdAt"`
+	ExpiresAt  *string  `json:"expiresAt,omitempty"`
+	LastUsedAt *string  `json:"lastUsedAt,omitempty"`
+	RevokedAt  *string  `json:"revokedAt,omitempty"`
+	Key        string   `json:"key,omitempty"`
+	KeyHash    string   `json:"-"`
+}
+
+// Promotion is a message for the promo bar. Start/end, days of week and
+// audience limit when and to whom it is shown.
+type Promotion struct {
+	ID         int     `json:"id"`
+	Message    string  `json:"message"`
+	StartsAt   *string `json:"startsAt,omitempty"`
+	EndsAt     *string `json:"endsAt,omitempty"`
+	DaysOfWeek []int   `json:"daysOfWeek"` // 0 = Sunday; empty means every day
+	Priority   int     `json:"priority"`
+	Audience   string  `json:"audience"` // all, logged_in or category:<name>
+	Active     bool    `json:"active"`
+	CreatedAt  string  `json:"createdAt"`
+	UpdatedAt  string  `json:"updatedAt"`
+}
+
+// CreateAPIKeyRequest is the payload for minting an API key
+type CreateAPIKeyRequest struct {
+	Name          string   `json:"name"`
+	Scopes        []string `json:"scopes"`
+	ExpiresInDays int      `json:"expiresInDays"` // 0 means no expiry
+}
+
+// UserIdentity is an external (OIDC) login linked to a user
+type UserIdentity struct {
+	Provider  string `json:"provider"`
+	Subject   string `json:"subject"`
+	Email     string `json:"email"`
+	CreatedAt string `json:"createdAt"`
+}
+
+// EmailVerification is a pending change of email address
+type EmailVerification struct {
+	NewEmail  string `json:"newEmail"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// DataExport is everything we hold about a user, for data-subject requests
+type DataExport struct {
+	ExportedAt         string              `json:"exportedAt"`
+	User               User                `json:"user"`
+	Orders             []Order             `json:"orders"`
+	Refunds            []Refund            `json:"refunds"`
+	Payments           []PaymentIntent     `json:"payments"`
+	CouponRedemptions  []CouponRedemption  `json:"couponRedemptions"`
+	Feedback           []Feedback          `json:"feedback"`
+	Identities         []UserIdentity      `json:"identities"`
+	APIKeys            []APIKey            `json:"apiKeys"`
+	Loyalty            []LoyaltyEntry      `json:"loyalty"`
+	GiftCards          []GiftCard          `json:"giftCards"`
+	EmailVerifications []EmailVerification `json:"emailVerifications"`
+	AuditLog           []AuditEntry        `json:"auditLog"`
+}
+
+// DeleteAccountRequest confirms deletion of one's own account
+type DeleteAccountRequest struct {
+	Password string `json:"password"`
+}
+
+// UpdateProfileRequest is the payload for PATCH /api/auth/me. Only fields
+// that are present are changed. Changing the email requires the current
+// password and only takes effect once the new address is verified.
+type UpdateProfileRequest struct {
+	Name            *string `json:"name"`
+	Phone           *string `json:"phone"`
+	Email           *string `json:"email"`
+	CurrentPassword string  `json:"currentPassword"`
+}
+
+// UpdateProfileResponse is returned after a profile update
+type UpdateProfileResponse struct {
+	User         User   `json:"user"`
+	PendingEmail string `json:"pendingEmail,omitempty"`
+}
+
+// ChangePasswordRequest is the payload for changing one's own password
+type ChangePasswordRequest struct {
+	CurrentPassword string `json:"currentPassword"`
+	NewPassword     string `json:"newPassword"`
+}
+
+// VerifyEmailRequest is the payload for confirming an email change
+type VerifyEmailRequest struct {
+	Token string `json:"token"`
+}
+
 // AuthResponse is returned after successful auth
 type AuthResponse struct {
 	Token string `json:"token"`
 	User  User   `json:"user"`
 }
 
-// OrderSupplyRequest is the payload for ordering supplies
+// OrderSupplyRequest is the payload for ordering supplies of one product.
+// It is a shortcut for a single-line purchase order; the supplier and unit
+// cost default to those of the product's last purchase order.
 type OrderSupplyRequest struct {
-	Quantity int  `json:"quantity"`
-	Received bool `json:"received"`
+	Quantity     int      `json:"quantity"`
+	Received     bool     `json:"received"`
+	SupplierID   *int     `json:"supplierId,omitempty"`
+	UnitCost     *float64 `json:"unitCost,omitempty"`
+	ExpectedDate string   `json:"expectedDate,omitempty"`
+	ExpiresAt    string   `json:"expiresAt,omitempty"` // of stock received
+}
+
+// Supplier is a company we buy stock from. LeadTimeDays is how long its
+// deliveries usually take.
+type Supplier struct {
+	ID           int    `json:"id"`
+	Name         string `json:"name"`
+	ContactName  string `json:"contactName,omitempty"`
+	Email        string `json:"email,omitempty"`
+	Phone        string `json:"phone,omitempty"`
+	LeadTimeDays int    `json:"leadTimeDays"`
+	Notes        string `json:"notes,omitempty"`
+	Active       bool   `json:"active"`
+	CreatedAt    string `json:"createdAt"`
+}
+
+// PurchaseOrder is stock ordered from a supplier. Status is draft,
+// ordered, partially_received, received or cancelled. Lines still to be
+// received count towards the products' ordered quantity.
+type PurchaseOrder struct {
+	ID           int                    `json:"id"`
+	SupplierID   *int                   `json:"supplierId,omitempty"`
+	SupplierName string                 `json:"supplierName,omitempty"`
+	Status       string                 `json:"status"`
+	ExpectedDate string                 `json:"expectedDate,omitempty"` // YYYY-MM-DD
+	Notes        string                 `json:"notes,omitempty"`
+	Lines        []PurchaseOrderLine    `json:"lines"`
+	Receipts     []PurchaseOrderReceipt `json:"receipts,omitempty"`
+	Total        float64                `json:"total"`
+	CreatedBy    *int                   `json:"createdBy,omitempty"`
+	OrderedAt    *string                `json:"orderedAt,omitempty"`
+	ReceivedAt   *string                `json:"receivedAt,omitempty"`
+	CreatedAt    string                 `json:"createdAt"`
+}
+
+// PurchaseOrderLine is one product on a purchase order
+type PurchaseOrderLine struct {
+	ID               int     `json:"id"`
+	ProductID        int     `json:"productId"`
+	ProductName      string  `json:"productName,omitempty"`
+	Quantity         int     `json:"quantity"`
+	ReceivedQuantity int     `json:"receivedQuantity"`
+	UnitCost         float64 `json:"unitCost"`
+}
+
+// PurchaseOrderReceipt records a delivery against a purchase order line
+type PurchaseOrderReceipt struct {
+	ID         int    `json:"id"`
+	LineID     int    `json:"lineId"`
+	ProductID  int    `json:"productId"`
+	Quantity   int    `json:"quantity"`
+	ReceivedBy *int   `json:"receivedBy,omitempty"`
+	ReceivedAt string `json:"receivedAt"`
+}
+
+// ReceiveRequest receives stock on a purchase order, or everything still
+// outstanding when Lines is empty
+type ReceiveRequest struct {
+	Lines []ReceiveLine `json:"lines"`
+}
+
+// ReceiveLine is how much of a purchase order line arrived
+type ReceiveLine struct {
+	LineID    int    `json:"lineId"`
+	Quantity  int    `json:"quantity"`
+	ExpiresAt string `json:"expiresAt,omitempty"` // YYYY-MM-DD
+}
+
+// StockMovement is a line in the stock ledger. Reason is sale, receipt,
+// adjustment, waste or return; quantity is negative when stock goes out and
+// balance is the stock left after the movement.
+type StockMovement struct {
+	ID            int    `json:"id"`
+	ProductID     int    `json:"productId"`
+	Quantity      int    `json:"quantity"`
+	Balance       int    `json:"balance"`
+	Reason        string `json:"reason"`
+	ReferenceType string `json:"referenceType,omitempty"`
+	ReferenceID   *int   `json:"referenceId,omitempty"`
+	Note          string `json:"note,omitempty"`
+	ActorID       *int   `json:"actorId,omitempty"`
+	CreatedAt     string `json:"createdAt"`
+	// Lot is the lot stock coming in goes into, filled in with its ID, or
+	// the lot stock going out is taken from first
+	Lot *StockLot `json:"lot,omitempty"`
+}
+
+// StockLot is stock of a product received together. Stock is sold from
+// the lot that expires soonest, then the oldest. ExpiresAt is the last day
+// it can be used, empty for stock that keeps; Expired lots are not sold.
+type StockLot struct {
+	ID               int     `json:"id"`
+	ProductID        int     `json:"productId"`
+	ProductName      string  `json:"productName,omitempty"`
+	ReceivedQuantity int     `json:"receivedQuantity"`
+	Quantity         int     `json:"quantity"` // left in stock
+	UnitCost         float64 `json:"unitCost"`
+	ExpiresAt        string  `json:"expiresAt,omitempty"` // YYYY-MM-DD
+	Expired          bool    `json:"expired"`
+	PurchaseOrderID  *int    `json:"purchaseOrderId,omitempty"`
+	ReceivedAt       string  `json:"receivedAt"`
+}
+
+// StockAdjustmentRequest changes a product's stock by hand. Stock added
+// can be given an expiry date.
+type StockAdjustmentRequest struct {
+	Quantity  int    `json:"quantity"`
+	Reason    string `json:"reason"`
+	Note      string `json:"note"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+// Ingredient is something products are made from, kept in stock in its
+// unit
+type Ingredient struct {
+	ID                int     `json:"id"`
+	Name              string  `json:"name"`
+	Unit              string  `json:"unit"`
+	StockQuantity     float64 `json:"stockQuantity"`
+	LowStockThreshold float64 `json:"lowStockThreshold"`
+	UnitCost          float64 `json:"unitCost"`
+	CreatedAt         string  `json:"createdAt"`
+}
+
+// IngredientMovement is a line in the ingredient stock ledger, like
+// StockMovement for products
+type IngredientMovement struct {
+	ID            int     `json:"id"`
+	IngredientID  int     `json:"ingredientId"`
+	Quantity      float64 `json:"quantity"`
+	Balance       float64 `json:"balance"`
+	Reason        string  `json:"reason"`
+	ReferenceType string  `json:"referenceType,omitempty"`
+	ReferenceID   *int    `json:"referenceId,omitempty"`
+	Note          string  `json:"note,omitempty"`
+	ActorID       *int    `json:"actorId,omitempty"`
+	CreatedAt     string  `json:"createdAt"`
+}
+
+// IngredientAdjustmentRequest changes an ingredient's stock by hand
+type IngredientAdjustmentRequest struct {
+	Quantity float64 `json:"quantity"`
+	Reason   string  `json:"reason"`
+	Note     string  `json:"note"`
+}
+
+// Recipe is what one of a product is made from. Lines without a portion
+// size are used for portion sizes that have no lines of their own.
+type Recipe struct {
+	ProductID int          `json:"productId"`
+	Lines     []RecipeLine `json:"lines"`
+}
+
+// RecipeLine is the quantity of an ingredient, in its unit, in one portion
+type RecipeLine struct {
+	PortionSize    string  `json:"portionSize,omitempty"`
+	IngredientID   int     `json:"ingredientId"`
+	IngredientName string  `json:"ingredientName,omitempty"`
+	Unit           string  `json:"unit,omitempty"`
+	Quantity       float64 `json:"quantity"`
+}
+
+// WasteEntry is food thrown away: a product, taken from stock or from the
+// ingredients of its recipe, or an ingredient. Cost is what it cost us, at
+// the lot's cost, the last purchase price or the recipe's ingredient costs.
+type WasteEntry struct {
+	ID           int     `json:"id"`
+	ProductID    *int    `json:"productId,omitempty"`
+	IngredientID *int    `json:"ingredientId,omitempty"`
+	LotID        *int    `json:"lotId,omitempty"`
+	Name         string  `json:"name"`
+	Unit         string  `json:"unit,omitempty"`
+	PortionSize  string  `json:"portionSize,omitempty"`
+	Quantity     float64 `json:"quantity"`
+	Reason       string  `json:"reason"`
+	Note         string  `json:"note,omitempty"`
+	UnitCost     float64 `json:"unitCost"`
+	Cost         float64 `json:"cost"`
+	StaffID      *int    `json:"staffId,omitempty"`
+	StaffName    string  `json:"staffName,omitempty"`
+	RecordedBy   *int    `json:"recordedBy,omitempty"`
+	CreatedAt    string  `json:"createdAt"`
+}
+
+// WasteRequest records food thrown away: a product or an ingredient.
+// StaffID is who wasted it, by default whoever records it. LotID is the
+// lot of the product it came from, when known.
+type WasteRequest struct {
+	ProductID    *int    `json:"productId"`
+	IngredientID *int    `json:"ingredientId"`
+	LotID        *int    `json:"lotId"`
+	PortionSize  string  `json:"portionSize"`
+	Quantity     float64 `json:"quantity"`
+	Reason       string  `json:"reason"`
+	Note         string  `json:"note"`
+	StaffID      *int    `json:"staffId"`
+}
+
+// WasteReport is the cost of waste over the last Days days, against net
+// sales. WastePercent is the waste cost as a percent of sales.
+type WasteReport struct {
+	Days         int                `json:"days"`
+	Sales        float64            `json:"sales"`
+	WasteCost    float64            `json:"wasteCost"`
+	WastePercent float64            `json:"wastePercent"`
+	Reasons      []WasteReasonTotal `json:"reasons"`
+	Items        []WasteItem        `json:"items"`
+}
+
+// WasteReasonTotal is the waste recorded for one reason
+type WasteReasonTotal struct {
+	Reason  string  `json:"reason"`
+	Entries int     `json:"entries"`
+	Cost    float64 `json:"cost"`
+}
+
+// WasteItem is the waste of one product or ingredient. Sales is the
+// product's own net sales, or all sales for ingredients. WastePercent is
+// nil when there were none.
+type WasteItem struct {
+	ProductID    *int     `json:"productId,omitempty"`
+	IngredientID *int     `json:"ingredientId,omitempty"`
+	Name         string   `json:"name"`
+	Unit         string   `json:"unit,omitempty"`
+	Entries      int      `json:"entries"`
+	Quantity     float64  `json:"quantity"`
+	Cost         float64  `json:"cost"`
+	Sales        float64  `json:"sales"`
+	WastePercent *float64 `json:"wastePercent"`
+}
+
+// StockCount is a stock-take: products are counted by hand and their stock
+// corrected to match. Status is open while counting, then posted or
+// cancelled. Products in an open count are locked against stock changes
+// other than returns.
+type StockCount struct {
+	ID     int    `json:"id"`
+	Status string `json:"status"`
+	Note   string `json:"note,omitempty"`
+	Reason string `json:"reason,omitempty"`
+	// Products is how many products are in the count and Counted how many
+	// have been counted
+	Products     int              `json:"products"`
+	Counted      int              `json:"counted"`
+	VarianceCost float64          `json:"varianceCost"`
+	Lines        []StockCountLine `json:"lines,omitempty"`
+	CreatedBy    *int             `json:"createdBy,omitempty"`
+	ClosedBy     *int             `json:"closedBy,omitempty"`
+	ClosedAt     *string          `json:"closedAt,omitempty"`
+	CreatedAt    string           `json:"createdAt"`
+}
+
+// StockCountLine is one product in a stock count. ExpectedQuantity is the
+// stock when the count was posted, or the stock now until then. Variance is
+// the counted quantity less the expected one, valued at the unit cost of
+// the last purchase order.
+type StockCountLine struct {
+	ProductID        int     `json:"productId"`
+	ProductName      string  `json:"productName"`
+	ExpectedQuantity int     `json:"expectedQuantity"`
+	CountedQuantity  *int    `json:"countedQuantity"`
+	Variance         *int    `json:"variance"`
+	UnitCost         float64 `json:"unitCost"`
+	VarianceCost     float64 `json:"varianceCost"`
+}
+
+// StockCountRequest opens a stock count of some products, or else of every
+// product in Category, or of all products. Products made from a recipe are
+// only counted when listed.
+type StockCountRequest struct {
+	ProductIDs []int  `json:"productIds"`
+	Category   string `json:"category"`
+	Note       string `json:"note"`
+}
+
+// StockCountEntry is a product's counted quantity, or nil to clear it
+type StockCountEntry struct {
+	ProductID       int  `json:"productId"`
+	CountedQuantity *int `json:"countedQuantity"`
+}
+
+// StockCountEntriesRequest records counted quantities in a stock count
+type StockCountEntriesRequest struct {
+	Lines []StockCountEntry `json:"lines"`
+}
+
+// StockCountPostRequest posts a stock count, correcting the stock of the
+// products counted. Reason is why, and goes on their stock movements.
+type StockCountPostRequest struct {
+	Reason string `json:"reason"`
+}
+
+// ReorderSuggestion is a product that should be reordered soon. The
+// supplier and unit cost are from its last purchase order.
+type ReorderSuggestion struct {
+	ProductID         int     `json:"productId"`
+	ProductName       string  `json:"productName"`
+	StockQuantity     int     `json:"stockQuantity"`
+	OrderedQuantity   int     `json:"orderedQuantity"`
+	DraftQuantity     int     `json:"draftQuantity"` // on draft purchase orders
+	LowStockThreshold int     `json:"lowStockThreshold"`
+	UnitsSold         int     `json:"unitsSold"`
+	DailySales        float64 `json:"dailySales"`
+	SupplierID        *int    `json:"supplierId,omitempty"`
+	SupplierName      string  `json:"supplierName,omitempty"`
+	LeadTimeDays      int     `json:"leadTimeDays"`
+	UnitCost          float64 `json:"unitCost"`
+	ReorderPoint      int     `json:"reorderPoint"`
+	SuggestedQuantity int     `json:"suggestedQuantity"`
+	EstimatedCost     float64 `json:"estimatedCost"`
+	ReorderDate       string  `json:"reorderDate"`
+	ExpectedDate      string  `json:"expectedDate"`
+	StockoutDate      *string `json:"stockoutDate,omitempty"`
+}
+
+// ReorderRequest turns reorder suggestions into purchase orders, one per
+// supplier: those for ProductIDs, or else those due within Days. Status is
+// ordered (the default) or draft.
+type ReorderRequest struct {
+	ProductIDs []int  `json:"productIds"`
+	Status     string `json:"status"`
+	Days       int    `json:"days"`
 }
 
 // DailyStat represents sales statistics for a single day
@@ -141,6 +1044,8 @@ type DailyStat struct {
 	Date         string  `json:"date"`
 	TotalOrders  int     `json:"totalOrders"`
 	TotalRevenue float64 `json:"totalRevenue"`
+	TotalTax     float64 `json:"totalTax"`
+	TotalTips    float64 `json:"totalTips"`
 }
 
 // MonthlyStat represents sales statistics for a single month
@@ -148,6 +1053,35 @@ type MonthlyStat struct {
 	Month        string  `json:"month"`
 	TotalOrders  int     `json:"totalOrders"`
 	TotalRevenue float64 `json:"totalRevenue"`
+	TotalTax     float64 `json:"totalTax"`
+	TotalTips    float64 `json:"totalTips"`
+}
+
+// TaxRate is a sales tax rate in percent for a menu category. The rate
+// with an empty Category applies to categories without their own.
+type TaxRate struct {
+	Category     string  `json:"category"`
+	Name         string  `json:"name"`
+	DineInRate   float64 `json:"dineInRate"`
+	TakeawayRate float64 `json:"takeawayRate"`
+}
+
+// TipSummary is the tips taken on one day, for paying out to staff
+type TipSummary struct {
+	Date          string  `json:"date"`
+	Orders        int     `json:"orders"`
+	Tips          float64 `json:"tips"`
+	ServiceCharge float64 `json:"serviceCharge"`
+}
+
+// TaxTotal is the tax collected at one rate for one order type, net of
+// refunds
+type TaxTotal struct {
+	Month     string  `json:"month"`
+	OrderType string  `json:"orderType"`
+	Rate      float64 `json:"rate"`
+	Taxable   float64 `json:"taxable"`
+	Tax       float64 `json:"tax"`
 }
 
 // TopSellingItem represents an item and its total quantity sold
@@ -161,15 +1095,15 @@ type TopSellingItem struct {
 
 // SalesReport represents the full sales report data
 type SalesReport struct {
-	DailySales   []DailyStat      `json:"dailySales"`
-	Revenue []MonthlyStat `json:"revenue"`
-	MonthlySales []MonthlyStat `json:"monthlySales"`
-	TopItems     []TopSellingItem `json:"topItems"`
-	TotalOrdersbyDay []DailyStat `json:"totalOrdersbyDay"`
-	TotalRevenuebyDay []DailyStat `json:"totalRevenuebyDay"`
-	TotalOrdersbyMonth []MonthlyStat `json:"totalOrdersbyMonth"`
-	TotalRevenuebyMonth []MonthlyStat `json:"totalRevenuebyMonth"`
-
+	DailySales          []DailyStat      `json:"dailySales"`
+	Revenue             []MonthlyStat    `json:"revenue"`
+	MonthlySales        []MonthlyStat    `json:"monthlySales"`
+	TopItems            []TopSellingItem `json:"topItems"`
+	TotalOrdersbyDay    []DailyStat      `json:"totalOrdersbyDay"`
+	TotalRevenuebyDay   []DailyStat      `json:"totalRevenuebyDay"`
+	TotalOrdersbyMonth  []MonthlyStat    `json:"totalOrdersbyMonth"`
+	TotalRevenuebyMonth []MonthlyStat    `json:"totalRevenuebyMonth"`
+	TaxTotals           []TaxTotal       `json:"taxTotals"`
 }
 
 // DashboardStats represents aggregated data for the dashboard
@@ -179,10 +1113,32 @@ type DashboardStats struct {
 	LowStockItems []Product   `json:"lowStockItems"`
 	Inventory     []Product   `json:"inventory"`
 	DailyStats    []DailyStat `json:"dailyStats"`
+	// LowStockIngredients are ingredients at or below their threshold
+	LowStockIngredients []Ingredient `json:"lowStockIngredients"`
+	// ExpiringLots are lots with stock left that expire soon
+	ExpiringLots []StockLot `json:"expiringLots"`
+	// GiftCardLiability is the balance left on gift cards, which is owed
+	// to card holders rather than earned
+	GiftCardLiability float64 `json:"giftCardLiability"`
 }
 
 type SalesCharts struct {
-	pieChart []MonthlyStat `json:"pieChart"`
+	pieChart  []MonthlyStat `json:"pieChart"`
 	lineChart []MonthlyStat `json:"lineChart"`
-	barChart []MonthlyStat `json:"barChart"`
+	barChart  []MonthlyStat `json:"barChart"`
+}
+
+// KitchenTicket is an order's ticket for one kitchen station. Status is
+// pending until printed, or failed once retries run out.
+type KitchenTicket struct {
+	ID            int     `json:"id"`
+	OrderID       int     `json:"orderId"`
+	Station       string  `json:"station"`
+	Status        string  `json:"status"`
+	Attempts      int     `json:"attempts"`
+	LastError     string  `json:"lastError,omitempty"`
+	NextAttemptAt string  `json:"nextAttemptAt,omitempty"`
+	PrintedAt     *string `json:"printedAt,omitempty"`
+	CreatedAt     string  `json:"createdAt"`
+	Data          []byte  `json:"-"`
 }
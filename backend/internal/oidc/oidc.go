@@ -0,0 +1,415 @@
+// Package oidc implements the relying-party side of the OpenID Connect
+// authorization code flow with PKCE.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	// discoveryTTL is how long provider metadata and keys are cached
+	discoveryTTL = time.Hour
+	// keyRefetchInterval is how often an unknown key ID may refetch the keys
+	keyRefetchInterval = time.Minute
+)
+
+var httpClient = &http.Client{Timeout: 10 * time.Second}
+
+// Provider is a configured OpenID provider, e.g. Google or Apple
+type Provider struct {
+	Name         string
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+	RedirectURL  string
+	Scopes       []string
+
+	mu            sync.Mutex
+	metadata      *metadata
+	keys          map[string]crypto.PublicKey
+	fetchedAt     time.Time
+	keysFetchedAt time.Time
+}
+
+// metadata is the subset of the discovery document we use
+type metadata struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	JWKSURI               string `json:"jwks_uri"`
+}
+
+// IDTokenClaims are the verified claims of an ID token
+type IDTokenClaims struct {
+	Nonce           string `json:"nonce"`
+	Email           string `json:"email"`
+	EmailVerified   any    `json:"email_verified"` // Apple sends "true" as a string
+	Name            string `json:"name"`
+	AuthorizedParty string `json:"azp"`
+	jwt.RegisteredClaims
+}
+
+// IsEmailVerified reports whether the provider vouches for the email
+func (c *IDTokenClaims) IsEmailVerified() bool {
+	switch v := c.EmailVerified.(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+// LoadProviders reads providers from the environment. OIDC_PROVIDERS lists
+// provider names; each one is configured with OIDC_<NAME>_ISSUER,
+// OIDC_<NAME>_CLIENT_ID, OIDC_<NAME>_CLIENT_SECRET, OIDC_<NAME>_REDIRECT_URL
+// and optionally OIDC_<NAME>_SCOPES (space separated).
+func LoadProviders() (map[string]*Provider, error) {
+	providers := map[string]*Provider{}
+	for _, name := range strings.Split(os.Getenv("OIDC_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+
+		prefix := "OIDC_" + strings.ToUpper(name) + "_"
+		p := &Provider{
+			Name:         name,
+			Issuer:       strings.TrimSuffix(os.Getenv(prefix+"ISSUER"), "/"),
+			ClientID:     os.Getenv(prefix + "CLIENT_ID"),
+			ClientSecret: os.Getenv(prefix + "CLIENT_SECRET"),
+			RedirectURL:  os.Getenv(prefix + "REDIRECT_URL"),
+			Scopes:       []string{"openid", "email", "profile"},
+		}
+		if scopes := os.Getenv(prefix + "SCOPES"); scopes != "" {
+			p.Scopes = strings.Fields(scopes)
+		}
+
+		if p.Issuer == "" || p.ClientID == "" || p.RedirectURL == "" {
+			return nil, fmt.Errorf("provider %q needs %sISSUER, %sCLIENT_ID and %sREDIRECT_URL",
+				name, prefix, prefix, prefix)
+		}
+		providers[name] = p
+	}
+	return providers, nil
+}
+
+// NewPKCEVerifier returns a random code verifier (RFC 7636)
+func NewPKCEVerifier() (string, error) {
+	return RandomString(32)
+}
+
+// RandomString returns n random bytes, base64url encoded
+func RandomString(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(buf), nil
+}
+
+// pkceChallenge derives the S256 code challenge from a verifier
+func pkceChallenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// AuthCodeURL returns the URL to send the user to for login
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce,
+	verifier string) (string, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("response_type", "code")
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURL)
+	q.Set("scope", strings.Join(p.Scopes, " "))
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+	q.Set("code_challenge", pkceChallenge(verifier))
+	q.Set("code_challenge_method", "S256")
+
+	sep := "?"
+	if strings.Contains(md.AuthorizationEndpoint, "?") {
+		sep = "&"
+	}
+	return md.AuthorizationEndpoint + sep + q.Encode(), nil
+}
+
+// Exchange trades an authorization code for tokens and returns the verified
+// ID token claims. The nonce must match the one sent in AuthCodeURL.
+func (p *Provider) Exchange(ctx context.Context, code, verifier,
+	nonce string) (*IDTokenClaims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURL)
+	form.Set("client_id", p.ClientID)
+	form.Set("code_verifier", verifier)
+	if p.ClientSecret != "" {
+		form.Set("client_secret", p.ClientSecret)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost,
+		md.TokenEndpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("token endpoint returned %d: %s", resp.StatusCode,
+			strings.TrimSpace(string(body)))
+	}
+
+	var tokens struct {
+		IDToken string `json:"id_token"`
+	}
+	if err := json.Unmarshal(body, &tokens); err != nil {
+		return nil, err
+	}
+	if tokens.IDToken == "" {
+		return nil, errors.New("token response has no id_token")
+	}
+
+	return p.VerifyIDToken(ctx, tokens.IDToken, nonce)
+}
+
+// VerifyIDToken checks the signature, issuer, audience, expiry and nonce of
+// an ID token
+func (p *Provider) VerifyIDToken(ctx context.Context, rawToken,
+	nonce string) (*IDTokenClaims, error) {
+	md, err := p.discover(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	keyFunc := func(t *jwt.Token) (any, error) {
+		kid, _ := t.Header["kid"].(string)
+		return p.key(ctx, kid)
+	}
+
+	claims := &IDTokenClaims{}
+	_, err = jwt.ParseWithClaims(rawToken, claims, keyFunc,
+		jwt.WithValidMethods([]string{"RS256", "ES256", "EdDSA"}),
+		jwt.WithIssuer(md.Issuer),
+		jwt.WithAudience(p.ClientID),
+		jwt.WithExpirationRequired(),
+		jwt.WithLeeway(time.Minute))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(claims.Audience) > 1 && claims.AuthorizedParty != p.ClientID {
+		return nil, errors.New("id_token azp does not match client")
+	}
+	if claims.Nonce == "" || claims.Nonce != nonce {
+		return nil, errors.New("id_token nonce mismatch")
+	}
+	if claims.Subject == "" {
+		return nil, errors.New("id_token has no subject")
+	}
+	return claims, nil
+}
+
+// discover returns cached provider metadata, fetching it when stale
+func (p *Provider) discover(ctx context.Context) (*metadata, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if p.metadata != nil && time.Since(p.fetchedAt) < discoveryTTL {
+		return p.metadata, nil
+	}
+
+	var md metadata
+	if err := getJSON(ctx, p.Issuer+"/.well-known/openid-configuration",
+		&md); err != nil {
+		return nil, fmt.Errorf("discovery for %s: %w", p.Name, err)
+	}
+	if strings.TrimSuffix(md.Issuer, "/") != p.Issuer {
+		return nil, fmt.Errorf("discovery for %s: issuer mismatch %q", p.Name,
+			md.Issuer)
+	}
+
+	keys, err := fetchKeys(ctx, md.JWKSURI)
+	if err != nil {
+		return nil, fmt.Errorf("jwks for %s: %w", p.Name, err)
+	}
+
+	p.metadata, p.keys, p.fetchedAt = &md, keys, time.Now()
+	p.keysFetchedAt = p.fetchedAt
+	return p.metadata, nil
+}
+
+// key returns the provider's signing key for kid, refetching the key set
+// if the kid is unknown (the provider may have rotated). Refetches happen
+// at most once per keyRefetchInterval, outside the lock, so tokens with
+// made-up key IDs cannot hammer the provider or hold up other logins.
+func (p *Provider) key(ctx context.Context, kid string) (any, error) {
+	p.mu.Lock()
+	k, ok := p.keys[kid]
+	jwksURI := p.metadata.JWKSURI
+	refetch := !ok && time.Since(p.keysFetchedAt) >= keyRefetchInterval
+	if refetch {
+		p.keysFetchedAt = time.Now()
+	}
+	p.mu.Unlock()
+
+	if ok {
+		return k, nil
+	}
+	if !refetch {
+		return nil, fmt.Errorf("unknown signing key %q", kid)
+	}
+
+	keys, err := fetchKeys(ctx, jwksURI)
+	if err != nil {
+		return nil, err
+	}
+	p.mu.Lock()
+	p.keys = keys
+	p.mu.Unlock()
+	if k, ok := keys[kid]; ok {
+		return k, nil
+	}
+	return nil, fmt.Errorf("unknown signing key %q", kid)
+}
+
+// jwk is a single key in a provider's JWKS
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Crv string `json:"crv"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+func fetchKeys(ctx context.Context, jwksURI string) (map[string]crypto.PublicKey, error) {
+	var set struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := getJSON(ctx, jwksURI, &set); err != nil {
+		return nil, err
+	}
+
+	keys := map[string]crypto.PublicKey{}
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		pub, err := k.publicKey()
+		if err != nil {
+			continue // skip key types we do not support
+		}
+		keys[k.Kid] = pub
+	}
+	return keys, nil
+}
+
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	decode := base64.RawURLEncoding.DecodeString
+	switch k.Kty {
+	case "RSA":
+		n, err := decode(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decode(k.E)
+		if err != nil {
+			return nil, err
+		}
+		return &rsa.PublicKey{
+			N: new(big.Int).SetBytes(n),
+			E: int(new(big.Int).SetBytes(e).Int64()),
+		}, nil
+	case "EC":
+		if k.Crv != "P-256" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decode(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		return &ecdsa.PublicKey{
+			Curve: elliptic.P256(),
+			X:     new(big.Int).SetBytes(x),
+			Y:     new(big.Int).SetBytes(y),
+		}, nil
+	case "OKP":
+		if k.Crv != "Ed25519" {
+			return nil, fmt.Errorf("unsupported curve %q", k.Crv)
+		}
+		x, err := decode(k.X)
+		if err != nil {
+			return nil, err
+		}
+		return ed25519.PublicKey(x), nil
+	}
+	return nil, fmt.Errorf("unsupported key type %q", k.Kty)
+}
+
+func getJSON(ctx context.Context, url string, v any) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("GET %s returned %d", url, resp.StatusCode)
+	}
+	return json.NewDecoder(io.LimitReader(resp.Body, 1<<20)).Decode(v)
+}
@@ -0,0 +1,204 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// testIssuer is an OpenID provider serving a key set that can be rotated
+type testIssuer struct {
+	*httptest.Server
+	mu        sync.Mutex
+	keys      map[string]ed25519.PrivateKey
+	jwksHits  atomic.Int32
+	blockJWKS chan struct{} // when set, key set requests wait for it to close
+}
+
+func newTestIssuer(t *testing.T) *testIssuer {
+	iss := &testIssuer{keys: map[string]ed25519.PrivateKey{}}
+	mux := http.NewServeMux()
+	mux.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(metadata{Issuer: iss.URL, JWKSURI: iss.URL + "/jwks"})
+	})
+	mux.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		iss.jwksHits.Add(1)
+		iss.mu.Lock()
+		block := iss.blockJWKS
+		var set struct {
+			Keys []jwk `json:"keys"`
+		}
+		for kid, k := range iss.keys {
+			set.Keys = append(set.Keys, jwk{Kty: "OKP", Crv: "Ed25519", Kid: kid,
+				X: base64.RawURLEncoding.EncodeToString(k.Public().(ed25519.PublicKey))})
+		}
+		iss.mu.Unlock()
+		if block != nil {
+			<-block
+		}
+		json.NewEncoder(w).Encode(set)
+	})
+	iss.Server = httptest.NewServer(mux)
+	t.Cleanup(iss.Close)
+	iss.rotate(t, "key-1")
+	return iss
+}
+
+// rotate adds a new signing key
+func (iss *testIssuer) rotate(t *testing.T, kid string) {
+	_, priv, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	iss.mu.Lock()
+	iss.keys[kid] = priv
+	iss.mu.Unlock()
+}
+
+// idToken signs an ID token for client with kid, or an unknown key when
+// kid is not in the key set
+func (iss *testIssuer) idToken(t *testing.T, kid, client, nonce string, expiry time.Duration) string {
+	t.Helper()
+	iss.mu.Lock()
+	priv, ok := iss.keys[kid]
+	iss.mu.Unlock()
+	if !ok {
+		_, priv, _ = ed25519.GenerateKey(rand.Reader)
+	}
+	token := jwt.NewWithClaims(jwt.SigningMethodEdDSA, IDTokenClaims{
+		Nonce: nonce,
+		Email: "user@example.com",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    iss.URL,
+			Subject:   "user-1",
+			Audience:  jwt.ClaimStrings{client},
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(expiry)),
+		},
+	})
+	token.Header["kid"] = kid
+	raw, err := token.SignedString(priv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func (iss *testIssuer) provider() *Provider {
+	return &Provider{Name: "test", Issuer: iss.URL, ClientID: "client"}
+}
+
+func TestVerifyIDToken(t *testing.T) {
+	iss := newTestIssuer(t)
+	p := iss.provider()
+	ctx := context.Background()
+
+	tests := []struct {
+		name   string
+		token  string
+		nonce  string
+		wantOK bool
+	}{
+		{"valid", iss.idToken(t, "key-1", "client", "n1", time.Hour), "n1", true},
+		{"wrong nonce", iss.idToken(t, "key-1", "client", "n1", time.Hour), "n2", false},
+		{"other client", iss.idToken(t, "key-1", "other", "n1", time.Hour), "n1", false},
+		{"expired", iss.idToken(t, "key-1", "client", "n1", -time.Hour), "n1", false},
+		{"unknown key", iss.idToken(t, "forged", "client", "n1", time.Hour), "n1", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			claims, err := p.VerifyIDToken(ctx, tt.token, tt.nonce)
+			if tt.wantOK && (err != nil || claims.Subject != "user-1") {
+				t.Errorf("VerifyIDToken = %+v, %v; want user-1", claims, err)
+			}
+			if !tt.wantOK && err == nil {
+				t.Error("VerifyIDToken accepted the token")
+			}
+		})
+	}
+}
+
+func TestKeyRefetch(t *testing.T) {
+	iss := newTestIssuer(t)
+	p := iss.provider()
+	ctx := context.Background()
+	if _, err := p.discover(ctx); err != nil {
+		t.Fatal(err)
+	}
+	fetched := iss.jwksHits.Load()
+
+	// Unknown key IDs refetch the keys at most once a minute
+	for i := 0; i < 3; i++ {
+		if _, err := p.key(ctx, "forged"); err == nil {
+			t.Fatal("found a key that does not exist")
+		}
+	}
+	if got := iss.jwksHits.Load() - fetched; got != 0 {
+		t.Errorf("refetched %d times right after discovery, want 0", got)
+	}
+
+	p.mu.Lock()
+	p.keysFetchedAt = time.Now().Add(-keyRefetchInterval)
+	p.mu.Unlock()
+	iss.rotate(t, "key-2")
+	for i := 0; i < 3; i++ {
+		if _, err := p.key(ctx, "key-2"); err != nil {
+			t.Fatalf("rotated key: %v", err)
+		}
+		if _, err := p.key(ctx, "forged"); err == nil {
+			t.Fatal("found a key that does not exist")
+		}
+	}
+	if got := iss.jwksHits.Load() - fetched; got != 1 {
+		t.Errorf("refetched %d times, want 1", got)
+	}
+}
+
+func TestKeyRefetchOutsideLock(t *testing.T) {
+	iss := newTestIssuer(t)
+	p := iss.provider()
+	ctx := context.Background()
+	if _, err := p.discover(ctx); err != nil {
+		t.Fatal(err)
+	}
+	p.keysFetchedAt = time.Time{}
+
+	block := make(chan struct{})
+	iss.mu.Lock()
+	iss.blockJWKS = block
+	iss.mu.Unlock()
+	refetched := make(chan struct{})
+	go func() {
+		p.key(ctx, "forged")
+		close(refetched)
+	}()
+	for iss.jwksHits.Load() < 2 {
+		time.Sleep(time.Millisecond)
+	}
+
+	// A known key is found while the refetch waits on the provider
+	found := make(chan error, 1)
+	go func() {
+		_, err := p.key(ctx, "key-1")
+		found <- err
+	}()
+	select {
+	case err := <-found:
+		if err != nil {
+			t.Error(err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Error("looking up a known key waited for the refetch")
+	}
+	close(block)
+	<-refetched
+}
@@ -0,0 +1,197 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// MockSignatureHeader carries the mock provider's webhook signature: the
+// hex HMAC-SHA256 of the body, keyed with the webhook secret
+const MockSignatureHeader = "Mock-Signature"
+
+// defaultMockWebhookSecret is used when MOCK_WEBHOOK_SECRET is not set
+const defaultMockWebhookSecret = "mock-webhook-secret"
+
+// Mock is an in-memory provider for development and tests. It understands
+// Stripe's test payment methods: pm_card_visa and other pm_card_* tokens
+// succeed, while pm_card_chargeDeclined,
+// pm_card_chargeDeclinedInsufficientFunds and
+// pm_card_chargeDeclinedExpiredCard are declined. Payments are lost when
+// the server restarts.
+type Mock struct {
+	mu            sync.Mutex
+	seq           int
+	payments      map[string]*mockPayment
+	idempotent    map[string]Result
+	webhookSecret []byte
+}
+
+type mockPayment struct {
+	status     Status
+	authorized int64
+	captured   int64
+	refunded   int64
+}
+
+// MockPaymentMethods are the test payment methods checkout offers instead
+// of a card form with the mock provider, the approved one first
+var MockPaymentMethods = []string{
+	"pm_card_visa",
+	"pm_card_chargeDeclined",
+	"pm_card_chargeDeclinedInsufficientFunds",
+	"pm_card_chargeDeclinedExpiredCard",
+}
+
+// mockDeclines maps declining test payment methods to their failure code
+var mockDeclines = map[string]string{
+	"pm_card_chargedeclined":                  "card_declined",
+	"pm_card_chargedeclinedinsufficientfunds": "insufficient_funds",
+	"pm_card_chargedeclinedexpiredcard":       "expired_card",
+}
+
+// NewMock returns a mock provider. An empty secret uses a fixed
+// development secret.
+func NewMock(webhookSecret string) *Mock {
+	if webhookSecret == "" {
+		webhookSecret = defaultMockWebhookSecret
+	}
+	return &Mock{
+		payments:      map[string]*mockPayment{},
+		idempotent:    map[string]Result{},
+		webhookSecret: []byte(webhookSecret),
+	}
+}
+
+func (m *Mock) Name() string { return "mock" }
+
+func (m *Mock) Authorize(ctx context.Context, req AuthorizeRequest) (*Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := m.idempotent[req.IdempotencyKey]; ok && req.IdempotencyKey != "" {
+		return &r, nil
+	}
+	if req.Amount <= 0 {
+		return nil, fmt.Errorf("mock: amount must be positive")
+	}
+	method := strings.ToLower(req.PaymentMethod)
+	if !strings.HasPrefix(method, "pm_card_") {
+		return nil, fmt.Errorf("mock: unknown payment method %q", req.PaymentMethod)
+	}
+
+	m.seq++
+	ref := fmt.Sprintf("mock_pi_%d", m.seq)
+	result := Result{ProviderRef: ref, Amount: req.Amount}
+	if code, declined := mockDeclines[method]; declined {
+		result.Status = StatusFailed
+		result.FailureCode = code
+		result.FailureMessage = "Your card was declined."
+		m.payments[ref] = &mockPayment{status: StatusFailed}
+	} else {
+		result.Status = StatusAuthorized
+		m.payments[ref] = &mockPayment{status: StatusAuthorized, authorized: req.Amount}
+	}
+	if req.IdempotencyKey != "" {
+		m.idempotent[req.IdempotencyKey] = result
+	}
+	return &result, nil
+}
+
+func (m *Mock) Capture(ctx context.Context, ref string, amount int64) (*Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.payments[ref]
+	if !ok {
+		return nil, fmt.Errorf("mock: no payment %s", ref)
+	}
+	if p.status == StatusCaptured && p.captured == amount {
+		return &Result{ProviderRef: ref, Status: StatusCaptured, Amount: amount}, nil
+	}
+	if p.status != StatusAuthorized {
+		return nil, fmt.Errorf("mock: payment %s is %s, not authorized", ref, p.status)
+	}
+	if amount <= 0 || amount > p.authorized {
+		return nil, fmt.Errorf("mock: cannot capture %d of %d", amount, p.authorized)
+	}
+	p.status, p.captured = StatusCaptured, amount
+	return &Result{ProviderRef: ref, Status: StatusCaptured, Amount: amount}, nil
+}
+
+func (m *Mock) Void(ctx context.Context, ref string) (*Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	p, ok := m.payments[ref]
+	if !ok {
+		return nil, fmt.Errorf("mock: no payment %s", ref)
+	}
+	if p.status != StatusAuthorized && p.status != StatusVoided {
+		return nil, fmt.Errorf("mock: payment %s is %s, not authorized", ref, p.status)
+	}
+	p.status = StatusVoided
+	return &Result{ProviderRef: ref, Status: StatusVoided}, nil
+}
+
+func (m *Mock) Refund(ctx context.Context, ref string, amount int64, idempotencyKey string) (*Result, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	if r, ok := m.idempotent[idempotencyKey]; ok && idempotencyKey != "" {
+		return &r, nil
+	}
+	p, ok := m.payments[ref]
+	if !ok {
+		return nil, fmt.Errorf("mock: no payment %s", ref)
+	}
+	if p.status != StatusCaptured && p.status != StatusPartiallyRefunded {
+		return nil, fmt.Errorf("mock: payment %s is %s, not captured", ref, p.status)
+	}
+	if amount <= 0 || p.refunded+amount > p.captured {
+		return nil, fmt.Errorf("mock: cannot refund %d of %d remaining", amount,
+			p.captured-p.refunded)
+	}
+
+	p.refunded += amount
+	p.status = StatusPartiallyRefunded
+	if p.refunded == p.captured {
+		p.status = StatusRefunded
+	}
+	m.seq++
+	result := Result{
+		ProviderRef: fmt.Sprintf("mock_re_%d", m.seq),
+		Status:      p.status,
+		Amount:      amount,
+	}
+	if idempotencyKey != "" {
+		m.idempotent[idempotencyKey] = result
+	}
+	return &result, nil
+}
+
+// VerifyWebhook accepts events in Stripe's format signed with
+// MockSignatureHeader
+func (m *Mock) VerifyWebhook(payload []byte, header http.Header) (*Event, error) {
+	sig, err := hex.DecodeString(header.Get(MockSignatureHeader))
+	if err != nil || !hmac.Equal(sig, m.sign(payload)) {
+		return nil, ErrInvalidSignature
+	}
+	return parseStripeEvent(payload)
+}
+
+// Sign returns the MockSignatureHeader value for a webhook body
+func (m *Mock) Sign(payload []byte) string {
+	return hex.EncodeToString(m.sign(payload))
+}
+
+func (m *Mock) sign(payload []byte) []byte {
+	mac := hmac.New(sha256.New, m.webhookSecret)
+	mac.Write(payload)
+	return mac.Sum(nil)
+}
@@ -0,0 +1,152 @@
+package payments
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+)
+
+func TestMockAuthorize(t *testing.T) {
+	tests := []struct {
+		method      string
+		status      Status
+		failureCode string
+		wantErr     bool
+	}{
+		{"pm_card_visa", StatusAuthorized, "", false},
+		{"pm_card_chargeDeclined", StatusFailed, "card_declined", false},
+		{"pm_card_chargeDeclinedInsufficientFunds", StatusFailed, "insufficient_funds", false},
+		{"pm_card_chargeDeclinedExpiredCard", StatusFailed, "expired_card", false},
+		{"tok_visa", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method, func(t *testing.T) {
+			m := NewMock("")
+			r, err := m.Authorize(context.Background(), AuthorizeRequest{
+				Amount: 1250, Currency: "usd", PaymentMethod: tt.method,
+			})
+			if tt.wantErr {
+				if err == nil {
+					t.Fatalf("Authorize = %+v, want an error", r)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if r.Status != tt.status || r.FailureCode != tt.failureCode {
+				t.Errorf("Authorize = %s %q, want %s %q", r.Status, r.FailureCode,
+					tt.status, tt.failureCode)
+			}
+		})
+	}
+}
+
+func TestMockIdempotentAuthorize(t *testing.T) {
+	m := NewMock("")
+	req := AuthorizeRequest{Amount: 500, PaymentMethod: "pm_card_visa",
+		IdempotencyKey: "order-1-authorize-1"}
+	first, err := m.Authorize(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	again, err := m.Authorize(context.Background(), req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if again.ProviderRef != first.ProviderRef {
+		t.Errorf("retried authorization made a new payment %s, want %s",
+			again.ProviderRef, first.ProviderRef)
+	}
+}
+
+func TestMockLifecycle(t *testing.T) {
+	ctx := context.Background()
+	m := NewMock("")
+	auth, err := m.Authorize(ctx, AuthorizeRequest{Amount: 1000, PaymentMethod: "pm_card_visa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ref := auth.ProviderRef
+
+	if _, err := m.Refund(ctx, ref, 1000, ""); err == nil {
+		t.Error("refunded a payment that was only authorized")
+	}
+	if _, err := m.Capture(ctx, ref, 1001); err == nil {
+		t.Error("captured more than was authorized")
+	}
+	r, err := m.Capture(ctx, ref, 1000)
+	if err != nil || r.Status != StatusCaptured {
+		t.Fatalf("Capture = %+v, %v", r, err)
+	}
+	if _, err := m.Void(ctx, ref); err == nil {
+		t.Error("voided a captured payment")
+	}
+
+	r, err = m.Refund(ctx, ref, 400, "refund-1")
+	if err != nil || r.Status != StatusPartiallyRefunded {
+		t.Fatalf("partial Refund = %+v, %v", r, err)
+	}
+	if r, err = m.Refund(ctx, ref, 400, "refund-1"); err != nil ||
+		r.Status != StatusPartiallyRefunded {
+		t.Fatalf("retried Refund = %+v, %v", r, err)
+	}
+	if _, err := m.Refund(ctx, ref, 601, "refund-2"); err == nil {
+		t.Error("refunded more than was left")
+	}
+	r, err = m.Refund(ctx, ref, 600, "refund-3")
+	if err != nil || r.Status != StatusRefunded {
+		t.Fatalf("final Refund = %+v, %v", r, err)
+	}
+}
+
+func TestMockVoid(t *testing.T) {
+	ctx := context.Background()
+	m := NewMock("")
+	auth, err := m.Authorize(ctx, AuthorizeRequest{Amount: 1000, PaymentMethod: "pm_card_visa"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 2; i++ {
+		r, err := m.Void(ctx, auth.ProviderRef)
+		if err != nil || r.Status != StatusVoided {
+			t.Fatalf("Void #%d = %+v, %v", i+1, r, err)
+		}
+	}
+	if _, err := m.Capture(ctx, auth.ProviderRef, 1000); err == nil {
+		t.Error("captured a voided payment")
+	}
+	if _, err := m.Void(ctx, "mock_pi_404"); err == nil {
+		t.Error("voided a payment that does not exist")
+	}
+}
+
+func TestMockVerifyWebhook(t *testing.T) {
+	m := NewMock("secret")
+	body := []byte(`{"id":"evt_1","type":"charge.refunded","data":{"object":{
+		"id":"ch_1","payment_intent":"mock_pi_1","amount_refunded":700,
+		"refunded":true}}}`)
+
+	header := http.Header{}
+	header.Set(MockSignatureHeader, m.Sign(body))
+	event, err := m.VerifyWebhook(body, header)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := Event{ID: "evt_1", Type: "charge.refunded", ProviderRef: "mock_pi_1",
+		Status: StatusRefunded, Amount: 700}
+	if *event != want {
+		t.Errorf("event = %+v, want %+v", *event, want)
+	}
+
+	other := NewMock("other-secret")
+	header.Set(MockSignatureHeader, other.Sign(body))
+	if _, err := m.VerifyWebhook(body, header); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("webhook signed with another secret: err = %v", err)
+	}
+	header.Del(MockSignatureHeader)
+	if _, err := m.VerifyWebhook(body, header); !errors.Is(err, ErrInvalidSignature) {
+		t.Errorf("unsigned webhook: err = %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+// Package payments talks to card payment providers.
+//
+// Orders are paid in two steps: the amount due is authorized (held on the
+// card) when the order is placed and captured when it is completed. An
+// authorization that is never captured is voided, and captured payments can
+// be refunded. Providers report changes they make on their own side, such
+// as a failed or disputed payment, through signed webhooks.
+package payments
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math"
+	"net/http"
+	"os"
+	"strings"
+)
+
+// Status is the state of a payment
+type Status string
+
+const (
+	StatusPending           Status = "pending"
+	StatusAuthorized        Status = "authorized"
+	StatusCaptured          Status = "captured"
+	StatusPartiallyRefunded Status = "partially_refunded"
+	StatusRefunded          Status = "refunded"
+	StatusVoided            Status = "voided"
+	StatusFailed            Status = "failed"
+)
+
+// transitions lists the states a payment may move to from each state, so
+// late or repeated webhooks cannot move a payment backwards
+var transitions = map[Status][]Status{
+	StatusPending:           {StatusAuthorized, StatusCaptured, StatusFailed, StatusVoided},
+	StatusAuthorized:        {StatusCaptured, StatusVoided, StatusFailed},
+	StatusCaptured:          {StatusPartiallyRefunded, StatusRefunded},
+	StatusPartiallyRefunded: {StatusPartiallyRefunded, StatusRefunded},
+}
+
+// CanTransition reports whether a payment in state from may move to to
+func CanTransition(from, to Status) bool {
+	for _, s := range transitions[from] {
+		if s == to {
+			return true
+		}
+	}
+	return false
+}
+
+// AuthorizeRequest asks a provider to hold an amount on a payment method
+type AuthorizeRequest struct {
+	Amount         int64  // in the smallest currency unit, e.g. cents
+	Currency       string // ISO 4217, lower case
+	PaymentMethod  string // provider token for the card
+	OrderID        int
+	IdempotencyKey string
+}
+
+// Result is the outcome of a call to a provider. A declined card is a
+// Result with StatusFailed, not an error; errors mean the provider could not
+// be reached or rejected the request itself.
+type Result struct {
+	ProviderRef    string // the provider's id for the payment (or refund)
+	Status         Status
+	Amount         int64
+	FailureCode    string
+	FailureMessage string
+}
+
+// Event is a verified webhook notification about a payment
+type Event struct {
+	ID          string
+	Type        string
+	ProviderRef string // the provider's id for the payment
+	Status      Status // empty when the event does not change the status
+	Amount      int64  // amount captured or refunded so far, if known
+}
+
+// Provider is a card payment gateway
+type Provider interface {
+	// Name identifies the provider in stored payments
+	Name() string
+	Authorize(ctx context.Context, req AuthorizeRequest) (*Result, error)
+	// Capture takes amount (at most the authorized amount) from an
+	// authorized payment
+	Capture(ctx context.Context, ref string, amount int64) (*Result, error)
+	// Void releases an authorization without taking any money
+	Void(ctx context.Context, ref string) (*Result, error)
+	// Refund returns amount of a captured payment to the customer
+	Refund(ctx context.Context, ref string, amount int64, idempotencyKey string) (*Result, error)
+	// VerifyWebhook checks a webhook's signature and parses it
+	VerifyWebhook(payload []byte, header http.Header) (*Event, error)
+}
+
+// ErrInvalidSignature is returned for webhooks that fail verification
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// Currency is the currency orders are charged in, from PAYMENT_CURRENCY
+var Currency = "usd"
+
+// PublishableKey is the key the checkout page uses to turn card details
+// into a payment method token, from STRIPE_PUBLISHABLE_KEY
+var PublishableKey string
+
+// FromEnv builds the provider named by PAYMENT_PROVIDER (mock or stripe).
+// Outside development the provider must be chosen explicitly.
+func FromEnv(devMode bool) (Provider, error) {
+	if c := os.Getenv("PAYMENT_CURRENCY"); c != "" {
+		Currency = strings.ToLower(c)
+	}
+
+	name := strings.ToLower(os.Getenv("PAYMENT_PROVIDER"))
+	switch name {
+	case "":
+		if !devMode {
+			return nil, errors.New("PAYMENT_PROVIDER is required outside development " +
+				"(set APP_ENV=development to use the mock provider)")
+		}
+		return NewMock(os.Getenv("MOCK_WEBHOOK_SECRET")), nil
+	case "mock":
+		if !devMode {
+			slog.Warn("using the mock payment provider; no real payments are taken")
+		}
+		return NewMock(os.Getenv("MOCK_WEBHOOK_SECRET")), nil
+	case "stripe":
+		key := os.Getenv("STRIPE_SECRET_KEY")
+		if key == "" {
+			return nil, errors.New("STRIPE_SECRET_KEY is required for the stripe provider")
+		}
+		PublishableKey = os.Getenv("STRIPE_PUBLISHABLE_KEY")
+		if PublishableKey == "" {
+			return nil, errors.New("STRIPE_PUBLISHABLE_KEY is required for the stripe provider")
+		}
+		return NewStripe(key, os.Getenv("STRIPE_WEBHOOK_SECRET"),
+			os.Getenv("STRIPE_API_BASE")), nil
+	default:
+		return nil, fmt.Errorf("unknown PAYMENT_PROVIDER %q", name)
+	}
+}
+
+// ToMinor converts a dollar amount to cents
+func ToMinor(amount float64) int64 {
+	return int64(math.Round(amount * 100))
+}
+
+// FromMinor converts cents to a dollar amount
+func FromMinor(amount int64) float64 {
+	return float64(amount) / 100
+}
@@ -0,0 +1,313 @@
+package payments
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	defaultStripeAPIBase = "https://api.stripe.com"
+	// stripeSignatureTolerance is how old a webhook may be, against replays
+	stripeSignatureTolerance = 5 * time.Minute
+)
+
+// Stripe uses the Stripe PaymentIntents API, or any server compatible with
+// it. Authorizations are created with manual capture.
+type Stripe struct {
+	secretKey     string
+	webhookSecret string
+	baseURL       string
+	client        *http.Client
+}
+
+// NewStripe returns a Stripe provider. An empty baseURL uses the Stripe API.
+func NewStripe(secretKey, webhookSecret, baseURL string) *Stripe {
+	if baseURL == "" {
+		baseURL = defaultStripeAPIBase
+	}
+	return &Stripe{
+		secretKey:     secretKey,
+		webhookSecret: webhookSecret,
+		baseURL:       strings.TrimRight(baseURL, "/"),
+		client:        &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+func (s *Stripe) Name() string { return "stripe" }
+
+// stripeObject holds the fields used from payment intents, charges and
+// refunds
+type stripeObject struct {
+	ID               string `json:"id"`
+	Object           string `json:"object"`
+	Status           string `json:"status"`
+	Amount           int64  `json:"amount"`
+	AmountReceived   int64  `json:"amount_received"`
+	AmountRefunded   int64  `json:"amount_refunded"`
+	Refunded         bool   `json:"refunded"`
+	PaymentIntent    string `json:"payment_intent"`
+	LastPaymentError *struct {
+		Code    string `json:"code"`
+		Message string `json:"message"`
+	} `json:"last_payment_error"`
+}
+
+type stripeError struct {
+	Error struct {
+		Type          string        `json:"type"`
+		Code          string        `json:"code"`
+		DeclineCode   string        `json:"decline_code"`
+		Message       string        `json:"message"`
+		PaymentIntent *stripeObject `json:"payment_intent"`
+	} `json:"error"`
+}
+
+func (s *Stripe) Authorize(ctx context.Context, req AuthorizeRequest) (*Result, error) {
+	form := url.Values{
+		"amount":                 {strconv.FormatInt(req.Amount, 10)},
+		"currency":               {req.Currency},
+		"payment_method":         {req.PaymentMethod},
+		"payment_method_types[]": {"card"},
+		"capture_method":         {"manual"},
+		"confirm":                {"true"},
+		"metadata[order_id]":     {strconv.Itoa(req.OrderID)},
+	}
+	obj, declined, err := s.post(ctx, "/v1/payment_intents", form, req.IdempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	if declined != nil {
+		return declined, nil
+	}
+
+	result := intentResult(obj)
+	if result.Status == StatusPending && obj.Status == "requires_action" {
+		// 3-D Secure needs the customer's browser, which checkout does not
+		// support yet
+		result.Status = StatusFailed
+		result.FailureCode = "authentication_required"
+		result.FailureMessage = "Your card requires authentication, which is not supported."
+	}
+	return result, nil
+}
+
+func (s *Stripe) Capture(ctx context.Context, ref string, amount int64) (*Result, error) {
+	form := url.Values{"amount_to_capture": {strconv.FormatInt(amount, 10)}}
+	obj, declined, err := s.post(ctx, "/v1/payment_intents/"+url.PathEscape(ref)+"/capture",
+		form, "capture-"+ref)
+	if err != nil {
+		return nil, err
+	}
+	if declined != nil {
+		return declined, nil
+	}
+	return intentResult(obj), nil
+}
+
+func (s *Stripe) Void(ctx context.Context, ref string) (*Result, error) {
+	obj, declined, err := s.post(ctx, "/v1/payment_intents/"+url.PathEscape(ref)+"/cancel",
+		url.Values{}, "void-"+ref)
+	if err != nil {
+		return nil, err
+	}
+	if declined != nil {
+		return declined, nil
+	}
+	return intentResult(obj), nil
+}
+
+func (s *Stripe) Refund(ctx context.Context, ref string, amount int64, idempotencyKey string) (*Result, error) {
+	form := url.Values{
+		"payment_intent": {ref},
+		"amount":         {strconv.FormatInt(amount, 10)},
+	}
+	obj, declined, err := s.post(ctx, "/v1/refunds", form, idempotencyKey)
+	if err != nil {
+		return nil, err
+	}
+	if declined != nil {
+		return declined, nil
+	}
+
+	result := &Result{ProviderRef: obj.ID, Amount: obj.Amount}
+	switch obj.Status {
+	case "succeeded", "pending":
+		result.Status = StatusRefunded
+	default:
+		result.Status = StatusFailed
+		result.FailureMessage = "Refund " + obj.Status
+	}
+	return result, nil
+}
+
+// VerifyWebhook checks the Stripe-Signature header: an HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the endpoint's signing secret
+func (s *Stripe) VerifyWebhook(payload []byte, header http.Header) (*Event, error) {
+	if s.webhookSecret == "" {
+		return nil, fmt.Errorf("%w: STRIPE_WEBHOOK_SECRET is not set", ErrInvalidSignature)
+	}
+
+	var timestamp string
+	var signatures [][]byte
+	for _, part := range strings.Split(header.Get("Stripe-Signature"), ",") {
+		k, v, _ := strings.Cut(strings.TrimSpace(part), "=")
+		switch k {
+		case "t":
+			timestamp = v
+		case "v1":
+			if sig, err := hex.DecodeString(v); err == nil {
+				signatures = append(signatures, sig)
+			}
+		}
+	}
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil || len(signatures) == 0 {
+		return nil, ErrInvalidSignature
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > stripeSignatureTolerance ||
+		age < -stripeSignatureTolerance {
+		return nil, fmt.Errorf("%w: timestamp outside tolerance", ErrInvalidSignature)
+	}
+
+	mac := hmac.New(sha256.New, []byte(s.webhookSecret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+	expected := mac.Sum(nil)
+	for _, sig := range signatures {
+		if hmac.Equal(sig, expected) {
+			return parseStripeEvent(payload)
+		}
+	}
+	return nil, ErrInvalidSignature
+}
+
+// post sends a form-encoded request. Card errors are returned as a failed
+// Result rather than an error.
+func (s *Stripe) post(ctx context.Context, path string, form url.Values, idempotencyKey string) (*stripeObject, *Result, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, s.baseURL+path,
+		strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, nil, err
+	}
+	req.SetBasicAuth(s.secretKey, "")
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if idempotencyKey != "" {
+		req.Header.Set("Idempotency-Key", idempotencyKey)
+	}
+
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return nil, nil, fmt.Errorf("stripe: %w", err)
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return nil, nil, fmt.Errorf("stripe: %w", err)
+	}
+
+	if resp.StatusCode >= 300 {
+		var e stripeError
+		json.Unmarshal(body, &e)
+		if e.Error.Type == "card_error" {
+			result := &Result{
+				Status:         StatusFailed,
+				FailureCode:    e.Error.Code,
+				FailureMessage: e.Error.Message,
+			}
+			if e.Error.DeclineCode != "" {
+				result.FailureCode = e.Error.DeclineCode
+			}
+			if e.Error.PaymentIntent != nil {
+				result.ProviderRef = e.Error.PaymentIntent.ID
+				result.Amount = e.Error.PaymentIntent.Amount
+			}
+			return nil, result, nil
+		}
+		return nil, nil, fmt.Errorf("stripe: %s %s: %s", path, resp.Status,
+			e.Error.Message)
+	}
+
+	var obj stripeObject
+	if err := json.Unmarshal(body, &obj); err != nil {
+		return nil, nil, fmt.Errorf("stripe: %w", err)
+	}
+	return &obj, nil, nil
+}
+
+// intentResult maps a payment intent to a Result
+func intentResult(obj *stripeObject) *Result {
+	result := &Result{
+		ProviderRef: obj.ID,
+		Status:      intentStatus(obj.Status),
+		Amount:      obj.Amount,
+	}
+	if result.Status == StatusCaptured {
+		result.Amount = obj.AmountReceived
+	}
+	if obj.LastPaymentError != nil {
+		result.FailureCode = obj.LastPaymentError.Code
+		result.FailureMessage = obj.LastPaymentError.Message
+	}
+	return result
+}
+
+func intentStatus(status string) Status {
+	switch status {
+	case "requires_capture":
+		return StatusAuthorized
+	case "succeeded":
+		return StatusCaptured
+	case "canceled":
+		return StatusVoided
+	case "requires_payment_method":
+		return StatusFailed
+	default:
+		return StatusPending
+	}
+}
+
+// parseStripeEvent reads the events the server acts on from a Stripe-style
+// webhook body. Other event types are returned without a status.
+func parseStripeEvent(payload []byte) (*Event, error) {
+	var raw struct {
+		ID   string `json:"id"`
+		Type string `json:"type"`
+		Data struct {
+			Object stripeObject `json:"object"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(payload, &raw); err != nil {
+		return nil, fmt.Errorf("invalid webhook body: %w", err)
+	}
+
+	obj := raw.Data.Object
+	event := &Event{ID: raw.ID, Type: raw.Type, ProviderRef: obj.ID}
+	switch raw.Type {
+	case "payment_intent.amount_capturable_updated":
+		event.Status, event.Amount = StatusAuthorized, obj.Amount
+	case "payment_intent.succeeded":
+		event.Status, event.Amount = StatusCaptured, obj.AmountReceived
+	case "payment_intent.payment_failed":
+		event.Status = StatusFailed
+	case "payment_intent.canceled":
+		event.Status = StatusVoided
+	case "charge.refunded":
+		event.ProviderRef = obj.PaymentIntent
+		event.Amount = obj.AmountRefunded
+		event.Status = StatusPartiallyRefunded
+		if obj.Refunded {
+			event.Status = StatusRefunded
+		}
+	}
+	return event, nil
+}
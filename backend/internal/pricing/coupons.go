@@ -0,0 +1,157 @@
+package pricing
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"slices"
+	"sort"
+	"time"
+
+	"restaurant-backend/internal/models"
+)
+
+// Coupon types
+const (
+	CouponPercentage = "percentage"
+	CouponFixed      = "fixed"
+	CouponBOGO       = "bogo"
+	CouponFreeItem   = "free_item"
+)
+
+// CouponError is a reason a coupon cannot be used that is safe to show
+// to the customer
+type CouponError struct {
+	Message string
+}
+
+func (e *CouponError) Error() string {
+	return e.Message
+}
+
+func couponErrorf(format string, args ...any) error {
+	return &CouponError{Message: fmt.Sprintf(format, args...)}
+}
+
+// IsCouponError reports whether err explains why a coupon was rejected
+func IsCouponError(err error) bool {
+	var ce *CouponError
+	return errors.As(err, &ce)
+}
+
+// CouponUsage is how often a coupon has been redeemed
+type CouponUsage struct {
+	Total   int
+	ForUser int
+}
+
+// ApplyCoupon checks a coupon against the cart and returns the discount.
+// Usage counts come from the caller since they live in the database.
+func ApplyCoupon(c *models.Coupon, lines []Line, usage CouponUsage, now time.Time) (float64, error) {
+	if !c.Active {
+		return 0, couponErrorf("Coupon %s is not valid", c.Code)
+	}
+	if c.StartsAt != nil {
+		if start, err := time.Parse(time.RFC3339, *c.StartsAt); err == nil &&
+			now.Before(start) {
+			return 0, couponErrorf("Coupon %s is not valid yet", c.Code)
+		}
+	}
+	if c.EndsAt != nil {
+		if end, err := time.Parse(time.RFC3339, *c.EndsAt); err == nil &&
+			!now.Before(end) {
+			return 0, couponErrorf("Coupon %s has expired", c.Code)
+		}
+	}
+	if c.MaxUses > 0 && usage.Total >= c.MaxUses {
+		return 0, couponErrorf("Coupon %s has been fully redeemed", c.Code)
+	}
+	if c.MaxUsesPerUser > 0 && usage.ForUser >= c.MaxUsesPerUser {
+		return 0, couponErrorf("You have already used coupon %s", c.Code)
+	}
+
+	if subtotal := Subtotal(lines); subtotal < c.MinSpend {
+		return 0, couponErrorf("Coupon %s needs a minimum spend of $%.2f",
+			c.Code, c.MinSpend)
+	}
+
+	var discount float64
+	switch c.Type {
+	case CouponFreeItem:
+		discount = freeItemDiscount(c, lines)
+		if discount == 0 {
+			return 0, couponErrorf("Add the free item to your cart to use coupon %s",
+				c.Code)
+		}
+	default:
+		eligible := eligibleLines(c, lines)
+		if len(eligible) == 0 {
+			return 0, couponErrorf("Coupon %s does not apply to any items in your cart",
+				c.Code)
+		}
+
+		switch c.Type {
+		case CouponPercentage:
+			discount = Subtotal(eligible) * c.Value / 100
+		case CouponFixed:
+			discount = math.Min(c.Value, Subtotal(eligible))
+		case CouponBOGO:
+			discount = bogoDiscount(eligible)
+			if discount == 0 {
+				return 0, couponErrorf("Coupon %s needs at least two eligible items",
+					c.Code)
+			}
+		default:
+			return 0, couponErrorf("Coupon %s is not valid", c.Code)
+		}
+	}
+
+	return Round(discount), nil
+}
+
+// eligibleLines returns the lines within the coupon's category and product
+// scope
+func eligibleLines(c *models.Coupon, lines []Line) []Line {
+	var eligible []Line
+	for _, l := range lines {
+		if c.Category != "" && l.Category != c.Category {
+			continue
+		}
+		if len(c.ProductIDs) > 0 && !slices.Contains(c.ProductIDs, l.ProductID) {
+			continue
+		}
+		eligible = append(eligible, l)
+	}
+	return eligible
+}
+
+// bogoDiscount makes every second eligible unit free, cheapest first
+func bogoDiscount(lines []Line) float64 {
+	var units []float64
+	for _, l := range lines {
+		for range l.Quantity {
+			units = append(units, l.UnitPrice)
+		}
+	}
+	sort.Sort(sort.Reverse(sort.Float64Slice(units)))
+
+	var discount float64
+	for i := 1; i < len(units); i += 2 {
+		discount += units[i]
+	}
+	return discount
+}
+
+// freeItemDiscount takes the base price of one unit of the free product
+// off, if it is in the cart
+func freeItemDiscount(c *models.Coupon, lines []Line) float64 {
+	if c.FreeProductID == nil {
+		return 0
+	}
+	for _, l := range lines {
+		if l.ProductID == *c.FreeProductID && l.Quantity > 0 {
+			return l.BasePrice
+		}
+	}
+	return 0
+}
@@ -0,0 +1,37 @@
+// Package pricing computes what a cart costs. It works on lines that the
+// caller has already priced from the catalogue, so it has no database
+// access and the same code serves quotes and checkout.
+package pricing
+
+import (
+	"math"
+)
+
+// Line is one cart item priced from the catalogue
+type Line struct {
+	ProductID int
+	Name      string
+	Category  string
+	BasePrice float64 // product price
+	UnitPrice float64 // product price plus customizations
+	Quantity  int
+}
+
+// Total returns the line total
+func (l Line) Total() float64 {
+	return Round(l.UnitPrice * float64(l.Quantity))
+}
+
+// Subtotal returns the sum of all line totals
+func Subtotal(lines []Line) float64 {
+	var sum float64
+	for _, l := range lines {
+		sum += l.Total()
+	}
+	return Round(sum)
+}
+
+// Round rounds an amount to whole cents
+func Round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
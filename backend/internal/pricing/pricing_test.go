@@ -0,0 +1,254 @@
+package pricing
+
+import (
+	"testing"
+	"time"
+
+	"restaurant-backend/internal/models"
+)
+
+func TestRound(t *testing.T) {
+	tests := []struct {
+		amount float64
+		want   float64
+	}{
+		{0, 0},
+		{1.004, 1},
+		{1.006, 1.01},
+		{2.5, 2.5},
+		{-1.006, -1.01},
+		{19.999, 20},
+	}
+	for _, tt := range tests {
+		if got := Round(tt.amount); got != tt.want {
+			t.Errorf("Round(%v) = %v, want %v", tt.amount, got, tt.want)
+		}
+	}
+}
+
+func TestSubtotal(t *testing.T) {
+	lines := []Line{
+		{UnitPrice: 3.33, Quantity: 3},
+		{UnitPrice: 0.1, Quantity: 7},
+	}
+	if got, want := Subtotal(lines), 10.69; got != want {
+		t.Errorf("Subtotal = %v, want %v", got, want)
+	}
+	if got := Subtotal(nil); got != 0 {
+		t.Errorf("Subtotal(nil) = %v, want 0", got)
+	}
+}
+
+func TestApplyCoupon(t *testing.T) {
+	now := time.Date(2026, 6, 15, 12, 0, 0, 0, time.UTC)
+	past, future := "2026-01-01T00:00:00Z", "2026-12-31T00:00:00Z"
+	burger := 1
+
+	cart := []Line{
+		{ProductID: 1, Category: "western", BasePrice: 9.99, UnitPrice: 9.99, Quantity: 3},
+		{ProductID: 2, Category: "eastern", BasePrice: 12, UnitPrice: 13.5, Quantity: 1},
+	}
+
+	tests := []struct {
+		name     string
+		coupon   models.Coupon
+		lines    []Line
+		usage    CouponUsage
+		inactive bool
+		want     float64
+		wantErr  bool
+	}{
+		{
+			name:   "percentage rounds to cents",
+			coupon: models.Coupon{Type: CouponPercentage, Value: 10},
+			lines:  cart,
+			want:   4.35, // 10% of 43.47
+		},
+		{
+			name:   "percentage of one category",
+			coupon: models.Coupon{Type: CouponPercentage, Value: 15, Category: "western"},
+			lines:  cart,
+			want:   4.5, // 15% of 29.97
+		},
+		{
+			name:   "fixed",
+			coupon: models.Coupon{Type: CouponFixed, Value: 5},
+			lines:  cart,
+			want:   5,
+		},
+		{
+			name:   "fixed is capped at the eligible items",
+			coupon: models.Coupon{Type: CouponFixed, Value: 20, ProductIDs: []int{2}},
+			lines:  cart,
+			want:   13.5,
+		},
+		{
+			name:   "bogo makes every second unit free, cheapest first",
+			coupon: models.Coupon{Type: CouponBOGO},
+			lines: []Line{
+				{ProductID: 1, UnitPrice: 10, Quantity: 1},
+				{ProductID: 2, UnitPrice: 8, Quantity: 2},
+				{ProductID: 3, UnitPrice: 5, Quantity: 1},
+			},
+			want: 13,
+		},
+		{
+			name:    "bogo needs two items",
+			coupon:  models.Coupon{Type: CouponBOGO},
+			lines:   []Line{{ProductID: 1, UnitPrice: 10, Quantity: 1}},
+			wantErr: true,
+		},
+		{
+			name:   "free item takes off the base price",
+			coupon: models.Coupon{Type: CouponFreeItem, FreeProductID: &burger},
+			lines:  []Line{{ProductID: 1, BasePrice: 4, UnitPrice: 5.5, Quantity: 2}},
+			want:   4,
+		},
+		{
+			name:    "free item not in cart",
+			coupon:  models.Coupon{Type: CouponFreeItem, FreeProductID: &burger},
+			lines:   cart[1:],
+			wantErr: true,
+		},
+		{
+			name:    "no eligible items",
+			coupon:  models.Coupon{Type: CouponPercentage, Value: 10, Category: "dessert"},
+			lines:   cart,
+			wantErr: true,
+		},
+		{
+			name:    "below minimum spend",
+			coupon:  models.Coupon{Type: CouponFixed, Value: 5, MinSpend: 50},
+			lines:   cart,
+			wantErr: true,
+		},
+		{
+			name:   "exactly the minimum spend",
+			coupon: models.Coupon{Type: CouponFixed, Value: 5, MinSpend: 43.47},
+			lines:  cart,
+			want:   5,
+		},
+		{
+			name:    "not started",
+			coupon:  models.Coupon{Type: CouponFixed, Value: 5, StartsAt: &future},
+			lines:   cart,
+			wantErr: true,
+		},
+		{
+			name:    "expired",
+			coupon:  models.Coupon{Type: CouponFixed, Value: 5, EndsAt: &past},
+			lines:   cart,
+			wantErr: true,
+		},
+		{
+			name:    "fully redeemed",
+			coupon:  models.Coupon{Type: CouponFixed, Value: 5, MaxUses: 10},
+			lines:   cart,
+			usage:   CouponUsage{Total: 10},
+			wantErr: true,
+		},
+		{
+			name:    "used up by this customer",
+			coupon:  models.Coupon{Type: CouponFixed, Value: 5, MaxUsesPerUser: 1},
+			lines:   cart,
+			usage:   CouponUsage{Total: 1, ForUser: 1},
+			wantErr: true,
+		},
+		{
+			name:     "inactive",
+			coupon:   models.Coupon{Type: CouponFixed, Value: 5},
+			lines:    cart,
+			inactive: true,
+			wantErr:  true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := tt.coupon
+			c.Code, c.Active = "TEST", !tt.inactive
+
+			got, err := ApplyCoupon(&c, tt.lines, tt.usage, now)
+			if tt.wantErr {
+				if !IsCouponError(err) {
+					t.Fatalf("got %v, %v; want a coupon error", got, err)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("discount = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestTip(t *testing.T) {
+	tests := []struct {
+		name    string
+		tip     *models.TipRequest
+		base    float64
+		want    float64
+		wantErr bool
+	}{
+		{name: "none", tip: nil, base: 20, want: 0},
+		{name: "percentage rounds to cents", tip: &models.TipRequest{Type: TipPercentage, Value: 15}, base: 33.33, want: 5},
+		{name: "percentage of a negative base", tip: &models.TipRequest{Type: TipPercentage, Value: 15}, base: -4, want: 0},
+		{name: "maximum percentage", tip: &models.TipRequest{Type: TipPercentage, Value: MaxTipPercent}, base: 10, want: 5},
+		{name: "percentage too high", tip: &models.TipRequest{Type: TipPercentage, Value: 150}, base: 10, wantErr: true},
+		{name: "negative percentage", tip: &models.TipRequest{Type: TipPercentage, Value: -1}, base: 10, wantErr: true},
+		{name: "fixed", tip: &models.TipRequest{Type: TipFixed, Value: 3}, base: 10, want: 3},
+		{name: "fixed rounds to cents", tip: &models.TipRequest{Type: TipFixed, Value: 2.004}, base: 10, want: 2},
+		{name: "fixed too high", tip: &models.TipRequest{Type: TipFixed, Value: MaxTipAmount + 1}, base: 10, wantErr: true},
+		{name: "unknown type", tip: &models.TipRequest{Type: "round_up", Value: 1}, base: 10, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := Tip(tt.tip, tt.base)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("err = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("tip = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestServiceCharge(t *testing.T) {
+	rules := []models.ServiceChargeRule{
+		{Name: "Large party", OrderType: "dine_in", MinPartySize: 6, Rate: 18},
+		{Name: "Large order", MinSubtotal: 100, Rate: 10},
+		{Name: "Dine-in", OrderType: "dine_in", Rate: 12.5},
+	}
+
+	tests := []struct {
+		name      string
+		orderType string
+		partySize int
+		base      float64
+		wantRule  string
+		want      float64
+	}{
+		{name: "no rule matches", orderType: "takeaway", partySize: 1, base: 50},
+		{name: "any order type", orderType: "takeaway", partySize: 1, base: 120, wantRule: "Large order", want: 12},
+		{name: "rounds to cents", orderType: "dine_in", partySize: 2, base: 33.33, wantRule: "Dine-in", want: 4.17},
+		{name: "highest rate wins", orderType: "dine_in", partySize: 8, base: 200, wantRule: "Large party", want: 36},
+		{name: "party size is inclusive", orderType: "dine_in", partySize: 6, base: 10, wantRule: "Large party", want: 1.8},
+		{name: "subtotal is inclusive", orderType: "takeaway", partySize: 1, base: 100, wantRule: "Large order", want: 10},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			rule, got := ServiceCharge(rules, tt.orderType, tt.partySize, tt.base)
+			name := ""
+			if rule != nil {
+				name = rule.Name
+			}
+			if name != tt.wantRule || got != tt.want {
+				t.Errorf("got %q %v, want %q %v", name, got, tt.wantRule, tt.want)
+			}
+		})
+	}
+}
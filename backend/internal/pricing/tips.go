@@ -0,0 +1,64 @@
+package pricing
+
+import (
+	"fmt"
+
+	"restaurant-backend/internal/models"
+)
+
+// Tip types
+const (
+	TipPercentage = "percentage"
+	TipFixed      = "fixed"
+)
+
+// Tip limits, against typos such as 150 instead of 15
+const (
+	MaxTipPercent = 50
+	MaxTipAmount  = 500
+)
+
+// Tip returns the tip a customer asked for. Percentages are of base, the
+// food total after discounts and before tax.
+func Tip(t *models.TipRequest, base float64) (float64, error) {
+	if t == nil {
+		return 0, nil
+	}
+	switch t.Type {
+	case TipPercentage:
+		if t.Value < 0 || t.Value > MaxTipPercent {
+			return 0, fmt.Errorf("tip percentage must be between 0 and %d",
+				MaxTipPercent)
+		}
+		return Round(max(base, 0) * t.Value / 100), nil
+	case TipFixed:
+		if t.Value < 0 || t.Value > MaxTipAmount {
+			return 0, fmt.Errorf("tip must be between 0 and %d", MaxTipAmount)
+		}
+		return Round(t.Value), nil
+	default:
+		return 0, fmt.Errorf("tip type must be %s or %s", TipPercentage, TipFixed)
+	}
+}
+
+// ServiceCharge returns the service charge rule that applies to an order
+// and the charge on base, the food total after discounts and before tax.
+// When several rules match, the highest rate wins.
+func ServiceCharge(rules []models.ServiceChargeRule, orderType string, partySize int, base float64) (*models.ServiceChargeRule, float64) {
+	var best *models.ServiceChargeRule
+	for i, r := range rules {
+		if r.OrderType != "" && r.OrderType != orderType {
+			continue
+		}
+		if partySize < r.MinPartySize || base < r.MinSubtotal {
+			continue
+		}
+		if best == nil || r.Rate > best.Rate {
+			best = &rules[i]
+		}
+	}
+	if best == nil {
+		return nil, 0
+	}
+	return best, Round(max(base, 0) * best.Rate / 100)
+}
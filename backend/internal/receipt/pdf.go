@@ -0,0 +1,115 @@
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+)
+
+// The PDF is written by hand with the standard Courier fonts, which every
+// reader has, so the columns line up as on the printed receipt
+const (
+	pageWidth   = 595.0 // A4 in points
+	pageHeight  = 842.0
+	pdfColumns  = 72
+	fontSize    = 10.0
+	titleSize   = 16.0
+	leading     = 13.0
+	charWidth   = 0.6 // Courier glyph width per point of font size
+	topMargin   = 60.0
+	pdfRowsPage = 55 // rows that fit between the top and bottom margins
+)
+
+// PDF renders the receipt as an A4 PDF document
+func (r *Receipt) PDF() []byte {
+	rows := r.layout(pdfColumns)
+	var pages [][]row
+	for len(rows) > pdfRowsPage {
+		pages = append(pages, rows[:pdfRowsPage])
+		rows = rows[pdfRowsPage:]
+	}
+	pages = append(pages, rows)
+
+	left := (pageWidth - pdfColumns*fontSize*charWidth) / 2
+	var objects []string
+	// 1 catalog, 2 page tree, 3 and 4 fonts, then a page and its content
+	// stream for each page
+	kids := make([]string, len(pages))
+	for i := range pages {
+		kids[i] = fmt.Sprintf("%d 0 R", 5+2*i)
+	}
+	objects = append(objects,
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>",
+			strings.Join(kids, " "), len(pages)),
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier /Encoding /WinAnsiEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Courier-Bold /Encoding /WinAnsiEncoding >>",
+	)
+	for i, page := range pages {
+		var content bytes.Buffer
+		y := pageHeight - topMargin
+		for _, row := range page {
+			font, size, x := "/F1", fontSize, left
+			switch row.style {
+			case bold:
+				font = "/F2"
+			case title:
+				font, size = "/F2", titleSize
+				text := strings.TrimSpace(row.text)
+				x = (pageWidth - float64(len([]rune(text)))*size*charWidth) / 2
+				row.text = text
+			}
+			fmt.Fprintf(&content, "BT %s %.1f Tf %.2f %.2f Td (%s) Tj ET\n",
+				font, size, x, y, pdfString(row.text))
+			y -= leading
+			if row.style == title {
+				y -= size - fontSize
+			}
+		}
+		objects = append(objects,
+			fmt.Sprintf("<< /Type /Page /Parent 2 0 R /MediaBox [0 0 %.0f %.0f] "+
+				"/Resources << /Font << /F1 3 0 R /F2 4 0 R >> >> /Contents %d 0 R >>",
+				pageWidth, pageHeight, 6+2*i),
+			fmt.Sprintf("<< /Length %d >>\nstream\n%sendstream", content.Len(),
+				content.String()),
+		)
+	}
+
+	var out bytes.Buffer
+	out.WriteString("%PDF-1.4\n")
+	offsets := make([]int, len(objects))
+	for i, obj := range objects {
+		offsets[i] = out.Len()
+		fmt.Fprintf(&out, "%d 0 obj\n%s\nendobj\n", i+1, obj)
+	}
+	xref := out.Len()
+	fmt.Fprintf(&out, "xref\n0 %d\n0000000000 65535 f \n", len(objects)+1)
+	for _, off := range offsets {
+		fmt.Fprintf(&out, "%010d 00000 n \n", off)
+	}
+	fmt.Fprintf(&out, "trailer\n<< /Size %d /Root 1 0 R >>\nstartxref\n%d\n%%%%EOF\n",
+		len(objects)+1, xref)
+	return out.Bytes()
+}
+
+// pdfString escapes text for a PDF string in WinAnsiEncoding. Characters
+// the encoding lacks print as "?".
+func pdfString(text string) string {
+	var b strings.Builder
+	for _, r := range text {
+		switch {
+		case r == '(' || r == ')' || r == '\\':
+			b.WriteByte('\\')
+			b.WriteRune(r)
+		case r >= 0x20 && r < 0x7f:
+			b.WriteRune(r)
+		case r == '€':
+			b.WriteString(`\200`)
+		case r >= 0xa0 && r <= 0xff:
+			fmt.Fprintf(&b, `\%03o`, r)
+		default:
+			b.WriteByte('?')
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,79 @@
+package receipt
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"strconv"
+	"testing"
+
+	"restaurant-backend/internal/models"
+)
+
+// checkXref checks that every object in the cross-reference table starts
+// where the table says
+func checkXref(t *testing.T, pdf []byte) {
+	t.Helper()
+	m := regexp.MustCompile(`startxref\n(\d+)\n%%EOF\n$`).FindSubmatch(pdf)
+	if m == nil {
+		t.Fatal("no startxref trailer")
+	}
+	xref, _ := strconv.Atoi(string(m[1]))
+	if !bytes.HasPrefix(pdf[xref:], []byte("xref\n")) {
+		t.Fatalf("startxref %d does not point at the xref table", xref)
+	}
+	offsets := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllSubmatch(pdf[xref:], -1)
+	if len(offsets) == 0 {
+		t.Fatal("empty xref table")
+	}
+	for i, off := range offsets {
+		at, _ := strconv.Atoi(string(off[1]))
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !bytes.HasPrefix(pdf[at:], []byte(want)) {
+			t.Errorf("object %d is not at offset %d", i+1, at)
+		}
+	}
+}
+
+func TestPDF(t *testing.T) {
+	pdf := testReceipt().PDF()
+	if !bytes.HasPrefix(pdf, []byte("%PDF-1.4\n")) {
+		t.Fatal("not a PDF")
+	}
+	checkXref(t, pdf)
+	if !bytes.Contains(pdf, []byte("/Count 1 ")) {
+		t.Error("short receipt is not one page")
+	}
+	for _, want := range []string{"(Test Kitchen) Tj", "/F2 16.0 Tf", "Beef Rendang"} {
+		if !bytes.Contains(pdf, []byte(want)) {
+			t.Errorf("PDF is missing %q", want)
+		}
+	}
+}
+
+func TestPDFPages(t *testing.T) {
+	r := testReceipt()
+	for i := 0; i < pdfRowsPage; i++ {
+		r.Order.Items = append(r.Order.Items, models.OrderItem{ProductName: "Tea",
+			Quantity: 1, UnitPrice: 2})
+	}
+	pdf := r.PDF()
+	checkXref(t, pdf)
+	if !bytes.Contains(pdf, []byte("/Count 2 ")) {
+		t.Error("long receipt is not split over two pages")
+	}
+}
+
+func TestPDFString(t *testing.T) {
+	tests := []struct{ text, want string }{
+		{"Order (7)", `Order \(7\)`},
+		{`a\b`, `a\\b`},
+		{"Crème", `Cr\350me`},
+		{"5€", `5\200`},
+		{"Ramen 🍜", "Ramen ?"},
+	}
+	for _, tt := range tests {
+		if got := pdfString(tt.text); got != tt.want {
+			t.Errorf("pdfString(%q) = %q, want %q", tt.text, got, tt.want)
+		}
+	}
+}
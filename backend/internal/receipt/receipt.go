@@ -0,0 +1,304 @@
+// Package receipt renders order receipts, as plain text sized for 80mm
+// receipt printers and as PDF, with the restaurant's branding.
+package receipt
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/tax"
+)
+
+// TextWidth is the number of characters on a line of an 80mm receipt
+// printer in its standard font
+const TextWidth = 48
+
+// Branding is what the receipt says about the restaurant
+type Branding struct {
+	Name    string
+	Address string // lines separated by "|"
+	Phone   string
+	Website string
+	TaxID   string
+	Footer  string
+}
+
+// Settings is the active branding, see LoadConfig
+var Settings = Branding{
+	Name:   "reststoresoft",
+	Footer: "Thank you for your order!",
+}
+
+// LoadConfig reads the RECEIPT_* variables, keeping the defaults for any
+// that are unset
+func LoadConfig() {
+	for env, field := range map[string]*string{
+		"RECEIPT_NAME":    &Settings.Name,
+		"RECEIPT_ADDRESS": &Settings.Address,
+		"RECEIPT_PHONE":   &Settings.Phone,
+		"RECEIPT_WEBSITE": &Settings.Website,
+		"RECEIPT_TAX_ID":  &Settings.TaxID,
+		"RECEIPT_FOOTER":  &Settings.Footer,
+	} {
+		if v, ok := os.LookupEnv(env); ok {
+			*field = strings.TrimSpace(v)
+		}
+	}
+}
+
+// Receipt is an order with what was paid and refunded on it
+type Receipt struct {
+	Branding Branding
+	Order    *models.Order
+	// Payment is the order's card payment, nil when there is none
+	Payment *models.PaymentIntent
+	Refunds []models.Refund
+}
+
+// style is how a row is printed
+type style int
+
+const (
+	plain style = iota
+	bold
+	title
+)
+
+// row is one line of the receipt
+type row struct {
+	text  string
+	style style
+}
+
+// layout lays the receipt out in rows of at most width characters
+func (r *Receipt) layout(width int) []row {
+	var rows []row
+	add := func(s style, text string) { rows = append(rows, row{text, s}) }
+	center := func(s style, text string) {
+		for _, l := range wrap(text, width) {
+			add(s, strings.Repeat(" ", (width-utf8.RuneCountInString(l))/2)+l)
+		}
+	}
+	amount := func(s style, label string, v float64) {
+		for _, l := range columns(label, money(v), width) {
+			add(s, l)
+		}
+	}
+	rule := func() { add(plain, strings.Repeat("-", width)) }
+
+	b, o := r.Branding, r.Order
+	center(title, b.Name)
+	for _, l := range strings.Split(b.Address, "|") {
+		if l = strings.TrimSpace(l); l != "" {
+			center(plain, l)
+		}
+	}
+	for _, l := range []string{b.Phone, b.Website} {
+		if l != "" {
+			center(plain, l)
+		}
+	}
+	if b.TaxID != "" {
+		center(plain, "Tax ID: "+b.TaxID)
+	}
+	rule()
+
+	for _, l := range columns(fmt.Sprintf("Order #%d", o.ID), formatTime(o.CreatedAt), width) {
+		add(bold, l)
+	}
+	kind := "Takeaway"
+	if o.OrderType == tax.DineIn {
+		kind = "Dine in"
+		if o.PartySize > 0 {
+			kind += fmt.Sprintf(", party of %d", o.PartySize)
+		}
+	}
+	add(plain, kind)
+	if o.Status != "completed" {
+		add(plain, "Status: "+o.Status)
+	}
+	rule()
+
+	for _, item := range o.Items {
+		name := item.ProductName
+		if name == "" {
+			name = fmt.Sprintf("Product #%d", item.ProductID)
+		}
+		amount(plain, fmt.Sprintf("%d x %s", item.Quantity, name),
+			item.UnitPrice*float64(item.Quantity))
+		var details []string
+		if item.PortionSize != "" {
+			details = append(details, "Portion: "+item.PortionSize)
+		}
+		for _, c := range item.Customizations {
+			details = append(details, "+ "+c.Name)
+		}
+		if item.RefundedQuantity > 0 {
+			details = append(details, fmt.Sprintf("Refunded: %d", item.RefundedQuantity))
+		}
+		for _, d := range details {
+			for _, l := range wrap(d, width-4) {
+				add(plain, "    "+l)
+			}
+		}
+	}
+	for _, g := range o.GiftCardPurchases {
+		amount(plain, "Gift card ****"+g.Last4, g.Amount)
+	}
+	rule()
+
+	amount(plain, "Subtotal", o.Subtotal)
+	for _, d := range o.Discounts {
+		amount(plain, d.Description, -d.Amount)
+	}
+	taxes := taxByRate(o.Items)
+	switch {
+	case len(taxes) == 0 && o.Tax > 0:
+		amount(plain, "Tax", o.Tax)
+	case o.TaxInclusive:
+		for _, t := range taxes {
+			amount(plain, fmt.Sprintf("Incl. tax %g%% on %s", t.rate, money(t.taxable)), t.tax)
+		}
+	default:
+		for _, t := range taxes {
+			amount(plain, fmt.Sprintf("Tax %g%% on %s", t.rate, money(t.taxable)), t.tax)
+		}
+	}
+	if o.ServiceCharge > 0 {
+		label := "Service charge"
+		if o.ServiceChargeName != "" {
+			label += " (" + o.ServiceChargeName + ")"
+		}
+		amount(plain, label, o.ServiceCharge)
+	}
+	if o.TipAmount > 0 {
+		amount(plain, "Tip", o.TipAmount)
+	}
+	amount(bold, "TOTAL", o.TotalPrice)
+	rule()
+
+	for _, t := range o.Tenders {
+		amount(plain, "Gift card ****"+t.Last4, t.Amount)
+	}
+	switch {
+	case r.Payment != nil:
+		amount(plain, fmt.Sprintf("Card (%s)", r.Payment.Status), r.Payment.Amount)
+	case o.AmountDue > 0:
+		amount(plain, "Amount due", o.AmountDue)
+	}
+	if len(r.Refunds) > 0 {
+		for _, ref := range r.Refunds {
+			amount(plain, fmt.Sprintf("Refund %s", formatTime(ref.CreatedAt)), -ref.Amount)
+		}
+		amount(bold, "NET TOTAL", o.TotalPrice-o.RefundedAmount)
+	}
+
+	if b.Footer != "" {
+		rule()
+		center(plain, b.Footer)
+	}
+	return rows
+}
+
+// Text renders the receipt for an 80mm receipt printer
+func (r *Receipt) Text() string {
+	var sb strings.Builder
+	for _, row := range r.layout(TextWidth) {
+		text := row.text
+		if row.style == title {
+			text = strings.ToUpper(text)
+		}
+		sb.WriteString(text)
+		sb.WriteByte('\n')
+	}
+	return sb.String()
+}
+
+// rateTax is the tax at one rate on a receipt
+type rateTax struct {
+	rate, taxable, tax float64
+}
+
+// taxByRate adds up the tax on items by rate, lowest rate first
+func taxByRate(items []models.OrderItem) []rateTax {
+	byRate := map[float64]*rateTax{}
+	var out []rateTax
+	for _, item := range items {
+		if item.TaxAmount == 0 {
+			continue
+		}
+		t, ok := byRate[item.TaxRate]
+		if !ok {
+			t = &rateTax{rate: item.TaxRate}
+			byRate[item.TaxRate] = t
+		}
+		t.taxable += item.Taxable
+		t.tax += item.TaxAmount
+	}
+	for _, t := range byRate {
+		out = append(out, *t)
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].rate < out[j].rate })
+	return out
+}
+
+func money(v float64) string {
+	if v < 0 && v > -0.005 {
+		v = 0
+	}
+	return fmt.Sprintf("%.2f", v)
+}
+
+// formatTime shortens a stored timestamp to minutes
+func formatTime(s string) string {
+	for _, layout := range []string{time.RFC3339, "2006-01-02 15:04:05"} {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.Format("2006-01-02 15:04")
+		}
+	}
+	return s
+}
+
+// columns puts left and right on one line of width, wrapping left when
+// they do not fit
+func columns(left, right string, width int) []string {
+	lines := wrap(left, width-utf8.RuneCountInString(right)-1)
+	last := lines[len(lines)-1]
+	pad := width - utf8.RuneCountInString(last) - utf8.RuneCountInString(right)
+	lines[len(lines)-1] = last + strings.Repeat(" ", pad) + right
+	return lines
+}
+
+// wrap breaks text into lines of at most width characters, at spaces
+// where it can
+func wrap(text string, width int) []string {
+	width = max(width, 1)
+	var lines []string
+	line := ""
+	for _, word := range strings.Fields(text) {
+		for utf8.RuneCountInString(word) > width {
+			if line != "" {
+				lines = append(lines, line)
+				line = ""
+			}
+			runes := []rune(word)
+			lines = append(lines, string(runes[:width]))
+			word = string(runes[width:])
+		}
+		switch {
+		case line == "":
+			line = word
+		case utf8.RuneCountInString(line)+1+utf8.RuneCountInString(word) <= width:
+			line += " " + word
+		default:
+			lines = append(lines, line)
+			line = word
+		}
+	}
+	return append(lines, line)
+}
@@ -0,0 +1,159 @@
+package receipt
+
+import (
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/tax"
+)
+
+// testReceipt is a dine-in order paid partly by gift card, with a tip and
+// one refund
+func testReceipt() *Receipt {
+	return &Receipt{
+		Branding: Branding{Name: "Test Kitchen", Address: "1 Main St | Springfield",
+			TaxID: "GB123", Footer: "See you soon"},
+		Order: &models.Order{
+			ID: 7, OrderType: tax.DineIn, PartySize: 2, Status: "completed",
+			CreatedAt: "2026-03-14T18:30:12Z",
+			Items: []models.OrderItem{
+				{ProductName: "Beef Rendang", Quantity: 2, UnitPrice: 12.5,
+					TaxRate: 10, Taxable: 25, TaxAmount: 2.5, RefundedQuantity: 1,
+					Customizations: []models.CustomizationOption{{Name: "Extra Rice"}}},
+				{ProductID: 3, Quantity: 1, UnitPrice: 4, TaxRate: 5, Taxable: 4,
+					TaxAmount: 0.2},
+			},
+			Subtotal:   29,
+			Discounts:  []models.OrderDiscount{{Description: "Welcome", Amount: 2}},
+			TipAmount:  3,
+			TotalPrice: 32.7,
+			Tenders: []models.OrderTender{{Type: "gift_card", Last4: "4321",
+				Amount: 10}},
+			RefundedAmount: 13.75,
+		},
+		Payment: &models.PaymentIntent{Status: "partially_refunded", Amount: 22.7},
+		Refunds: []models.Refund{{Amount: 13.75, CreatedAt: "2026-03-15 09:00:00"}},
+	}
+}
+
+// hasRow reports whether text has a full-width row with left and right
+func hasRow(text, left, right string) bool {
+	for _, l := range strings.Split(text, "\n") {
+		if strings.HasPrefix(l, left) && strings.HasSuffix(l, right) &&
+			utf8.RuneCountInString(l) == TextWidth {
+			return true
+		}
+	}
+	return false
+}
+
+func TestText(t *testing.T) {
+	text := testReceipt().Text()
+
+	for _, l := range strings.Split(strings.TrimSuffix(text, "\n"), "\n") {
+		if n := utf8.RuneCountInString(l); n > TextWidth {
+			t.Errorf("%q is %d wide, want at most %d", l, n, TextWidth)
+		}
+	}
+	for _, want := range []string{"TEST KITCHEN", "Springfield", "Tax ID: GB123",
+		"Dine in, party of 2", "    + Extra Rice", "    Refunded: 1", "See you soon"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("receipt is missing %q:\n%s", want, text)
+		}
+	}
+	if strings.Contains(text, "Status:") {
+		t.Error("completed order shows its status")
+	}
+	rows := [][2]string{
+		{"Order #7", "2026-03-14 18:30"},
+		{"2 x Beef Rendang", "25.00"},
+		{"1 x Product #3", "4.00"},
+		{"Subtotal", "29.00"},
+		{"Welcome", "-2.00"},
+		{"Tax 5% on 4.00", "0.20"},
+		{"Tax 10% on 25.00", "2.50"},
+		{"Tip", "3.00"},
+		{"TOTAL", "32.70"},
+		{"Gift card ****4321", "10.00"},
+		{"Card (partially_refunded)", "22.70"},
+		{"Refund 2026-03-15 09:00", "-13.75"},
+		{"NET TOTAL", "18.95"},
+	}
+	for _, r := range rows {
+		if !hasRow(text, r[0], r[1]) {
+			t.Errorf("receipt has no row %q ... %q:\n%s", r[0], r[1], text)
+		}
+	}
+	if strings.Index(text, "Tax 5%") > strings.Index(text, "Tax 10%") {
+		t.Error("tax rates are not listed lowest first")
+	}
+}
+
+func TestTextUnpaid(t *testing.T) {
+	r := &Receipt{Branding: Settings, Order: &models.Order{ID: 8,
+		OrderType: tax.Takeaway, Status: "pending", Subtotal: 10, Tax: 1,
+		TotalPrice: 11, AmountDue: 11,
+		Items: []models.OrderItem{{ProductName: "Tea", Quantity: 1, UnitPrice: 10}}}}
+	text := r.Text()
+
+	for _, want := range []string{"Takeaway", "Status: pending"} {
+		if !strings.Contains(text, want) {
+			t.Errorf("receipt is missing %q:\n%s", want, text)
+		}
+	}
+	if !hasRow(text, "Tax", "1.00") || !hasRow(text, "Amount due", "11.00") {
+		t.Errorf("receipt lacks the tax or amount due:\n%s", text)
+	}
+	if strings.Contains(text, "NET TOTAL") {
+		t.Error("receipt without refunds shows a net total")
+	}
+}
+
+func TestLoadConfig(t *testing.T) {
+	saved := Settings
+	t.Cleanup(func() { Settings = saved })
+	t.Setenv("RECEIPT_NAME", " Corner Cafe ")
+	t.Setenv("RECEIPT_FOOTER", "")
+
+	LoadConfig()
+	if Settings.Name != "Corner Cafe" || Settings.Footer != "" {
+		t.Errorf("settings = %+v, want the name trimmed and the footer cleared", Settings)
+	}
+}
+
+func TestColumns(t *testing.T) {
+	tests := []struct {
+		left, right string
+		width       int
+		want        []string
+	}{
+		{"Tip", "3.00", 12, []string{"Tip     3.00"}},
+		{"2 x Chicken Satay", "9.00", 16, []string{"2 x Chicken", "Satay       9.00"}},
+	}
+	for _, tt := range tests {
+		got := columns(tt.left, tt.right, tt.width)
+		if strings.Join(got, "|") != strings.Join(tt.want, "|") {
+			t.Errorf("columns(%q, %q, %d) = %q, want %q", tt.left, tt.right, tt.width,
+				got, tt.want)
+		}
+	}
+}
+
+func TestMoneyAndTime(t *testing.T) {
+	for v, want := range map[float64]string{12.5: "12.50", -0.001: "0.00", -2: "-2.00"} {
+		if got := money(v); got != want {
+			t.Errorf("money(%v) = %q, want %q", v, got, want)
+		}
+	}
+	for s, want := range map[string]string{
+		"2026-03-14T18:30:12Z": "2026-03-14 18:30",
+		"2026-03-14 18:30:12":  "2026-03-14 18:30",
+		"yesterday":            "yesterday",
+	} {
+		if got := formatTime(s); got != want {
+			t.Errorf("formatTime(%q) = %q, want %q", s, got, want)
+		}
+	}
+}
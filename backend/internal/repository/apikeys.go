@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+
+	"restaurant-backend/internal/models"
+)
+
+const apiKeyColumns = `id, user_id, name, prefix, key_hash, scopes, created_at,
+	expires_at, last_used_at, revoked_at`
+
+// CreateAPIKey stores a new API key. expiresInDays of 0 means no expiry.
+func CreateAPIKey(key *models.APIKey, expiresInDays int) error {
+	scopes, _ := json.Marshal(key.Scopes)
+
+	var expires any
+	if expiresInDays > 0 {
+		expires = fmt.Sprintf("+%d days", expiresInDays)
+	}
+
+	result, err := db.Exec(`
+		INSERT INTO api_keys (user_id, name, prefix, key_hash, scopes,
+			expires_at)
+		VALUES (?, ?, ?, ?, ?, datetime('now', ?))`,
+		key.UserID, key.Name, key.Prefix, key.KeyHash, string(scopes), expires)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	key.ID = int(id)
+
+	return db.QueryRow(`SELECT created_at, expires_at FROM api_keys
+		WHERE id = ?`, key.ID).Scan(&key.CreatedAt, &key.ExpiresAt)
+}
+
+// GetActiveAPIKeyByPrefix retrieves a key that is neither revoked nor expired
+func GetActiveAPIKeyByPrefix(prefix string) (*models.APIKey, error) {
+	row := db.QueryRow(`SELECT `+apiKeyColumns+` FROM api_keys
+		WHERE prefix = ? AND revoked_at IS NULL
+		AND (expires_at IS NULL OR expires_at > datetime('now'))`, prefix)
+	return scanAPIKey(row)
+}
+
+// TouchAPIKey records that a key was used. Writes are limited to once a
+// minute per key so busy integrations do not hammer the database.
+func TouchAPIKey(id int) error {
+	_, err := db.Exec(`UPDATE api_keys SET last_used_at = datetime('now')
+		WHERE id = ? AND (last_used_at IS NULL
+			OR last_used_at < datetime('now', '-1 minute'))`, id)
+	return err
+}
+
+// ListAPIKeys retrieves all API keys, newest first
+func ListAPIKeys() ([]models.APIKey, error) {
+	return queryAPIKeys(`SELECT ` + apiKeyColumns + ` FROM api_keys
+		ORDER BY id DESC`)
+}
+
+// ListAPIKeysByUserID retrieves the API keys created by a user, newest first
+func ListAPIKeysByUserID(userID int) ([]models.APIKey, error) {
+	return queryAPIKeys(`SELECT `+apiKeyColumns+` FROM api_keys
+		WHERE user_id = ? ORDER BY id DESC`, userID)
+}
+
+func queryAPIKeys(query string, args ...any) ([]models.APIKey, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	keys := []models.APIKey{}
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, err
+		}
+		keys = append(keys, *k)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey revokes a key. Revoking an already revoked key is a no-op.
+func RevokeAPIKey(id int) error {
+	result, err := db.Exec(`UPDATE api_keys
+		SET revoked_at = COALESCE(revoked_at, datetime('now'))
+		WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// rowScanner is satisfied by both *sql.Row and *sql.Rows
+type rowScanner interface {
+	Scan(dest ...any) error
+}
+
+func scanAPIKey(row rowScanner) (*models.APIKey, error) {
+	var k models.APIKey
+	var scopes string
+	if err := row.Scan(&k.ID, &k.UserID, &k.Name, &k.Prefix, &k.KeyHash,
+		&scopes, &k.CreatedAt, &k.ExpiresAt, &k.LastUsedAt,
+		&k.RevokedAt); err != nil {
+		return nil, err
+	}
+	json.Unmarshal([]byte(scopes), &k.Scopes)
+	return &k, nil
+}
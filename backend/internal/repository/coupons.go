@@ -0,0 +1,289 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+	"strconv"
+	"strings"
+
+	"restaurant-backend/internal/models"
+)
+
+// ErrCouponUsedUp is returned when a coupon reached its usage limit between
+// quoting and placing the order
+var ErrCouponUsedUp = errors.New("coupon usage limit reached")
+
+const couponColumns = `c.id, c.code, c.description, c.type, c.value,
+	c.free_product_id, c.category, c.product_ids, c.min_spend, c.starts_at,
+	c.ends_at, c.max_uses, c.max_uses_per_user, c.active, c.created_at,
+	(SELECT COUNT(*) FROM coupon_redemptions r WHERE r.coupon_id = c.id)`
+
+// seedCoupons adds the EAST20 code the default promos advertise
+func seedCoupons() {
+	const migrationID = 3
+	const migrationName = "coupons_seed_v1"
+
+	var alreadyExecuted bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM migrations WHERE id = ?)",
+		migrationID).Scan(&alreadyExecuted)
+	if err != nil {
+		slog.Error("failed to check migration status", "error", err)
+		return
+	}
+	if alreadyExecuted {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		slog.Error("failed to seed coupons", "error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`
+		INSERT OR IGNORE INTO coupons (code, description, type, value, category)
+		VALUES ('EAST20', '20% off all Eastern Eats', 'percentage', 20,
+			'eastern')`); err != nil {
+		slog.Error("failed to seed coupon", "error", err)
+		return
+	}
+	if _, err := tx.Exec("INSERT INTO migrations (id, name) VALUES (?, ?)",
+		migrationID, migrationName); err != nil {
+		slog.Error("failed to record migration", "error", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed to seed coupons", "error", err)
+		return
+	}
+	slog.Info("seeded default coupons")
+}
+
+// FetchCoupons retrieves all coupons, newest first
+func FetchCoupons() ([]models.Coupon, error) {
+	rows, err := db.Query(`SELECT ` + couponColumns + ` FROM coupons c
+		ORDER BY c.id DESC`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	coupons := []models.Coupon{}
+	for rows.Next() {
+		c, err := scanCoupon(rows)
+		if err != nil {
+			return nil, err
+		}
+		coupons = append(coupons, *c)
+	}
+	return coupons, nil
+}
+
+// GetCoupon retrieves a coupon by ID
+func GetCoupon(id int) (*models.Coupon, error) {
+	row := db.QueryRow(`SELECT `+couponColumns+` FROM coupons c
+		WHERE c.id = ?`, id)
+	return scanCoupon(row)
+}
+
+// GetCouponByCode retrieves a coupon by its code, ignoring case
+func GetCouponByCode(code string) (*models.Coupon, error) {
+	row := db.QueryRow(`SELECT `+couponColumns+` FROM coupons c
+		WHERE c.code = ?`, strings.ToUpper(code))
+	return scanCoupon(row)
+}
+
+// CreateCoupon inserts a coupon
+func CreateCoupon(c *models.Coupon) error {
+	result, err := db.Exec(`
+		INSERT INTO coupons (code, description, type, value, free_product_id,
+			category, product_ids, min_spend, starts_at, ends_at, max_uses,
+			max_uses_per_user, active)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		c.Code, c.Description, c.Type, c.Value, c.FreeProductID, c.Category,
+		formatIntList(c.ProductIDs), c.MinSpend, c.StartsAt, c.EndsAt, c.MaxUses,
+		c.MaxUsesPerUser, c.Active)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.ID = int(id)
+
+	return db.QueryRow("SELECT created_at FROM coupons WHERE id = ?",
+		c.ID).Scan(&c.CreatedAt)
+}
+
+// UpdateCoupon replaces all editable fields of a coupon
+func UpdateCoupon(c *models.Coupon) error {
+	result, err := db.Exec(`
+		UPDATE coupons SET code = ?, description = ?, type = ?, value = ?,
+			free_product_id = ?, category = ?, product_ids = ?, min_spend = ?,
+			starts_at = ?, ends_at = ?, max_uses = ?, max_uses_per_user = ?,
+			active = ?
+		WHERE id = ?`,
+		c.Code, c.Description, c.Type, c.Value, c.FreeProductID, c.Category,
+		formatIntList(c.ProductIDs), c.MinSpend, c.StartsAt, c.EndsAt, c.MaxUses,
+		c.MaxUsesPerUser, c.Active, c.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	updated, err := GetCoupon(c.ID)
+	if err != nil {
+		return err
+	}
+	*c = *updated
+	return nil
+}
+
+// DeleteCoupon removes a coupon and its redemption counts. Discount lines
+// on past orders keep the code and amount.
+func DeleteCoupon(id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM coupon_redemptions WHERE coupon_id = ?",
+		id); err != nil {
+		return err
+	}
+	result, err := tx.Exec("DELETE FROM coupons WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return tx.Commit()
+}
+
+// CountCouponRedemptions returns how often a coupon was redeemed in total
+// and by one user
+func CountCouponRedemptions(couponID, userID int) (total, forUser int, err error) {
+	err = db.QueryRow(`SELECT COUNT(*),
+		COALESCE(SUM(CASE WHEN user_id = ? THEN 1 ELSE 0 END), 0)
+		FROM coupon_redemptions WHERE coupon_id = ?`,
+		userID, couponID).Scan(&total, &forUser)
+	return total, forUser, err
+}
+
+// FetchCouponRedemptionsByUserID retrieves the coupons a user has redeemed,
+// newest first
+func FetchCouponRedemptionsByUserID(userID int) ([]models.CouponRedemption, error) {
+	rows, err := db.Query(`SELECT r.id, r.coupon_id, c.code, r.order_id,
+		r.amount, r.created_at
+		FROM coupon_redemptions r JOIN coupons c ON c.id = r.coupon_id
+		WHERE r.user_id = ? ORDER BY r.id DESC`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	redemptions := []models.CouponRedemption{}
+	for rows.Next() {
+		var cr models.CouponRedemption
+		if err := rows.Scan(&cr.ID, &cr.CouponID, &cr.Code, &cr.OrderID,
+			&cr.Amount, &cr.CreatedAt); err != nil {
+			return nil, err
+		}
+		redemptions = append(redemptions, cr)
+	}
+	return redemptions, rows.Err()
+}
+
+// redeemCoupon records a redemption inside the order transaction, checking
+// the limits again so concurrent checkouts cannot overshoot them
+func redeemCoupon(tx *sql.Tx, couponID, userID, orderID int, amount float64) error {
+	var maxUses, maxPerUser, total, forUser int
+	err := tx.QueryRow(`SELECT c.max_uses, c.max_uses_per_user,
+		(SELECT COUNT(*) FROM coupon_redemptions WHERE coupon_id = c.id),
+		(SELECT COUNT(*) FROM coupon_redemptions
+			WHERE coupon_id = c.id AND user_id = ?)
+		FROM coupons c WHERE c.id = ?`, userID, couponID).
+		Scan(&maxUses, &maxPerUser, &total, &forUser)
+	if err != nil {
+		return err
+	}
+	if (maxUses > 0 && total >= maxUses) ||
+		(maxPerUser > 0 && forUser >= maxPerUser) {
+		return ErrCouponUsedUp
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO coupon_redemptions (coupon_id, user_id, order_id, amount)
+		VALUES (?, ?, ?, ?)`, couponID, userID, orderID, amount)
+	return err
+}
+
+func fetchOrderDiscounts(orderID int) ([]models.OrderDiscount, error) {
+	rows, err := db.Query(`SELECT coupon_id, code, description, amount, points
+		FROM order_discounts WHERE order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var discounts []models.OrderDiscount
+	for rows.Next() {
+		var d models.OrderDiscount
+		var couponID sql.NullInt64
+		if err := rows.Scan(&couponID, &d.Code, &d.Description, &d.Amount,
+			&d.Points); err != nil {
+			return nil, err
+		}
+		if couponID.Valid {
+			id := int(couponID.Int64)
+			d.CouponID = &id
+		}
+		discounts = append(discounts, d)
+	}
+	return discounts, nil
+}
+
+func scanCoupon(row rowScanner) (*models.Coupon, error) {
+	var c models.Coupon
+	var freeProductID sql.NullInt64
+	var productIDs string
+	if err := row.Scan(&c.ID, &c.Code, &c.Description, &c.Type, &c.Value,
+		&freeProductID, &c.Category, &productIDs, &c.MinSpend, &c.StartsAt,
+		&c.EndsAt, &c.MaxUses, &c.MaxUsesPerUser, &c.Active, &c.CreatedAt,
+		&c.TimesUsed); err != nil {
+		return nil, err
+	}
+	if freeProductID.Valid {
+		id := int(freeProductID.Int64)
+		c.FreeProductID = &id
+	}
+	c.ProductIDs = parseIntList(productIDs)
+	return &c, nil
+}
+
+// formatIntList stores a list of numbers as comma separated text
+func formatIntList(values []int) string {
+	parts := make([]string, len(values))
+	for i, v := range values {
+		parts[i] = strconv.Itoa(v)
+	}
+	return strings.Join(parts, ",")
+}
+
+func parseIntList(s string) []int {
+	values := []int{}
+	for _, part := range strings.Split(s, ",") {
+		if v, err := strconv.Atoi(part); err == nil {
+			values = append(values, v)
+		}
+	}
+	return values
+}
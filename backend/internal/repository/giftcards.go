@@ -0,0 +1,357 @@
+package repository
+
+// Gift card balances are never stored: every change is a row in
+// gift_card_transactions, which is only ever appended to, and a card's
+// balance is the sum of its rows.
+
+import (
+	"database/sql"
+	"errors"
+	"math"
+
+	"restaurant-backend/internal/models"
+)
+
+// ErrGiftCardBalance is returned when a gift card cannot cover a payment,
+// because it was used or voided since the order was priced
+var ErrGiftCardBalance = errors.New("gift card balance too low")
+
+const giftCardColumns = `g.id, g.last4, g.initial_value,
+	COALESCE((SELECT SUM(amount) FROM gift_card_transactions
+		WHERE gift_card_id = g.id), 0),
+	g.recipient_email, g.message, g.purchaser_id, g.order_id, g.status,
+	g.created_at`
+
+// CreateGiftCard issues a gift card with its initial value
+func CreateGiftCard(card *models.GiftCard, codeHash string, actorID *int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := issueGiftCardTx(tx, card, codeHash, actorID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func issueGiftCardTx(tx *sql.Tx, card *models.GiftCard, codeHash string, actorID *int) error {
+	result, err := tx.Exec(`
+		INSERT INTO gift_cards (code_hash, last4, initial_value,
+			recipient_email, message, purchaser_id, order_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		codeHash, card.Last4, card.InitialValue, card.RecipientEmail,
+		card.Message, card.PurchaserID, card.OrderID)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	card.ID = int(id)
+
+	if err := addGiftCardTransaction(tx, card.ID, "issue", card.InitialValue,
+		card.OrderID, actorID, ""); err != nil {
+		return err
+	}
+
+	card.Balance = card.InitialValue
+	card.Status = "active"
+	return tx.QueryRow("SELECT created_at FROM gift_cards WHERE id = ?",
+		card.ID).Scan(&card.CreatedAt)
+}
+
+// GetGiftCard retrieves a gift card
+func GetGiftCard(id int) (*models.GiftCard, error) {
+	row := db.QueryRow(`SELECT `+giftCardColumns+` FROM gift_cards g
+		WHERE g.id = ?`, id)
+	return scanGiftCard(row)
+}
+
+// GetGiftCardByCodeHash retrieves the gift card with the given code hash
+func GetGiftCardByCodeHash(codeHash string) (*models.GiftCard, error) {
+	row := db.QueryRow(`SELECT `+giftCardColumns+` FROM gift_cards g
+		WHERE g.code_hash = ?`, codeHash)
+	return scanGiftCard(row)
+}
+
+// FetchGiftCards retrieves all gift cards, newest first
+func FetchGiftCards() ([]models.GiftCard, error) {
+	return queryGiftCards(`SELECT ` + giftCardColumns + ` FROM gift_cards g
+		ORDER BY g.id DESC`)
+}
+
+// FetchGiftCardsByPurchaser retrieves the gift cards a user bought
+func FetchGiftCardsByPurchaser(userID int) ([]models.GiftCard, error) {
+	return queryGiftCards(`SELECT `+giftCardColumns+` FROM gift_cards g
+		WHERE g.purchaser_id = ? ORDER BY g.id DESC`, userID)
+}
+
+// FetchGiftCardTransactions retrieves a gift card's ledger, oldest first
+func FetchGiftCardTransactions(giftCardID int) ([]models.GiftCardTransaction, error) {
+	rows, err := db.Query(`SELECT id, gift_card_id, kind, amount, order_id,
+		actor_id, note, created_at FROM gift_card_transactions
+		WHERE gift_card_id = ? ORDER BY id`, giftCardID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	transactions := []models.GiftCardTransaction{}
+	for rows.Next() {
+		var t models.GiftCardTransaction
+		var orderID, actorID sql.NullInt64
+		if err := rows.Scan(&t.ID, &t.GiftCardID, &t.Kind, &t.Amount, &orderID,
+			&actorID, &t.Note, &t.CreatedAt); err != nil {
+			return nil, err
+		}
+		t.OrderID = nullIntPtr(orderID)
+		t.ActorID = nullIntPtr(actorID)
+		transactions = append(transactions, t)
+	}
+	return transactions, nil
+}
+
+// VoidGiftCard cancels a gift card, writing off its remaining balance
+func VoidGiftCard(id int, actorID int, note string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := voidGiftCardTx(tx, id, nil, &actorID, note); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func voidGiftCardTx(tx *sql.Tx, id int, orderID, actorID *int, note string) error {
+	result, err := tx.Exec(`UPDATE gift_cards SET status = 'void'
+		WHERE id = ? AND status = 'active'`, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	balance, err := giftCardBalanceTx(tx, id)
+	if err != nil {
+		return err
+	}
+	if balance > 0 {
+		return addGiftCardTransaction(tx, id, "void", -balance, orderID, actorID,
+			note)
+	}
+	return nil
+}
+
+// GetGiftCardLiability totals the gift card ledger by kind
+func GetGiftCardLiability() (*models.GiftCardLiability, error) {
+	var l models.GiftCardLiability
+	err := db.QueryRow(`SELECT
+		COALESCE(SUM(CASE WHEN kind = 'issue' THEN amount END), 0),
+		COALESCE(-SUM(CASE WHEN kind = 'redeem' THEN amount END), 0),
+		COALESCE(SUM(CASE WHEN kind = 'refund' THEN amount END), 0),
+		COALESCE(-SUM(CASE WHEN kind = 'void' THEN amount END), 0),
+		COALESCE(SUM(amount), 0)
+		FROM gift_card_transactions`).Scan(&l.Issued, &l.Redeemed, &l.Refunded,
+		&l.Voided, &l.Outstanding)
+	if err != nil {
+		return nil, err
+	}
+	l.Issued, l.Redeemed = roundCents(l.Issued), roundCents(l.Redeemed)
+	l.Refunded, l.Voided = roundCents(l.Refunded), roundCents(l.Voided)
+	l.Outstanding = roundCents(l.Outstanding)
+
+	err = db.QueryRow(`SELECT COUNT(*) FROM gift_cards
+		WHERE status = 'active'`).Scan(&l.ActiveCards)
+	return &l, err
+}
+
+// redeemGiftCardTx takes a payment from a gift card, checking the balance
+// again inside the order's transaction
+func redeemGiftCardTx(tx *sql.Tx, id, orderID int, amount float64) error {
+	var status string
+	if err := tx.QueryRow("SELECT status FROM gift_cards WHERE id = ?",
+		id).Scan(&status); err != nil {
+		return err
+	}
+	balance, err := giftCardBalanceTx(tx, id)
+	if err != nil {
+		return err
+	}
+	if status != "active" || balance < amount-0.005 {
+		return ErrGiftCardBalance
+	}
+	return addGiftCardTransaction(tx, id, "redeem", -amount, &orderID, nil, "")
+}
+
+// fetchOrderTenders lists the gift card payments made for an order
+func fetchOrderTenders(orderID int) ([]models.OrderTender, error) {
+	rows, err := db.Query(`SELECT g.id, g.last4, -SUM(t.amount)
+		FROM gift_card_transactions t JOIN gift_cards g ON g.id = t.gift_card_id
+		WHERE t.order_id = ? AND t.kind = 'redeem'
+		GROUP BY g.id ORDER BY MIN(t.id)`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenders []models.OrderTender
+	for rows.Next() {
+		t := models.OrderTender{Type: "gift_card"}
+		if err := rows.Scan(&t.GiftCardID, &t.Last4, &t.Amount); err != nil {
+			return nil, err
+		}
+		t.Amount = roundCents(t.Amount)
+		tenders = append(tenders, t)
+	}
+	return tenders, nil
+}
+
+// fetchOrderGiftCardPurchases lists the gift cards an order bought
+func fetchOrderGiftCardPurchases(orderID int) ([]models.GiftCardPurchase, error) {
+	rows, err := db.Query(`SELECT id, initial_value, recipient_email, message,
+		last4 FROM gift_cards WHERE order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var purchases []models.GiftCardPurchase
+	for rows.Next() {
+		var p models.GiftCardPurchase
+		if err := rows.Scan(&p.GiftCardID, &p.Amount, &p.RecipientEmail,
+			&p.Message, &p.Last4); err != nil {
+			return nil, err
+		}
+		purchases = append(purchases, p)
+	}
+	return purchases, nil
+}
+
+// reverseOrderGiftCardsTx gives gift card payments on an order back to
+// their cards and voids the cards the order bought
+func reverseOrderGiftCardsTx(tx *sql.Tx, orderID int) error {
+	rows, err := tx.Query(`SELECT gift_card_id, -SUM(amount)
+		FROM gift_card_transactions
+		WHERE order_id = ? AND kind IN ('redeem', 'refund')
+		GROUP BY gift_card_id`, orderID)
+	if err != nil {
+		return err
+	}
+	type payment struct {
+		cardID int
+		amount float64
+	}
+	var payments []payment
+	for rows.Next() {
+		var p payment
+		if err := rows.Scan(&p.cardID, &p.amount); err != nil {
+			rows.Close()
+			return err
+		}
+		payments = append(payments, p)
+	}
+	rows.Close()
+
+	for _, p := range payments {
+		if p.amount <= 0 {
+			continue
+		}
+		if err := addGiftCardTransaction(tx, p.cardID, "refund",
+			roundCents(p.amount), &orderID, nil, "Order cancelled"); err != nil {
+			return err
+		}
+	}
+
+	rows, err = tx.Query(`SELECT id FROM gift_cards
+		WHERE order_id = ? AND status = 'active'`, orderID)
+	if err != nil {
+		return err
+	}
+	var purchased []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		purchased = append(purchased, id)
+	}
+	rows.Close()
+
+	for _, id := range purchased {
+		if err := voidGiftCardTx(tx, id, &orderID, nil,
+			"Purchase order cancelled"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func giftCardBalanceTx(tx *sql.Tx, id int) (float64, error) {
+	var balance float64
+	err := tx.QueryRow(`SELECT COALESCE(SUM(amount), 0)
+		FROM gift_card_transactions WHERE gift_card_id = ?`, id).Scan(&balance)
+	return roundCents(balance), err
+}
+
+func addGiftCardTransaction(tx *sql.Tx, giftCardID int, kind string, amount float64,
+	orderID, actorID *int, note string) error {
+	_, err := tx.Exec(`
+		INSERT INTO gift_card_transactions (gift_card_id, kind, amount,
+			order_id, actor_id, note)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		giftCardID, kind, amount, orderID, actorID, note)
+	return err
+}
+
+func queryGiftCards(query string, args ...any) ([]models.GiftCard, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	cards := []models.GiftCard{}
+	for rows.Next() {
+		c, err := scanGiftCard(rows)
+		if err != nil {
+			return nil, err
+		}
+		cards = append(cards, *c)
+	}
+	return cards, nil
+}
+
+func scanGiftCard(row rowScanner) (*models.GiftCard, error) {
+	var c models.GiftCard
+	var purchaserID, orderID sql.NullInt64
+	if err := row.Scan(&c.ID, &c.Last4, &c.InitialValue, &c.Balance,
+		&c.RecipientEmail, &c.Message, &purchaserID, &orderID, &c.Status,
+		&c.CreatedAt); err != nil {
+		return nil, err
+	}
+	c.Balance = roundCents(c.Balance)
+	c.PurchaserID = nullIntPtr(purchaserID)
+	c.OrderID = nullIntPtr(orderID)
+	return &c, nil
+}
+
+func nullIntPtr(n sql.NullInt64) *int {
+	if !n.Valid {
+		return nil
+	}
+	id := int(n.Int64)
+	return &id
+}
+
+// roundCents removes floating point noise from summed amounts
+func roundCents(v float64) float64 {
+	return math.Round(v*100) / 100
+}
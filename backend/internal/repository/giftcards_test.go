@@ -0,0 +1,186 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"restaurant-backend/internal/models"
+)
+
+// giftCardOrder places a pending order for one of p that buys a gift card
+// worth value, and returns the order with the card
+func giftCardOrder(t *testing.T, p *models.Product, value float64) (*models.Order, *models.GiftCard) {
+	t.Helper()
+	order := &models.Order{UserID: 1, OrderType: "takeaway", Status: "pending",
+		Items:             []models.OrderItem{{ProductID: p.ID, Quantity: 1, UnitPrice: p.Price}},
+		Subtotal:          p.Price,
+		GiftCardPurchases: []models.GiftCardPurchase{{Amount: value, Code: unique(t.Name()), Last4: "0000"}},
+	}
+	order.TotalPrice, order.AmountDue = p.Price+value, p.Price+value
+	if err := CreateOrder(order); err != nil {
+		t.Fatal(err)
+	}
+	card, err := GetGiftCard(order.GiftCardPurchases[0].GiftCardID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return order, card
+}
+
+// payWithGiftCard places a pending order for one of p paying amount with
+// card and the rest by card payment
+func payWithGiftCard(p *models.Product, card *models.GiftCard, amount float64) (*models.Order, error) {
+	order := &models.Order{UserID: 1, OrderType: "takeaway", Status: "pending",
+		Items:      []models.OrderItem{{ProductID: p.ID, Quantity: 1, UnitPrice: p.Price}},
+		Subtotal:   p.Price,
+		TotalPrice: p.Price,
+		AmountDue:  p.Price - amount,
+		Tenders: []models.OrderTender{{Type: "gift_card", GiftCardID: card.ID,
+			Amount: amount}},
+	}
+	return order, CreateOrder(order)
+}
+
+// balanceOf is a gift card's balance, failing the test on error
+func balanceOf(t *testing.T, id int) float64 {
+	t.Helper()
+	card, err := GetGiftCard(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return card.Balance
+}
+
+// ledgerKinds lists a gift card's transactions as kind and amount
+func ledgerKinds(t *testing.T, id int) []models.GiftCardTransaction {
+	t.Helper()
+	txs, err := FetchGiftCardTransactions(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range txs {
+		txs[i] = models.GiftCardTransaction{Kind: txs[i].Kind, Amount: txs[i].Amount}
+	}
+	return txs
+}
+
+func TestGiftCardLedger(t *testing.T) {
+	p := testProduct(t, 10)
+	_, card := giftCardOrder(t, p, 25)
+	if card.Balance != 25 || card.Status != "active" {
+		t.Fatalf("issued card = %+v, want 25 active", card)
+	}
+
+	order, err := payWithGiftCard(p, card, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := payWithGiftCard(p, card, 15.01); !errors.Is(err, ErrGiftCardBalance) {
+		t.Errorf("paying more than the balance: err = %v, want ErrGiftCardBalance", err)
+	}
+	if got := balanceOf(t, card.ID); got != 15 {
+		t.Errorf("balance after paying 10 = %v, want 15", got)
+	}
+
+	stored, err := GetOrderByID(order.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stored.Tenders) != 1 || stored.Tenders[0].Amount != 10 ||
+		stored.Tenders[0].Last4 != "0000" {
+		t.Errorf("tenders = %+v, want 10 from the card", stored.Tenders)
+	}
+
+	// Cancelling gives the payment back to the card
+	if err := CancelOrder(order.ID, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := VoidGiftCard(card.ID, 1, "Lost"); err != nil {
+		t.Fatal(err)
+	}
+	if err := VoidGiftCard(card.ID, 1, "Lost"); err == nil {
+		t.Error("voided a void card")
+	}
+	if _, err := payWithGiftCard(p, card, 1); !errors.Is(err, ErrGiftCardBalance) {
+		t.Errorf("paying with a void card: err = %v, want ErrGiftCardBalance", err)
+	}
+
+	want := []models.GiftCardTransaction{{Kind: "issue", Amount: 25},
+		{Kind: "redeem", Amount: -10}, {Kind: "refund", Amount: 10},
+		{Kind: "void", Amount: -25}}
+	got := ledgerKinds(t, card.ID)
+	if len(got) != len(want) {
+		t.Fatalf("ledger = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("ledger[%d] = %+v, want %+v", i, got[i], want[i])
+		}
+	}
+	if got := balanceOf(t, card.ID); got != 0 {
+		t.Errorf("balance of a void card = %v, want 0", got)
+	}
+}
+
+func TestCancelGiftCardPurchase(t *testing.T) {
+	p := testProduct(t, 10)
+	order, card := giftCardOrder(t, p, 30)
+
+	if err := CancelOrder(order.ID, 0, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := GetGiftCard(card.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != "void" || got.Balance != 0 {
+		t.Errorf("card bought by a cancelled order = %+v, want void with nothing left", got)
+	}
+}
+
+func TestGiftCardLiability(t *testing.T) {
+	before, err := GetGiftCardLiability()
+	if err != nil {
+		t.Fatal(err)
+	}
+	statsBefore, err := GetDashboardStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	p := testProduct(t, 10)
+	_, card := giftCardOrder(t, p, 40)
+	if _, err := payWithGiftCard(p, card, 6); err != nil {
+		t.Fatal(err)
+	}
+	if err := VoidGiftCard(card.ID, 1, ""); err != nil {
+		t.Fatal(err)
+	}
+
+	after, err := GetGiftCardLiability()
+	if err != nil {
+		t.Fatal(err)
+	}
+	delta := models.GiftCardLiability{
+		Issued:      roundCents(after.Issued - before.Issued),
+		Redeemed:    roundCents(after.Redeemed - before.Redeemed),
+		Voided:      roundCents(after.Voided - before.Voided),
+		Outstanding: roundCents(after.Outstanding - before.Outstanding),
+	}
+	if want := (models.GiftCardLiability{Issued: 40, Redeemed: 6, Voided: 34}); delta != want {
+		t.Errorf("liability moved by %+v, want %+v", delta, want)
+	}
+
+	// The card sold is owed, not earned: revenue is the two meals
+	stats, err := GetDashboardStats()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := roundCents(stats.TotalRevenue - statsBefore.TotalRevenue); got != 20 {
+		t.Errorf("revenue rose by %v, want 20", got)
+	}
+	if stats.GiftCardLiability != after.Outstanding {
+		t.Errorf("dashboard liability = %v, want %v", stats.GiftCardLiability,
+			after.Outstanding)
+	}
+}
@@ -0,0 +1,368 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"restaurant-backend/internal/models"
+)
+
+const ingredientColumns = `id, name, unit, stock_quantity, low_stock_threshold,
+	unit_cost, created_at`
+
+const ingredientMovementColumns = `id, ingredient_id, quantity, balance, reason,
+	reference_type, reference_id, note, actor_id, created_at`
+
+// FetchIngredients retrieves all ingredients by name
+func FetchIngredients() ([]models.Ingredient, error) {
+	return queryIngredients(`SELECT ` + ingredientColumns + ` FROM ingredients
+		ORDER BY name`)
+}
+
+// FetchLowStockIngredients retrieves the ingredients at or below their low
+// stock threshold
+func FetchLowStockIngredients() ([]models.Ingredient, error) {
+	return queryIngredients(`SELECT ` + ingredientColumns + ` FROM ingredients
+		WHERE stock_quantity <= low_stock_threshold ORDER BY name`)
+}
+
+// GetIngredient retrieves an ingredient by ID
+func GetIngredient(id int) (*models.Ingredient, error) {
+	return scanIngredient(db.QueryRow(`SELECT `+ingredientColumns+`
+		FROM ingredients WHERE id = ?`, id))
+}
+
+// CreateIngredient inserts an ingredient. Its starting stock is recorded as
+// an adjustment by actorID.
+func CreateIngredient(ing *models.Ingredient, actorID *int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO ingredients (name, unit, low_stock_threshold,
+			unit_cost)
+		VALUES (?, ?, ?, ?)`, ing.Name, ing.Unit, ing.LowStockThreshold,
+		ing.UnitCost)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	ing.ID = int(id)
+
+	m := models.IngredientMovement{
+		IngredientID: ing.ID,
+		Quantity:     ing.StockQuantity,
+		Reason:       "adjustment",
+		Note:         "Opening stock",
+		ActorID:      actorID,
+	}
+	if err := moveIngredientTx(tx, &m); err != nil {
+		return err
+	}
+	if err := tx.QueryRow(`SELECT stock_quantity, created_at FROM ingredients
+		WHERE id = ?`, ing.ID).Scan(&ing.StockQuantity, &ing.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdateIngredient updates an ingredient's details, returning sql.ErrNoRows
+// when it does not exist. Its stock is left alone and read back into ing.
+func UpdateIngredient(ing *models.Ingredient) error {
+	res, err := db.Exec(`UPDATE ingredients SET name = ?, unit = ?,
+			low_stock_threshold = ?, unit_cost = ?
+		WHERE id = ?`, ing.Name, ing.Unit, ing.LowStockThreshold, ing.UnitCost,
+		ing.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return db.QueryRow(`SELECT stock_quantity, created_at FROM ingredients
+		WHERE id = ?`, ing.ID).Scan(&ing.StockQuantity, &ing.CreatedAt)
+}
+
+// IngredientInRecipes reports whether any recipe uses an ingredient
+func IngredientInRecipes(id int) (bool, error) {
+	var used bool
+	err := db.QueryRow(`SELECT EXISTS(SELECT 1 FROM recipe_lines
+		WHERE ingredient_id = ?)`, id).Scan(&used)
+	return used, err
+}
+
+// AdjustIngredientStock changes an ingredient's stock by hand. The movement
+// is filled in with its ID and the resulting balance.
+func AdjustIngredientStock(m *models.IngredientMovement) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := moveIngredientTx(tx, m); err != nil {
+		return err
+	}
+	if m.Balance < 0 {
+		return ErrStockBelowZero
+	}
+	if err := tx.QueryRow("SELECT created_at FROM ingredient_movements WHERE id = ?",
+		m.ID).Scan(&m.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// FetchIngredientMovements retrieves an ingredient's newest stock
+// movements, optionally only those with a reason
+func FetchIngredientMovements(ingredientID int, reason string, limit int) ([]models.IngredientMovement, error) {
+	rows, err := db.Query(`SELECT `+ingredientMovementColumns+`
+		FROM ingredient_movements
+		WHERE ingredient_id = ? AND (? = '' OR reason = ?)
+		ORDER BY id DESC LIMIT ?`, ingredientID, reason, reason, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movements := []models.IngredientMovement{}
+	for rows.Next() {
+		var m models.IngredientMovement
+		var referenceID, actorID sql.NullInt64
+		if err := rows.Scan(&m.ID, &m.IngredientID, &m.Quantity, &m.Balance,
+			&m.Reason, &m.ReferenceType, &referenceID, &m.Note, &actorID,
+			&m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.ReferenceID, m.ActorID = nullIntPtr(referenceID), nullIntPtr(actorID)
+		movements = append(movements, m)
+	}
+	return movements, nil
+}
+
+// GetRecipe retrieves a product's recipe, returning sql.ErrNoRows when the
+// product does not exist
+func GetRecipe(productID int) (*models.Recipe, error) {
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM products WHERE id = ?)",
+		productID).Scan(&exists); err != nil {
+		return nil, err
+	}
+	if !exists {
+		return nil, sql.ErrNoRows
+	}
+
+	rows, err := db.Query(`SELECT r.portion_size, r.ingredient_id, i.name, i.unit,
+			r.quantity
+		FROM recipe_lines r JOIN ingredients i ON i.id = r.ingredient_id
+		WHERE r.product_id = ?
+		ORDER BY r.portion_size, i.name`, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	recipe := &models.Recipe{ProductID: productID, Lines: []models.RecipeLine{}}
+	for rows.Next() {
+		var l models.RecipeLine
+		if err := rows.Scan(&l.PortionSize, &l.IngredientID, &l.IngredientName,
+			&l.Unit, &l.Quantity); err != nil {
+			return nil, err
+		}
+		recipe.Lines = append(recipe.Lines, l)
+	}
+	return recipe, nil
+}
+
+// SetRecipe replaces a product's recipe, returning sql.ErrNoRows when the
+// product does not exist. With no lines the product is no longer made from
+// ingredients.
+func SetRecipe(productID int, lines []models.RecipeLine) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var exists bool
+	if err := tx.QueryRow("SELECT EXISTS(SELECT 1 FROM products WHERE id = ?)",
+		productID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec("DELETE FROM recipe_lines WHERE product_id = ?",
+		productID); err != nil {
+		return err
+	}
+	for _, l := range lines {
+		if _, err := tx.Exec(`INSERT INTO recipe_lines (product_id, portion_size,
+				ingredient_id, quantity)
+			VALUES (?, ?, ?, ?)`, productID, l.PortionSize, l.IngredientID,
+			l.Quantity); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// fillAvailability sets how many of each product can be sold: what the
+// ingredients in stock can make for products with a recipe, taking the
+// portion size that can make the most, and the stock for the rest
+func fillAvailability(products []models.Product) error {
+	rows, err := db.Query(`SELECT r.product_id,
+			MIN(MAX(0, CAST(i.stock_quantity / r.quantity + 1e-9 AS INTEGER)))
+		FROM recipe_lines r JOIN ingredients i ON i.id = r.ingredient_id
+		GROUP BY r.product_id, r.portion_size`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	available := map[int]int{}
+	for rows.Next() {
+		var productID, n int
+		if err := rows.Scan(&productID, &n); err != nil {
+			return err
+		}
+		if cur, ok := available[productID]; !ok || n > cur {
+			available[productID] = n
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for i := range products {
+		p := &products[i]
+		n, ok := available[p.ID]
+		p.HasRecipe = ok
+		if !ok {
+			n = p.StockQuantity
+		}
+		p.AvailableQuantity = n
+	}
+	return nil
+}
+
+// recipeTx returns the recipe for a portion of a product: the portion's own
+// lines, or else the lines for every portion. It is empty for products
+// without a recipe.
+func recipeTx(tx *sql.Tx, productID int, portion string) ([]models.RecipeLine, error) {
+	rows, err := tx.Query(`SELECT portion_size, ingredient_id, quantity
+		FROM recipe_lines
+		WHERE product_id = ? AND (portion_size = '' OR lower(portion_size) = lower(?))`,
+		productID, portion)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var own, shared []models.RecipeLine
+	for rows.Next() {
+		var l models.RecipeLine
+		if err := rows.Scan(&l.PortionSize, &l.IngredientID, &l.Quantity); err != nil {
+			return nil, err
+		}
+		if l.PortionSize == "" {
+			shared = append(shared, l)
+		} else {
+			own = append(own, l)
+		}
+	}
+	if len(own) > 0 {
+		return own, rows.Err()
+	}
+	return shared, rows.Err()
+}
+
+// useIngredientsTx takes the ingredients for an order item out of stock
+func useIngredientsTx(tx *sql.Tx, lines []models.RecipeLine, item models.OrderItem,
+	order *models.Order) error {
+	for _, l := range lines {
+		m := models.IngredientMovement{
+			IngredientID:  l.IngredientID,
+			Quantity:      -l.Quantity * float64(item.Quantity),
+			Reason:        "sale",
+			ReferenceType: "order",
+			ReferenceID:   &order.ID,
+			ActorID:       &order.UserID,
+		}
+		if err := moveIngredientTx(tx, &m); err != nil {
+			return err
+		}
+		if m.Balance < 0 {
+			return fmt.Errorf("insufficient stock for product ID %d", item.ProductID)
+		}
+	}
+	return nil
+}
+
+// moveIngredientTx changes an ingredient's stock by m.Quantity and records
+// the movement in the ledger. Stock is kept to three decimal places.
+func moveIngredientTx(tx *sql.Tx, m *models.IngredientMovement) error {
+	if m.Quantity == 0 {
+		return nil
+	}
+	res, err := tx.Exec(`UPDATE ingredients
+		SET stock_quantity = ROUND(stock_quantity + ?, 3)
+		WHERE id = ?`, m.Quantity, m.IngredientID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if err := tx.QueryRow("SELECT stock_quantity FROM ingredients WHERE id = ?",
+		m.IngredientID).Scan(&m.Balance); err != nil {
+		return err
+	}
+	res, err = tx.Exec(`INSERT INTO ingredient_movements (ingredient_id, quantity,
+			balance, reason, reference_type, reference_id, note, actor_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.IngredientID, m.Quantity, m.Balance, m.Reason, m.ReferenceType,
+		m.ReferenceID, m.Note, m.ActorID)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	m.ID = int(id)
+	return nil
+}
+
+func queryIngredients(query string, args ...any) ([]models.Ingredient, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	ingredients := []models.Ingredient{}
+	for rows.Next() {
+		ing, err := scanIngredient(rows)
+		if err != nil {
+			return nil, err
+		}
+		ingredients = append(ingredients, *ing)
+	}
+	return ingredients, nil
+}
+
+func scanIngredient(row rowScanner) (*models.Ingredient, error) {
+	var ing models.Ingredient
+	if err := row.Scan(&ing.ID, &ing.Name, &ing.Unit, &ing.StockQuantity,
+		&ing.LowStockThreshold, &ing.UnitCost, &ing.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &ing, nil
+}
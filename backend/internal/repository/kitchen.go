@@ -0,0 +1,140 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"restaurant-backend/internal/models"
+)
+
+const kitchenTicketColumns = `id, order_id, station, status, attempts,
+	last_error, COALESCE(next_attempt_at, ''), printed_at, created_at`
+
+// CreateKitchenTickets queues tickets for printing
+func CreateKitchenTickets(tickets []models.KitchenTicket) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for i := range tickets {
+		t := &tickets[i]
+		res, err := tx.Exec(`INSERT INTO kitchen_tickets (order_id, station, data)
+			VALUES (?, ?, ?)`, t.OrderID, t.Station, t.Data)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		t.ID, t.Status = int(id), "pending"
+	}
+	return tx.Commit()
+}
+
+// FetchDueKitchenTickets retrieves pending tickets whose next try is due,
+// oldest first, with their data
+func FetchDueKitchenTickets(limit int) ([]models.KitchenTicket, error) {
+	rows, err := db.Query(`SELECT `+kitchenTicketColumns+`, data
+		FROM kitchen_tickets
+		WHERE status = 'pending' AND next_attempt_at <= CURRENT_TIMESTAMP
+		ORDER BY id LIMIT ?`, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tickets := []models.KitchenTicket{}
+	for rows.Next() {
+		t, err := scanKitchenTicket(rows, true)
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, *t)
+	}
+	return tickets, nil
+}
+
+// FetchKitchenTickets retrieves the newest tickets, optionally only those
+// with a status
+func FetchKitchenTickets(status string, limit int) ([]models.KitchenTicket, error) {
+	rows, err := db.Query(`SELECT `+kitchenTicketColumns+` FROM kitchen_tickets
+		WHERE ? = '' OR status = ?
+		ORDER BY id DESC LIMIT ?`, status, status, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	tickets := []models.KitchenTicket{}
+	for rows.Next() {
+		t, err := scanKitchenTicket(rows, false)
+		if err != nil {
+			return nil, err
+		}
+		tickets = append(tickets, *t)
+	}
+	return tickets, nil
+}
+
+// MarkKitchenTicketPrinted records a successful print
+func MarkKitchenTicketPrinted(id int) error {
+	_, err := db.Exec(`UPDATE kitchen_tickets
+		SET status = 'printed', attempts = attempts + 1, last_error = '',
+			printed_at = CURRENT_TIMESTAMP
+		WHERE id = ?`, id)
+	return err
+}
+
+// MarkKitchenTicketFailed records a failed print. The ticket is tried again
+// after retryAfter, or marked failed when retry is false.
+func MarkKitchenTicketFailed(id int, problem string, retry bool, retryAfter time.Duration) error {
+	status := "failed"
+	if retry {
+		status = "pending"
+	}
+	_, err := db.Exec(`UPDATE kitchen_tickets
+		SET status = ?, attempts = attempts + 1, last_error = ?,
+			next_attempt_at = datetime('now', ?)
+		WHERE id = ?`, status, problem,
+		fmt.Sprintf("+%d seconds", int(retryAfter.Seconds())), id)
+	return err
+}
+
+// RequeueKitchenTicket queues a ticket to print again straight away, for
+// reprints and tickets that ran out of retries
+func RequeueKitchenTicket(id int) (*models.KitchenTicket, error) {
+	res, err := db.Exec(`UPDATE kitchen_tickets
+		SET status = 'pending', attempts = 0, last_error = '',
+			next_attempt_at = CURRENT_TIMESTAMP
+		WHERE id = ?`, id)
+	if err != nil {
+		return nil, err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return nil, sql.ErrNoRows
+	}
+	row := db.QueryRow(`SELECT `+kitchenTicketColumns+` FROM kitchen_tickets
+		WHERE id = ?`, id)
+	return scanKitchenTicket(row, false)
+}
+
+func scanKitchenTicket(row rowScanner, withData bool) (*models.KitchenTicket, error) {
+	var t models.KitchenTicket
+	var printedAt sql.NullString
+	dest := []any{&t.ID, &t.OrderID, &t.Station, &t.Status, &t.Attempts,
+		&t.LastError, &t.NextAttemptAt, &printedAt, &t.CreatedAt}
+	if withData {
+		dest = append(dest, &t.Data)
+	}
+	if err := row.Scan(dest...); err != nil {
+		return nil, err
+	}
+	if printedAt.Valid {
+		t.PrintedAt = &printedAt.String
+	}
+	return &t, nil
+}
@@ -0,0 +1,367 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"log/slog"
+
+	"restaurant-backend/internal/models"
+)
+
+const stockLotColumns = `l.id, l.product_id, COALESCE(p.name, ''),
+	l.received_quantity, l.quantity, l.unit_cost, COALESCE(l.expires_at, ''),
+	COALESCE(l.expires_at < date('now'), 0), l.purchase_order_id, l.received_at`
+
+// migrateStockLots puts the stock products had before lots existed into
+// one lot each, with no expiry, so each product's lots add up to its stock
+func migrateStockLots() {
+	const migrationID = 6
+	const migrationName = "stock_lots_opening_balances_v1"
+
+	var alreadyExecuted bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM migrations WHERE id = ?)",
+		migrationID).Scan(&alreadyExecuted)
+	if err != nil {
+		slog.Error("failed to check migration status", "error", err)
+		return
+	}
+	if alreadyExecuted {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		slog.Error("failed to create opening stock lots", "error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO stock_lots (product_id, received_quantity,
+			quantity, unit_cost)
+		SELECT p.id, p.stock_quantity, p.stock_quantity,
+			COALESCE((SELECT l.unit_cost FROM purchase_order_lines l
+				JOIN purchase_orders po ON po.id = l.purchase_order_id
+				WHERE l.product_id = p.id AND po.status != 'cancelled'
+				ORDER BY l.id DESC LIMIT 1), 0)
+		FROM products p WHERE p.stock_quantity > 0`); err != nil {
+		slog.Error("failed to create opening stock lots", "error", err)
+		return
+	}
+	if _, err := tx.Exec("INSERT INTO migrations (id, name) VALUES (?, ?)",
+		migrationID, migrationName); err != nil {
+		slog.Error("failed to record migration", "error", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed to create opening stock lots", "error", err)
+	}
+}
+
+// FetchStockLots retrieves a product's lots in the order they are sold
+// from, only those with stock left unless all is set. Expired lots, which
+// are never sold from, come last.
+func FetchStockLots(productID int, all bool) ([]models.StockLot, error) {
+	return queryStockLots(`SELECT `+stockLotColumns+` FROM stock_lots l
+		LEFT JOIN products p ON p.id = l.product_id
+		WHERE l.product_id = ? AND (? OR l.quantity > 0)
+		ORDER BY COALESCE(l.expires_at < date('now'), 0), l.expires_at IS NULL,
+			l.expires_at, l.received_at, l.id`,
+		productID, all)
+}
+
+// FetchExpiringLots retrieves the lots with stock left that expire within
+// days, including any already past their expiry, soonest first
+func FetchExpiringLots(days int) ([]models.StockLot, error) {
+	return queryStockLots(`SELECT `+stockLotColumns+` FROM stock_lots l
+		JOIN products p ON p.id = l.product_id
+		WHERE l.quantity > 0 AND l.expires_at IS NOT NULL
+			AND l.expires_at <= date('now', ?)
+		ORDER BY l.expires_at, l.id`, fmt.Sprintf("+%d days", days))
+}
+
+// ExpireLots writes off the stock left in lots past their expiry date as
+// expired waste, returning how many lots were written off. Lots of products
+// in an open stock count wait until it is closed.
+func ExpireLots() (int, error) {
+	lots, err := expiredLots(db, 0)
+	if err != nil {
+		return 0, err
+	}
+
+	expired := 0
+	for _, l := range lots {
+		err := RecordWaste(l.wasteEntry())
+		if err == ErrStockLocked {
+			continue
+		}
+		if err != nil {
+			return expired, fmt.Errorf("lot %d: %w", l.id, err)
+		}
+		expired++
+	}
+	return expired, nil
+}
+
+// expireProductLotsTx writes off a product's expired lots before it is
+// sold, so a sale never takes stock that has expired and ExpireLots has
+// not yet written off
+func expireProductLotsTx(tx *sql.Tx, productID int) error {
+	lots, err := expiredLots(tx, productID)
+	if err != nil {
+		return err
+	}
+	for _, l := range lots {
+		if err := recordWasteTx(tx, l.wasteEntry()); err != nil {
+			return fmt.Errorf("lot %d: %w", l.id, err)
+		}
+	}
+	return nil
+}
+
+// querier runs queries on the database or in a transaction
+type querier interface {
+	Query(query string, args ...any) (*sql.Rows, error)
+}
+
+type expiredLot struct {
+	id, productID, quantity int
+	expiresAt               string
+}
+
+func (l expiredLot) wasteEntry() *models.WasteEntry {
+	return &models.WasteEntry{
+		ProductID: &l.productID,
+		LotID:     &l.id,
+		Quantity:  float64(l.quantity),
+		Reason:    "expired",
+		Note:      fmt.Sprintf("Lot %d expired on %s", l.id, l.expiresAt),
+	}
+}
+
+// expiredLots lists lots with stock left past their expiry date, of one
+// product or, with productID 0, of all of them
+func expiredLots(q querier, productID int) ([]expiredLot, error) {
+	rows, err := q.Query(`SELECT id, product_id, quantity, expires_at
+		FROM stock_lots
+		WHERE quantity > 0 AND expires_at IS NOT NULL
+			AND expires_at < date('now') AND (? = 0 OR product_id = ?)
+		ORDER BY expires_at, id`, productID, productID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var lots []expiredLot
+	for rows.Next() {
+		var l expiredLot
+		if err := rows.Scan(&l.id, &l.productID, &l.quantity, &l.expiresAt); err != nil {
+			return nil, err
+		}
+		lots = append(lots, l)
+	}
+	return lots, rows.Err()
+}
+
+// moveLotsTx keeps a product's lots in step with a stock movement already
+// recorded. Stock going out is taken from m.Lot first, then from the lots
+// that expire soonest, oldest first; sales never take from expired lots.
+// Returned stock goes back into the unexpired lots its order took it from,
+// and other stock coming in goes into a new lot, described by m.Lot if set.
+func moveLotsTx(tx *sql.Tx, m *models.StockMovement) error {
+	if m.Quantity < 0 {
+		return takeFromLotsTx(tx, m)
+	}
+
+	left := m.Quantity
+	if m.Reason == "return" {
+		refilled, err := refillLotsTx(tx, m)
+		if err != nil {
+			return err
+		}
+		left -= refilled
+	}
+	if left == 0 {
+		return nil
+	}
+
+	if m.Lot == nil {
+		// Without details the new lot keeps and is costed at the last
+		// purchase price
+		m.Lot = &models.StockLot{}
+		var err error
+		if _, m.Lot.UnitCost, err = lastPurchaseTx(tx, m.ProductID); err != nil {
+			return err
+		}
+	}
+	lot := m.Lot
+	lot.ProductID, lot.ReceivedQuantity, lot.Quantity = m.ProductID, left, left
+	var expiresAt *string
+	if lot.ExpiresAt != "" {
+		expiresAt = &lot.ExpiresAt
+	}
+	// The lot starts empty and is filled by the movement
+	res, err := tx.Exec(`INSERT INTO stock_lots (product_id, received_quantity,
+			quantity, unit_cost, expires_at, purchase_order_id)
+		VALUES (?, ?, 0, ?, ?, ?)`, lot.ProductID, left, lot.UnitCost,
+		expiresAt, lot.PurchaseOrderID)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	lot.ID = int(id)
+	if err := tx.QueryRow("SELECT received_at FROM stock_lots WHERE id = ?",
+		lot.ID).Scan(&lot.ReceivedAt); err != nil {
+		return err
+	}
+	return recordLotMovementTx(tx, m.ID, lot.ID, left)
+}
+
+// takeFromLotsTx takes stock going out from the product's lots. Stock
+// beyond what the lots hold is not taken from any.
+func takeFromLotsTx(tx *sql.Tx, m *models.StockMovement) error {
+	first := 0
+	if m.Lot != nil {
+		first = m.Lot.ID
+	}
+	rows, err := tx.Query(`SELECT id, quantity FROM stock_lots
+		WHERE product_id = ? AND quantity > 0 AND (? != 'sale'
+			OR expires_at IS NULL OR expires_at >= date('now'))
+		ORDER BY id = ? DESC, expires_at IS NULL, expires_at, received_at, id`,
+		m.ProductID, m.Reason, first)
+	if err != nil {
+		return err
+	}
+	type lotStock struct{ id, quantity int }
+	var lots []lotStock
+	for rows.Next() {
+		var l lotStock
+		if err := rows.Scan(&l.id, &l.quantity); err != nil {
+			rows.Close()
+			return err
+		}
+		lots = append(lots, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	need := -m.Quantity
+	for _, l := range lots {
+		if need == 0 {
+			break
+		}
+		n := min(need, l.quantity)
+		if err := recordLotMovementTx(tx, m.ID, l.id, -n); err != nil {
+			return err
+		}
+		need -= n
+	}
+	return nil
+}
+
+// refillLotsTx puts stock returned from an order, or a refund of one, back
+// into the lots the order took it from, returning how much went back.
+// Lots that have expired since are skipped, so the stock is not written
+// off with them.
+func refillLotsTx(tx *sql.Tx, m *models.StockMovement) (int, error) {
+	if m.ReferenceID == nil {
+		return 0, nil
+	}
+	orderID := *m.ReferenceID
+	switch m.ReferenceType {
+	case "order":
+	case "refund":
+		err := tx.QueryRow("SELECT order_id FROM refunds WHERE id = ?",
+			*m.ReferenceID).Scan(&orderID)
+		if err == sql.ErrNoRows {
+			return 0, nil
+		}
+		if err != nil {
+			return 0, err
+		}
+	default:
+		return 0, nil
+	}
+
+	// What is still out of each lot after the order's earlier returns
+	rows, err := tx.Query(`SELECT a.lot_id, -SUM(a.quantity)
+		FROM stock_lot_movements a
+		JOIN stock_movements sm ON sm.id = a.movement_id
+		JOIN stock_lots l ON l.id = a.lot_id
+		WHERE sm.product_id = ? AND ((sm.reference_type = 'order'
+				AND sm.reference_id = ?)
+			OR (sm.reference_type = 'refund' AND sm.reference_id IN
+				(SELECT id FROM refunds WHERE order_id = ?)))
+			AND (l.expires_at IS NULL OR l.expires_at >= date('now'))
+		GROUP BY a.lot_id HAVING SUM(a.quantity) < 0
+		ORDER BY a.lot_id DESC`, m.ProductID, orderID, orderID)
+	if err != nil {
+		return 0, err
+	}
+	type lotStock struct{ id, quantity int }
+	var lots []lotStock
+	for rows.Next() {
+		var l lotStock
+		if err := rows.Scan(&l.id, &l.quantity); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		lots = append(lots, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	refilled := 0
+	for _, l := range lots {
+		n := min(m.Quantity-refilled, l.quantity)
+		if n == 0 {
+			break
+		}
+		if err := recordLotMovementTx(tx, m.ID, l.id, n); err != nil {
+			return 0, err
+		}
+		refilled += n
+	}
+	return refilled, nil
+}
+
+// recordLotMovementTx changes a lot's stock by quantity for a movement
+func recordLotMovementTx(tx *sql.Tx, movementID, lotID, quantity int) error {
+	if _, err := tx.Exec(`UPDATE stock_lots SET quantity = quantity + ?
+		WHERE id = ?`, quantity, lotID); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`INSERT INTO stock_lot_movements (movement_id, lot_id,
+			quantity)
+		VALUES (?, ?, ?)`, movementID, lotID, quantity)
+	return err
+}
+
+func queryStockLots(query string, args ...any) ([]models.StockLot, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lots := []models.StockLot{}
+	for rows.Next() {
+		var l models.StockLot
+		var purchaseOrderID sql.NullInt64
+		if err := rows.Scan(&l.ID, &l.ProductID, &l.ProductName,
+			&l.ReceivedQuantity, &l.Quantity, &l.UnitCost, &l.ExpiresAt,
+			&l.Expired, &purchaseOrderID, &l.ReceivedAt); err != nil {
+			return nil, err
+		}
+		l.PurchaseOrderID = nullIntPtr(purchaseOrderID)
+		lots = append(lots, l)
+	}
+	return lots, rows.Err()
+}
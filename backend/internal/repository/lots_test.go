@@ -0,0 +1,137 @@
+package repository
+
+import (
+	"testing"
+	"time"
+
+	"restaurant-backend/internal/models"
+)
+
+// inDays is the date days from today, as lots store it
+func inDays(days int) string {
+	return time.Now().AddDate(0, 0, days).Format("2006-01-02")
+}
+
+// addLot adds quantity of a product as a new lot expiring on expiresAt,
+// or keeping when it is empty, and returns the lot's ID
+func addLot(t *testing.T, p *models.Product, quantity int, expiresAt string) int {
+	t.Helper()
+	m := &models.StockMovement{ProductID: p.ID, Quantity: quantity,
+		Reason: "adjustment", Lot: &models.StockLot{ExpiresAt: expiresAt}}
+	if err := AdjustStock(m); err != nil {
+		t.Fatal(err)
+	}
+	return m.Lot.ID
+}
+
+// lotQuantities is what is left in each of a product's lots, by ID
+func lotQuantities(t *testing.T, productID int) map[int]int {
+	t.Helper()
+	lots, err := FetchStockLots(productID, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	left := map[int]int{}
+	for _, l := range lots {
+		left[l.ID] = l.Quantity
+	}
+	return left
+}
+
+func TestSalesTakeFromLotsExpiringFirst(t *testing.T) {
+	p := testProduct(t, 0)
+	later := addLot(t, p, 5, inDays(10))
+	keeps := addLot(t, p, 5, "")
+	sooner := addLot(t, p, 5, inDays(2))
+
+	testOrder(t, 7, p)
+
+	want := map[int]int{sooner: 0, later: 3, keeps: 5}
+	got := lotQuantities(t, p.ID)
+	for id, n := range want {
+		if got[id] != n {
+			t.Errorf("lot %d has %d left, want %d (lots %v)", id, got[id], n, got)
+		}
+	}
+
+	lots, err := FetchStockLots(p.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lots) != 2 || lots[0].ID != later || lots[1].ID != keeps {
+		t.Errorf("lots with stock = %+v, want %d then %d", lots, later, keeps)
+	}
+}
+
+func TestExpiredLotsAreNotSold(t *testing.T) {
+	p := testProduct(t, 0)
+	expired := addLot(t, p, 5, inDays(-1))
+	fresh := addLot(t, p, 3, inDays(5))
+
+	if err := CreateOrder(&models.Order{UserID: 1, Status: "pending",
+		Items: []models.OrderItem{{ProductID: p.ID, Quantity: 4}}}); err == nil {
+		t.Fatal("sold stock from an expired lot")
+	}
+	testOrder(t, 3, p)
+
+	got := lotQuantities(t, p.ID)
+	if got[expired] != 0 || got[fresh] != 0 {
+		t.Errorf("lots = %v, want both empty", got)
+	}
+	if stock := stockOf(t, p.ID); stock != 0 {
+		t.Errorf("stock = %d, want 0", stock)
+	}
+	var wasted int
+	if err := db.QueryRow(`SELECT COALESCE(SUM(quantity), 0) FROM waste_entries
+		WHERE lot_id = ? AND reason = 'expired'`, expired).Scan(&wasted); err != nil {
+		t.Fatal(err)
+	}
+	if wasted != 5 {
+		t.Errorf("wrote off %d of the expired lot, want 5", wasted)
+	}
+}
+
+func TestReturnsRefillLots(t *testing.T) {
+	tests := []struct {
+		name string
+		// expireFirst makes the lot expire before the stock comes back
+		expireFirst bool
+		wantLot     int
+		wantNewLot  int
+	}{
+		{"back into the lot", false, 5, 0},
+		{"lot expired since", true, 3, 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testProduct(t, 0)
+			lot := addLot(t, p, 5, inDays(3))
+			order := testOrder(t, 2, p)
+			if tt.expireFirst {
+				if _, err := db.Exec(`UPDATE stock_lots SET expires_at = ?
+					WHERE id = ?`, inDays(-1), lot); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := CancelOrder(order.ID, 0, nil); err != nil {
+				t.Fatal(err)
+			}
+
+			got := lotQuantities(t, p.ID)
+			newLot := 0
+			for id, n := range got {
+				if id != lot {
+					newLot += n
+				}
+			}
+			if got[lot] != tt.wantLot || newLot != tt.wantNewLot {
+				t.Errorf("lot has %d and new lots %d, want %d and %d", got[lot],
+					newLot, tt.wantLot, tt.wantNewLot)
+			}
+			if stock := stockOf(t, p.ID); stock != 5 {
+				t.Errorf("stock = %d, want 5", stock)
+			}
+		})
+	}
+}
@@ -0,0 +1,318 @@
+package repository
+
+// The points ledger is append-only: every change to a balance is a row.
+// Rows that add points ("lots") also track how many of their points are
+// left, so redemptions use the oldest-expiring points first and expiry only
+// removes what was not used.
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"restaurant-backend/internal/models"
+)
+
+var (
+	// ErrInsufficientPoints is returned when a balance cannot cover a
+	// redemption or deduction
+	ErrInsufficientPoints = errors.New("not enough loyalty points")
+	// ErrOrderNotPending is returned when completing or cancelling an order
+	// that is already completed or cancelled
+	ErrOrderNotPending = errors.New("order is not pending")
+)
+
+const loyaltyEntryColumns = `id, order_id, kind, points, expires_at,
+	description, created_at`
+
+// expirePointsTx writes expire entries for lots past their expiry date
+func expirePointsTx(tx *sql.Tx, userID int) error {
+	rows, err := tx.Query(`SELECT id, remaining, expires_at FROM loyalty_ledger
+		WHERE user_id = ? AND remaining > 0 AND expires_at <= datetime('now')`,
+		userID)
+	if err != nil {
+		return err
+	}
+	type lot struct {
+		id, remaining int
+		expiresAt     string
+	}
+	var expired []lot
+	for rows.Next() {
+		var l lot
+		if err := rows.Scan(&l.id, &l.remaining, &l.expiresAt); err != nil {
+			rows.Close()
+			return err
+		}
+		expired = append(expired, l)
+	}
+	rows.Close()
+
+	for _, l := range expired {
+		if _, err := tx.Exec("UPDATE loyalty_ledger SET remaining = 0 WHERE id = ?",
+			l.id); err != nil {
+			return err
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO loyalty_ledger (user_id, kind, points, description)
+			VALUES (?, 'expire', ?, ?)`, userID, -l.remaining,
+			fmt.Sprintf("Points expired on %s", l.expiresAt)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addPointsTx adds a lot of points that expires after expiryDays
+func addPointsTx(tx *sql.Tx, userID int, orderID *int, kind string, points,
+	expiryDays int, description string, actorID *int) error {
+	_, err := tx.Exec(`
+		INSERT INTO loyalty_ledger (user_id, order_id, kind, points, remaining,
+			expires_at, description, actor_id)
+		VALUES (?, ?, ?, ?, ?, datetime('now', ?), ?, ?)`,
+		userID, orderID, kind, points, points,
+		fmt.Sprintf("+%d days", expiryDays), description, actorID)
+	return err
+}
+
+// deductPointsTx takes points from the oldest-expiring lots and records the
+// deduction
+func deductPointsTx(tx *sql.Tx, userID int, orderID *int, kind string, points int,
+	description string, actorID *int) error {
+	if err := expirePointsTx(tx, userID); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT id, remaining FROM loyalty_ledger
+		WHERE user_id = ? AND remaining > 0 ORDER BY expires_at, id`, userID)
+	if err != nil {
+		return err
+	}
+	type lot struct{ id, remaining int }
+	var lots []lot
+	available := 0
+	for rows.Next() {
+		var l lot
+		if err := rows.Scan(&l.id, &l.remaining); err != nil {
+			rows.Close()
+			return err
+		}
+		lots = append(lots, l)
+		available += l.remaining
+	}
+	rows.Close()
+
+	if available < points {
+		return ErrInsufficientPoints
+	}
+
+	left := points
+	for _, l := range lots {
+		if left == 0 {
+			break
+		}
+		take := min(l.remaining, left)
+		if _, err := tx.Exec(`UPDATE loyalty_ledger SET remaining = remaining - ?
+			WHERE id = ?`, take, l.id); err != nil {
+			return err
+		}
+		left -= take
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO loyalty_ledger (user_id, order_id, kind, points,
+			description, actor_id)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		userID, orderID, kind, -points, description, actorID)
+	return err
+}
+
+// GetLoyaltyBalance expires lapsed points and returns the balance
+func GetLoyaltyBalance(userID int) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	if err := expirePointsTx(tx, userID); err != nil {
+		return 0, err
+	}
+	var balance int
+	if err := tx.QueryRow(`SELECT COALESCE(SUM(points), 0) FROM loyalty_ledger
+		WHERE user_id = ?`, userID).Scan(&balance); err != nil {
+		return 0, err
+	}
+	return balance, tx.Commit()
+}
+
+// GetQualifyingPoints returns the points earned within the last windowDays,
+// less any reversed by refunds, which decide the membership tier
+func GetQualifyingPoints(userID, windowDays int) (int, error) {
+	var points int
+	err := db.QueryRow(`SELECT COALESCE(SUM(points), 0) FROM loyalty_ledger
+		WHERE user_id = ? AND kind IN ('earn', 'reversal')
+		AND created_at >= datetime('now', ?)`,
+		userID, fmt.Sprintf("-%d days", windowDays)).Scan(&points)
+	return points, err
+}
+
+// FetchExpiringPoints returns unused points that expire within days,
+// grouped by expiry date
+func FetchExpiringPoints(userID, days int) ([]models.ExpiringPoints, error) {
+	rows, err := db.Query(`SELECT SUM(remaining), date(expires_at)
+		FROM loyalty_ledger
+		WHERE user_id = ? AND remaining > 0
+		AND expires_at <= datetime('now', ?)
+		GROUP BY date(expires_at) ORDER BY date(expires_at)`,
+		userID, fmt.Sprintf("+%d days", days))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	expiring := []models.ExpiringPoints{}
+	for rows.Next() {
+		var e models.ExpiringPoints
+		if err := rows.Scan(&e.Points, &e.ExpiresAt); err != nil {
+			return nil, err
+		}
+		expiring = append(expiring, e)
+	}
+	return expiring, nil
+}
+
+// FetchLoyaltyLedger retrieves a user's ledger, newest first. A limit of 0
+// returns everything.
+func FetchLoyaltyLedger(userID, limit int) ([]models.LoyaltyEntry, error) {
+	query := `SELECT ` + loyaltyEntryColumns + ` FROM loyalty_ledger
+		WHERE user_id = ? ORDER BY id DESC`
+	args := []any{userID}
+	if limit > 0 {
+		query += " LIMIT ?"
+		args = append(args, limit)
+	}
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.LoyaltyEntry{}
+	for rows.Next() {
+		var e models.LoyaltyEntry
+		var orderID sql.NullInt64
+		if err := rows.Scan(&e.ID, &orderID, &e.Kind, &e.Points, &e.ExpiresAt,
+			&e.Description, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if orderID.Valid {
+			id := int(orderID.Int64)
+			e.OrderID = &id
+		}
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// AdjustLoyaltyPoints adds or removes points on behalf of an admin
+func AdjustLoyaltyPoints(userID, points, expiryDays int, reason string, actorID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if points > 0 {
+		err = addPointsTx(tx, userID, nil, "adjust", points, expiryDays, reason,
+			&actorID)
+	} else {
+		err = deductPointsTx(tx, userID, nil, "adjust", -points, reason, &actorID)
+	}
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CompleteOrder marks a pending order completed and credits the points it
+// earned to the customer
+func CompleteOrder(orderID, userID, points, expiryDays int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setPendingOrderStatus(tx, orderID, "completed"); err != nil {
+		return err
+	}
+	if userID > 0 && points > 0 {
+		if err := addPointsTx(tx, userID, &orderID, "earn", points, expiryDays,
+			fmt.Sprintf("Earned on order #%d", orderID), nil); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CancelOrder marks a pending order cancelled. Redeemed points and gift
+// card payments are given back, gift cards it bought are voided, the
+// coupon can be used again and the items return to stock. actorID is who
+// cancelled it, or nil when a failed payment did.
+func CancelOrder(orderID, expiryDays int, actorID *int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := setPendingOrderStatus(tx, orderID, "cancelled"); err != nil {
+		return err
+	}
+
+	var userID sql.NullInt64
+	var redeemed int
+	if err := tx.QueryRow(`SELECT o.user_id,
+		COALESCE((SELECT -SUM(points) FROM loyalty_ledger
+			WHERE order_id = o.id AND kind = 'redeem'), 0)
+		FROM orders o WHERE o.id = ?`, orderID).Scan(&userID,
+		&redeemed); err != nil {
+		return err
+	}
+	if userID.Valid && redeemed > 0 {
+		if err := addPointsTx(tx, int(userID.Int64), &orderID, "refund", redeemed,
+			expiryDays, fmt.Sprintf("Refunded from cancelled order #%d", orderID),
+			nil); err != nil {
+			return err
+		}
+	}
+
+	if err := reverseOrderGiftCardsTx(tx, orderID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM coupon_redemptions WHERE order_id = ?",
+		orderID); err != nil {
+		return err
+	}
+	if err := returnOrderStockTx(tx, orderID, actorID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func setPendingOrderStatus(tx *sql.Tx, orderID int, status string) error {
+	var current string
+	err := tx.QueryRow("SELECT status FROM orders WHERE id = ?", orderID).
+		Scan(&current)
+	if err != nil {
+		return err
+	}
+	if current != "pending" {
+		return ErrOrderNotPending
+	}
+	_, err = tx.Exec("UPDATE orders SET status = ? WHERE id = ?", status, orderID)
+	return err
+}
@@ -0,0 +1,72 @@
+package repository
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"testing"
+	"time"
+
+	"restaurant-backend/internal/models"
+)
+
+// TestMain runs the tests against a fresh database in a temporary directory
+func TestMain(m *testing.M) {
+	dir, err := os.MkdirTemp("", "repository-test")
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		log.Fatal(err)
+	}
+	InitDB()
+
+	code := m.Run()
+	db.Close()
+	os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// testProduct stores a product with stock, failing the test on error
+func testProduct(t *testing.T, stock int) *models.Product {
+	t.Helper()
+	p := &models.Product{Name: t.Name(), Price: 10, Category: "test",
+		StockQuantity: stock}
+	if err := InsertProduct(p, nil); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+// testOrder places a pending order for quantity of each product
+func testOrder(t *testing.T, quantity int, products ...*models.Product) *models.Order {
+	t.Helper()
+	order := &models.Order{UserID: 1, OrderType: "takeaway", Status: "pending"}
+	for _, p := range products {
+		order.Items = append(order.Items, models.OrderItem{ProductID: p.ID,
+			Quantity: quantity, UnitPrice: p.Price})
+		order.Subtotal += p.Price * float64(quantity)
+	}
+	order.TotalPrice, order.AmountDue = order.Subtotal, order.Subtotal
+	if err := CreateOrder(order); err != nil {
+		t.Fatal(err)
+	}
+	return order
+}
+
+// stockOf is a product's stock, failing the test on error
+func stockOf(t *testing.T, productID int) int {
+	t.Helper()
+	var stock int
+	if err := db.QueryRow("SELECT stock_quantity FROM products WHERE id = ?",
+		productID).Scan(&stock); err != nil {
+		t.Fatal(err)
+	}
+	return stock
+}
+
+// unique prefixes name with the time, for values in UNIQUE columns that
+// must not clash when the tests are run more than once
+func unique(name string) string {
+	return fmt.Sprintf("%d-%s", time.Now().UnixNano(), name)
+}
@@ -0,0 +1,131 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+
+	"restaurant-backend/internal/models"
+)
+
+// OIDCLoginState is the server-side half of an in-flight OIDC login
+type OIDCLoginState struct {
+	Provider     string
+	Nonce        string
+	CodeVerifier string
+}
+
+// SaveOIDCState stores the state/nonce/PKCE verifier for a login redirect
+// and prunes expired ones
+func SaveOIDCState(state string, s OIDCLoginState, ttlMinutes int) error {
+	if _, err := db.Exec(`DELETE FROM oidc_login_states
+		WHERE expires_at <= datetime('now')`); err != nil {
+		return err
+	}
+
+	_, err := db.Exec(`
+		INSERT INTO oidc_login_states (state, provider, nonce, code_verifier,
+			expires_at)
+		VALUES (?, ?, ?, ?, datetime('now', ?))`,
+		state, s.Provider, s.Nonce, s.CodeVerifier,
+		fmt.Sprintf("+%d minutes", ttlMinutes))
+	return err
+}
+
+// ConsumeOIDCState returns and deletes the login state so it can only be
+// used once. ErrInvalidToken is returned for unknown or expired states.
+func ConsumeOIDCState(state string) (*OIDCLoginState, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	var s OIDCLoginState
+	err = tx.QueryRow(`SELECT provider, nonce, code_verifier
+		FROM oidc_login_states
+		WHERE state = ? AND expires_at > datetime('now')`, state).
+		Scan(&s.Provider, &s.Nonce, &s.CodeVerifier)
+	if err == sql.ErrNoRows {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if _, err := tx.Exec("DELETE FROM oidc_login_states WHERE state = ?",
+		state); err != nil {
+		return nil, err
+	}
+	return &s, tx.Commit()
+}
+
+// GetUserByIdentity retrieves the user linked to an external identity
+func GetUserByIdentity(provider, subject string) (*models.User, error) {
+	var userID int
+	err := db.QueryRow(`SELECT user_id FROM user_identities
+		WHERE provider = ? AND subject = ?`, provider, subject).Scan(&userID)
+	if err != nil {
+		return nil, err
+	}
+	return GetUserByID(userID)
+}
+
+// FetchIdentitiesByUserID retrieves the external identities linked to a user
+func FetchIdentitiesByUserID(userID int) ([]models.UserIdentity, error) {
+	rows, err := db.Query(`SELECT provider, subject, COALESCE(email, ''),
+		created_at FROM user_identities WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	identities := []models.UserIdentity{}
+	for rows.Next() {
+		var i models.UserIdentity
+		if err := rows.Scan(&i.Provider, &i.Subject, &i.Email,
+			&i.CreatedAt); err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+	return identities, nil
+}
+
+// LinkIdentity links an external identity to an existing user
+func LinkIdentity(userID int, provider, subject, email string) error {
+	_, err := db.Exec(`
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES (?, ?, ?, ?)`, userID, provider, subject, email)
+	return err
+}
+
+// CreateUserWithIdentity inserts a new user together with their external
+// identity
+func CreateUserWithIdentity(user *models.User, provider, subject string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO users (email, password, name, role, phone)
+		VALUES (?, ?, ?, ?, ?)`,
+		user.Email, user.Password, user.Name, user.Role, user.Phone)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	user.ID = int(id)
+
+	if _, err := tx.Exec(`
+		INSERT INTO user_identities (user_id, provider, subject, email)
+		VALUES (?, ?, ?, ?)`, user.ID, provider, subject, user.Email); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
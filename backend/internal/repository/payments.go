@@ -0,0 +1,200 @@
+package repository
+
+import (
+	"database/sql"
+
+	"restaurant-backend/internal/models"
+)
+
+const paymentIntentColumns = `id, order_id, provider, provider_ref, amount,
+	currency, status, captured_amount, refunded_amount, failure_code,
+	failure_message, created_at, updated_at`
+
+// CreatePaymentIntent stores a new payment for an order and copies its
+// status to the order
+func CreatePaymentIntent(pi *models.PaymentIntent) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		INSERT INTO payment_intents (order_id, provider, provider_ref, amount,
+			currency, status)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		pi.OrderID, pi.Provider, pi.ProviderRef, pi.Amount, pi.Currency, pi.Status)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	pi.ID = int(id)
+
+	if _, err := tx.Exec("UPDATE orders SET payment_status = ? WHERE id = ?",
+		pi.Status, pi.OrderID); err != nil {
+		return err
+	}
+	if err := tx.QueryRow(`SELECT created_at, updated_at FROM payment_intents
+		WHERE id = ?`, pi.ID).Scan(&pi.CreatedAt, &pi.UpdatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// UpdatePaymentIntent saves a payment's provider reference, status and
+// amounts, and copies its status to the order
+func UpdatePaymentIntent(pi *models.PaymentIntent) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE payment_intents SET provider_ref = ?, status = ?,
+			captured_amount = ?, refunded_amount = ?, failure_code = ?,
+			failure_message = ?, updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		pi.ProviderRef, pi.Status, pi.CapturedAmount, pi.RefundedAmount,
+		pi.FailureCode, pi.FailureMessage, pi.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	if _, err := tx.Exec("UPDATE orders SET payment_status = ? WHERE id = ?",
+		pi.Status, pi.OrderID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// AddPaymentIntentRefund adds amount to what has been refunded of a
+// payment, at most what was captured, updates its status and the order's to
+// match, and reads the payment back into pi. The sum is taken in the
+// database so refunds made at the same time are all counted.
+func AddPaymentIntentRefund(pi *models.PaymentIntent, amount float64) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`
+		UPDATE payment_intents SET
+			refunded_amount = MIN(captured_amount, ROUND(refunded_amount + ?, 2)),
+			status = CASE WHEN ROUND(refunded_amount + ?, 2) >= captured_amount
+				THEN 'refunded' ELSE 'partially_refunded' END,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`, amount, amount, pi.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	updated, err := scanPaymentIntent(tx.QueryRow(`SELECT `+paymentIntentColumns+`
+		FROM payment_intents WHERE id = ?`, pi.ID))
+	if err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE orders SET payment_status = ? WHERE id = ?",
+		updated.Status, updated.OrderID); err != nil {
+		return err
+	}
+	if err := tx.Commit(); err != nil {
+		return err
+	}
+	*pi = *updated
+	return nil
+}
+
+// GetPaymentIntentByOrderID retrieves the latest payment for an order
+func GetPaymentIntentByOrderID(orderID int) (*models.PaymentIntent, error) {
+	row := db.QueryRow(`SELECT `+paymentIntentColumns+` FROM payment_intents
+		WHERE order_id = ? ORDER BY id DESC LIMIT 1`, orderID)
+	return scanPaymentIntent(row)
+}
+
+// GetPaymentIntentByProviderRef retrieves a payment by the provider's id
+func GetPaymentIntentByProviderRef(provider, ref string) (*models.PaymentIntent, error) {
+	row := db.QueryRow(`SELECT `+paymentIntentColumns+` FROM payment_intents
+		WHERE provider = ? AND provider_ref = ?`, provider, ref)
+	return scanPaymentIntent(row)
+}
+
+// FetchPaymentIntentsByOrderID retrieves every payment for an order with
+// its attempts, oldest first
+func FetchPaymentIntentsByOrderID(orderID int) ([]models.PaymentIntent, error) {
+	rows, err := db.Query(`SELECT `+paymentIntentColumns+` FROM payment_intents
+		WHERE order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	intents := []models.PaymentIntent{}
+	for rows.Next() {
+		pi, err := scanPaymentIntent(rows)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		intents = append(intents, *pi)
+	}
+	rows.Close()
+
+	for i := range intents {
+		intents[i].Attempts, err = fetchPaymentAttempts(intents[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return intents, nil
+}
+
+// RecordPaymentAttempt logs a call to the provider or a webhook from it
+func RecordPaymentAttempt(a *models.PaymentAttempt) error {
+	_, err := db.Exec(`
+		INSERT INTO payment_attempts (intent_id, action, amount, succeeded,
+			provider_ref, detail)
+		VALUES (?, ?, ?, ?, ?, ?)`,
+		a.IntentID, a.Action, a.Amount, a.Succeeded, a.ProviderRef, a.Detail)
+	return err
+}
+
+func fetchPaymentAttempts(intentID int) ([]models.PaymentAttempt, error) {
+	rows, err := db.Query(`SELECT id, intent_id, action, amount, succeeded,
+		provider_ref, detail, created_at FROM payment_attempts
+		WHERE intent_id = ? ORDER BY id`, intentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attempts []models.PaymentAttempt
+	for rows.Next() {
+		var a models.PaymentAttempt
+		if err := rows.Scan(&a.ID, &a.IntentID, &a.Action, &a.Amount,
+			&a.Succeeded, &a.ProviderRef, &a.Detail, &a.CreatedAt); err != nil {
+			return nil, err
+		}
+		attempts = append(attempts, a)
+	}
+	return attempts, nil
+}
+
+func scanPaymentIntent(row rowScanner) (*models.PaymentIntent, error) {
+	var pi models.PaymentIntent
+	if err := row.Scan(&pi.ID, &pi.OrderID, &pi.Provider, &pi.ProviderRef,
+		&pi.Amount, &pi.Currency, &pi.Status, &pi.CapturedAmount,
+		&pi.RefundedAmount, &pi.FailureCode, &pi.FailureMessage, &pi.CreatedAt,
+		&pi.UpdatedAt); err != nil {
+		return nil, err
+	}
+	return &pi, nil
+}
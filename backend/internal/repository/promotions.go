@@ -0,0 +1,241 @@
+package repository
+
+import (
+	"database/sql"
+	"log/slog"
+
+	"restaurant-backend/internal/models"
+)
+
+const promotionColumns = `id, message, starts_at, ends_at, days_of_week,
+	priority, audience, active, created_at, updated_at`
+
+// defaultPromotions are the promos the promo bar shipped with
+var defaultPromotions = []string{
+	"🎉 Weekend Special: 20% off all Eastern Eats! Use code EAST20",
+	"🍔 Burger Tuesday: Buy one get one free on all Western meals!",
+	"🍜 Free Kimchi with any Eastern order over $30",
+	"🍟 Friday Deal: Free large fries with any combo",
+	"🍰 Dessert Sunday: 50% off all sweet treats!",
+}
+
+// seedPromotions inserts the default promos once, so promos an admin
+// deletes stay deleted across restarts
+func seedPromotions() {
+	const migrationID = 2
+	const migrationName = "promotions_seed_v1"
+
+	var alreadyExecuted bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM migrations WHERE id = ?)",
+		migrationID).Scan(&alreadyExecuted)
+	if err != nil {
+		slog.Error("failed to check migration status", "error", err)
+		return
+	}
+	if alreadyExecuted {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		slog.Error("failed to seed promotions", "error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	for _, message := range defaultPromotions {
+		if _, err := tx.Exec("INSERT INTO promotions (message) VALUES (?)",
+			message); err != nil {
+			slog.Error("failed to seed promotion", "error", err)
+			return
+		}
+	}
+	if _, err := tx.Exec("INSERT INTO migrations (id, name) VALUES (?, ?)",
+		migrationID, migrationName); err != nil {
+		slog.Error("failed to record migration", "error", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed to seed promotions", "error", err)
+		return
+	}
+	slog.Info("seeded default promotions")
+}
+
+// FetchPromotions retrieves all promotions, highest priority first
+func FetchPromotions() ([]models.Promotion, error) {
+	return queryPromotions(`SELECT ` + promotionColumns + ` FROM promotions
+		ORDER BY priority DESC, id`)
+}
+
+// FetchActivePromotions retrieves promotions with the active flag set,
+// highest priority first. Schedules are not applied.
+func FetchActivePromotions() ([]models.Promotion, error) {
+	return queryPromotions(`SELECT ` + promotionColumns + ` FROM promotions
+		WHERE active = 1 ORDER BY priority DESC, id`)
+}
+
+// GetPromotion retrieves a single promotion
+func GetPromotion(id int) (*models.Promotion, error) {
+	row := db.QueryRow(`SELECT `+promotionColumns+` FROM promotions
+		WHERE id = ?`, id)
+	return scanPromotion(row)
+}
+
+// CreatePromotion inserts a promotion
+func CreatePromotion(p *models.Promotion) error {
+	result, err := db.Exec(`
+		INSERT INTO promotions (message, starts_at, ends_at, days_of_week,
+			priority, audience, active)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`,
+		p.Message, p.StartsAt, p.EndsAt, formatIntList(p.DaysOfWeek), p.Priority,
+		p.Audience, p.Active)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	p.ID = int(id)
+
+	return db.QueryRow(`SELECT created_at, updated_at FROM promotions
+		WHERE id = ?`, p.ID).Scan(&p.CreatedAt, &p.UpdatedAt)
+}
+
+// UpdatePromotion replaces all editable fields of a promotion
+func UpdatePromotion(p *models.Promotion) error {
+	result, err := db.Exec(`
+		UPDATE promotions SET message = ?, starts_at = ?, ends_at = ?,
+			days_of_week = ?, priority = ?, audience = ?, active = ?,
+			updated_at = CURRENT_TIMESTAMP
+		WHERE id = ?`,
+		p.Message, p.StartsAt, p.EndsAt, formatIntList(p.DaysOfWeek), p.Priority,
+		p.Audience, p.Active, p.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+
+	return db.QueryRow(`SELECT created_at, updated_at FROM promotions
+		WHERE id = ?`, p.ID).Scan(&p.CreatedAt, &p.UpdatedAt)
+}
+
+// DeletePromotion removes a promotion
+func DeletePromotion(id int) error {
+	result, err := db.Exec("DELETE FROM promotions WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// SyncPromotionMessages makes the active promotions match a plain list of
+// messages, as edited in the promo bar editor. Active promotions whose
+// message is not listed are deleted, listed messages without an active
+// promotion are added with default settings, and the rest keep their
+// schedule and audience.
+func SyncPromotionMessages(messages []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT id, message FROM promotions WHERE active = 1")
+	if err != nil {
+		return err
+	}
+	existing := map[string][]int{}
+	for rows.Next() {
+		var id int
+		var message string
+		if err := rows.Scan(&id, &message); err != nil {
+			rows.Close()
+			return err
+		}
+		existing[message] = append(existing[message], id)
+	}
+	rows.Close()
+
+	for _, message := range messages {
+		if ids := existing[message]; len(ids) > 0 {
+			existing[message] = ids[1:]
+			continue
+		}
+		if _, err := tx.Exec("INSERT INTO promotions (message) VALUES (?)",
+			message); err != nil {
+			return err
+		}
+	}
+
+	for _, ids := range existing {
+		for _, id := range ids {
+			if _, err := tx.Exec("DELETE FROM promotions WHERE id = ?",
+				id); err != nil {
+				return err
+			}
+		}
+	}
+
+	return tx.Commit()
+}
+
+// FetchOrderedCategories retrieves the product categories a user has
+// ordered from
+func FetchOrderedCategories(userID int) ([]string, error) {
+	rows, err := db.Query(`SELECT DISTINCT p.category FROM orders o
+		JOIN order_items oi ON oi.order_id = o.id
+		JOIN products p ON p.id = oi.product_id
+		WHERE o.user_id = ?`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var categories []string
+	for rows.Next() {
+		var c string
+		if err := rows.Scan(&c); err != nil {
+			return nil, err
+		}
+		categories = append(categories, c)
+	}
+	return categories, nil
+}
+
+func queryPromotions(query string, args ...any) ([]models.Promotion, error) {
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	promotions := []models.Promotion{}
+	for rows.Next() {
+		p, err := scanPromotion(rows)
+		if err != nil {
+			return nil, err
+		}
+		promotions = append(promotions, *p)
+	}
+	return promotions, nil
+}
+
+func scanPromotion(row rowScanner) (*models.Promotion, error) {
+	var p models.Promotion
+	var days string
+	if err := row.Scan(&p.ID, &p.Message, &p.StartsAt, &p.EndsAt, &days,
+		&p.Priority, &p.Audience, &p.Active, &p.CreatedAt,
+		&p.UpdatedAt); err != nil {
+		return nil, err
+	}
+	p.DaysOfWeek = parseIntList(days)
+	return &p, nil
+}
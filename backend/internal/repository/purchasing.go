@@ -0,0 +1,741 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"log/slog"
+
+	"restaurant-backend/internal/models"
+)
+
+var (
+	// ErrPurchaseOrderStatus is returned when a purchase order's status does
+	// not allow the change, such as receiving a draft
+	ErrPurchaseOrderStatus = errors.New("purchase order status does not allow this")
+	// ErrOverReceipt is returned when receiving more than is outstanding
+	ErrOverReceipt = errors.New("received quantity exceeds what is outstanding")
+	// ErrUnknownPurchaseOrderLine is returned for lines not on the order
+	ErrUnknownPurchaseOrderLine = errors.New("line is not on this purchase order")
+)
+
+const supplierColumns = `id, name, contact_name, email, phone, lead_time_days,
+	notes, active, created_at`
+
+const purchaseOrderColumns = `po.id, po.supplier_id, COALESCE(s.name, ''),
+	po.status, po.expected_date, po.notes, po.created_by, po.ordered_at,
+	po.received_at, po.created_at,
+	(SELECT COALESCE(ROUND(SUM(l.quantity * l.unit_cost), 2), 0)
+		FROM purchase_order_lines l WHERE l.purchase_order_id = po.id)`
+
+// migrateSupplyOrders turns supplies ordered before purchase orders
+// existed into one open purchase order, so they can still be received
+func migrateSupplyOrders() {
+	const migrationID = 4
+	const migrationName = "purchase_orders_from_ordered_quantity_v1"
+
+	var alreadyExecuted bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM migrations WHERE id = ?)",
+		migrationID).Scan(&alreadyExecuted)
+	if err != nil {
+		slog.Error("failed to check migration status", "error", err)
+		return
+	}
+	if alreadyExecuted {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		slog.Error("failed to migrate supply orders", "error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	var open int
+	if err := tx.QueryRow(`SELECT COUNT(*) FROM products
+		WHERE ordered_quantity > 0`).Scan(&open); err != nil {
+		slog.Error("failed to migrate supply orders", "error", err)
+		return
+	}
+	if open > 0 {
+		res, err := tx.Exec(`INSERT INTO purchase_orders (status, notes, ordered_at)
+			VALUES ('ordered', 'Supplies ordered before purchase orders',
+				CURRENT_TIMESTAMP)`)
+		if err != nil {
+			slog.Error("failed to migrate supply orders", "error", err)
+			return
+		}
+		poID, _ := res.LastInsertId()
+		if _, err := tx.Exec(`INSERT INTO purchase_order_lines (purchase_order_id,
+				product_id, quantity)
+			SELECT ?, id, ordered_quantity FROM products WHERE ordered_quantity > 0`,
+			poID); err != nil {
+			slog.Error("failed to migrate supply orders", "error", err)
+			return
+		}
+	}
+	if _, err := tx.Exec("INSERT INTO migrations (id, name) VALUES (?, ?)",
+		migrationID, migrationName); err != nil {
+		slog.Error("failed to record migration", "error", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed to migrate supply orders", "error", err)
+	}
+}
+
+// FetchSuppliers retrieves all suppliers by name
+func FetchSuppliers() ([]models.Supplier, error) {
+	rows, err := db.Query(`SELECT ` + supplierColumns + ` FROM suppliers
+		ORDER BY name`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	suppliers := []models.Supplier{}
+	for rows.Next() {
+		s, err := scanSupplier(rows)
+		if err != nil {
+			return nil, err
+		}
+		suppliers = append(suppliers, *s)
+	}
+	return suppliers, nil
+}
+
+// GetSupplier retrieves a supplier by ID
+func GetSupplier(id int) (*models.Supplier, error) {
+	return scanSupplier(db.QueryRow(`SELECT `+supplierColumns+` FROM suppliers
+		WHERE id = ?`, id))
+}
+
+// CreateSupplier inserts a supplier
+func CreateSupplier(s *models.Supplier) error {
+	res, err := db.Exec(`INSERT INTO suppliers (name, contact_name, email, phone,
+			lead_time_days, notes, active)
+		VALUES (?, ?, ?, ?, ?, ?, ?)`, s.Name, s.ContactName, s.Email, s.Phone,
+		s.LeadTimeDays, s.Notes, s.Active)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	s.ID = int(id)
+	return db.QueryRow("SELECT created_at FROM suppliers WHERE id = ?", s.ID).
+		Scan(&s.CreatedAt)
+}
+
+// UpdateSupplier updates a supplier, returning sql.ErrNoRows when it does
+// not exist
+func UpdateSupplier(s *models.Supplier) error {
+	res, err := db.Exec(`UPDATE suppliers SET name = ?, contact_name = ?,
+			email = ?, phone = ?, lead_time_days = ?, notes = ?, active = ?
+		WHERE id = ?`, s.Name, s.ContactName, s.Email, s.Phone, s.LeadTimeDays,
+		s.Notes, s.Active, s.ID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return db.QueryRow("SELECT created_at FROM suppliers WHERE id = ?", s.ID).
+		Scan(&s.CreatedAt)
+}
+
+func scanSupplier(row rowScanner) (*models.Supplier, error) {
+	var s models.Supplier
+	if err := row.Scan(&s.ID, &s.Name, &s.ContactName, &s.Email, &s.Phone,
+		&s.LeadTimeDays, &s.Notes, &s.Active, &s.CreatedAt); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// FetchPurchaseOrders retrieves purchase orders with their lines, newest
+// first, optionally only those with a status or from a supplier
+func FetchPurchaseOrders(status string, supplierID int) ([]models.PurchaseOrder, error) {
+	query := `SELECT ` + purchaseOrderColumns + ` FROM purchase_orders po
+		LEFT JOIN suppliers s ON s.id = po.supplier_id WHERE 1 = 1`
+	var args []any
+	if status != "" {
+		query += " AND po.status = ?"
+		args = append(args, status)
+	}
+	if supplierID > 0 {
+		query += " AND po.supplier_id = ?"
+		args = append(args, supplierID)
+	}
+	rows, err := db.Query(query+" ORDER BY po.id DESC", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	orders := []models.PurchaseOrder{}
+	for rows.Next() {
+		po, err := scanPurchaseOrder(rows)
+		if err != nil {
+			return nil, err
+		}
+		orders = append(orders, *po)
+	}
+	rows.Close()
+
+	for i := range orders {
+		if orders[i].Lines, err = fetchPurchaseOrderLines(orders[i].ID); err != nil {
+			return nil, err
+		}
+	}
+	return orders, nil
+}
+
+// GetPurchaseOrder retrieves a purchase order with its lines and receipts
+func GetPurchaseOrder(id int) (*models.PurchaseOrder, error) {
+	po, err := scanPurchaseOrder(db.QueryRow(`SELECT `+purchaseOrderColumns+`
+		FROM purchase_orders po LEFT JOIN suppliers s ON s.id = po.supplier_id
+		WHERE po.id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	if po.Lines, err = fetchPurchaseOrderLines(po.ID); err != nil {
+		return nil, err
+	}
+	if po.Receipts, err = fetchPurchaseOrderReceipts(po.ID); err != nil {
+		return nil, err
+	}
+	return po, nil
+}
+
+// CreatePurchaseOrder inserts a purchase order with its lines. A status of
+// ordered places it straight away; anything else makes a draft.
+func CreatePurchaseOrder(po *models.PurchaseOrder) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := createPurchaseOrderTx(tx, po); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func createPurchaseOrderTx(tx *sql.Tx, po *models.PurchaseOrder) error {
+	if po.Status != "ordered" {
+		po.Status = "draft"
+	}
+	res, err := tx.Exec(`INSERT INTO purchase_orders (supplier_id, status,
+			expected_date, notes, created_by)
+		VALUES (?, 'draft', ?, ?, ?)`, po.SupplierID, po.ExpectedDate,
+		po.Notes, po.CreatedBy)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	po.ID = int(id)
+
+	if err := insertPurchaseOrderLinesTx(tx, po); err != nil {
+		return err
+	}
+	if po.Status == "ordered" {
+		return placePurchaseOrderTx(tx, po.ID)
+	}
+	return nil
+}
+
+// UpdatePurchaseOrder changes a draft's supplier, expected date, notes and
+// lines
+func UpdatePurchaseOrder(po *models.PurchaseOrder) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := requirePurchaseOrderStatus(tx, po.ID, "draft"); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE purchase_orders SET supplier_id = ?,
+			expected_date = ?, notes = ?
+		WHERE id = ?`, po.SupplierID, po.ExpectedDate, po.Notes,
+		po.ID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`DELETE FROM purchase_order_lines
+		WHERE purchase_order_id = ?`, po.ID); err != nil {
+		return err
+	}
+	if err := insertPurchaseOrderLinesTx(tx, po); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SubmitPurchaseOrder places a draft with its supplier. Its lines count
+// towards the products' ordered quantity until received.
+func SubmitPurchaseOrder(id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := requirePurchaseOrderStatus(tx, id, "draft"); err != nil {
+		return err
+	}
+	if err := placePurchaseOrderTx(tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// CancelPurchaseOrder cancels a purchase order that is not fully received.
+// Stock already received stays; the rest no longer counts as ordered.
+func CancelPurchaseOrder(id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	status, err := purchaseOrderStatusTx(tx, id)
+	if err != nil {
+		return err
+	}
+	switch status {
+	case "draft":
+	case "ordered", "partially_received":
+		if _, err := tx.Exec(`UPDATE products SET ordered_quantity = MAX(0,
+				ordered_quantity - (SELECT COALESCE(SUM(quantity - received_quantity), 0)
+					FROM purchase_order_lines
+					WHERE purchase_order_id = ? AND product_id = products.id))
+			WHERE id IN (SELECT product_id FROM purchase_order_lines
+				WHERE purchase_order_id = ?)`, id, id); err != nil {
+			return err
+		}
+	default:
+		return ErrPurchaseOrderStatus
+	}
+	if _, err := tx.Exec(`UPDATE purchase_orders SET status = 'cancelled'
+		WHERE id = ?`, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReceivePurchaseOrder adds a delivery to stock. With no lines everything
+// still outstanding is received.
+func ReceivePurchaseOrder(id int, lines []models.ReceiveLine, actorID *int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	status, err := purchaseOrderStatusTx(tx, id)
+	if err != nil {
+		return err
+	}
+	if status != "ordered" && status != "partially_received" {
+		return ErrPurchaseOrderStatus
+	}
+
+	rows, err := tx.Query(`SELECT id, product_id, quantity - received_quantity
+		FROM purchase_order_lines WHERE purchase_order_id = ?`, id)
+	if err != nil {
+		return err
+	}
+	type openLine struct{ productID, outstanding int }
+	open := map[int]openLine{}
+	var order []int
+	for rows.Next() {
+		var lineID int
+		var l openLine
+		if err := rows.Scan(&lineID, &l.productID, &l.outstanding); err != nil {
+			rows.Close()
+			return err
+		}
+		open[lineID] = l
+		order = append(order, lineID)
+	}
+	rows.Close()
+
+	if len(lines) == 0 {
+		for _, lineID := range order {
+			if open[lineID].outstanding > 0 {
+				lines = append(lines, models.ReceiveLine{LineID: lineID,
+					Quantity: open[lineID].outstanding})
+			}
+		}
+	}
+	for _, rl := range lines {
+		l, ok := open[rl.LineID]
+		if !ok {
+			return ErrUnknownPurchaseOrderLine
+		}
+		if rl.Quantity > l.outstanding {
+			return ErrOverReceipt
+		}
+		if err := receiveLineTx(tx, id, rl.LineID, l.productID, rl.Quantity,
+			rl.ExpiresAt, actorID); err != nil {
+			return err
+		}
+		l.outstanding -= rl.Quantity
+		open[rl.LineID] = l
+	}
+	if err := refreshPurchaseOrderStatusTx(tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ReceiveProductSupplies receives a delivery of one product against its
+// open purchase orders, oldest first. Anything beyond what was ordered is
+// recorded as a new received purchase order from the product's last
+// supplier. The stock received expires on expiresAt, if not empty.
+func ReceiveProductSupplies(productID, quantity int, expiresAt string, actorID *int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query(`SELECT l.id, l.purchase_order_id,
+			l.quantity - l.received_quantity
+		FROM purchase_order_lines l
+		JOIN purchase_orders po ON po.id = l.purchase_order_id
+		WHERE l.product_id = ? AND l.quantity > l.received_quantity
+			AND po.status IN ('ordered', 'partially_received')
+		ORDER BY po.id, l.id`, productID)
+	if err != nil {
+		return err
+	}
+	type openLine struct{ id, poID, outstanding int }
+	var open []openLine
+	for rows.Next() {
+		var l openLine
+		if err := rows.Scan(&l.id, &l.poID, &l.outstanding); err != nil {
+			rows.Close()
+			return err
+		}
+		open = append(open, l)
+	}
+	rows.Close()
+
+	left := quantity
+	for _, l := range open {
+		if left == 0 {
+			break
+		}
+		n := min(left, l.outstanding)
+		if err := receiveLineTx(tx, l.poID, l.id, productID, n, expiresAt,
+			actorID); err != nil {
+			return err
+		}
+		if err := refreshPurchaseOrderStatusTx(tx, l.poID); err != nil {
+			return err
+		}
+		left -= n
+	}
+
+	if left > 0 {
+		supplierID, unitCost, err := lastPurchaseTx(tx, productID)
+		if err != nil {
+			return err
+		}
+		po := &models.PurchaseOrder{
+			SupplierID: supplierID,
+			Status:     "ordered",
+			Notes:      "Received without a purchase order",
+			CreatedBy:  actorID,
+			Lines: []models.PurchaseOrderLine{{ProductID: productID,
+				Quantity: left, UnitCost: unitCost}},
+		}
+		if err := createPurchaseOrderTx(tx, po); err != nil {
+			return err
+		}
+		if err := receiveLineTx(tx, po.ID, po.Lines[0].ID, productID, left,
+			expiresAt, actorID); err != nil {
+			return err
+		}
+		if err := refreshPurchaseOrderStatusTx(tx, po.ID); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// LastPurchase returns the supplier and unit cost of a product's most
+// recent purchase order line, nil and 0 when it was never ordered
+func LastPurchase(productID int) (*int, float64, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, 0, err
+	}
+	defer tx.Rollback()
+	return lastPurchaseTx(tx, productID)
+}
+
+func lastPurchaseTx(tx *sql.Tx, productID int) (*int, float64, error) {
+	var supplierID sql.NullInt64
+	var unitCost float64
+	err := tx.QueryRow(`SELECT po.supplier_id, l.unit_cost
+		FROM purchase_order_lines l
+		JOIN purchase_orders po ON po.id = l.purchase_order_id
+		WHERE l.product_id = ? AND po.status != 'cancelled'
+		ORDER BY l.id DESC LIMIT 1`, productID).Scan(&supplierID, &unitCost)
+	if err == sql.ErrNoRows {
+		return nil, 0, nil
+	}
+	if err != nil {
+		return nil, 0, err
+	}
+	return nullIntPtr(supplierID), unitCost, nil
+}
+
+// receiveLineTx adds quantity of a line to stock, in a lot expiring on
+// expiresAt if not empty, and records the receipt
+func receiveLineTx(tx *sql.Tx, poID, lineID, productID, quantity int,
+	expiresAt string, actorID *int) error {
+	if quantity <= 0 {
+		return nil
+	}
+	lot := &models.StockLot{ExpiresAt: expiresAt, PurchaseOrderID: &poID}
+	if err := tx.QueryRow("SELECT unit_cost FROM purchase_order_lines WHERE id = ?",
+		lineID).Scan(&lot.UnitCost); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE purchase_order_lines
+		SET received_quantity = received_quantity + ?
+		WHERE id = ?`, quantity, lineID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE products
+		SET ordered_quantity = MAX(0, ordered_quantity - ?)
+		WHERE id = ?`, quantity, productID); err != nil {
+		return err
+	}
+	if err := moveStockTx(tx, &models.StockMovement{
+		ProductID:     productID,
+		Quantity:      quantity,
+		Reason:        "receipt",
+		ReferenceType: "purchase_order",
+		ReferenceID:   &poID,
+		ActorID:       actorID,
+		Lot:           lot,
+	}); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`INSERT INTO purchase_order_receipts (purchase_order_id,
+			line_id, quantity, received_by)
+		VALUES (?, ?, ?, ?)`, poID, lineID, quantity, actorID)
+	return err
+}
+
+// refreshPurchaseOrderStatusTx marks a purchase order received once every
+// line has arrived, or partially received before that
+func refreshPurchaseOrderStatusTx(tx *sql.Tx, id int) error {
+	_, err := tx.Exec(`UPDATE purchase_orders SET
+			status = CASE WHEN EXISTS (SELECT 1 FROM purchase_order_lines
+					WHERE purchase_order_id = ? AND received_quantity < quantity)
+				THEN 'partially_received' ELSE 'received' END,
+			received_at = CASE WHEN EXISTS (SELECT 1 FROM purchase_order_lines
+					WHERE purchase_order_id = ? AND received_quantity < quantity)
+				THEN NULL ELSE CURRENT_TIMESTAMP END
+		WHERE id = ?`, id, id, id)
+	return err
+}
+
+// placePurchaseOrderTx marks a purchase order ordered and counts its lines
+// as ordered on the products
+func placePurchaseOrderTx(tx *sql.Tx, id int) error {
+	if _, err := tx.Exec(`UPDATE purchase_orders
+		SET status = 'ordered', ordered_at = CURRENT_TIMESTAMP
+		WHERE id = ?`, id); err != nil {
+		return err
+	}
+	_, err := tx.Exec(`UPDATE products SET ordered_quantity =
+			COALESCE(ordered_quantity, 0) + (SELECT SUM(quantity)
+				FROM purchase_order_lines
+				WHERE purchase_order_id = ? AND product_id = products.id)
+		WHERE id IN (SELECT product_id FROM purchase_order_lines
+			WHERE purchase_order_id = ?)`, id, id)
+	return err
+}
+
+func insertPurchaseOrderLinesTx(tx *sql.Tx, po *models.PurchaseOrder) error {
+	for i := range po.Lines {
+		l := &po.Lines[i]
+		res, err := tx.Exec(`INSERT INTO purchase_order_lines (purchase_order_id,
+				product_id, quantity, unit_cost)
+			VALUES (?, ?, ?, ?)`, po.ID, l.ProductID, l.Quantity, l.UnitCost)
+		if err != nil {
+			return err
+		}
+		id, err := res.LastInsertId()
+		if err != nil {
+			return err
+		}
+		l.ID = int(id)
+	}
+	return nil
+}
+
+func requirePurchaseOrderStatus(tx *sql.Tx, id int, want string) error {
+	status, err := purchaseOrderStatusTx(tx, id)
+	if err != nil {
+		return err
+	}
+	if status != want {
+		return ErrPurchaseOrderStatus
+	}
+	return nil
+}
+
+func purchaseOrderStatusTx(tx *sql.Tx, id int) (string, error) {
+	var status string
+	err := tx.QueryRow("SELECT status FROM purchase_orders WHERE id = ?", id).
+		Scan(&status)
+	return status, err
+}
+
+func fetchPurchaseOrderLines(poID int) ([]models.PurchaseOrderLine, error) {
+	rows, err := db.Query(`SELECT l.id, l.product_id, COALESCE(p.name, ''),
+			l.quantity, l.received_quantity, l.unit_cost
+		FROM purchase_order_lines l LEFT JOIN products p ON p.id = l.product_id
+		WHERE l.purchase_order_id = ? ORDER BY l.id`, poID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []models.PurchaseOrderLine{}
+	for rows.Next() {
+		var l models.PurchaseOrderLine
+		if err := rows.Scan(&l.ID, &l.ProductID, &l.ProductName, &l.Quantity,
+			&l.ReceivedQuantity, &l.UnitCost); err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	return lines, nil
+}
+
+func fetchPurchaseOrderReceipts(poID int) ([]models.PurchaseOrderReceipt, error) {
+	rows, err := db.Query(`SELECT r.id, r.line_id, l.product_id, r.quantity,
+			r.received_by, r.received_at
+		FROM purchase_order_receipts r
+		JOIN purchase_order_lines l ON l.id = r.line_id
+		WHERE r.purchase_order_id = ? ORDER BY r.id`, poID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var receipts []models.PurchaseOrderReceipt
+	for rows.Next() {
+		var rc models.PurchaseOrderReceipt
+		var by sql.NullInt64
+		if err := rows.Scan(&rc.ID, &rc.LineID, &rc.ProductID, &rc.Quantity, &by,
+			&rc.ReceivedAt); err != nil {
+			return nil, err
+		}
+		rc.ReceivedBy = nullIntPtr(by)
+		receipts = append(receipts, rc)
+	}
+	return receipts, nil
+}
+
+func scanPurchaseOrder(row rowScanner) (*models.PurchaseOrder, error) {
+	var po models.PurchaseOrder
+	var supplierID, createdBy sql.NullInt64
+	var orderedAt, receivedAt sql.NullString
+	if err := row.Scan(&po.ID, &supplierID, &po.SupplierName, &po.Status,
+		&po.ExpectedDate, &po.Notes, &createdBy, &orderedAt, &receivedAt,
+		&po.CreatedAt, &po.Total); err != nil {
+		return nil, err
+	}
+	po.SupplierID = nullIntPtr(supplierID)
+	po.CreatedBy = nullIntPtr(createdBy)
+	if orderedAt.Valid {
+		po.OrderedAt = &orderedAt.String
+	}
+	if receivedAt.Valid {
+		po.ReceivedAt = &receivedAt.String
+	}
+	return &po, nil
+}
+
+// FetchReorderData retrieves what reorder suggestions are worked out from
+// for each product that isn't made from a recipe: its stock, what is on
+// draft purchase orders, the units sold in the last windowDays, and the
+// supplier and unit cost of its last purchase. Inactive suppliers are left out; LeadTimeDays is -1 for
+// products without a supplier.
+func FetchReorderData(windowDays int) ([]models.ReorderSuggestion, error) {
+	rows, err := db.Query(`SELECT p.id, p.name, p.stock_quantity, p.ordered_quantity,
+			(SELECT COALESCE(SUM(l.quantity), 0) FROM purchase_order_lines l
+				JOIN purchase_orders po ON po.id = l.purchase_order_id
+				WHERE l.product_id = p.id AND po.status = 'draft'),
+			p.low_stock_threshold,
+			(SELECT COALESCE(SUM(oi.quantity), 0) FROM order_items oi
+				JOIN orders o ON o.id = oi.order_id
+				WHERE oi.product_id = p.id AND o.status != 'cancelled'
+					AND o.created_at >= datetime('now', ?)),
+			s.id, COALESCE(s.name, ''), COALESCE(s.lead_time_days, -1),
+			COALESCE((SELECT l.unit_cost FROM purchase_order_lines l
+				JOIN purchase_orders po ON po.id = l.purchase_order_id
+				WHERE l.product_id = p.id AND po.status != 'cancelled'
+				ORDER BY l.id DESC LIMIT 1), 0)
+		FROM products p
+		LEFT JOIN suppliers s ON s.active = 1 AND s.id = (SELECT po.supplier_id
+			FROM purchase_order_lines l
+			JOIN purchase_orders po ON po.id = l.purchase_order_id
+			WHERE l.product_id = p.id AND po.status != 'cancelled'
+			ORDER BY l.id DESC LIMIT 1)
+		WHERE p.id NOT IN (SELECT product_id FROM recipe_lines)
+		ORDER BY p.name`, fmt.Sprintf("-%d days", windowDays))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var data []models.ReorderSuggestion
+	for rows.Next() {
+		var s models.ReorderSuggestion
+		var supplierID sql.NullInt64
+		if err := rows.Scan(&s.ProductID, &s.ProductName, &s.StockQuantity,
+			&s.OrderedQuantity, &s.DraftQuantity, &s.LowStockThreshold, &s.UnitsSold, &supplierID,
+			&s.SupplierName, &s.LeadTimeDays, &s.UnitCost); err != nil {
+			return nil, err
+		}
+		s.SupplierID = nullIntPtr(supplierID)
+		data = append(data, s)
+	}
+	return data, rows.Err()
+}
+
+// CreatePurchaseOrders inserts several purchase orders at once, so either
+// all of them are created or none
+func CreatePurchaseOrders(pos []*models.PurchaseOrder) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, po := range pos {
+		if err := createPurchaseOrderTx(tx, po); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
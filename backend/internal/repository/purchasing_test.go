@@ -0,0 +1,188 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"restaurant-backend/internal/models"
+)
+
+// orderedOf is how much of a product is on order, failing the test on error
+func orderedOf(t *testing.T, productID int) int {
+	t.Helper()
+	var ordered int
+	if err := db.QueryRow("SELECT ordered_quantity FROM products WHERE id = ?",
+		productID).Scan(&ordered); err != nil {
+		t.Fatal(err)
+	}
+	return ordered
+}
+
+// placedOrder places a purchase order for quantity of each product at cost
+func placedOrder(t *testing.T, quantity int, cost float64, products ...*models.Product) *models.PurchaseOrder {
+	t.Helper()
+	po := &models.PurchaseOrder{Status: "ordered"}
+	for _, p := range products {
+		po.Lines = append(po.Lines, models.PurchaseOrderLine{ProductID: p.ID,
+			Quantity: quantity, UnitCost: cost})
+	}
+	if err := CreatePurchaseOrder(po); err != nil {
+		t.Fatal(err)
+	}
+	return po
+}
+
+// purchaseOrderStatus is a purchase order's status, failing the test on error
+func purchaseOrderStatus(t *testing.T, id int) string {
+	t.Helper()
+	po, err := GetPurchaseOrder(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return po.Status
+}
+
+func TestReceivePurchaseOrder(t *testing.T) {
+	a, b := testProduct(t, 0), testProduct(t, 1)
+	po := placedOrder(t, 10, 2.5, a, b)
+	if got := orderedOf(t, a.ID); got != 10 {
+		t.Errorf("on order = %d, want 10", got)
+	}
+
+	first := po.Lines[0].ID
+	if err := ReceivePurchaseOrder(po.ID, []models.ReceiveLine{
+		{LineID: first, Quantity: 4, ExpiresAt: inDays(7)}}, nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := purchaseOrderStatus(t, po.ID); got != "partially_received" {
+		t.Errorf("status = %s, want partially_received", got)
+	}
+	if stock, ordered := stockOf(t, a.ID), orderedOf(t, a.ID); stock != 4 || ordered != 6 {
+		t.Errorf("stock %d with %d on order, want 4 with 6", stock, ordered)
+	}
+	lots, err := FetchStockLots(a.ID, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(lots) != 1 || lots[0].Quantity != 4 || lots[0].UnitCost != 2.5 ||
+		lots[0].ExpiresAt != inDays(7) || lots[0].PurchaseOrderID == nil ||
+		*lots[0].PurchaseOrderID != po.ID {
+		t.Errorf("lots = %+v, want 4 at 2.5 from the order", lots)
+	}
+
+	refused := []struct {
+		name string
+		line models.ReceiveLine
+		want error
+	}{
+		{"more than is outstanding", models.ReceiveLine{LineID: first, Quantity: 7},
+			ErrOverReceipt},
+		{"line on another order", models.ReceiveLine{LineID: -1, Quantity: 1},
+			ErrUnknownPurchaseOrderLine},
+	}
+	for _, tt := range refused {
+		err := ReceivePurchaseOrder(po.ID, []models.ReceiveLine{tt.line}, nil)
+		if !errors.Is(err, tt.want) {
+			t.Errorf("%s: err = %v, want %v", tt.name, err, tt.want)
+		}
+	}
+
+	// Without lines everything outstanding arrives
+	if err := ReceivePurchaseOrder(po.ID, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	got, err := GetPurchaseOrder(po.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Status != "received" || got.ReceivedAt == nil || len(got.Receipts) != 3 {
+		t.Errorf("order = %s with %d receipts, want received with 3", got.Status,
+			len(got.Receipts))
+	}
+	for _, p := range []*models.Product{a, b} {
+		if stock, ordered := stockOf(t, p.ID), orderedOf(t, p.ID); stock != 10+p.StockQuantity ||
+			ordered != 0 {
+			t.Errorf("product %d: stock %d with %d on order, want %d with 0", p.ID,
+				stock, ordered, 10+p.StockQuantity)
+		}
+	}
+	if err := ReceivePurchaseOrder(po.ID, nil, nil); !errors.Is(err, ErrPurchaseOrderStatus) {
+		t.Errorf("receiving a received order: err = %v, want ErrPurchaseOrderStatus", err)
+	}
+}
+
+func TestReceiveDraftPurchaseOrder(t *testing.T) {
+	p := testProduct(t, 0)
+	po := &models.PurchaseOrder{Lines: []models.PurchaseOrderLine{
+		{ProductID: p.ID, Quantity: 5, UnitCost: 1}}}
+	if err := CreatePurchaseOrder(po); err != nil {
+		t.Fatal(err)
+	}
+	if orderedOf(t, p.ID) != 0 {
+		t.Error("a draft counts as ordered")
+	}
+	if err := ReceivePurchaseOrder(po.ID, nil, nil); !errors.Is(err, ErrPurchaseOrderStatus) {
+		t.Errorf("receiving a draft: err = %v, want ErrPurchaseOrderStatus", err)
+	}
+	if err := SubmitPurchaseOrder(po.ID); err != nil {
+		t.Fatal(err)
+	}
+	if got := orderedOf(t, p.ID); got != 5 {
+		t.Errorf("on order after submitting = %d, want 5", got)
+	}
+}
+
+func TestCancelPartiallyReceivedPurchaseOrder(t *testing.T) {
+	p := testProduct(t, 0)
+	po := placedOrder(t, 10, 1, p)
+	if err := ReceivePurchaseOrder(po.ID, []models.ReceiveLine{
+		{LineID: po.Lines[0].ID, Quantity: 3}}, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := CancelPurchaseOrder(po.ID); err != nil {
+		t.Fatal(err)
+	}
+	if stock, ordered := stockOf(t, p.ID), orderedOf(t, p.ID); stock != 3 || ordered != 0 {
+		t.Errorf("stock %d with %d on order, want 3 with 0", stock, ordered)
+	}
+	if err := CancelPurchaseOrder(po.ID); !errors.Is(err, ErrPurchaseOrderStatus) {
+		t.Errorf("cancelling twice: err = %v, want ErrPurchaseOrderStatus", err)
+	}
+}
+
+func TestReceiveProductSupplies(t *testing.T) {
+	p := testProduct(t, 0)
+	older := placedOrder(t, 3, 2, p)
+	newer := placedOrder(t, 4, 3, p)
+
+	// Fills the orders oldest first and records the rest as a new order
+	if err := ReceiveProductSupplies(p.ID, 9, "", nil); err != nil {
+		t.Fatal(err)
+	}
+	for _, po := range []*models.PurchaseOrder{older, newer} {
+		if got := purchaseOrderStatus(t, po.ID); got != "received" {
+			t.Errorf("order %d is %s, want received", po.ID, got)
+		}
+	}
+	if stock, ordered := stockOf(t, p.ID), orderedOf(t, p.ID); stock != 9 || ordered != 0 {
+		t.Errorf("stock %d with %d on order, want 9 with 0", stock, ordered)
+	}
+
+	received, err := FetchPurchaseOrders("received", 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var extra *models.PurchaseOrder
+	for i := range received {
+		if received[i].ID > newer.ID && received[i].Lines[0].ProductID == p.ID {
+			extra = &received[i]
+		}
+	}
+	if extra == nil {
+		t.Fatal("no purchase order for the extra stock")
+	}
+	if l := extra.Lines[0]; l.Quantity != 2 || l.ReceivedQuantity != 2 || l.UnitCost != 3 {
+		t.Errorf("extra line = %+v, want 2 received at the last cost of 3", l)
+	}
+}
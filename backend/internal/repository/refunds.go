@@ -0,0 +1,358 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"restaurant-backend/internal/models"
+)
+
+var (
+	// ErrOrderNotRefundable is returned when refunding an order that is not
+	// completed
+	ErrOrderNotRefundable = errors.New("order cannot be refunded")
+	// ErrRefundExceedsOrder is returned when refunding more of an item, or
+	// more of the card payment, than is left to refund
+	ErrRefundExceedsOrder = errors.New("refund exceeds the quantity ordered")
+	// ErrRefundPaymentStatus is returned when retrying a card refund that
+	// has not failed
+	ErrRefundPaymentStatus = errors.New("refund payment has not failed")
+)
+
+// Card refund statuses
+const (
+	RefundPaymentPending     = "pending"
+	RefundPaymentSucceeded   = "succeeded"
+	RefundPaymentFailed      = "failed"
+	RefundPaymentNotRequired = "not_required"
+)
+
+// CreateRefund records a refund of a completed order. Refunded quantities
+// are checked against what is left to refund, optionally returned to
+// stock, and the gift card part of the refund is credited back to the
+// cards in giftCards. Earned loyalty points are taken back in proportion
+// to the amount refunded, limited to the customer's balance; a full refund
+// also gives back points redeemed on the order. The card part is checked
+// against what is left of the card payment and recorded as pending, to be
+// sent to the provider once the refund is stored.
+func CreateRefund(refund *models.Refund, giftCards []models.OrderTender, expiryDays int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var status string
+	var userID sql.NullInt64
+	var total, purchased, taxTotal, refundedTax float64
+	if err := tx.QueryRow(`SELECT o.status, o.user_id, o.total_price,
+		COALESCE((SELECT SUM(initial_value) FROM gift_cards
+			WHERE order_id = o.id), 0),
+		o.tax_total, o.refunded_tax
+		FROM orders o WHERE o.id = ?`, refund.OrderID).Scan(&status, &userID,
+		&total, &purchased, &taxTotal, &refundedTax); err != nil {
+		return err
+	}
+	if status != "completed" {
+		return ErrOrderNotRefundable
+	}
+
+	for _, l := range refund.Lines {
+		result, err := tx.Exec(`UPDATE order_items
+			SET refunded_quantity = refunded_quantity + ?
+			WHERE id = ? AND order_id = ? AND quantity - refunded_quantity >= ?`,
+			l.Quantity, l.OrderItemID, refund.OrderID, l.Quantity)
+		if err != nil {
+			return err
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return ErrRefundExceedsOrder
+		}
+		var lineTax float64
+		if err := tx.QueryRow(`SELECT tax_amount * ? / quantity FROM order_items
+			WHERE id = ?`, l.Quantity, l.OrderItemID).Scan(&lineTax); err != nil {
+			return err
+		}
+		refund.Tax += lineTax
+	}
+
+	refund.Tax = roundCents(refund.Tax)
+	if refund.Full {
+		// The last refund takes the rest so rounding leaves nothing behind
+		refund.Tax = roundCents(taxTotal - refundedTax)
+	}
+
+	if userID.Valid {
+		if err := refundPointsTx(tx, refund, int(userID.Int64),
+			total-purchased, expiryDays); err != nil {
+			return err
+		}
+	}
+
+	refund.PaymentStatus = RefundPaymentNotRequired
+	if refund.PaymentAmount > 0 {
+		refund.PaymentStatus = RefundPaymentPending
+	}
+	result, err := tx.Exec(`
+		INSERT INTO refunds (order_id, amount, tax_amount, reason, note,
+			restocked, full, payment_amount, gift_card_amount, external_amount,
+			payment_status, points_reversed, points_returned, actor_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		refund.OrderID, refund.Amount, refund.Tax, refund.Reason, refund.Note,
+		refund.Restocked, refund.Full, refund.PaymentAmount,
+		refund.GiftCardAmount, refund.ExternalAmount, refund.PaymentStatus,
+		refund.PointsReversed, refund.PointsReturned, refund.ActorID)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	refund.ID = int(id)
+
+	if refund.PaymentAmount > 0 {
+		// Checked after writing, so refunds made at the same time wait
+		// for each other and each sees the others' card parts
+		var captured, refunding float64
+		if err := tx.QueryRow(`SELECT COALESCE((SELECT captured_amount
+				FROM payment_intents WHERE order_id = ? ORDER BY id DESC LIMIT 1), 0),
+			(SELECT SUM(payment_amount) FROM refunds
+				WHERE order_id = ? AND payment_status != ?)`, refund.OrderID,
+			refund.OrderID, RefundPaymentFailed).Scan(&captured,
+			&refunding); err != nil {
+			return err
+		}
+		if roundCents(refunding) > roundCents(captured) {
+			return ErrRefundExceedsOrder
+		}
+	}
+
+	for _, l := range refund.Lines {
+		if _, err := tx.Exec(`
+			INSERT INTO refund_lines (refund_id, order_item_id, quantity, amount)
+			VALUES (?, ?, ?, ?)`,
+			refund.ID, l.OrderItemID, l.Quantity, l.Amount); err != nil {
+			return err
+		}
+		if !refund.Restocked {
+			continue
+		}
+		m := models.StockMovement{
+			Quantity:      l.Quantity,
+			Reason:        "return",
+			ReferenceType: "refund",
+			ReferenceID:   &refund.ID,
+			ActorID:       refund.ActorID,
+		}
+		if err := tx.QueryRow("SELECT product_id FROM order_items WHERE id = ?",
+			l.OrderItemID).Scan(&m.ProductID); err != nil {
+			return err
+		}
+		// A dish made from ingredients can't go back in stock
+		took, err := orderTookProductStockTx(tx, refund.OrderID, m.ProductID)
+		if err != nil {
+			return err
+		}
+		if !took {
+			continue
+		}
+		if err := moveStockTx(tx, &m); err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+
+	for _, t := range giftCards {
+		if err := addGiftCardTransaction(tx, t.GiftCardID, "refund", t.Amount,
+			&refund.OrderID, refund.ActorID,
+			fmt.Sprintf("Refund #%d", refund.ID)); err != nil {
+			return err
+		}
+	}
+
+	if _, err := tx.Exec(`UPDATE orders
+		SET refunded_amount = refunded_amount + ?,
+			refunded_tax = refunded_tax + ?,
+			status = CASE WHEN ? THEN 'refunded' ELSE status END
+		WHERE id = ?`, refund.Amount, refund.Tax, refund.Full,
+		refund.OrderID); err != nil {
+		return err
+	}
+
+	if err := tx.QueryRow("SELECT created_at FROM refunds WHERE id = ?",
+		refund.ID).Scan(&refund.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// SetRefundPaymentStatus records how a refund's card part went
+func SetRefundPaymentStatus(id int, status string) error {
+	_, err := db.Exec("UPDATE refunds SET payment_status = ? WHERE id = ?",
+		status, id)
+	return err
+}
+
+// RetryRefundPayment marks a refund whose card part failed as pending
+// again, returning the refund. sql.ErrNoRows is returned when the order
+// has no such refund and ErrRefundPaymentStatus when it has not failed.
+func RetryRefundPayment(orderID, refundID int) (*models.Refund, error) {
+	result, err := db.Exec(`UPDATE refunds SET payment_status = ?
+		WHERE id = ? AND order_id = ? AND payment_status = ?`,
+		RefundPaymentPending, refundID, orderID, RefundPaymentFailed)
+	if err != nil {
+		return nil, err
+	}
+	refunds, err := FetchRefundsByOrderID(orderID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range refunds {
+		if refunds[i].ID != refundID {
+			continue
+		}
+		if n, _ := result.RowsAffected(); n == 0 {
+			return nil, ErrRefundPaymentStatus
+		}
+		return &refunds[i], nil
+	}
+	return nil, sql.ErrNoRows
+}
+
+// refundPointsTx takes back points earned on the refunded part of an order
+// and, on a full refund, gives back points redeemed on it. refundable is
+// what the order's food cost after discounts.
+func refundPointsTx(tx *sql.Tx, refund *models.Refund, userID int, refundable float64, expiryDays int) error {
+	var earned, reversed, redeemed, returned int
+	if err := tx.QueryRow(`SELECT
+		COALESCE(SUM(CASE WHEN kind = 'earn' THEN points END), 0),
+		COALESCE(-SUM(CASE WHEN kind = 'reversal' THEN points END), 0),
+		COALESCE(-SUM(CASE WHEN kind = 'redeem' THEN points END), 0),
+		COALESCE(SUM(CASE WHEN kind = 'refund' THEN points END), 0)
+		FROM loyalty_ledger WHERE order_id = ?`, refund.OrderID).Scan(&earned,
+		&reversed, &redeemed, &returned); err != nil {
+		return err
+	}
+
+	reverse := earned - reversed
+	if !refund.Full && refundable > 0 {
+		reverse = min(reverse, int(float64(earned)*refund.Amount/refundable))
+	}
+	if reverse > 0 {
+		if err := expirePointsTx(tx, userID); err != nil {
+			return err
+		}
+		var balance int
+		if err := tx.QueryRow(`SELECT COALESCE(SUM(points), 0) FROM loyalty_ledger
+			WHERE user_id = ?`, userID).Scan(&balance); err != nil {
+			return err
+		}
+		// Points already spent stay spent
+		reverse = min(reverse, balance)
+	}
+	if reverse > 0 {
+		if err := deductPointsTx(tx, userID, &refund.OrderID, "reversal", reverse,
+			fmt.Sprintf("Reversed for refunded order #%d", refund.OrderID),
+			refund.ActorID); err != nil {
+			return err
+		}
+		refund.PointsReversed = reverse
+	}
+
+	if refund.Full && redeemed > returned {
+		if err := addPointsTx(tx, userID, &refund.OrderID, "refund",
+			redeemed-returned, expiryDays,
+			fmt.Sprintf("Refunded from order #%d", refund.OrderID),
+			refund.ActorID); err != nil {
+			return err
+		}
+		refund.PointsReturned = redeemed - returned
+	}
+	return nil
+}
+
+// FetchRefundsByOrderID retrieves an order's refunds with their lines,
+// oldest first
+func FetchRefundsByOrderID(orderID int) ([]models.Refund, error) {
+	rows, err := db.Query(`SELECT id, order_id, amount, tax_amount, reason, note,
+		restocked, full, payment_amount, gift_card_amount, external_amount,
+		payment_status, points_reversed, points_returned, actor_id, created_at
+		FROM refunds WHERE order_id = ? ORDER BY id`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	refunds := []models.Refund{}
+	for rows.Next() {
+		var rf models.Refund
+		var actorID sql.NullInt64
+		if err := rows.Scan(&rf.ID, &rf.OrderID, &rf.Amount, &rf.Tax, &rf.Reason,
+			&rf.Note, &rf.Restocked, &rf.Full, &rf.PaymentAmount,
+			&rf.GiftCardAmount, &rf.ExternalAmount, &rf.PaymentStatus,
+			&rf.PointsReversed,
+			&rf.PointsReturned, &actorID, &rf.CreatedAt); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		rf.ActorID = nullIntPtr(actorID)
+		refunds = append(refunds, rf)
+	}
+	rows.Close()
+
+	for i := range refunds {
+		refunds[i].Lines, err = fetchRefundLines(refunds[i].ID)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return refunds, nil
+}
+
+// FetchRefundableGiftCardPayments returns what each gift card paid for an
+// order less what has been refunded to it, in the order they were used
+func FetchRefundableGiftCardPayments(orderID int) ([]models.OrderTender, error) {
+	rows, err := db.Query(`SELECT t.gift_card_id, g.last4, -SUM(t.amount)
+		FROM gift_card_transactions t
+		JOIN gift_cards g ON g.id = t.gift_card_id
+		WHERE t.order_id = ? AND t.kind IN ('redeem', 'refund')
+		GROUP BY t.gift_card_id, g.last4
+		HAVING -SUM(t.amount) > 0
+		ORDER BY MIN(t.id)`, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tenders []models.OrderTender
+	for rows.Next() {
+		t := models.OrderTender{Type: "gift_card"}
+		if err := rows.Scan(&t.GiftCardID, &t.Last4, &t.Amount); err != nil {
+			return nil, err
+		}
+		t.Amount = roundCents(t.Amount)
+		tenders = append(tenders, t)
+	}
+	return tenders, nil
+}
+
+func fetchRefundLines(refundID int) ([]models.RefundLine, error) {
+	rows, err := db.Query(`SELECT l.order_item_id, COALESCE(oi.product_id, 0),
+		l.quantity, l.amount
+		FROM refund_lines l LEFT JOIN order_items oi ON oi.id = l.order_item_id
+		WHERE l.refund_id = ? ORDER BY l.id`, refundID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	lines := []models.RefundLine{}
+	for rows.Next() {
+		var l models.RefundLine
+		if err := rows.Scan(&l.OrderItemID, &l.ProductID, &l.Quantity,
+			&l.Amount); err != nil {
+			return nil, err
+		}
+		lines = append(lines, l)
+	}
+	return lines, nil
+}
@@ -9,6 +9,7 @@ import (
 
 	"golang.org/x/crypto/bcrypt"
 
+	"restaurant-backend/internal/giftcard"
 	"restaurant-backend/internal/models"
 
 	_ "modernc.org/sqlite"
@@ -19,7 +20,9 @@ var db *sql.DB
 // InitDB initializes the database connection
 func InitDB() {
 	var err error
-	db, err = sql.Open("sqlite", "./restaurant_v4.db")
+	// Requests made at the same time wait for each other's writes instead
+	// of failing with "database is locked"
+	db, err = sql.Open("sqlite", "./restaurant_v4.db?_pragma=busy_timeout(5000)")
 	if err != nil {
 		slog.Error("failed to open database", "error", err)
 		log.Fatal(err)
@@ -34,7 +37,15 @@ func InitDB() {
 	ensureStockColumns()
 	ensureOrderedQuantityColumn()
 	ensureUserColumns()
+	ensureOrderColumns()
+	ensureWasteColumns()
+	ensureRefundColumns()
 	seedDefaultUser()
+	seedPromotions()
+	seedCoupons()
+	migrateSupplyOrders()
+	migrateStockOpeningBalances()
+	migrateStockLots()
 }
 
 func ensureOrderedQuantityColumn() {
@@ -44,12 +55,236 @@ func ensureOrderedQuantityColumn() {
 	}
 }
 
+func ensureWasteColumns() {
+	_, err := db.Exec("ALTER TABLE waste_entries ADD COLUMN lot_id INTEGER")
+	if err != nil {
+		slog.Debug("lot_id column might already exist or error adding it", "details",
+			err)
+	}
+}
+
+// ensureRefundColumns adds the card refund status. Refunds made before it
+// was recorded had their card refunded before they were stored.
+func ensureRefundColumns() {
+	_, err := db.Exec(`ALTER TABLE refunds ADD COLUMN payment_status TEXT
+		NOT NULL DEFAULT 'succeeded'`)
+	if err != nil {
+		slog.Debug("payment_status column might already exist or error adding it",
+			"details", err)
+		return
+	}
+	if _, err := db.Exec(`UPDATE refunds SET payment_status = 'not_required'
+		WHERE payment_amount = 0`); err != nil {
+		slog.Error("failed to set refund payment statuses", "error", err)
+	}
+}
+
+func ensureOrderColumns() {
+	_, err := db.Exec("ALTER TABLE orders ADD COLUMN subtotal REAL")
+	if err != nil {
+		slog.Debug("subtotal column might already exist or error adding it", "details",
+			err)
+	}
+
+	_, err = db.Exec("ALTER TABLE orders ADD COLUMN coupon_code TEXT DEFAULT ''")
+	if err != nil {
+		slog.Debug("coupon_code column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec("ALTER TABLE orders ADD COLUMN amount_due REAL")
+	if err != nil {
+		slog.Debug("amount_due column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec("ALTER TABLE orders ADD COLUMN payment_status TEXT DEFAULT ''")
+	if err != nil {
+		slog.Debug("payment_status column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE order_discounts
+		ADD COLUMN points INTEGER NOT NULL DEFAULT 0`)
+	if err != nil {
+		slog.Debug("points column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE orders
+		ADD COLUMN refunded_amount REAL NOT NULL DEFAULT 0`)
+	if err != nil {
+		slog.Debug("refunded_amount column might already exist or error adding it",
+			"details", err)
+	}
+
+	// Older items have no unit_price; refunds fall back to the catalogue
+	// price for them
+	_, err = db.Exec("ALTER TABLE order_items ADD COLUMN unit_price REAL")
+	if err != nil {
+		slog.Debug("unit_price column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE order_items
+		ADD COLUMN refunded_quantity INTEGER NOT NULL DEFAULT 0`)
+	if err != nil {
+		slog.Debug("refunded_quantity column might already exist or error adding it",
+			"details", err)
+	}
+
+	// Orders placed before tax was calculated have no tax
+	_, err = db.Exec(`ALTER TABLE orders
+		ADD COLUMN order_type TEXT NOT NULL DEFAULT 'takeaway'`)
+	if err != nil {
+		slog.Debug("order_type column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE orders
+		ADD COLUMN tax_total REAL NOT NULL DEFAULT 0`)
+	if err != nil {
+		slog.Debug("tax_total column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE orders
+		ADD COLUMN tax_inclusive INTEGER NOT NULL DEFAULT 0`)
+	if err != nil {
+		slog.Debug("tax_inclusive column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE orders
+		ADD COLUMN refunded_tax REAL NOT NULL DEFAULT 0`)
+	if err != nil {
+		slog.Debug("refunded_tax column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE order_items
+		ADD COLUMN tax_rate REAL NOT NULL DEFAULT 0`)
+	if err != nil {
+		slog.Debug("tax_rate column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE order_items
+		ADD COLUMN taxable_amount REAL`)
+	if err != nil {
+		slog.Debug("taxable_amount column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE order_items
+		ADD COLUMN tax_amount REAL NOT NULL DEFAULT 0`)
+	if err != nil {
+		slog.Debug("tax_amount column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE refunds
+		ADD COLUMN tax_amount REAL NOT NULL DEFAULT 0`)
+	if err != nil {
+		slog.Debug("tax_amount column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE orders
+		ADD COLUMN party_size INTEGER NOT NULL DEFAULT 0`)
+	if err != nil {
+		slog.Debug("party_size column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE orders
+		ADD COLUMN tip_amount REAL NOT NULL DEFAULT 0`)
+	if err != nil {
+		slog.Debug("tip_amount column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE orders
+		ADD COLUMN service_charge REAL NOT NULL DEFAULT 0`)
+	if err != nil {
+		slog.Debug("service_charge column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec(`ALTER TABLE orders
+		ADD COLUMN service_charge_name TEXT NOT NULL DEFAULT ''`)
+	if err != nil {
+		slog.Debug("service_charge_name column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec("ALTER TABLE orders ADD COLUMN note TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		slog.Debug("note column might already exist or error adding it", "details",
+			err)
+	}
+
+	_, err = db.Exec("ALTER TABLE order_items ADD COLUMN note TEXT NOT NULL DEFAULT ''")
+	if err != nil {
+		slog.Debug("note column might already exist or error adding it", "details",
+			err)
+	}
+}
+
 func ensureUserColumns() {
 	_, err := db.Exec("ALTER TABLE users ADD COLUMN phone TEXT DEFAULT ''")
 	if err != nil {
 		slog.Debug("phone column might already exist or error adding it", "details",
 			err)
 	}
+
+	_, err = db.Exec("ALTER TABLE users ADD COLUMN disabled INTEGER DEFAULT 0")
+	if err != nil {
+		slog.Debug("disabled column might already exist or error adding it", "details",
+			err)
+	}
+
+	_, err = db.Exec("ALTER TABLE users ADD COLUMN must_change_password INTEGER DEFAULT 0")
+	if err != nil {
+		slog.Debug("must_change_password column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec("ALTER TABLE users ADD COLUMN totp_secret TEXT DEFAULT ''")
+	if err != nil {
+		slog.Debug("totp_secret column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec("ALTER TABLE users ADD COLUMN totp_enabled INTEGER DEFAULT 0")
+	if err != nil {
+		slog.Debug("totp_enabled column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec("ALTER TABLE users ADD COLUMN totp_last_step INTEGER DEFAULT 0")
+	if err != nil {
+		slog.Debug("totp_last_step column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec("ALTER TABLE users ADD COLUMN password_changed_at INTEGER DEFAULT 0")
+	if err != nil {
+		slog.Debug("password_changed_at column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec("ALTER TABLE users ADD COLUMN totp_failures INTEGER DEFAULT 0")
+	if err != nil {
+		slog.Debug("totp_failures column might already exist or error adding it",
+			"details", err)
+	}
+
+	_, err = db.Exec("ALTER TABLE users ADD COLUMN totp_locked_until TEXT")
+	if err != nil {
+		slog.Debug("totp_locked_until column might already exist or error adding it",
+			"details", err)
+	}
 }
 
 func seedDefaultUser() {
@@ -116,13 +351,6 @@ func ensureStockColumns() {
 	if err != nil {
 		slog.Debug("low_stock_threshold column might already exist or error adding it", "details", err)
 	}
-
-	// For dev/test: Ensure all products have at least 20 stock if they are 0 (or just reset to 20 for now as requested)
-	// The user requested "let all products start from 20".
-	_, err = db.Exec("UPDATE products SET stock_quantity = 20 WHERE stock_quantity = 0")
-	if err != nil {
-		slog.Debug("Error updating stock quantity", "details", err)
-	}
 }
 
 // SeedDB seeds the database with initial data
@@ -265,6 +493,428 @@ func createTables() {
 		FOREIGN KEY(order_id) REFERENCES orders(id),
 		FOREIGN KEY(product_id) REFERENCES products(id)
 	);
+
+	CREATE TABLE IF NOT EXISTS email_verifications (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		new_email TEXT NOT NULL,
+		token_hash TEXT UNIQUE NOT NULL,
+		expires_at TEXT NOT NULL,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS recovery_codes (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		code_hash TEXT NOT NULL,
+		used_at TEXT,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS oidc_login_states (
+		state TEXT PRIMARY KEY,
+		provider TEXT NOT NULL,
+		nonce TEXT NOT NULL,
+		code_verifier TEXT NOT NULL,
+		expires_at TEXT NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS user_identities (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		subject TEXT NOT NULL,
+		email TEXT,
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE(provider, subject),
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS api_keys (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		name TEXT NOT NULL,
+		prefix TEXT UNIQUE NOT NULL,
+		key_hash TEXT NOT NULL,
+		scopes TEXT NOT NULL, -- JSON array of scope strings
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		expires_at TEXT,
+		last_used_at TEXT,
+		revoked_at TEXT,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS promotions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		message TEXT NOT NULL,
+		starts_at TEXT, -- RFC 3339
+		ends_at TEXT,
+		days_of_week TEXT NOT NULL DEFAULT '', -- comma separated, 0 = Sunday
+		priority INTEGER NOT NULL DEFAULT 0,
+		audience TEXT NOT NULL DEFAULT 'all',
+		active INTEGER NOT NULL DEFAULT 1,
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		updated_at TEXT DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS coupons (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		code TEXT UNIQUE NOT NULL,
+		description TEXT NOT NULL DEFAULT '',
+		type TEXT NOT NULL,
+		value REAL NOT NULL DEFAULT 0,
+		free_product_id INTEGER,
+		category TEXT NOT NULL DEFAULT '',
+		product_ids TEXT NOT NULL DEFAULT '', -- comma separated
+		min_spend REAL NOT NULL DEFAULT 0,
+		starts_at TEXT, -- RFC 3339
+		ends_at TEXT,
+		max_uses INTEGER NOT NULL DEFAULT 0,
+		max_uses_per_user INTEGER NOT NULL DEFAULT 0,
+		active INTEGER NOT NULL DEFAULT 1,
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS coupon_redemptions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		coupon_id INTEGER NOT NULL,
+		user_id INTEGER,
+		order_id INTEGER NOT NULL,
+		amount REAL NOT NULL,
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(coupon_id) REFERENCES coupons(id),
+		FOREIGN KEY(order_id) REFERENCES orders(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS order_discounts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		coupon_id INTEGER,
+		code TEXT NOT NULL DEFAULT '',
+		description TEXT NOT NULL,
+		amount REAL NOT NULL,
+		points INTEGER NOT NULL DEFAULT 0,
+		FOREIGN KEY(order_id) REFERENCES orders(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS loyalty_ledger (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		user_id INTEGER NOT NULL,
+		order_id INTEGER,
+		kind TEXT NOT NULL, -- earn, redeem, refund, adjust, expire
+		points INTEGER NOT NULL,
+		remaining INTEGER NOT NULL DEFAULT 0, -- unused points of a lot
+		expires_at TEXT,
+		description TEXT NOT NULL DEFAULT '',
+		actor_id INTEGER,
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(user_id) REFERENCES users(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS gift_cards (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		code_hash TEXT NOT NULL UNIQUE,
+		last4 TEXT NOT NULL,
+		initial_value REAL NOT NULL,
+		recipient_email TEXT NOT NULL DEFAULT '',
+		message TEXT NOT NULL DEFAULT '',
+		purchaser_id INTEGER,
+		order_id INTEGER, -- order that bought the card
+		status TEXT NOT NULL DEFAULT 'active', -- active, void
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS gift_card_transactions (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		gift_card_id INTEGER NOT NULL,
+		kind TEXT NOT NULL, -- issue, redeem, refund, void
+		amount REAL NOT NULL,
+		order_id INTEGER,
+		actor_id INTEGER,
+		note TEXT NOT NULL DEFAULT '',
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(gift_card_id) REFERENCES gift_cards(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS payment_intents (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		provider TEXT NOT NULL,
+		provider_ref TEXT NOT NULL DEFAULT '',
+		amount REAL NOT NULL,
+		currency TEXT NOT NULL,
+		status TEXT NOT NULL,
+		captured_amount REAL NOT NULL DEFAULT 0,
+		refunded_amount REAL NOT NULL DEFAULT 0,
+		failure_code TEXT NOT NULL DEFAULT '',
+		failure_message TEXT NOT NULL DEFAULT '',
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		updated_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(order_id) REFERENCES orders(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_payment_intents_ref
+		ON payment_intents(provider, provider_ref);
+
+	CREATE TABLE IF NOT EXISTS payment_attempts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		intent_id INTEGER NOT NULL,
+		action TEXT NOT NULL, -- authorize, capture, void, refund, webhook
+		amount REAL NOT NULL DEFAULT 0,
+		succeeded INTEGER NOT NULL,
+		provider_ref TEXT NOT NULL DEFAULT '',
+		detail TEXT NOT NULL DEFAULT '',
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(intent_id) REFERENCES payment_intents(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS refunds (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL,
+		amount REAL NOT NULL,
+		tax_amount REAL NOT NULL DEFAULT 0,
+		reason TEXT NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		restocked INTEGER NOT NULL DEFAULT 0,
+		full INTEGER NOT NULL DEFAULT 0,
+		payment_amount REAL NOT NULL DEFAULT 0,
+		gift_card_amount REAL NOT NULL DEFAULT 0,
+		external_amount REAL NOT NULL DEFAULT 0,
+		payment_status TEXT NOT NULL DEFAULT 'not_required',
+		points_reversed INTEGER NOT NULL DEFAULT 0,
+		points_returned INTEGER NOT NULL DEFAULT 0,
+		actor_id INTEGER,
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(order_id) REFERENCES orders(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS refund_lines (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		refund_id INTEGER NOT NULL,
+		order_item_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL,
+		amount REAL NOT NULL,
+		FOREIGN KEY(refund_id) REFERENCES refunds(id),
+		FOREIGN KEY(order_item_id) REFERENCES order_items(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS tax_rates (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		category TEXT UNIQUE NOT NULL, -- '' is the default rate
+		name TEXT NOT NULL DEFAULT '',
+		dine_in_rate REAL NOT NULL DEFAULT 0,
+		takeaway_rate REAL NOT NULL DEFAULT 0
+	);
+
+	CREATE TABLE IF NOT EXISTS service_charge_rules (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL,
+		order_type TEXT NOT NULL DEFAULT '', -- '' is any order type
+		min_party_size INTEGER NOT NULL DEFAULT 0,
+		min_subtotal REAL NOT NULL DEFAULT 0,
+		rate REAL NOT NULL
+	);
+
+	CREATE TABLE IF NOT EXISTS suppliers (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		contact_name TEXT NOT NULL DEFAULT '',
+		email TEXT NOT NULL DEFAULT '',
+		phone TEXT NOT NULL DEFAULT '',
+		lead_time_days INTEGER NOT NULL DEFAULT 0,
+		notes TEXT NOT NULL DEFAULT '',
+		active INTEGER NOT NULL DEFAULT 1,
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS purchase_orders (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		supplier_id INTEGER,
+		status TEXT NOT NULL DEFAULT 'draft',
+		expected_date TEXT NOT NULL DEFAULT '',
+		notes TEXT NOT NULL DEFAULT '',
+		created_by INTEGER,
+		ordered_at TEXT,
+		received_at TEXT,
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(supplier_id) REFERENCES suppliers(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS purchase_order_lines (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		purchase_order_id INTEGER NOT NULL,
+		product_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL,
+		received_quantity INTEGER NOT NULL DEFAULT 0,
+		unit_cost REAL NOT NULL DEFAULT 0,
+		FOREIGN KEY(purchase_order_id) REFERENCES purchase_orders(id),
+		FOREIGN KEY(product_id) REFERENCES products(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS purchase_order_receipts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		purchase_order_id INTEGER NOT NULL,
+		line_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL,
+		received_by INTEGER,
+		received_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(purchase_order_id) REFERENCES purchase_orders(id),
+		FOREIGN KEY(line_id) REFERENCES purchase_order_lines(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS stock_movements (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL, -- negative when stock goes out
+		balance INTEGER NOT NULL, -- stock after the movement
+		reason TEXT NOT NULL, -- sale, receipt, adjustment, waste, return
+		reference_type TEXT NOT NULL DEFAULT '', -- order, refund, purchase_order, waste, stock_count
+		reference_id INTEGER,
+		note TEXT NOT NULL DEFAULT '',
+		actor_id INTEGER,
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(product_id) REFERENCES products(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_stock_movements_product
+		ON stock_movements(product_id, id);
+
+	CREATE TABLE IF NOT EXISTS stock_lots (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_id INTEGER NOT NULL,
+		received_quantity INTEGER NOT NULL,
+		quantity INTEGER NOT NULL, -- left in stock
+		unit_cost REAL NOT NULL DEFAULT 0,
+		expires_at TEXT, -- YYYY-MM-DD, the last day it can be used
+		purchase_order_id INTEGER,
+		received_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(product_id) REFERENCES products(id),
+		FOREIGN KEY(purchase_order_id) REFERENCES purchase_orders(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_stock_lots_product
+		ON stock_lots(product_id, quantity);
+
+	-- Which lots each stock movement took from or added to
+	CREATE TABLE IF NOT EXISTS stock_lot_movements (
+		movement_id INTEGER NOT NULL,
+		lot_id INTEGER NOT NULL,
+		quantity INTEGER NOT NULL, -- negative when taken from the lot
+		PRIMARY KEY(movement_id, lot_id),
+		FOREIGN KEY(movement_id) REFERENCES stock_movements(id),
+		FOREIGN KEY(lot_id) REFERENCES stock_lots(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_stock_lot_movements_lot
+		ON stock_lot_movements(lot_id);
+
+	CREATE TABLE IF NOT EXISTS ingredients (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		name TEXT NOT NULL UNIQUE,
+		unit TEXT NOT NULL, -- g, kg, ml, l or each
+		stock_quantity REAL NOT NULL DEFAULT 0,
+		low_stock_threshold REAL NOT NULL DEFAULT 0,
+		unit_cost REAL NOT NULL DEFAULT 0,
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS recipe_lines (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_id INTEGER NOT NULL,
+		portion_size TEXT NOT NULL DEFAULT '', -- '' for every portion
+		ingredient_id INTEGER NOT NULL,
+		quantity REAL NOT NULL, -- in the ingredient's unit
+		UNIQUE(product_id, portion_size, ingredient_id),
+		FOREIGN KEY(product_id) REFERENCES products(id),
+		FOREIGN KEY(ingredient_id) REFERENCES ingredients(id)
+	);
+
+	CREATE TABLE IF NOT EXISTS ingredient_movements (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		ingredient_id INTEGER NOT NULL,
+		quantity REAL NOT NULL, -- negative when stock goes out
+		balance REAL NOT NULL, -- stock after the movement
+		reason TEXT NOT NULL, -- sale, receipt, adjustment, waste, return
+		reference_type TEXT NOT NULL DEFAULT '', -- order, waste
+		reference_id INTEGER,
+		note TEXT NOT NULL DEFAULT '',
+		actor_id INTEGER,
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(ingredient_id) REFERENCES ingredients(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_ingredient_movements_ingredient
+		ON ingredient_movements(ingredient_id, id);
+
+	CREATE TABLE IF NOT EXISTS waste_entries (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		product_id INTEGER, -- either a product or an ingredient
+		ingredient_id INTEGER,
+		lot_id INTEGER, -- the product's lot, when known
+		portion_size TEXT NOT NULL DEFAULT '',
+		quantity REAL NOT NULL, -- in the ingredient's unit for ingredients
+		reason TEXT NOT NULL,
+		note TEXT NOT NULL DEFAULT '',
+		unit_cost REAL NOT NULL DEFAULT 0,
+		cost REAL NOT NULL DEFAULT 0,
+		staff_id INTEGER, -- who wasted it
+		recorded_by INTEGER,
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP,
+		FOREIGN KEY(product_id) REFERENCES products(id),
+		FOREIGN KEY(ingredient_id) REFERENCES ingredients(id),
+		FOREIGN KEY(staff_id) REFERENCES users(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_waste_entries_created
+		ON waste_entries(created_at);
+
+	CREATE TABLE IF NOT EXISTS stock_counts (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		status TEXT NOT NULL DEFAULT 'open', -- open, posted or cancelled
+		note TEXT NOT NULL DEFAULT '',
+		reason TEXT NOT NULL DEFAULT '', -- given when posted
+		created_by INTEGER,
+		closed_by INTEGER,
+		closed_at TEXT,
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS stock_count_lines (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		stock_count_id INTEGER NOT NULL,
+		product_id INTEGER NOT NULL,
+		counted_quantity INTEGER, -- NULL until counted
+		expected_quantity INTEGER, -- the stock when the line was counted
+		UNIQUE(stock_count_id, product_id),
+		FOREIGN KEY(stock_count_id) REFERENCES stock_counts(id),
+		FOREIGN KEY(product_id) REFERENCES products(id)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_stock_count_lines_product
+		ON stock_count_lines(product_id);
+
+	CREATE TABLE IF NOT EXISTS kitchen_tickets (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		order_id INTEGER NOT NULL REFERENCES orders(id),
+		station TEXT NOT NULL,
+		data BLOB NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		last_error TEXT NOT NULL DEFAULT '',
+		next_attempt_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+		printed_at DATETIME,
+		created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS audit_log (
+		id INTEGER PRIMARY KEY AUTOINCREMENT,
+		actor_id INTEGER NOT NULL,
+		actor_email TEXT NOT NULL,
+		action TEXT NOT NULL,
+		target_user_id INTEGER,
+		details TEXT,
+		created_at TEXT DEFAULT CURRENT_TIMESTAMP
+	);
 	`
 	_, err := db.Exec(query)
 	if err != nil {
@@ -301,6 +951,9 @@ func FetchProducts() ([]models.Product, error) {
 		p.Reviews, _ = fetchReviews(p.ID)
 		products = append(products, p)
 	}
+	if err := fillAvailability(products); err != nil {
+		return nil, err
+	}
 	return products, nil
 }
 
@@ -319,7 +972,11 @@ func FetchProductByID(id int) (*models.Product, error) {
 	json.Unmarshal([]byte(iaJSON), &p.ImageAttribution)
 
 	p.Reviews, _ = fetchReviews(p.ID)
-	return &p, nil
+	products := []models.Product{p}
+	if err := fillAvailability(products); err != nil {
+		return nil, err
+	}
+	return &products[0], nil
 }
 
 // FetchProductsByCategory retrieves products by category
@@ -348,6 +1005,9 @@ func FetchProductsByCategory(category string) ([]models.Product, error) {
 		p.Reviews, _ = fetchReviews(p.ID)
 		products = append(products, p)
 	}
+	if err := fillAvailability(products); err != nil {
+		return nil, err
+	}
 	return products, nil
 }
 
@@ -391,15 +1051,23 @@ func SaveFeedback(feedback *models.Feedback) error {
 	return nil
 }
 
-// InsertProduct adds a new product to the database
-func InsertProduct(p *models.Product) error {
+// InsertProduct adds a new product to the database. Its starting stock is
+// recorded as an adjustment by actorID. Nothing is on order for it yet.
+func InsertProduct(p *models.Product, actorID *int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	p.OrderedQuantity = 0
 	ia, _ := json.Marshal(p.ImageAttribution)
-	result, err := db.Exec(`
+	result, err := tx.Exec(`
 		INSERT INTO products (name, price, description, category, image, 
-			image_attribution, detailed_description, stock_quantity, low_stock_threshold, ordered_quantity)
-		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+			image_attribution, detailed_description, stock_quantity, low_stock_threshold)
+		VALUES (?, ?, ?, ?, ?, ?, ?, 0, ?)`,
 		p.Name, p.Price, p.Description, p.Category, p.Image, string(ia),
-		p.DetailedDescription, p.StockQuantity, p.LowStockThreshold, p.OrderedQuantity)
+		p.DetailedDescription, p.LowStockThreshold)
 	if err != nil {
 		return err
 	}
@@ -408,19 +1076,35 @@ func InsertProduct(p *models.Product) error {
 		return err
 	}
 	p.ID = int(id)
-	return nil
+
+	if err := moveStockTx(tx, &models.StockMovement{
+		ProductID: p.ID,
+		Quantity:  p.StockQuantity,
+		Reason:    "adjustment",
+		Note:      "Opening stock",
+		ActorID:   actorID,
+	}); err != nil {
+		return err
+	}
+	return tx.Commit()
 }
 
-// UpdateProduct updates an existing product in the database
+// UpdateProduct updates an existing product in the database. Its stock and
+// the quantity on order, which only purchase orders change, are left alone
+// and read back into p.
 func UpdateProduct(p *models.Product) error {
 	ia, _ := json.Marshal(p.ImageAttribution)
 	_, err := db.Exec(`
 		UPDATE products SET name=?, price=?, description=?, category=?, 
-		image=?, image_attribution=?, detailed_description=?, stock_quantity=?, low_stock_threshold=?, ordered_quantity=?
+		image=?, image_attribution=?, detailed_description=?, low_stock_threshold=?
 		WHERE id=?`,
 		p.Name, p.Price, p.Description, p.Category, p.Image, string(ia),
-		p.DetailedDescription, p.StockQuantity, p.LowStockThreshold, p.OrderedQuantity, p.ID)
-	return err
+		p.DetailedDescription, p.LowStockThreshold, p.ID)
+	if err != nil {
+		return err
+	}
+	return db.QueryRow(`SELECT stock_quantity, ordered_quantity FROM products
+		WHERE id = ?`, p.ID).Scan(&p.StockQuantity, &p.OrderedQuantity)
 }
 
 // DeleteProduct removes a product and its reviews from the database
@@ -486,9 +1170,13 @@ func CreateUser(user *models.User) error {
 // GetUserByEmail retrieves a user by email
 func GetUserByEmail(email string) (*models.User, error) {
 	var user models.User
-	err := db.QueryRow(`SELECT id, email, password, name, role, phone 
+	err := db.QueryRow(`SELECT id, email, password, name, role, phone,
+		disabled, must_change_password, totp_enabled, totp_secret, totp_last_step,
+		password_changed_at
 		FROM users WHERE email = ?`, email).
-		Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.Role, &user.Phone)
+		Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.Role, &user.Phone,
+			&user.Disabled, &user.MustChangePassword, &user.TwoFactorEnabled,
+			&user.TOTPSecret, &user.TOTPLastStep, &user.PasswordChangedAt)
 	if err != nil {
 		return nil, err
 	}
@@ -503,10 +1191,45 @@ func CreateOrder(order *models.Order) error {
 	}
 	defer tx.Rollback()
 
-	// Check stock availability and decrement stock
+	result, err := tx.Exec(`
+		INSERT INTO orders (user_id, subtotal, total_price, amount_due, status,
+			payment_status, coupon_code, order_type, tax_total, tax_inclusive,
+			party_size, tip_amount, service_charge, service_charge_name, note)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		order.UserID, order.Subtotal, order.TotalPrice, order.AmountDue,
+		order.Status, order.PaymentStatus, order.CouponCode, order.OrderType,
+		order.Tax, order.TaxInclusive, order.PartySize, order.TipAmount,
+		order.ServiceCharge, order.ServiceChargeName, order.Note)
+	if err != nil {
+		return err
+	}
+
+	orderID, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	order.ID = int(orderID)
+
+	// Check stock availability and decrement stock. Products made from a
+	// recipe use up their ingredients instead.
 	for _, item := range order.Items {
+		lines, err := recipeTx(tx, item.ProductID, item.PortionSize)
+		if err != nil {
+			return err
+		}
+		if len(lines) > 0 {
+			if err := useIngredientsTx(tx, lines, item, order); err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Expired stock is written off first and cannot be sold
+		if err := expireProductLotsTx(tx, item.ProductID); err != nil {
+			return err
+		}
 		var currentStock int
-		err := tx.QueryRow("SELECT stock_quantity FROM products WHERE id = ?", item.ProductID).Scan(&currentStock)
+		err = tx.QueryRow("SELECT stock_quantity FROM products WHERE id = ?", item.ProductID).Scan(&currentStock)
 		if err != nil {
 			return err // Product not found or other error
 		}
@@ -515,59 +1238,99 @@ func CreateOrder(order *models.Order) error {
 			return fmt.Errorf("insufficient stock for product ID %d", item.ProductID)
 		}
 
-		_, err = tx.Exec("UPDATE products SET stock_quantity = stock_quantity - ? WHERE id = ?", item.Quantity, item.ProductID)
-		if err != nil {
+		if err := moveStockTx(tx, &models.StockMovement{
+			ProductID:     item.ProductID,
+			Quantity:      -item.Quantity,
+			Reason:        "sale",
+			ReferenceType: "order",
+			ReferenceID:   &order.ID,
+			ActorID:       &order.UserID,
+		}); err != nil {
 			return err
 		}
 	}
 
-	result, err := tx.Exec(`
-		INSERT INTO orders (user_id, total_price, status)
-		VALUES (?, ?, ?)`,
-		order.UserID, order.TotalPrice, order.Status)
-	if err != nil {
-		return err
+	for _, d := range order.Discounts {
+		if d.Points > 0 {
+			if err := deductPointsTx(tx, order.UserID, &order.ID, "redeem",
+				d.Points, fmt.Sprintf("Redeemed on order #%d", order.ID),
+				nil); err != nil {
+				return err
+			}
+		}
+		if d.CouponID != nil {
+			if err := redeemCoupon(tx, *d.CouponID, order.UserID, order.ID,
+				d.Amount); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`
+			INSERT INTO order_discounts (order_id, coupon_id, code,
+				description, amount, points)
+			VALUES (?, ?, ?, ?, ?, ?)`,
+			order.ID, d.CouponID, d.Code, d.Description, d.Amount,
+			d.Points); err != nil {
+			return err
+		}
 	}
 
-	orderID, err := result.LastInsertId()
-	if err != nil {
-		return err
+	for _, t := range order.Tenders {
+		if err := redeemGiftCardTx(tx, t.GiftCardID, order.ID,
+			t.Amount); err != nil {
+			return err
+		}
 	}
-	order.ID = int(orderID)
 
-	for _, item := range order.Items {
+	for i := range order.GiftCardPurchases {
+		p := &order.GiftCardPurchases[i]
+		card := &models.GiftCard{
+			Last4:          p.Last4,
+			InitialValue:   p.Amount,
+			RecipientEmail: p.RecipientEmail,
+			Message:        p.Message,
+			PurchaserID:    &order.UserID,
+			OrderID:        &order.ID,
+		}
+		if err := issueGiftCardTx(tx, card, giftcard.Hash(p.Code),
+			nil); err != nil {
+			return err
+		}
+		p.GiftCardID = card.ID
+	}
+
+	for i := range order.Items {
+		item := &order.Items[i]
 		custJSON, _ := json.Marshal(item.Customizations)
-		_, err := tx.Exec(`
+		result, err := tx.Exec(`
 			INSERT INTO order_items (order_id, product_id, quantity, 
-				portion_size, customizations)
-			VALUES (?, ?, ?, ?, ?)`,
+				portion_size, customizations, note, unit_price, tax_rate,
+				taxable_amount, tax_amount)
+			VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
 			order.ID, item.ProductID, item.Quantity, item.PortionSize,
-			string(custJSON))
+			string(custJSON), item.Note, item.UnitPrice, item.TaxRate,
+			item.Taxable, item.TaxAmount)
+		if err != nil {
+			return err
+		}
+		itemID, err := result.LastInsertId()
 		if err != nil {
 			return err
 		}
+		item.ID = int(itemID)
 	}
 
 	return tx.Commit()
 }
 
-// OrderSupplies updates stock and ordered quantities based on whether supplies are being ordered or received
-// Should stay visible for 2 days for tracking
-func OrderSupplies(productID int, quantity int, received bool) error {
-	if received {
-		// Receiving supplies: increase stock, decrease ordered
-		// Ensure we don't decrease ordered below 0 (optional safety check, but good practice)
-		_, err := db.Exec(`UPDATE products 
-			SET stock_quantity = stock_quantity + ?, 
-			    ordered_quantity = MAX(0, ordered_quantity - ?) 
-			WHERE id = ?`, quantity, quantity, productID)
-		return err
-	} else {
-		// Ordering supplies: increase ordered
-		_, err := db.Exec("UPDATE products SET ordered_quantity = ordered_quantity + ? WHERE id = ?", quantity, productID)
-		return err
-	}
-}
+// orderTip is the tip staff keep from an order; a full refund gives it back
+const orderTip = `CASE WHEN status = 'refunded' THEN 0 ELSE tip_amount END`
+
+// orderRevenue is what an order earned: its total net of refunds, without
+// tips, which belong to staff, and without gift cards it sold, which are
+// owed to the card holder until the order that redeems them
+const orderRevenue = `total_price - refunded_amount - ` + orderTip + ` -
+	(SELECT COALESCE(SUM(g.initial_value), 0) FROM gift_cards g
+		WHERE g.order_id = orders.id)`
 
 // GetDashboardStats retrieves aggregated data for the dashboard
 func GetDashboardStats() (*models.DashboardStats, error) {
@@ -581,7 +1344,9 @@ func GetDashboardStats() (*models.DashboardStats, error) {
 
 	// Total Revenue
 	var totalRevenue sql.NullFloat64
-	err = db.QueryRow("SELECT SUM(total_price) FROM orders WHERE status != 'cancelled'").Scan(&totalRevenue)
+	err = db.QueryRow(`SELECT SUM(` + orderRevenue + `)
+		FROM orders
+		WHERE status != 'cancelled'`).Scan(&totalRevenue)
 	if err != nil {
 		return nil, err
 	}
@@ -589,10 +1354,11 @@ func GetDashboardStats() (*models.DashboardStats, error) {
 		stats.TotalRevenue = totalRevenue.Float64
 	}
 
-	// Low Stock Items
+	// Low Stock Items, leaving out products made from ingredients
 	rows, err := db.Query(`SELECT id, name, price, description, category, 
 		image, image_attribution, detailed_description, stock_quantity, low_stock_threshold, ordered_quantity 
-		FROM products WHERE stock_quantity <= low_stock_threshold`)
+		FROM products WHERE stock_quantity <= low_stock_threshold
+			AND id NOT IN (SELECT product_id FROM recipe_lines)`)
 	if err != nil {
 		return nil, err
 	}
@@ -609,6 +1375,9 @@ func GetDashboardStats() (*models.DashboardStats, error) {
 		json.Unmarshal([]byte(iaJSON), &p.ImageAttribution)
 		stats.LowStockItems = append(stats.LowStockItems, p)
 	}
+	if err := fillAvailability(stats.LowStockItems); err != nil {
+		return nil, err
+	}
 
 	// Full Inventory
 	rows, err = db.Query(`SELECT id, name, price, description, category, 
@@ -630,12 +1399,31 @@ func GetDashboardStats() (*models.DashboardStats, error) {
 		json.Unmarshal([]byte(iaJSON), &p.ImageAttribution)
 		stats.Inventory = append(stats.Inventory, p)
 	}
+	if err := fillAvailability(stats.Inventory); err != nil {
+		return nil, err
+	}
+
+	// Gift cards sold are owed to their holders until redeemed
+	if err := db.QueryRow(`SELECT COALESCE(SUM(amount), 0)
+		FROM gift_card_transactions`).Scan(&stats.GiftCardLiability); err != nil {
+		return nil, err
+	}
+	stats.GiftCardLiability = roundCents(stats.GiftCardLiability)
+
+	stats.LowStockIngredients, err = FetchLowStockIngredients()
+	if err != nil {
+		return nil, err
+	}
 
 	// Daily Stats (Last 7 days)
 	rows, err = db.Query(`
-		SELECT date(created_at) as day, COUNT(*) as count, SUM(total_price) as revenue
+		SELECT date(created_at) as day, COUNT(*) as count,
+			SUM(` + orderRevenue + `) as revenue,
+			SUM(tax_total - refunded_tax) as tax,
+			SUM(` + orderTip + `) as tips
 		FROM orders
-		WHERE status != 'cancelled' AND created_at >= date('now', '-7 days')
+		WHERE status != 'cancelled'
+			AND created_at >= date('now', '-7 days')
 		GROUP BY date(created_at)
 		ORDER BY date(created_at) ASC
 	`)
@@ -646,7 +1434,8 @@ func GetDashboardStats() (*models.DashboardStats, error) {
 
 	for rows.Next() {
 		var ds models.DailyStat
-		err := rows.Scan(&ds.Date, &ds.TotalOrders, &ds.TotalRevenue)
+		err := rows.Scan(&ds.Date, &ds.TotalOrders, &ds.TotalRevenue, &ds.TotalTax,
+			&ds.TotalTips)
 		if err != nil {
 			return nil, err
 		}
@@ -663,9 +1452,13 @@ func GetSalesReport() (*models.SalesReport, error) {
 
 	// Daily Sales (Last 30 days)
 	rows, err := db.Query(`
-		SELECT date(created_at) as day, COUNT(*) as count, SUM(total_price) as revenue
+		SELECT date(created_at) as day, COUNT(*) as count,
+			SUM(` + orderRevenue + `) as revenue,
+			SUM(tax_total - refunded_tax) as tax,
+			SUM(` + orderTip + `) as tips
 		FROM orders
-		WHERE status != 'cancelled' AND created_at >= date('now', '-30 days')
+		WHERE status != 'cancelled'
+			AND created_at >= date('now', '-30 days')
 		GROUP BY date(created_at)
 		ORDER BY date(created_at) ASC
 	`)
@@ -676,7 +1469,8 @@ func GetSalesReport() (*models.SalesReport, error) {
 
 	for rows.Next() {
 		var ds models.DailyStat
-		err := rows.Scan(&ds.Date, &ds.TotalOrders, &ds.TotalRevenue)
+		err := rows.Scan(&ds.Date, &ds.TotalOrders, &ds.TotalRevenue, &ds.TotalTax,
+			&ds.TotalTips)
 		if err != nil {
 			return nil, err
 		}
@@ -685,9 +1479,13 @@ func GetSalesReport() (*models.SalesReport, error) {
 
 	// Monthly Sales (Last 12 months)
 	rows, err = db.Query(`
-		SELECT strftime('%Y-%m', created_at) as month, COUNT(*) as count, SUM(total_price) as revenue
+		SELECT strftime('%Y-%m', created_at) as month, COUNT(*) as count,
+			SUM(` + orderRevenue + `) as revenue,
+			SUM(tax_total - refunded_tax) as tax,
+			SUM(` + orderTip + `) as tips
 		FROM orders
-		WHERE status != 'cancelled' AND created_at >= date('now', '-12 months')
+		WHERE status != 'cancelled'
+			AND created_at >= date('now', '-12 months')
 		GROUP BY strftime('%Y-%m', created_at)
 		ORDER BY strftime('%Y-%m', created_at) ASC
 	`)
@@ -698,7 +1496,8 @@ func GetSalesReport() (*models.SalesReport, error) {
 
 	for rows.Next() {
 		var ms models.MonthlyStat
-		err := rows.Scan(&ms.Month, &ms.TotalOrders, &ms.TotalRevenue)
+		err := rows.Scan(&ms.Month, &ms.TotalOrders, &ms.TotalRevenue, &ms.TotalTax,
+			&ms.TotalTips)
 		if err != nil {
 			return nil, err
 		}
@@ -707,12 +1506,16 @@ func GetSalesReport() (*models.SalesReport, error) {
 
 	// Top Selling Items (Top 20)
 	rows, err = db.Query(`
-		SELECT p.id, p.name, p.category, SUM(oi.quantity) as qty, SUM(oi.quantity * p.price) as rev 
+		SELECT p.id, p.name, p.category,
+			SUM(oi.quantity - oi.refunded_quantity) as qty,
+			SUM((oi.quantity - oi.refunded_quantity) *
+				COALESCE(oi.unit_price, p.price)) as rev
 		FROM order_items oi 
 		JOIN orders o ON oi.order_id = o.id 
 		JOIN products p ON oi.product_id = p.id 
-		WHERE o.status != 'cancelled' 
+		WHERE o.status != 'cancelled'
 		GROUP BY p.id, p.name, p.category 
+		HAVING qty > 0
 		ORDER BY qty DESC 
 		LIMIT 20
 	`)
@@ -730,36 +1533,127 @@ func GetSalesReport() (*models.SalesReport, error) {
 		report.TopItems = append(report.TopItems, ti)
 	}
 
+	// Tax by month, order type and rate (Last 12 months), leaving out
+	// refunded quantities
+	rows, err = db.Query(`
+		SELECT strftime('%Y-%m', o.created_at) as month, o.order_type,
+			oi.tax_rate,
+			ROUND(SUM(COALESCE(oi.taxable_amount, 0) *
+				(oi.quantity - oi.refunded_quantity) / oi.quantity), 2),
+			ROUND(SUM(oi.tax_amount *
+				(oi.quantity - oi.refunded_quantity) / oi.quantity), 2)
+		FROM order_items oi
+		JOIN orders o ON oi.order_id = o.id
+		WHERE o.status != 'cancelled'
+			AND o.created_at >= date('now', '-12 months')
+		GROUP BY month, o.order_type, oi.tax_rate
+		ORDER BY month ASC, o.order_type, oi.tax_rate
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tt models.TaxTotal
+		err := rows.Scan(&tt.Month, &tt.OrderType, &tt.Rate, &tt.Taxable, &tt.Tax)
+		if err != nil {
+			return nil, err
+		}
+		report.TaxTotals = append(report.TaxTotals, tt)
+	}
+
 	return report, nil
 }
 
+const orderColumns = `id, user_id, COALESCE(subtotal, total_price),
+	total_price, COALESCE(amount_due, total_price), status,
+	COALESCE(payment_status, ''), COALESCE(coupon_code, ''), order_type,
+	tax_total, tax_inclusive, party_size, tip_amount, service_charge,
+	service_charge_name, note, refunded_amount, refunded_tax, created_at`
+
 // FetchOrdersByUserID retrieves all orders for a specific user
 func FetchOrdersByUserID(userID int) ([]models.Order, error) {
-	rows, err := db.Query(`SELECT id, user_id, total_price, status, created_at 
+	rows, err := db.Query(`SELECT `+orderColumns+`
 		FROM orders WHERE user_id = ? ORDER BY created_at DESC`, userID)
 	if err != nil {
 		return nil, err
 	}
-	defer rows.Close()
-
 	var orders []models.Order
 	for rows.Next() {
-		var o models.Order
-		if err := rows.Scan(&o.ID, &o.UserID, &o.TotalPrice, &o.Status,
-			&o.CreatedAt); err != nil {
+		o, err := scanOrder(rows)
+		if err != nil {
+			rows.Close()
 			return nil, err
 		}
+		orders = append(orders, *o)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
 
-		// Fetch items for each order
-		o.Items, _ = fetchOrderItems(o.ID)
-		orders = append(orders, o)
+	// Fetch items, discounts and gift cards for each order
+	for i := range orders {
+		if err := fetchOrderDetails(&orders[i]); err != nil {
+			return nil, err
+		}
 	}
 	return orders, nil
 }
 
+// GetOrderByID retrieves a single order with its items, discounts and
+// gift cards
+func GetOrderByID(id int) (*models.Order, error) {
+	o, err := scanOrder(db.QueryRow(`SELECT `+orderColumns+`
+		FROM orders WHERE id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+	if err := fetchOrderDetails(o); err != nil {
+		return nil, err
+	}
+	return o, nil
+}
+
+func scanOrder(row rowScanner) (*models.Order, error) {
+	var o models.Order
+	var userID sql.NullInt64
+	if err := row.Scan(&o.ID, &userID, &o.Subtotal, &o.TotalPrice,
+		&o.AmountDue, &o.Status, &o.PaymentStatus, &o.CouponCode,
+		&o.OrderType, &o.Tax, &o.TaxInclusive, &o.PartySize, &o.TipAmount,
+		&o.ServiceCharge, &o.ServiceChargeName, &o.Note, &o.RefundedAmount,
+		&o.RefundedTax, &o.CreatedAt); err != nil {
+		return nil, err
+	}
+	o.UserID = int(userID.Int64)
+	return &o, nil
+}
+
+// fetchOrderDetails fills in an order's items, discounts, gift card
+// payments and gift cards bought
+func fetchOrderDetails(o *models.Order) error {
+	var err error
+	if o.Items, err = fetchOrderItems(o.ID); err != nil {
+		return err
+	}
+	if o.Discounts, err = fetchOrderDiscounts(o.ID); err != nil {
+		return err
+	}
+	if o.Tenders, err = fetchOrderTenders(o.ID); err != nil {
+		return err
+	}
+	o.GiftCardPurchases, err = fetchOrderGiftCardPurchases(o.ID)
+	return err
+}
+
 func fetchOrderItems(orderID int) ([]models.OrderItem, error) {
-	rows, err := db.Query(`SELECT product_id, quantity, portion_size, 
-		customizations FROM order_items WHERE order_id = ?`, orderID)
+	rows, err := db.Query(`SELECT oi.id, oi.product_id, COALESCE(p.name, ''),
+		COALESCE(p.category, ''), oi.quantity, oi.portion_size, oi.customizations,
+		oi.note, COALESCE(oi.unit_price, p.price, 0), oi.refunded_quantity,
+		oi.tax_rate, COALESCE(oi.taxable_amount, 0), oi.tax_amount
+		FROM order_items oi LEFT JOIN products p ON p.id = oi.product_id
+		WHERE oi.order_id = ? ORDER BY oi.id`, orderID)
 	if err != nil {
 		return nil, err
 	}
@@ -769,8 +1663,10 @@ func fetchOrderItems(orderID int) ([]models.OrderItem, error) {
 	for rows.Next() {
 		var item models.OrderItem
 		var custJSON string
-		if err := rows.Scan(&item.ProductID, &item.Quantity, &item.PortionSize,
-			&custJSON); err != nil {
+		if err := rows.Scan(&item.ID, &item.ProductID, &item.ProductName,
+			&item.Category, &item.Quantity, &item.PortionSize, &custJSON,
+			&item.Note, &item.UnitPrice, &item.RefundedQuantity, &item.TaxRate,
+			&item.Taxable, &item.TaxAmount); err != nil {
 			return nil, err
 		}
 		json.Unmarshal([]byte(custJSON), &item.Customizations)
@@ -789,9 +1685,13 @@ func GetUserCount() (int, error) {
 // GetUserByID retrieves a user by ID
 func GetUserByID(id int) (*models.User, error) {
 	var user models.User
-	err := db.QueryRow(`SELECT id, email, password, name, role, phone 
+	err := db.QueryRow(`SELECT id, email, password, name, role, phone,
+		disabled, must_change_password, totp_enabled, totp_secret, totp_last_step,
+		password_changed_at
 		FROM users WHERE id = ?`, id).
-		Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.Role, &user.Phone)
+		Scan(&user.ID, &user.Email, &user.Password, &user.Name, &user.Role, &user.Phone,
+			&user.Disabled, &user.MustChangePassword, &user.TwoFactorEnabled,
+			&user.TOTPSecret, &user.TOTPLastStep, &user.PasswordChangedAt)
 	if err != nil {
 		return nil, err
 	}
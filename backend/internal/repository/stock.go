@@ -0,0 +1,264 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"log/slog"
+
+	"restaurant-backend/internal/models"
+)
+
+// ErrStockBelowZero is returned when a movement would leave a product with
+// negative stock
+var ErrStockBelowZero = errors.New("stock cannot go below zero")
+
+const stockMovementColumns = `id, product_id, quantity, balance, reason,
+	reference_type, reference_id, note, actor_id, created_at`
+
+// migrateStockOpeningBalances records the stock products had before the
+// ledger existed as an opening adjustment, so each product's movements add
+// up to its stock
+func migrateStockOpeningBalances() {
+	const migrationID = 5
+	const migrationName = "stock_movements_opening_balances_v1"
+
+	var alreadyExecuted bool
+	err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM migrations WHERE id = ?)",
+		migrationID).Scan(&alreadyExecuted)
+	if err != nil {
+		slog.Error("failed to check migration status", "error", err)
+		return
+	}
+	if alreadyExecuted {
+		return
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		slog.Error("failed to record opening stock", "error", err)
+		return
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`INSERT INTO stock_movements (product_id, quantity,
+			balance, reason, note)
+		SELECT id, stock_quantity, stock_quantity, 'adjustment', 'Opening balance'
+		FROM products WHERE stock_quantity != 0`); err != nil {
+		slog.Error("failed to record opening stock", "error", err)
+		return
+	}
+	if _, err := tx.Exec("INSERT INTO migrations (id, name) VALUES (?, ?)",
+		migrationID, migrationName); err != nil {
+		slog.Error("failed to record migration", "error", err)
+		return
+	}
+
+	if err := tx.Commit(); err != nil {
+		slog.Error("failed to record opening stock", "error", err)
+	}
+}
+
+// AdjustStock changes a product's stock by hand, for counts, breakages and
+// other changes that don't come from orders or deliveries. The movement is
+// filled in with its ID and the resulting balance.
+func AdjustStock(m *models.StockMovement) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := moveStockTx(tx, m); err != nil {
+		return err
+	}
+	if m.Balance < 0 {
+		return ErrStockBelowZero
+	}
+	if err := tx.QueryRow("SELECT created_at FROM stock_movements WHERE id = ?",
+		m.ID).Scan(&m.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// FetchStockMovements retrieves a product's newest stock movements,
+// optionally only those with a reason
+func FetchStockMovements(productID int, reason string, limit int) ([]models.StockMovement, error) {
+	rows, err := db.Query(`SELECT `+stockMovementColumns+` FROM stock_movements
+		WHERE product_id = ? AND (? = '' OR reason = ?)
+		ORDER BY id DESC LIMIT ?`, productID, reason, reason, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	movements := []models.StockMovement{}
+	for rows.Next() {
+		var m models.StockMovement
+		var referenceID, actorID sql.NullInt64
+		if err := rows.Scan(&m.ID, &m.ProductID, &m.Quantity, &m.Balance,
+			&m.Reason, &m.ReferenceType, &referenceID, &m.Note, &actorID,
+			&m.CreatedAt); err != nil {
+			return nil, err
+		}
+		m.ReferenceID, m.ActorID = nullIntPtr(referenceID), nullIntPtr(actorID)
+		movements = append(movements, m)
+	}
+	return movements, nil
+}
+
+// moveStockTx changes a product's stock by m.Quantity and records the
+// movement in the ledger, keeping the product's lots in step. Every change
+// to stock_quantity goes through here. Products in an open stock count only
+// take returns from orders and refunds, and ErrStockLocked is returned for
+// anything else.
+func moveStockTx(tx *sql.Tx, m *models.StockMovement) error {
+	if m.Quantity == 0 {
+		return nil
+	}
+	if m.ReferenceType != "stock_count" &&
+		(m.Reason != "return" || m.ReferenceType == "") {
+		locked, err := productCountedTx(tx, m.ProductID)
+		if err != nil {
+			return err
+		}
+		if locked {
+			return ErrStockLocked
+		}
+	}
+	res, err := tx.Exec(`UPDATE products SET stock_quantity = stock_quantity + ?
+		WHERE id = ?`, m.Quantity, m.ProductID)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	if err := tx.QueryRow("SELECT stock_quantity FROM products WHERE id = ?",
+		m.ProductID).Scan(&m.Balance); err != nil {
+		return err
+	}
+	res, err = tx.Exec(`INSERT INTO stock_movements (product_id, quantity,
+			balance, reason, reference_type, reference_id, note, actor_id)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		m.ProductID, m.Quantity, m.Balance, m.Reason, m.ReferenceType,
+		m.ReferenceID, m.Note, m.ActorID)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	m.ID = int(id)
+	return moveLotsTx(tx, m)
+}
+
+// returnOrderStockTx puts back the product and ingredient stock a cancelled
+// order took. Orders placed before the ledger give back their items.
+func returnOrderStockTx(tx *sql.Tx, orderID int, actorID *int) error {
+	legacy, err := orderPredatesLedgerTx(tx, orderID)
+	if err != nil {
+		return err
+	}
+	query := `SELECT product_id, -SUM(quantity) FROM stock_movements
+		WHERE reference_type = 'order' AND reference_id = ? AND reason = 'sale'
+		GROUP BY product_id ORDER BY product_id`
+	if legacy {
+		query = `SELECT product_id, SUM(quantity) FROM order_items
+			WHERE order_id = ? GROUP BY product_id ORDER BY product_id`
+	}
+	products, err := stockReturnsTx(tx, query, orderID)
+	if err != nil {
+		return err
+	}
+	ingredients, err := stockReturnsTx(tx, `SELECT ingredient_id, -SUM(quantity)
+		FROM ingredient_movements
+		WHERE reference_type = 'order' AND reference_id = ? AND reason = 'sale'
+		GROUP BY ingredient_id ORDER BY ingredient_id`, orderID)
+	if err != nil {
+		return err
+	}
+
+	// Products and ingredients deleted since are skipped
+	for _, r := range products {
+		err := moveStockTx(tx, &models.StockMovement{
+			ProductID:     r.id,
+			Quantity:      int(r.quantity),
+			Reason:        "return",
+			ReferenceType: "order",
+			ReferenceID:   &orderID,
+			Note:          "Order cancelled",
+			ActorID:       actorID,
+		})
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+	for _, r := range ingredients {
+		err := moveIngredientTx(tx, &models.IngredientMovement{
+			IngredientID:  r.id,
+			Quantity:      r.quantity,
+			Reason:        "return",
+			ReferenceType: "order",
+			ReferenceID:   &orderID,
+			Note:          "Order cancelled",
+			ActorID:       actorID,
+		})
+		if err != nil && err != sql.ErrNoRows {
+			return err
+		}
+	}
+	return nil
+}
+
+// orderTookProductStockTx reports whether an order took a product from
+// stock, rather than the ingredients of its recipe
+func orderTookProductStockTx(tx *sql.Tx, orderID, productID int) (bool, error) {
+	legacy, err := orderPredatesLedgerTx(tx, orderID)
+	if err != nil || legacy {
+		return legacy, err
+	}
+	var took bool
+	err = tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM stock_movements
+		WHERE reference_type = 'order' AND reference_id = ? AND reason = 'sale'
+			AND product_id = ?)`, orderID, productID).Scan(&took)
+	return took, err
+}
+
+// orderPredatesLedgerTx reports whether an order was placed before stock
+// movements were recorded, so none were recorded for its sale
+func orderPredatesLedgerTx(tx *sql.Tx, orderID int) (bool, error) {
+	var legacy bool
+	err := tx.QueryRow(`SELECT NOT EXISTS(SELECT 1 FROM stock_movements
+			WHERE reference_type = 'order' AND reference_id = ? AND reason = 'sale')
+		AND NOT EXISTS(SELECT 1 FROM ingredient_movements
+			WHERE reference_type = 'order' AND reference_id = ? AND reason = 'sale')`,
+		orderID, orderID).Scan(&legacy)
+	return legacy, err
+}
+
+type stockReturn struct {
+	id       int
+	quantity float64
+}
+
+// stockReturnsTx reads the ID and quantity pairs a query returns for an
+// order
+func stockReturnsTx(tx *sql.Tx, query string, orderID int) ([]stockReturn, error) {
+	rows, err := tx.Query(query, orderID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var returns []stockReturn
+	for rows.Next() {
+		var r stockReturn
+		if err := rows.Scan(&r.id, &r.quantity); err != nil {
+			return nil, err
+		}
+		returns = append(returns, r)
+	}
+	return returns, rows.Err()
+}
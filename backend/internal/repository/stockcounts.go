@@ -0,0 +1,312 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+
+	"restaurant-backend/internal/models"
+)
+
+var (
+	// ErrStockLocked is returned when a product's stock is changed, or it
+	// is added to a stock count, while it is in an open stock count
+	ErrStockLocked = errors.New("product is in an open stock count")
+	// ErrStockCountStatus is returned when a stock count is no longer open
+	ErrStockCountStatus = errors.New("stock count is not open")
+	// ErrEmptyStockCount is returned when a stock count would have no
+	// products
+	ErrEmptyStockCount = errors.New("stock count has no products")
+	// ErrUnknownStockCountLine is returned for a product not in the count
+	ErrUnknownStockCountLine = errors.New("product is not in this stock count")
+)
+
+// CreateStockCount opens a stock count of productIDs, or else of every
+// product in category, or of all products, locking them until the count is
+// posted or cancelled. sql.ErrNoRows is returned when a listed product does
+// not exist.
+func CreateStockCount(c *models.StockCount, productIDs []int, category string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	res, err := tx.Exec(`INSERT INTO stock_counts (note, created_by)
+		VALUES (?, ?)`, c.Note, c.CreatedBy)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	c.ID = int(id)
+
+	if len(productIDs) > 0 {
+		args := []any{c.ID}
+		for _, pid := range productIDs {
+			args = append(args, pid)
+		}
+		res, err = tx.Exec(`INSERT INTO stock_count_lines (stock_count_id, product_id)
+			SELECT ?, id FROM products WHERE id IN (?`+
+			strings.Repeat(", ?", len(productIDs)-1)+`)`, args...)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); int(n) != len(productIDs) {
+			return sql.ErrNoRows
+		}
+	} else {
+		res, err = tx.Exec(`INSERT INTO stock_count_lines (stock_count_id, product_id)
+			SELECT ?, id FROM products
+			WHERE (? = '' OR category = ?)
+				AND id NOT IN (SELECT product_id FROM recipe_lines)`,
+			c.ID, category, category)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrEmptyStockCount
+		}
+	}
+
+	var locked bool
+	if err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM stock_count_lines l
+		JOIN stock_counts c ON c.id = l.stock_count_id
+		WHERE c.status = 'open' AND c.id != ? AND l.product_id IN
+			(SELECT product_id FROM stock_count_lines WHERE stock_count_id = ?))`,
+		c.ID, c.ID).Scan(&locked); err != nil {
+		return err
+	}
+	if locked {
+		return ErrStockLocked
+	}
+	return tx.Commit()
+}
+
+// FetchStockCounts retrieves stock counts, newest first, optionally only
+// those with a status. Their lines are left out.
+func FetchStockCounts(status string) ([]models.StockCount, error) {
+	rows, err := db.Query(`SELECT `+stockCountColumns+` FROM stock_counts c
+		WHERE ? = '' OR c.status = ?
+		ORDER BY c.id DESC`, status, status)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := []models.StockCount{}
+	for rows.Next() {
+		c, err := scanStockCount(rows)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, *c)
+	}
+	return counts, rows.Err()
+}
+
+// GetStockCount retrieves a stock count with its lines and variances
+func GetStockCount(id int) (*models.StockCount, error) {
+	c, err := scanStockCount(db.QueryRow(`SELECT `+stockCountColumns+`
+		FROM stock_counts c WHERE c.id = ?`, id))
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT l.product_id, COALESCE(p.name, ''),
+			COALESCE(l.expected_quantity, p.stock_quantity, 0), l.counted_quantity,
+			COALESCE((SELECT pl.unit_cost FROM purchase_order_lines pl
+				JOIN purchase_orders po ON po.id = pl.purchase_order_id
+				WHERE pl.product_id = l.product_id AND po.status != 'cancelled'
+				ORDER BY pl.id DESC LIMIT 1), 0)
+		FROM stock_count_lines l
+		LEFT JOIN products p ON p.id = l.product_id
+		WHERE l.stock_count_id = ?
+		ORDER BY p.name, l.product_id`, id)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	c.Lines = []models.StockCountLine{}
+	for rows.Next() {
+		var l models.StockCountLine
+		var counted sql.NullInt64
+		if err := rows.Scan(&l.ProductID, &l.ProductName, &l.ExpectedQuantity,
+			&counted, &l.UnitCost); err != nil {
+			return nil, err
+		}
+		if l.CountedQuantity = nullIntPtr(counted); l.CountedQuantity != nil {
+			variance := *l.CountedQuantity - l.ExpectedQuantity
+			l.Variance = &variance
+			if variance != 0 && l.UnitCost != 0 {
+				l.VarianceCost = roundCents(float64(variance) * l.UnitCost)
+				c.VarianceCost += l.VarianceCost
+			}
+		}
+		c.Lines = append(c.Lines, l)
+	}
+	c.VarianceCost = roundCents(c.VarianceCost)
+	return c, rows.Err()
+}
+
+// RecordStockCounts sets counted quantities in an open stock count, along
+// with the stock each product had when it was counted
+func RecordStockCounts(id int, entries []models.StockCountEntry) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := checkStockCountOpenTx(tx, id); err != nil {
+		return err
+	}
+	for _, e := range entries {
+		res, err := tx.Exec(`UPDATE stock_count_lines SET counted_quantity = ?,
+				expected_quantity = CASE WHEN ? IS NULL THEN NULL ELSE
+					(SELECT stock_quantity FROM products WHERE id = product_id) END
+			WHERE stock_count_id = ? AND product_id = ?`,
+			e.CountedQuantity, e.CountedQuantity, id, e.ProductID)
+		if err != nil {
+			return err
+		}
+		if n, _ := res.RowsAffected(); n == 0 {
+			return ErrUnknownStockCountLine
+		}
+	}
+	return tx.Commit()
+}
+
+// PostStockCount closes an open stock count, correcting the stock of each
+// product counted by its variance in one transaction, so returns that came
+// in after a product was counted are kept. Products not counted are left
+// as they are.
+func PostStockCount(id int, reason string, actorID *int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := closeStockCountTx(tx, id, "posted", reason, actorID); err != nil {
+		return err
+	}
+
+	rows, err := tx.Query(`SELECT l.id, l.product_id, l.counted_quantity,
+			COALESCE(l.expected_quantity, p.stock_quantity)
+		FROM stock_count_lines l JOIN products p ON p.id = l.product_id
+		WHERE l.stock_count_id = ? AND l.counted_quantity IS NOT NULL
+		ORDER BY l.id`, id)
+	if err != nil {
+		return err
+	}
+	type countedLine struct{ id, productID, counted, expected int }
+	var lines []countedLine
+	for rows.Next() {
+		var l countedLine
+		if err := rows.Scan(&l.id, &l.productID, &l.counted, &l.expected); err != nil {
+			rows.Close()
+			return err
+		}
+		lines = append(lines, l)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return err
+	}
+
+	for _, l := range lines {
+		if _, err := tx.Exec(`UPDATE stock_count_lines SET expected_quantity = ?
+			WHERE id = ?`, l.expected, l.id); err != nil {
+			return err
+		}
+		if err := moveStockTx(tx, &models.StockMovement{
+			ProductID:     l.productID,
+			Quantity:      l.counted - l.expected,
+			Reason:        "adjustment",
+			ReferenceType: "stock_count",
+			ReferenceID:   &id,
+			Note:          reason,
+			ActorID:       actorID,
+		}); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// CancelStockCount closes an open stock count without changing any stock
+func CancelStockCount(id int, actorID *int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := closeStockCountTx(tx, id, "cancelled", "", actorID); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// closeStockCountTx moves an open stock count to status, unlocking its
+// products
+func closeStockCountTx(tx *sql.Tx, id int, status, reason string, actorID *int) error {
+	res, err := tx.Exec(`UPDATE stock_counts SET status = ?, reason = ?,
+			closed_by = ?, closed_at = CURRENT_TIMESTAMP
+		WHERE id = ? AND status = 'open'`, status, reason, actorID, id)
+	if err != nil {
+		return err
+	}
+	if n, _ := res.RowsAffected(); n == 0 {
+		return checkStockCountOpenTx(tx, id)
+	}
+	return nil
+}
+
+// checkStockCountOpenTx returns sql.ErrNoRows when a stock count does not
+// exist and ErrStockCountStatus when it is no longer open
+func checkStockCountOpenTx(tx *sql.Tx, id int) error {
+	var status string
+	if err := tx.QueryRow("SELECT status FROM stock_counts WHERE id = ?",
+		id).Scan(&status); err != nil {
+		return err
+	}
+	if status != "open" {
+		return ErrStockCountStatus
+	}
+	return nil
+}
+
+// productCountedTx reports whether a product is in an open stock count
+func productCountedTx(tx *sql.Tx, productID int) (bool, error) {
+	var counted bool
+	err := tx.QueryRow(`SELECT EXISTS(SELECT 1 FROM stock_count_lines l
+		JOIN stock_counts c ON c.id = l.stock_count_id
+		WHERE l.product_id = ? AND c.status = 'open')`, productID).Scan(&counted)
+	return counted, err
+}
+
+const stockCountColumns = `c.id, c.status, c.note, c.reason,
+	(SELECT COUNT(*) FROM stock_count_lines WHERE stock_count_id = c.id),
+	(SELECT COUNT(*) FROM stock_count_lines
+		WHERE stock_count_id = c.id AND counted_quantity IS NOT NULL),
+	c.created_by, c.closed_by, c.closed_at, c.created_at`
+
+func scanStockCount(row rowScanner) (*models.StockCount, error) {
+	var c models.StockCount
+	var createdBy, closedBy sql.NullInt64
+	var closedAt sql.NullString
+	if err := row.Scan(&c.ID, &c.Status, &c.Note, &c.Reason, &c.Products,
+		&c.Counted, &createdBy, &closedBy, &closedAt, &c.CreatedAt); err != nil {
+		return nil, err
+	}
+	c.CreatedBy, c.ClosedBy = nullIntPtr(createdBy), nullIntPtr(closedBy)
+	if closedAt.Valid {
+		c.ClosedAt = &closedAt.String
+	}
+	return &c, nil
+}
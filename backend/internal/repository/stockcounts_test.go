@@ -0,0 +1,141 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"restaurant-backend/internal/models"
+)
+
+// openCount opens a stock count of products
+func openCount(t *testing.T, products ...*models.Product) int {
+	t.Helper()
+	var ids []int
+	for _, p := range products {
+		ids = append(ids, p.ID)
+	}
+	c := &models.StockCount{}
+	if err := CreateStockCount(c, ids, ""); err != nil {
+		t.Fatal(err)
+	}
+	return c.ID
+}
+
+// recordCount records counted as what was found of product
+func recordCount(t *testing.T, countID int, p *models.Product, counted int) {
+	t.Helper()
+	if err := RecordStockCounts(countID, []models.StockCountEntry{
+		{ProductID: p.ID, CountedQuantity: &counted}}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestStockCountLocksProducts(t *testing.T) {
+	p := testProduct(t, 10)
+	id := openCount(t, p)
+
+	err := AdjustStock(&models.StockMovement{ProductID: p.ID, Quantity: -1,
+		Reason: "adjustment"})
+	if !errors.Is(err, ErrStockLocked) {
+		t.Errorf("adjusting counted stock: err = %v, want ErrStockLocked", err)
+	}
+	if err := CreateOrder(&models.Order{UserID: 1, Status: "pending",
+		Items: []models.OrderItem{{ProductID: p.ID, Quantity: 1}}}); !errors.Is(err,
+		ErrStockLocked) {
+		t.Errorf("selling counted stock: err = %v, want ErrStockLocked", err)
+	}
+	if err := CreateStockCount(&models.StockCount{}, []int{p.ID}, ""); !errors.Is(err,
+		ErrStockLocked) {
+		t.Errorf("counting a product twice: err = %v, want ErrStockLocked", err)
+	}
+
+	if err := CancelStockCount(id, nil); err != nil {
+		t.Fatal(err)
+	}
+	if err := AdjustStock(&models.StockMovement{ProductID: p.ID, Quantity: -1,
+		Reason: "adjustment"}); err != nil {
+		t.Errorf("adjusting after the count was cancelled: %v", err)
+	}
+	if err := PostStockCount(id, "late", nil); !errors.Is(err, ErrStockCountStatus) {
+		t.Errorf("posting a cancelled count: err = %v, want ErrStockCountStatus", err)
+	}
+}
+
+func TestPostStockCount(t *testing.T) {
+	tests := []struct {
+		name string
+		// returnBefore cancels the order before the product is counted,
+		// otherwise it is cancelled after
+		returnBefore bool
+		counted      int
+		wantStock    int
+		wantVariance int
+	}{
+		// 10 in stock, 2 sold and 1 lost before the count; the 2 come back
+		{"return before counting", true, 9, 9, -1},
+		{"return after counting", false, 7, 9, -1},
+		{"nothing missing", false, 8, 10, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := testProduct(t, 10)
+			order := testOrder(t, 2, p)
+			id := openCount(t, p)
+
+			if tt.returnBefore {
+				if err := CancelOrder(order.ID, 0, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+			recordCount(t, id, p, tt.counted)
+			if !tt.returnBefore {
+				if err := CancelOrder(order.ID, 0, nil); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			if err := PostStockCount(id, "weekly count", nil); err != nil {
+				t.Fatal(err)
+			}
+			if got := stockOf(t, p.ID); got != tt.wantStock {
+				t.Errorf("stock = %d, want %d", got, tt.wantStock)
+			}
+			c, err := GetStockCount(id)
+			if err != nil {
+				t.Fatal(err)
+			}
+			l := c.Lines[0]
+			switch {
+			case l.Variance == nil:
+				t.Error("no variance for a counted line")
+			case *l.Variance != tt.wantVariance:
+				t.Errorf("variance = %d, want %d", *l.Variance, tt.wantVariance)
+			}
+			if c.Status != "posted" {
+				t.Errorf("status = %s, want posted", c.Status)
+			}
+		})
+	}
+}
+
+func TestPostStockCountLeavesUncountedStock(t *testing.T) {
+	counted, skipped := testProduct(t, 5), testProduct(t, 5)
+	id := openCount(t, counted, skipped)
+	recordCount(t, id, counted, 3)
+	// Clearing a line leaves it uncounted
+	recordCount(t, id, skipped, 1)
+	if err := RecordStockCounts(id, []models.StockCountEntry{
+		{ProductID: skipped.ID}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := PostStockCount(id, "spot check", nil); err != nil {
+		t.Fatal(err)
+	}
+	if got := stockOf(t, counted.ID); got != 3 {
+		t.Errorf("counted stock = %d, want 3", got)
+	}
+	if got := stockOf(t, skipped.ID); got != 5 {
+		t.Errorf("uncounted stock = %d, want 5", got)
+	}
+}
@@ -0,0 +1,49 @@
+package repository
+
+import (
+	"restaurant-backend/internal/models"
+)
+
+// FetchTaxRates retrieves all tax rates, the default rate first
+func FetchTaxRates() ([]models.TaxRate, error) {
+	rows, err := db.Query(`SELECT category, name, dine_in_rate, takeaway_rate
+		FROM tax_rates ORDER BY category`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rates := []models.TaxRate{}
+	for rows.Next() {
+		var t models.TaxRate
+		if err := rows.Scan(&t.Category, &t.Name, &t.DineInRate,
+			&t.TakeawayRate); err != nil {
+			return nil, err
+		}
+		rates = append(rates, t)
+	}
+	return rates, nil
+}
+
+// ReplaceTaxRates replaces all tax rates. Orders keep the rates they were
+// taxed at.
+func ReplaceTaxRates(rates []models.TaxRate) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM tax_rates"); err != nil {
+		return err
+	}
+	for _, t := range rates {
+		if _, err := tx.Exec(`
+			INSERT INTO tax_rates (category, name, dine_in_rate, takeaway_rate)
+			VALUES (?, ?, ?, ?)`,
+			t.Category, t.Name, t.DineInRate, t.TakeawayRate); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
@@ -0,0 +1,81 @@
+package repository
+
+import (
+	"fmt"
+
+	"restaurant-backend/internal/models"
+)
+
+// FetchServiceChargeRules retrieves all service charge rules
+func FetchServiceChargeRules() ([]models.ServiceChargeRule, error) {
+	rows, err := db.Query(`SELECT name, order_type, min_party_size, min_subtotal,
+		rate FROM service_charge_rules ORDER BY id`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	rules := []models.ServiceChargeRule{}
+	for rows.Next() {
+		var r models.ServiceChargeRule
+		if err := rows.Scan(&r.Name, &r.OrderType, &r.MinPartySize,
+			&r.MinSubtotal, &r.Rate); err != nil {
+			return nil, err
+		}
+		rules = append(rules, r)
+	}
+	return rules, nil
+}
+
+// ReplaceServiceChargeRules replaces all service charge rules. Orders keep
+// the charge they were placed with.
+func ReplaceServiceChargeRules(rules []models.ServiceChargeRule) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM service_charge_rules"); err != nil {
+		return err
+	}
+	for _, r := range rules {
+		if _, err := tx.Exec(`
+			INSERT INTO service_charge_rules (name, order_type, min_party_size,
+				min_subtotal, rate)
+			VALUES (?, ?, ?, ?, ?)`,
+			r.Name, r.OrderType, r.MinPartySize, r.MinSubtotal, r.Rate); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+// FetchTipSummary returns the tips and service charges on completed orders
+// per day for the last days, newest first
+func FetchTipSummary(days int) ([]models.TipSummary, error) {
+	rows, err := db.Query(`
+		SELECT date(created_at) as day,
+			SUM(CASE WHEN tip_amount > 0 THEN 1 ELSE 0 END),
+			ROUND(SUM(tip_amount), 2), ROUND(SUM(service_charge), 2)
+		FROM orders
+		WHERE status = 'completed' AND created_at >= date('now', ?)
+			AND (tip_amount > 0 OR service_charge > 0)
+		GROUP BY day
+		ORDER BY day DESC`, fmt.Sprintf("-%d days", days))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	summary := []models.TipSummary{}
+	for rows.Next() {
+		var t models.TipSummary
+		if err := rows.Scan(&t.Date, &t.Orders, &t.Tips,
+			&t.ServiceCharge); err != nil {
+			return nil, err
+		}
+		summary = append(summary, t)
+	}
+	return summary, nil
+}
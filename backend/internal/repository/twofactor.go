@@ -0,0 +1,134 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+)
+
+// ErrTwoFactorLocked is returned while a user is locked out of two-factor
+// login after too many failed codes
+var ErrTwoFactorLocked = errors.New("too many failed two-factor attempts")
+
+// SetPendingTOTPSecret stores a new TOTP secret that is not yet enabled.
+// Enrollment is only completed by EnableTOTP once a code has been verified.
+func SetPendingTOTPSecret(userID int, secret string) error {
+	return execAffectingUser(`UPDATE users SET totp_secret = ?, totp_enabled = 0,
+		totp_last_step = 0 WHERE id = ?`, secret, userID)
+}
+
+// EnableTOTP turns on two-factor authentication for a user
+func EnableTOTP(userID int) error {
+	return execAffectingUser(`UPDATE users SET totp_enabled = 1
+		WHERE id = ? AND totp_secret != ''`, userID)
+}
+
+// DisableTOTP turns off two-factor authentication and discards the secret
+// and any recovery codes
+func DisableTOTP(userID int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec(`UPDATE users SET totp_secret = '', totp_enabled = 0,
+		totp_last_step = 0 WHERE id = ?`, userID); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?",
+		userID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ClaimTOTPStep records the time step of a successfully verified code. It
+// returns false if that step (or a later one) was already used, which
+// prevents the same code being replayed.
+func ClaimTOTPStep(userID int, step int64) (bool, error) {
+	result, err := db.Exec(`UPDATE users SET totp_last_step = ?
+		WHERE id = ? AND totp_last_step < ?`, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// ReplaceRecoveryCodes discards a user's recovery codes and stores new ones
+func ReplaceRecoveryCodes(userID int, codeHashes []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM recovery_codes WHERE user_id = ?",
+		userID); err != nil {
+		return err
+	}
+	for _, h := range codeHashes {
+		if _, err := tx.Exec(`INSERT INTO recovery_codes (user_id, code_hash)
+			VALUES (?, ?)`, userID, h); err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode marks an unused recovery code as used. It returns false if
+// the code does not exist or was already used.
+func UseRecoveryCode(userID int, codeHash string) (bool, error) {
+	result, err := db.Exec(`UPDATE recovery_codes SET used_at = datetime('now')
+		WHERE user_id = ? AND code_hash = ? AND used_at IS NULL`,
+		userID, codeHash)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n > 0, err
+}
+
+// BeginTwoFactorAttempt counts an attempt at a user's second factor before
+// the code is checked, so parallel guesses cannot get past the limit. The
+// attempt that reaches maxAttempts locks the user out for lockout; once
+// that has passed counting starts again. ResetTwoFactorAttempts clears the
+// count after a correct code.
+func BeginTwoFactorAttempt(userID, maxAttempts int, lockout time.Duration) error {
+	result, err := db.Exec(`UPDATE users SET
+		totp_failures = CASE WHEN totp_locked_until IS NULL
+			THEN totp_failures ELSE 0 END + 1,
+		totp_locked_until = CASE WHEN CASE WHEN totp_locked_until IS NULL
+			THEN totp_failures ELSE 0 END + 1 >= ?
+			THEN datetime('now', ?) END
+		WHERE id = ? AND (totp_locked_until IS NULL
+			OR totp_locked_until <= datetime('now'))`,
+		maxAttempts, fmt.Sprintf("+%d seconds", int(lockout.Seconds())), userID)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n > 0 {
+		return nil
+	}
+
+	var exists bool
+	if err := db.QueryRow("SELECT EXISTS(SELECT 1 FROM users WHERE id = ?)",
+		userID).Scan(&exists); err != nil {
+		return err
+	}
+	if !exists {
+		return sql.ErrNoRows
+	}
+	return ErrTwoFactorLocked
+}
+
+// ResetTwoFactorAttempts clears a user's failed two-factor attempts
+func ResetTwoFactorAttempts(userID int) error {
+	_, err := db.Exec(`UPDATE users SET totp_failures = 0,
+		totp_locked_until = NULL WHERE id = ?`, userID)
+	return err
+}
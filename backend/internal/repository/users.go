@@ -0,0 +1,374 @@
+package repository
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+
+	"modernc.org/sqlite"
+	sqlite3 "modernc.org/sqlite/lib"
+
+	"restaurant-backend/internal/models"
+)
+
+var (
+	// ErrInvalidToken is returned when a one-time token is unknown or expired
+	ErrInvalidToken = errors.New("invalid or expired token")
+	// ErrEmailTaken is returned when an email change is confirmed for an
+	// address another account has registered since it was requested
+	ErrEmailTaken = errors.New("email already registered")
+)
+
+// ListUsers retrieves users, optionally filtered by a search term matched
+// against email/name/phone and by role
+func ListUsers(search, role string) ([]models.User, error) {
+	query := `SELECT id, email, name, role, phone, disabled, must_change_password,
+		totp_enabled FROM users WHERE 1 = 1`
+	var args []any
+
+	if search != "" {
+		like := "%" + search + "%"
+		query += " AND (email LIKE ? OR name LIKE ? OR phone LIKE ?)"
+		args = append(args, like, like, like)
+	}
+	if role != "" {
+		query += " AND role = ?"
+		args = append(args, role)
+	}
+	query += " ORDER BY id ASC"
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	users := []models.User{}
+	for rows.Next() {
+		var u models.User
+		var name, phone sql.NullString
+		if err := rows.Scan(&u.ID, &u.Email, &name, &u.Role, &phone,
+			&u.Disabled, &u.MustChangePassword, &u.TwoFactorEnabled); err != nil {
+			return nil, err
+		}
+		u.Name = name.String
+		u.Phone = phone.String
+		users = append(users, u)
+	}
+	return users, nil
+}
+
+// UpdateUserRole changes the role of a user
+func UpdateUserRole(id int, role string) error {
+	return execAffectingUser("UPDATE users SET role = ? WHERE id = ?", role, id)
+}
+
+// SetUserDisabled enables or disables a user account
+func SetUserDisabled(id int, disabled bool) error {
+	return execAffectingUser("UPDATE users SET disabled = ? WHERE id = ?",
+		disabled, id)
+}
+
+// SetUserPassword replaces a user's password hash and sets whether they must
+// change it on next login. Session tokens issued before now stop working.
+func SetUserPassword(id int, hash string, mustChange bool) error {
+	return execAffectingUser(`UPDATE users SET password = ?, must_change_password = ?,
+		password_changed_at = strftime('%s', 'now') WHERE id = ?`, hash, mustChange, id)
+}
+
+// UpdateUserProfile updates the self-editable fields of a user
+func UpdateUserProfile(id int, name, phone string) error {
+	return execAffectingUser("UPDATE users SET name = ?, phone = ? WHERE id = ?",
+		name, phone, id)
+}
+
+// CreateEmailVerification stores a pending email change. Any earlier pending
+// change for the same user is replaced.
+func CreateEmailVerification(userID int, newEmail, tokenHash string,
+	ttlHours int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM email_verifications WHERE user_id = ?",
+		userID); err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`
+		INSERT INTO email_verifications (user_id, new_email, token_hash,
+			expires_at)
+		VALUES (?, ?, ?, datetime('now', ?))`,
+		userID, newEmail, tokenHash, fmt.Sprintf("+%d hours", ttlHours))
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// ConfirmEmailVerification applies the pending email change matching the
+// token hash and returns the affected user ID. ErrEmailTaken is returned,
+// and the verification removed, when another account has the address.
+func ConfirmEmailVerification(tokenHash string) (int, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	var userID int
+	var newEmail string
+	err = tx.QueryRow(`SELECT user_id, new_email FROM email_verifications
+		WHERE token_hash = ? AND expires_at > datetime('now')`, tokenHash).
+		Scan(&userID, &newEmail)
+	if err == sql.ErrNoRows {
+		return 0, ErrInvalidToken
+	}
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec("UPDATE users SET email = ? WHERE id = ?",
+		newEmail, userID); err != nil {
+		if !isUniqueViolation(err) {
+			return 0, err
+		}
+		// The change can never go through, so the verification goes
+		if _, err := tx.Exec("DELETE FROM email_verifications WHERE token_hash = ?",
+			tokenHash); err != nil {
+			return 0, err
+		}
+		if err := tx.Commit(); err != nil {
+			return 0, err
+		}
+		return 0, ErrEmailTaken
+	}
+
+	if _, err := tx.Exec("DELETE FROM email_verifications WHERE user_id = ?",
+		userID); err != nil {
+		return 0, err
+	}
+
+	return userID, tx.Commit()
+}
+
+// isUniqueViolation reports whether err is a UNIQUE constraint failing
+func isUniqueViolation(err error) bool {
+	var e *sqlite.Error
+	return errors.As(err, &e) && e.Code() == sqlite3.SQLITE_CONSTRAINT_UNIQUE
+}
+
+// FetchEmailVerificationsByUserID retrieves a user's pending email changes.
+// The token hash is left out.
+func FetchEmailVerificationsByUserID(userID int) ([]models.EmailVerification, error) {
+	rows, err := db.Query(`SELECT new_email, expires_at FROM email_verifications
+		WHERE user_id = ? ORDER BY id`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	verifications := []models.EmailVerification{}
+	for rows.Next() {
+		var v models.EmailVerification
+		if err := rows.Scan(&v.NewEmail, &v.ExpiresAt); err != nil {
+			return nil, err
+		}
+		verifications = append(verifications, v)
+	}
+	return verifications, rows.Err()
+}
+
+// DeleteUser removes a user. Their orders are kept for reporting but
+// detached from the account.
+func DeleteUser(id int) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := deleteUserTx(tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// EraseUser deletes a user at their own request. On top of DeleteUser it
+// anonymizes their feedback and their name in the audit trail, and clears
+// the free text they left on orders and gift cards; orders are kept,
+// detached from the user, so revenue reporting stays intact.
+func EraseUser(id int, email string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, query := range []string{
+		"UPDATE orders SET note = '' WHERE user_id = ?",
+		`UPDATE order_items SET note = ''
+			WHERE order_id IN (SELECT id FROM orders WHERE user_id = ?)`,
+		// Printed tickets carry the notes too; pending ones still have
+		// to reach the kitchen
+		`DELETE FROM kitchen_tickets WHERE status != 'pending'
+			AND order_id IN (SELECT id FROM orders WHERE user_id = ?)`,
+		`UPDATE gift_cards SET recipient_email = '', message = ''
+			WHERE purchaser_id = ?`,
+	} {
+		if _, err := tx.Exec(query, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec(`UPDATE feedback SET name = 'Anonymous', email = ''
+		WHERE email = ?`, email); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE audit_log SET actor_email = ? WHERE actor_id = ?",
+		fmt.Sprintf("deleted-user-%d", id), id); err != nil {
+		return err
+	}
+
+	if err := deleteUserTx(tx, id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// deleteUserTx removes a user and everything that only makes sense with
+// them, detaching their orders
+func deleteUserTx(tx *sql.Tx, id int) error {
+	if _, err := tx.Exec("UPDATE orders SET user_id = NULL WHERE user_id = ?",
+		id); err != nil {
+		return err
+	}
+	// Gift cards stay valid for whoever holds the code
+	if _, err := tx.Exec(`UPDATE gift_cards SET purchaser_id = NULL
+		WHERE purchaser_id = ?`, id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(`UPDATE coupon_redemptions SET user_id = NULL
+		WHERE user_id = ?`, id); err != nil {
+		return err
+	}
+
+	for _, table := range []string{"user_identities", "recovery_codes",
+		"email_verifications", "api_keys", "loyalty_ledger"} {
+		if _, err := tx.Exec("DELETE FROM "+table+" WHERE user_id = ?",
+			id); err != nil {
+			return err
+		}
+	}
+
+	result, err := tx.Exec("DELETE FROM users WHERE id = ?", id)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
+
+// FetchFeedbackByEmail retrieves all feedback submitted with the given email
+func FetchFeedbackByEmail(email string) ([]models.Feedback, error) {
+	rows, err := db.Query(`SELECT id, name, email, rating, comment,
+		product_id, product_name, date FROM feedback
+		WHERE email = ? ORDER BY date DESC`, email)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	feedbacks := []models.Feedback{}
+	for rows.Next() {
+		var f models.Feedback
+		var productID sql.NullInt64
+		var productName sql.NullString
+		err := rows.Scan(&f.ID, &f.Name, &f.Email, &f.Rating, &f.Comment,
+			&productID, &productName, &f.Date)
+		if err != nil {
+			return nil, err
+		}
+		if productID.Valid {
+			pid := int(productID.Int64)
+			f.ProductID = &pid
+		}
+		f.ProductName = productName.String
+		feedbacks = append(feedbacks, f)
+	}
+	return feedbacks, nil
+}
+
+// InsertAuditEntry records an administrative action in the audit trail
+func InsertAuditEntry(entry *models.AuditEntry) error {
+	result, err := db.Exec(`
+		INSERT INTO audit_log (actor_id, actor_email, action, target_user_id,
+			details)
+		VALUES (?, ?, ?, ?, ?)`,
+		entry.ActorID, entry.ActorEmail, entry.Action, entry.TargetUserID,
+		entry.Details)
+	if err != nil {
+		return err
+	}
+	id, err := result.LastInsertId()
+	if err != nil {
+		return err
+	}
+	entry.ID = int(id)
+	return nil
+}
+
+// FetchAuditLog retrieves the most recent audit entries, optionally limited
+// to a single target user
+func FetchAuditLog(targetUserID, limit int) ([]models.AuditEntry, error) {
+	query := `SELECT id, actor_id, actor_email, action, target_user_id,
+		details, created_at FROM audit_log`
+	var args []any
+	if targetUserID > 0 {
+		query += " WHERE target_user_id = ?"
+		args = append(args, targetUserID)
+	}
+	query += " ORDER BY id DESC LIMIT ?"
+	args = append(args, limit)
+
+	rows, err := db.Query(query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.AuditEntry{}
+	for rows.Next() {
+		var e models.AuditEntry
+		var target sql.NullInt64
+		var details sql.NullString
+		if err := rows.Scan(&e.ID, &e.ActorID, &e.ActorEmail, &e.Action,
+			&target, &details, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		if target.Valid {
+			tid := int(target.Int64)
+			e.TargetUserID = &tid
+		}
+		e.Details = details.String
+		entries = append(entries, e)
+	}
+	return entries, nil
+}
+
+// execAffectingUser runs an update against a single user and reports
+// sql.ErrNoRows if no such user exists
+func execAffectingUser(query string, args ...any) error {
+	result, err := db.Exec(query, args...)
+	if err != nil {
+		return err
+	}
+	if n, _ := result.RowsAffected(); n == 0 {
+		return sql.ErrNoRows
+	}
+	return nil
+}
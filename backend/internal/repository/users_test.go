@@ -0,0 +1,70 @@
+package repository
+
+import (
+	"errors"
+	"testing"
+
+	"restaurant-backend/internal/models"
+)
+
+// testUser stores a customer with email, failing the test on error
+func testUser(t *testing.T, email string) *models.User {
+	t.Helper()
+	u := &models.User{Email: email, Password: "x", Name: "Test", Role: "user"}
+	if err := CreateUser(u); err != nil {
+		t.Fatal(err)
+	}
+	return u
+}
+
+func TestConfirmEmailVerification(t *testing.T) {
+	u := testUser(t, unique("old@example.com"))
+	email, hash := unique("new@example.com"), unique("hash")
+	if err := CreateEmailVerification(u.ID, email, hash, 24); err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := ConfirmEmailVerification(hash)
+	if err != nil || id != u.ID {
+		t.Fatalf("ConfirmEmailVerification = %d, %v; want %d", id, err, u.ID)
+	}
+	got, err := GetUserByID(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != email {
+		t.Errorf("email = %s, want %s", got.Email, email)
+	}
+	if _, err := ConfirmEmailVerification(hash); !errors.Is(err, ErrInvalidToken) {
+		t.Errorf("confirming twice: err = %v, want ErrInvalidToken", err)
+	}
+}
+
+func TestConfirmEmailVerificationTaken(t *testing.T) {
+	mine, wanted, hash := unique("mine@example.com"), unique("wanted@example.com"),
+		unique("hash")
+	u := testUser(t, mine)
+	if err := CreateEmailVerification(u.ID, wanted, hash, 24); err != nil {
+		t.Fatal(err)
+	}
+	// Someone else registers the address before the change is confirmed
+	testUser(t, wanted)
+
+	if _, err := ConfirmEmailVerification(hash); !errors.Is(err, ErrEmailTaken) {
+		t.Fatalf("err = %v, want ErrEmailTaken", err)
+	}
+	got, err := GetUserByID(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.Email != mine {
+		t.Errorf("email = %s, want %s", got.Email, mine)
+	}
+	pending, err := FetchEmailVerificationsByUserID(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(pending) != 0 {
+		t.Errorf("verification kept: %+v", pending)
+	}
+}
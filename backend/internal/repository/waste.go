@@ -0,0 +1,281 @@
+package repository
+
+import (
+	"database/sql"
+	"fmt"
+	"math"
+	"sort"
+
+	"restaurant-backend/internal/models"
+)
+
+// RecordWaste records food thrown away and takes it out of stock: the
+// ingredient, the product's lot, the product's recipe ingredients, or else
+// the product. The entry's product, ingredient or lot must exist, or
+// sql.ErrNoRows is returned; ErrStockBelowZero is returned when there is
+// not that much in stock. The entry is filled in with its ID, name and
+// cost.
+func RecordWaste(e *models.WasteEntry) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := recordWasteTx(tx, e); err != nil {
+		return err
+	}
+	if err := tx.QueryRow("SELECT created_at FROM waste_entries WHERE id = ?",
+		e.ID).Scan(&e.CreatedAt); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+func recordWasteTx(tx *sql.Tx, e *models.WasteEntry) error {
+	var lines []models.RecipeLine
+	if e.IngredientID != nil {
+		err := tx.QueryRow(`SELECT name, unit, unit_cost FROM ingredients
+			WHERE id = ?`, *e.IngredientID).Scan(&e.Name, &e.Unit, &e.UnitCost)
+		if err != nil {
+			return err
+		}
+	} else if e.LotID != nil {
+		// Stock from a lot is the product itself, at what the lot cost
+		err := tx.QueryRow(`SELECT p.name, l.unit_cost
+			FROM stock_lots l JOIN products p ON p.id = l.product_id
+			WHERE l.id = ? AND l.product_id = ?`, *e.LotID,
+			*e.ProductID).Scan(&e.Name, &e.UnitCost)
+		if err != nil {
+			return err
+		}
+	} else {
+		err := tx.QueryRow("SELECT name FROM products WHERE id = ?",
+			*e.ProductID).Scan(&e.Name)
+		if err != nil {
+			return err
+		}
+		if lines, err = recipeTx(tx, *e.ProductID, e.PortionSize); err != nil {
+			return err
+		}
+		if len(lines) > 0 {
+			e.UnitCost, err = recipeCostTx(tx, lines)
+		} else {
+			_, e.UnitCost, err = lastPurchaseTx(tx, *e.ProductID)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	e.Cost = roundCents(e.UnitCost * e.Quantity)
+
+	res, err := tx.Exec(`INSERT INTO waste_entries (product_id, ingredient_id,
+			lot_id, portion_size, quantity, reason, note, unit_cost, cost, staff_id,
+			recorded_by)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.ProductID, e.IngredientID, e.LotID, e.PortionSize, e.Quantity, e.Reason,
+		e.Note, e.UnitCost, e.Cost, e.StaffID, e.RecordedBy)
+	if err != nil {
+		return err
+	}
+	id, err := res.LastInsertId()
+	if err != nil {
+		return err
+	}
+	e.ID = int(id)
+
+	note := "Waste: " + e.Reason
+	if e.IngredientID != nil {
+		lines = []models.RecipeLine{{IngredientID: *e.IngredientID, Quantity: 1}}
+	}
+	for _, l := range lines {
+		m := models.IngredientMovement{
+			IngredientID:  l.IngredientID,
+			Quantity:      -l.Quantity * e.Quantity,
+			Reason:        "waste",
+			ReferenceType: "waste",
+			ReferenceID:   &e.ID,
+			Note:          note,
+			ActorID:       e.RecordedBy,
+		}
+		if err := moveIngredientTx(tx, &m); err != nil {
+			return err
+		}
+		if m.Balance < 0 {
+			return ErrStockBelowZero
+		}
+	}
+	if len(lines) > 0 {
+		return nil
+	}
+
+	m := models.StockMovement{
+		ProductID:     *e.ProductID,
+		Quantity:      -int(e.Quantity),
+		Reason:        "waste",
+		ReferenceType: "waste",
+		ReferenceID:   &e.ID,
+		Note:          note,
+		ActorID:       e.RecordedBy,
+	}
+	if e.LotID != nil {
+		m.Lot = &models.StockLot{ID: *e.LotID}
+	}
+	if err := moveStockTx(tx, &m); err != nil {
+		return err
+	}
+	if m.Balance < 0 {
+		return ErrStockBelowZero
+	}
+	return nil
+}
+
+// recipeCostTx returns what the ingredients of one portion cost
+func recipeCostTx(tx *sql.Tx, lines []models.RecipeLine) (float64, error) {
+	var cost float64
+	for _, l := range lines {
+		var unitCost float64
+		err := tx.QueryRow("SELECT unit_cost FROM ingredients WHERE id = ?",
+			l.IngredientID).Scan(&unitCost)
+		if err != nil && err != sql.ErrNoRows {
+			return 0, err
+		}
+		cost += l.Quantity * unitCost
+	}
+	return math.Round(cost*10000) / 10000, nil
+}
+
+// FetchWasteEntries retrieves the newest waste entries, optionally only
+// those for a product, an ingredient or a reason
+func FetchWasteEntries(productID, ingredientID int, reason string, limit int) ([]models.WasteEntry, error) {
+	rows, err := db.Query(`SELECT w.id, w.product_id, w.ingredient_id, w.lot_id,
+			COALESCE(p.name, i.name, ''), COALESCE(i.unit, ''), w.portion_size,
+			w.quantity, w.reason, w.note, w.unit_cost, w.cost, w.staff_id,
+			COALESCE(u.name, u.email, ''), w.recorded_by, w.created_at
+		FROM waste_entries w
+		LEFT JOIN products p ON p.id = w.product_id
+		LEFT JOIN ingredients i ON i.id = w.ingredient_id
+		LEFT JOIN users u ON u.id = w.staff_id
+		WHERE (? = 0 OR w.product_id = ?) AND (? = 0 OR w.ingredient_id = ?)
+			AND (? = '' OR w.reason = ?)
+		ORDER BY w.id DESC LIMIT ?`, productID, productID, ingredientID,
+		ingredientID, reason, reason, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	entries := []models.WasteEntry{}
+	for rows.Next() {
+		var e models.WasteEntry
+		var productID, ingredientID, lotID, staffID, recordedBy sql.NullInt64
+		if err := rows.Scan(&e.ID, &productID, &ingredientID, &lotID, &e.Name,
+			&e.Unit, &e.PortionSize, &e.Quantity, &e.Reason, &e.Note, &e.UnitCost, &e.Cost,
+			&staffID, &e.StaffName, &recordedBy, &e.CreatedAt); err != nil {
+			return nil, err
+		}
+		e.ProductID, e.IngredientID = nullIntPtr(productID), nullIntPtr(ingredientID)
+		e.LotID = nullIntPtr(lotID)
+		e.StaffID, e.RecordedBy = nullIntPtr(staffID), nullIntPtr(recordedBy)
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// FetchWasteReport totals the waste of the last days days by reason and by
+// product or ingredient, costliest first, against net sales over the same
+// days
+func FetchWasteReport(days int) (*models.WasteReport, error) {
+	since := fmt.Sprintf("-%d days", days)
+	report := &models.WasteReport{
+		Days:    days,
+		Reasons: []models.WasteReasonTotal{},
+		Items:   []models.WasteItem{},
+	}
+
+	err := db.QueryRow(`SELECT COALESCE(SUM(`+orderRevenue+`), 0)
+		FROM orders
+		WHERE status != 'cancelled'
+			AND created_at >= date('now', ?)`, since).Scan(&report.Sales)
+	if err != nil {
+		return nil, err
+	}
+
+	rows, err := db.Query(`SELECT reason, COUNT(*), SUM(cost)
+		FROM waste_entries WHERE created_at >= date('now', ?)
+		GROUP BY reason ORDER BY SUM(cost) DESC, reason`, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var t models.WasteReasonTotal
+		if err := rows.Scan(&t.Reason, &t.Entries, &t.Cost); err != nil {
+			return nil, err
+		}
+		t.Cost = roundCents(t.Cost)
+		report.WasteCost += t.Cost
+		report.Reasons = append(report.Reasons, t)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	rows, err = db.Query(`SELECT w.product_id, w.ingredient_id,
+			COALESCE(p.name, i.name, ''), COALESCE(i.unit, ''), COUNT(*),
+			SUM(w.quantity), SUM(w.cost),
+			CASE WHEN w.product_id IS NULL THEN 0 ELSE COALESCE((
+				SELECT SUM((oi.quantity - oi.refunded_quantity) *
+					COALESCE(oi.unit_price, p.price))
+				FROM order_items oi JOIN orders o ON o.id = oi.order_id
+				WHERE oi.product_id = w.product_id
+					AND o.status != 'cancelled'
+					AND o.created_at >= date('now', ?)), 0) END
+		FROM waste_entries w
+		LEFT JOIN products p ON p.id = w.product_id
+		LEFT JOIN ingredients i ON i.id = w.ingredient_id
+		WHERE w.created_at >= date('now', ?)
+		GROUP BY w.product_id, w.ingredient_id`, since, since)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var item models.WasteItem
+		var productID, ingredientID sql.NullInt64
+		if err := rows.Scan(&productID, &ingredientID, &item.Name, &item.Unit,
+			&item.Entries, &item.Quantity, &item.Cost, &item.Sales); err != nil {
+			return nil, err
+		}
+		item.ProductID, item.IngredientID = nullIntPtr(productID), nullIntPtr(ingredientID)
+		item.Quantity = math.Round(item.Quantity*1000) / 1000
+		item.Cost, item.Sales = roundCents(item.Cost), roundCents(item.Sales)
+		if item.IngredientID != nil {
+			// Ingredients go into many dishes, so they are set against all sales
+			item.Sales = report.Sales
+		}
+		item.WastePercent = wastePercent(item.Cost, item.Sales)
+		report.Items = append(report.Items, item)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	sort.SliceStable(report.Items, func(i, j int) bool {
+		return report.Items[i].Cost > report.Items[j].Cost
+	})
+
+	report.WasteCost = roundCents(report.WasteCost)
+	if p := wastePercent(report.WasteCost, report.Sales); p != nil {
+		report.WastePercent = *p
+	}
+	return report, nil
+}
+
+// wastePercent is a waste cost as a percent of sales, nil without sales
+func wastePercent(cost, sales float64) *float64 {
+	if sales <= 0 {
+		return nil
+	}
+	p := math.Round(cost/sales*10000) / 100
+	return &p
+}
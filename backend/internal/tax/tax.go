@@ -0,0 +1,119 @@
+// Package tax works out the sales tax on an order. Rates are set per
+// menu category, with separate rates for dine-in and takeaway, and menu
+// prices either include tax or have it added at checkout.
+package tax
+
+import (
+	"fmt"
+	"math"
+	"os"
+	"strconv"
+
+	"restaurant-backend/internal/models"
+)
+
+// Order types, which can be taxed at different rates
+const (
+	DineIn   = "dine_in"
+	Takeaway = "takeaway"
+)
+
+// Config is the tax configuration that is not per rate
+type Config struct {
+	// PricesIncludeTax is true when menu prices already include tax, so tax
+	// is worked out of the price rather than added to it
+	PricesIncludeTax bool
+}
+
+// Settings is the active configuration, see LoadConfig
+var Settings = Config{}
+
+// LoadConfig reads TAX_PRICES_INCLUDE_TAX, keeping the default (tax added
+// at checkout) when it is unset
+func LoadConfig() error {
+	if v := os.Getenv("TAX_PRICES_INCLUDE_TAX"); v != "" {
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return fmt.Errorf("invalid TAX_PRICES_INCLUDE_TAX %q", v)
+		}
+		Settings.PricesIncludeTax = b
+	}
+	return nil
+}
+
+// ValidOrderType reports whether t is an order type
+func ValidOrderType(t string) bool {
+	return t == DineIn || t == Takeaway
+}
+
+// RateFor returns the percentage rate for a category and order type. The
+// rate with an empty category applies to categories without their own;
+// with neither there is no tax.
+func RateFor(rates []models.TaxRate, category, orderType string) float64 {
+	var fallback *models.TaxRate
+	for i := range rates {
+		switch rates[i].Category {
+		case category:
+			return rateFor(rates[i], orderType)
+		case "":
+			fallback = &rates[i]
+		}
+	}
+	if fallback != nil {
+		return rateFor(*fallback, orderType)
+	}
+	return 0
+}
+
+func rateFor(r models.TaxRate, orderType string) float64 {
+	if orderType == DineIn {
+		return r.DineInRate
+	}
+	return r.TakeawayRate
+}
+
+// Line is the amount charged for one order line after discounts
+type Line struct {
+	Category string
+	Amount   float64
+}
+
+// LineTax is the tax on one line. Taxable excludes the tax; with
+// tax-inclusive prices Taxable plus Tax is the line's amount.
+type LineTax struct {
+	Rate    float64
+	Taxable float64
+	Tax     float64
+}
+
+// Calculate works out the tax on each line, rounding per line
+func Calculate(lines []Line, rates []models.TaxRate, orderType string, inclusive bool) []LineTax {
+	result := make([]LineTax, len(lines))
+	for i, l := range lines {
+		rate := RateFor(rates, l.Category, orderType)
+		lt := LineTax{Rate: rate, Taxable: round(l.Amount)}
+		if rate > 0 && l.Amount > 0 {
+			if inclusive {
+				lt.Taxable = round(l.Amount / (1 + rate/100))
+				lt.Tax = round(l.Amount - lt.Taxable)
+			} else {
+				lt.Tax = round(l.Amount * rate / 100)
+			}
+		}
+		result[i] = lt
+	}
+	return result
+}
+
+// Total returns the tax on all lines
+func Total(lines []LineTax) float64 {
+	var sum float64
+	for _, l := range lines {
+		sum += l.Tax
+	}
+	return round(sum)
+}
+
+func round(amount float64) float64 {
+	return math.Round(amount*100) / 100
+}
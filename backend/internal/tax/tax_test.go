@@ -0,0 +1,114 @@
+package tax
+
+import (
+	"testing"
+
+	"restaurant-backend/internal/models"
+)
+
+var rates = []models.TaxRate{
+	{Category: "", Name: "Standard", DineInRate: 10, TakeawayRate: 8},
+	{Category: "drinks", Name: "Drinks", DineInRate: 20, TakeawayRate: 20},
+	{Category: "groceries", Name: "Zero rated", DineInRate: 0, TakeawayRate: 0},
+}
+
+func TestRateFor(t *testing.T) {
+	tests := []struct {
+		name      string
+		rates     []models.TaxRate
+		category  string
+		orderType string
+		want      float64
+	}{
+		{"own rate", rates, "drinks", Takeaway, 20},
+		{"own zero rate", rates, "groceries", DineIn, 0},
+		{"fallback dine-in", rates, "western", DineIn, 10},
+		{"fallback takeaway", rates, "western", Takeaway, 8},
+		{"no rates", nil, "western", DineIn, 0},
+		{"no fallback", rates[1:], "western", DineIn, 0},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := RateFor(tt.rates, tt.category, tt.orderType); got != tt.want {
+				t.Errorf("RateFor = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestCalculate(t *testing.T) {
+	tests := []struct {
+		name      string
+		lines     []Line
+		orderType string
+		inclusive bool
+		want      []LineTax
+		wantTotal float64
+	}{
+		{
+			name:      "added at checkout",
+			lines:     []Line{{Category: "western", Amount: 10}, {Category: "drinks", Amount: 3.5}},
+			orderType: DineIn,
+			want:      []LineTax{{Rate: 10, Taxable: 10, Tax: 1}, {Rate: 20, Taxable: 3.5, Tax: 0.7}},
+			wantTotal: 1.7,
+		},
+		{
+			name:      "rounded per line",
+			lines:     []Line{{Category: "western", Amount: 0.06}, {Category: "western", Amount: 0.06}},
+			orderType: Takeaway,
+			want:      []LineTax{{Rate: 8, Taxable: 0.06, Tax: 0}, {Rate: 8, Taxable: 0.06, Tax: 0}},
+			wantTotal: 0,
+		},
+		{
+			name:      "half a cent rounds up",
+			lines:     []Line{{Category: "western", Amount: 0.25}},
+			orderType: DineIn,
+			want:      []LineTax{{Rate: 10, Taxable: 0.25, Tax: 0.03}},
+			wantTotal: 0.03,
+		},
+		{
+			name:      "included in the price",
+			lines:     []Line{{Category: "western", Amount: 10}},
+			orderType: DineIn,
+			inclusive: true,
+			want:      []LineTax{{Rate: 10, Taxable: 9.09, Tax: 0.91}},
+			wantTotal: 0.91,
+		},
+		{
+			name:      "included parts add up to the price",
+			lines:     []Line{{Category: "drinks", Amount: 4.99}},
+			orderType: Takeaway,
+			inclusive: true,
+			want:      []LineTax{{Rate: 20, Taxable: 4.16, Tax: 0.83}},
+			wantTotal: 0.83,
+		},
+		{
+			name:      "zero rate",
+			lines:     []Line{{Category: "groceries", Amount: 7.5}},
+			orderType: DineIn,
+			want:      []LineTax{{Rate: 0, Taxable: 7.5, Tax: 0}},
+		},
+		{
+			name:      "fully discounted line",
+			lines:     []Line{{Category: "western", Amount: 0}},
+			orderType: DineIn,
+			want:      []LineTax{{Rate: 10, Taxable: 0, Tax: 0}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := Calculate(tt.lines, rates, tt.orderType, tt.inclusive)
+			if len(got) != len(tt.want) {
+				t.Fatalf("got %d lines, want %d", len(got), len(tt.want))
+			}
+			for i := range got {
+				if got[i] != tt.want[i] {
+					t.Errorf("line %d = %+v, want %+v", i, got[i], tt.want[i])
+				}
+			}
+			if total := Total(got); total != tt.wantTotal {
+				t.Errorf("Total = %v, want %v", total, tt.wantTotal)
+			}
+		})
+	}
+}
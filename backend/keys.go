@@ -0,0 +1,251 @@
+package main
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"log/slog"
+	"math/big"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/golang-jwt/jwt/v5"
+
+	"restaurant-backend/internal/models"
+)
+
+// defaultJWTSecret is the development fallback. The server refuses to start
+// with it unless APP_ENV is development.
+const defaultJWTSecret = "dev-secret-change-in-production"
+
+// verificationKey is a key that tokens may be checked against
+type verificationKey struct {
+	method jwt.SigningMethod
+	public crypto.PublicKey // []byte for HS256
+}
+
+// keyring holds the key used to sign new tokens and every key that is still
+// accepted for verification, indexed by kid. During a rotation the old key
+// stays in verify until all tokens signed with it have expired.
+type keyring struct {
+	signingKID    string
+	signingMethod jwt.SigningMethod
+	signingKey    any
+	verify        map[string]verificationKey
+}
+
+var keys atomic.Pointer[keyring]
+
+// isDevMode reports whether APP_ENV marks this as a development instance
+func isDevMode() bool {
+	env := strings.ToLower(os.Getenv("APP_ENV"))
+	return env == "development" || env == "dev"
+}
+
+// loadKeyring builds the keyring from the environment.
+//
+// With JWT_KEYS_DIR set, every *.pem file in that directory is loaded and its
+// file name (without extension) becomes its kid. Private keys (RSA or
+// Ed25519, PKCS#1/PKCS#8) can sign and verify; public keys (PKIX) only
+// verify, which lets a retired or not-yet-active key stay published.
+// JWT_SIGNING_KID picks the signing key and may be omitted when the
+// directory holds exactly one private key.
+//
+// Without JWT_KEYS_DIR the legacy HS256 JWT_SECRET is used.
+func loadKeyring() (*keyring, error) {
+	dir := os.Getenv("JWT_KEYS_DIR")
+	if dir == "" {
+		secret := os.Getenv("JWT_SECRET")
+		if secret == "" || secret == defaultJWTSecret {
+			if !isDevMode() {
+				return nil, errors.New("JWT_KEYS_DIR or a non-default JWT_SECRET " +
+					"is required outside development (set APP_ENV=development for local use)")
+			}
+			secret = defaultJWTSecret
+			slog.Warn("using default development JWT secret")
+		}
+		return &keyring{
+			signingKID:    "hs256",
+			signingMethod: jwt.SigningMethodHS256,
+			signingKey:    []byte(secret),
+			verify: map[string]verificationKey{
+				"hs256": {method: jwt.SigningMethodHS256, public: []byte(secret)},
+			},
+		}, nil
+	}
+
+	files, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+
+	kr := &keyring{verify: map[string]verificationKey{}}
+	private := map[string]any{}
+	for _, f := range files {
+		kid := strings.TrimSuffix(filepath.Base(f), ".pem")
+		priv, pub, err := parseKeyFile(f)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+
+		method, err := methodForKey(pub)
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", f, err)
+		}
+		kr.verify[kid] = verificationKey{method: method, public: pub}
+		if priv != nil {
+			private[kid] = priv
+		}
+	}
+
+	kr.signingKID = os.Getenv("JWT_SIGNING_KID")
+	if kr.signingKID == "" {
+		if len(private) != 1 {
+			return nil, fmt.Errorf("JWT_SIGNING_KID must be set when %s holds %d private keys",
+				dir, len(private))
+		}
+		for kid := range private {
+			kr.signingKID = kid
+		}
+	}
+
+	priv, ok := private[kr.signingKID]
+	if !ok {
+		return nil, fmt.Errorf("no private key for signing kid %q in %s",
+			kr.signingKID, dir)
+	}
+	kr.signingKey = priv
+	kr.signingMethod = kr.verify[kr.signingKID].method
+
+	return kr, nil
+}
+
+// parseKeyFile reads a PEM file and returns the private key (nil for public
+// key files) and the public key
+func parseKeyFile(path string) (any, crypto.PublicKey, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, nil, errors.New("no PEM block found")
+	}
+
+	switch block.Type {
+	case "PRIVATE KEY":
+		key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		signer, ok := key.(crypto.Signer)
+		if !ok {
+			return nil, nil, errors.New("unsupported private key type")
+		}
+		return key, signer.Public(), nil
+	case "RSA PRIVATE KEY":
+		key, err := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if err != nil {
+			return nil, nil, err
+		}
+		return key, key.Public(), nil
+	case "PUBLIC KEY":
+		key, err := x509.ParsePKIXPublicKey(block.Bytes)
+		return nil, key, err
+	default:
+		return nil, nil, fmt.Errorf("unsupported PEM block %q", block.Type)
+	}
+}
+
+// methodForKey maps a public key to the JWT algorithm we sign it with
+func methodForKey(pub crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch k := pub.(type) {
+	case *rsa.PublicKey:
+		if k.N.BitLen() < 2048 {
+			return nil, errors.New("RSA keys must be at least 2048 bits")
+		}
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", pub)
+	}
+}
+
+// initKeys loads the keyring and reloads it on SIGHUP so keys can be rotated
+// without dropping connections
+func initKeys() error {
+	kr, err := loadKeyring()
+	if err != nil {
+		return err
+	}
+	keys.Store(kr)
+	slog.Info("loaded JWT keys", "signing_kid", kr.signingKID,
+		"alg", kr.signingMethod.Alg(), "verification_keys", len(kr.verify))
+
+	hup := make(chan os.Signal, 1)
+	signal.Notify(hup, syscall.SIGHUP)
+	go func() {
+		for range hup {
+			kr, err := loadKeyring()
+			if err != nil {
+				slog.Error("failed to reload JWT keys, keeping current keys",
+					"error", err)
+				continue
+			}
+			keys.Store(kr)
+			slog.Info("reloaded JWT keys", "signing_kid", kr.signingKID,
+				"verification_keys", len(kr.verify))
+		}
+	}()
+	return nil
+}
+
+// jwksHandler handles GET /.well-known/jwks.json. Symmetric keys are never
+// published, so the set is empty when running on JWT_SECRET.
+func jwksHandler(w http.ResponseWriter, r *http.Request) {
+	kr := keys.Load()
+
+	kids := make([]string, 0, len(kr.verify))
+	for kid := range kr.verify {
+		kids = append(kids, kid)
+	}
+	sort.Strings(kids)
+
+	set := models.JSONWebKeySet{Keys: []models.JSONWebKey{}}
+	for _, kid := range kids {
+		vk := kr.verify[kid]
+		jwk := models.JSONWebKey{KeyID: kid, Use: "sig", Algorithm: vk.method.Alg()}
+		switch k := vk.public.(type) {
+		case *rsa.PublicKey:
+			jwk.KeyType = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(k.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(
+				big.NewInt(int64(k.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.KeyType = "OKP"
+			jwk.Curve = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(k)
+		default:
+			continue
+		}
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "public, max-age=300")
+	json.NewEncoder(w).Encode(set)
+}
@@ -13,15 +13,22 @@ import (
 	"github.com/joho/godotenv"
 
 	"restaurant-backend/internal/handlers"
+	"restaurant-backend/internal/inventory"
+	"restaurant-backend/internal/kitchen"
+	"restaurant-backend/internal/loyalty"
+	"restaurant-backend/internal/mailer"
+	"restaurant-backend/internal/payments"
+	"restaurant-backend/internal/receipt"
 	"restaurant-backend/internal/repository"
+	"restaurant-backend/internal/tax"
 )
 
 // CORS middleware
 func enableCORS(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Access-Control-Allow-Origin", "*")
-		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+		w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key")
 
 		if r.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
@@ -82,31 +89,105 @@ func main() {
 		slog.Error("No .env file found, relying on system environment variables")
 	}
 
+	if err := initAuth(); err != nil {
+		slog.Error("failed to initialize auth", "error", err)
+		os.Exit(1)
+	}
+
+	provider, err := payments.FromEnv(isDevMode())
+	if err != nil {
+		slog.Error("failed to configure payments", "error", err)
+		os.Exit(1)
+	}
+	handlers.SetPaymentProvider(provider)
+
+	outbox, err := mailer.FromEnv(isDevMode())
+	if err != nil {
+		slog.Error("failed to configure mail", "error", err)
+		os.Exit(1)
+	}
+	handlers.SetMailer(outbox)
+	receipt.LoadConfig()
+	if err := kitchen.LoadConfig(); err != nil {
+		slog.Error("failed to load kitchen printers", "error", err)
+		os.Exit(1)
+	}
+
+	if err := loyalty.LoadConfig(); err != nil {
+		slog.Error("failed to load loyalty settings", "error", err)
+		os.Exit(1)
+	}
+	if err := tax.LoadConfig(); err != nil {
+		slog.Error("failed to load tax settings", "error", err)
+		os.Exit(1)
+	}
+	if err := inventory.LoadConfig(); err != nil {
+		slog.Error("failed to load reorder settings", "error", err)
+		os.Exit(1)
+	}
+
 	repository.InitDB()
+	handlers.StartPromoHub()
+	handlers.StartKitchenPrinting()
+	handlers.StartLotExpiry()
 
 	r := mux.NewRouter()
 	r.Use(loggingMiddleware)
 
 	// Public routes
-	r.HandleFunc("/api/promos", handlers.GetPromosSSE).Methods("GET")
+	r.Handle("/api/promos",
+		optionalAuthMiddleware(http.HandlerFunc(handlers.GetPromosSSE))).Methods("GET")
 	r.HandleFunc("/api/products", handlers.GetProducts).Methods("GET")
 	r.HandleFunc("/api/products/category/{category}",
 		handlers.GetProductsByCategory).Methods("GET")
 	r.HandleFunc("/api/products/{id}", handlers.GetProduct).Methods("GET")
 	r.HandleFunc("/api/feedback", handlers.SubmitFeedback).Methods("POST")
 	r.HandleFunc("/api/feedback", handlers.GetFeedback).Methods("GET")
+	r.Handle("/api/cart/quote",
+		optionalAuthMiddleware(http.HandlerFunc(handlers.QuoteCart))).Methods("POST")
+	r.HandleFunc("/api/gift-cards/balance",
+		handlers.CheckGiftCardBalance).Methods("POST")
+	r.HandleFunc("/api/payments/webhook", handlers.PaymentWebhook).Methods("POST")
+	r.HandleFunc("/api/payments/config", handlers.GetPaymentConfig).Methods("GET")
+
+	r.HandleFunc("/.well-known/jwks.json", jwksHandler).Methods("GET")
 
 	// Auth routes
 	r.HandleFunc("/api/auth/register", registerHandler).Methods("POST")
 	r.HandleFunc("/api/auth/login", loginHandler).Methods("POST")
+	r.HandleFunc("/api/auth/verify-email", verifyEmailHandler).Methods("POST")
+	r.HandleFunc("/api/auth/login/2fa", loginTwoFactorHandler).Methods("POST")
+	r.HandleFunc("/api/auth/oidc/providers", oidcProvidersHandler).Methods("GET")
+	r.HandleFunc("/api/auth/oidc/{provider}/login", oidcLoginHandler).Methods("GET")
+	r.HandleFunc("/api/auth/oidc/{provider}/callback",
+		oidcCallbackHandler).Methods("GET")
+
+	// 2FA enrollment also accepts the interim token given to admins who
+	// have not set up 2FA yet
+	r.Handle("/api/auth/2fa/enroll",
+		enrollmentMiddleware(http.HandlerFunc(enroll2FAHandler))).Methods("POST")
+	r.Handle("/api/auth/2fa/confirm",
+		enrollmentMiddleware(http.HandlerFunc(confirm2FAHandler))).Methods("POST")
+	r.Handle("/api/auth/change-password",
+		passwordChangeMiddleware(http.HandlerFunc(changePasswordHandler))).Methods("POST")
 
 	// Protected routes (require auth)
 	authRouter := r.PathPrefix("/api").Subrouter()
 	authRouter.Use(authMiddleware)
 	authRouter.HandleFunc("/auth/me", getMeHandler).Methods("GET")
+	authRouter.HandleFunc("/auth/me", updateMeHandler).Methods("PATCH")
+	authRouter.HandleFunc("/auth/me", deleteMeHandler).Methods("DELETE")
+	authRouter.HandleFunc("/auth/me/export", exportMeHandler).Methods("GET")
+	authRouter.HandleFunc("/auth/2fa/disable", disable2FAHandler).Methods("POST")
+	authRouter.HandleFunc("/auth/2fa/recovery-codes",
+		regenerateRecoveryCodesHandler).Methods("POST")
 	authRouter.HandleFunc("/orders", handlers.CreateOrder).Methods("POST")
 	authRouter.HandleFunc("/orders/user/{userId}",
 		handlers.GetUserOrders).Methods("GET")
+	authRouter.HandleFunc("/orders/{id}/receipt", handlers.GetReceipt).Methods("GET")
+	authRouter.HandleFunc("/orders/{id}/receipt/email",
+		handlers.EmailReceipt).Methods("POST")
+	authRouter.HandleFunc("/loyalty", handlers.GetLoyalty).Methods("GET")
 
 	// Admin routes (require admin role)
 	adminRouter := r.PathPrefix("/api").Subrouter()
@@ -123,6 +204,134 @@ func main() {
 		handlers.DeleteProduct).Methods("DELETE")
 	adminRouter.HandleFunc("/products/{id}/supply",
 		handlers.OrderSupplies).Methods("POST")
+	adminRouter.HandleFunc("/products/{id}/stock-movements",
+		handlers.GetStockMovements).Methods("GET")
+	adminRouter.HandleFunc("/products/{id}/stock-adjustments",
+		handlers.AdjustStock).Methods("POST")
+	adminRouter.HandleFunc("/products/{id}/lots", handlers.ListStockLots).Methods("GET")
+	adminRouter.HandleFunc("/products/{id}/recipe", handlers.GetRecipe).Methods("GET")
+	adminRouter.HandleFunc("/products/{id}/recipe", handlers.SetRecipe).Methods("PUT")
+	adminRouter.HandleFunc("/inventory/reorder-suggestions",
+		handlers.GetReorderSuggestions).Methods("GET")
+	adminRouter.HandleFunc("/inventory/reorder-suggestions/convert",
+		handlers.ConvertReorderSuggestions).Methods("POST")
+	adminRouter.HandleFunc("/admin/ingredients", handlers.ListIngredients).Methods("GET")
+	adminRouter.HandleFunc("/admin/ingredients",
+		handlers.CreateIngredient).Methods("POST")
+	adminRouter.HandleFunc("/admin/ingredients/{id}",
+		handlers.UpdateIngredient).Methods("PUT")
+	adminRouter.HandleFunc("/admin/ingredients/{id}/movements",
+		handlers.GetIngredientMovements).Methods("GET")
+	adminRouter.HandleFunc("/admin/ingredients/{id}/adjustments",
+		handlers.AdjustIngredientStock).Methods("POST")
+	adminRouter.HandleFunc("/admin/waste", handlers.ListWaste).Methods("GET")
+	adminRouter.HandleFunc("/admin/waste", handlers.RecordWaste).Methods("POST")
+	adminRouter.HandleFunc("/admin/stock-counts",
+		handlers.ListStockCounts).Methods("GET")
+	adminRouter.HandleFunc("/admin/stock-counts",
+		handlers.CreateStockCount).Methods("POST")
+	adminRouter.HandleFunc("/admin/stock-counts/{id}",
+		handlers.GetStockCount).Methods("GET")
+	adminRouter.HandleFunc("/admin/stock-counts/{id}/lines",
+		handlers.RecordStockCounts).Methods("PUT")
+	adminRouter.HandleFunc("/admin/stock-counts/{id}/post",
+		handlers.PostStockCount).Methods("POST")
+	adminRouter.HandleFunc("/admin/stock-counts/{id}/cancel",
+		handlers.CancelStockCount).Methods("POST")
+	adminRouter.HandleFunc("/admin/suppliers", handlers.ListSuppliers).Methods("GET")
+	adminRouter.HandleFunc("/admin/suppliers", handlers.CreateSupplier).Methods("POST")
+	adminRouter.HandleFunc("/admin/suppliers/{id}",
+		handlers.UpdateSupplier).Methods("PUT")
+	adminRouter.HandleFunc("/admin/purchase-orders",
+		handlers.ListPurchaseOrders).Methods("GET")
+	adminRouter.HandleFunc("/admin/purchase-orders",
+		handlers.CreatePurchaseOrder).Methods("POST")
+	adminRouter.HandleFunc("/admin/purchase-orders/{id}",
+		handlers.GetPurchaseOrder).Methods("GET")
+	adminRouter.HandleFunc("/admin/purchase-orders/{id}",
+		handlers.UpdatePurchaseOrder).Methods("PUT")
+	adminRouter.HandleFunc("/admin/purchase-orders/{id}/submit",
+		handlers.SubmitPurchaseOrder).Methods("POST")
+	adminRouter.HandleFunc("/admin/purchase-orders/{id}/receive",
+		handlers.ReceivePurchaseOrder).Methods("POST")
+	adminRouter.HandleFunc("/admin/purchase-orders/{id}/cancel",
+		handlers.CancelPurchaseOrder).Methods("POST")
+	adminRouter.HandleFunc("/admin/users", handlers.ListUsers).Methods("GET")
+	adminRouter.HandleFunc("/admin/users/{id}",
+		handlers.GetUserDetail).Methods("GET")
+	adminRouter.HandleFunc("/admin/users/{id}",
+		handlers.DeleteUser).Methods("DELETE")
+	adminRouter.HandleFunc("/admin/users/{id}/orders",
+		handlers.GetUserOrdersAdmin).Methods("GET")
+	adminRouter.HandleFunc("/admin/users/{id}/feedback",
+		handlers.GetUserFeedbackAdmin).Methods("GET")
+	adminRouter.HandleFunc("/admin/users/{id}/role",
+		handlers.UpdateUserRole).Methods("PUT")
+	adminRouter.HandleFunc("/admin/users/{id}/disable",
+		handlers.DisableUser).Methods("POST")
+	adminRouter.HandleFunc("/admin/users/{id}/enable",
+		handlers.EnableUser).Methods("POST")
+	adminRouter.HandleFunc("/admin/users/{id}/reset-password",
+		handlers.ForcePasswordReset).Methods("POST")
+	adminRouter.HandleFunc("/admin/users/{id}/loyalty",
+		handlers.GetUserLoyaltyAdmin).Methods("GET")
+	adminRouter.HandleFunc("/admin/users/{id}/loyalty/adjust",
+		handlers.AdjustUserLoyalty).Methods("POST")
+	adminRouter.HandleFunc("/reports/tips", handlers.GetTipSummary).Methods("GET")
+	adminRouter.HandleFunc("/reports/waste", handlers.GetWasteReport).Methods("GET")
+	adminRouter.HandleFunc("/admin/service-charges",
+		handlers.GetServiceChargeRules).Methods("GET")
+	adminRouter.HandleFunc("/admin/service-charges",
+		handlers.UpdateServiceChargeRules).Methods("PUT")
+	adminRouter.HandleFunc("/admin/tax-rates", handlers.GetTaxRates).Methods("GET")
+	adminRouter.HandleFunc("/admin/tax-rates", handlers.UpdateTaxRates).Methods("PUT")
+	adminRouter.HandleFunc("/orders/{id}/refunds", handlers.CreateRefund).Methods("POST")
+	adminRouter.HandleFunc("/orders/{id}/refunds", handlers.ListRefunds).Methods("GET")
+	adminRouter.HandleFunc("/orders/{id}/refunds/{refundId}/retry",
+		handlers.RetryRefund).Methods("POST")
+	adminRouter.HandleFunc("/admin/orders/{id}/status",
+		handlers.UpdateOrderStatus).Methods("PUT")
+	adminRouter.HandleFunc("/admin/orders/{id}/payments",
+		handlers.GetOrderPayments).Methods("GET")
+	adminRouter.HandleFunc("/admin/kitchen/tickets",
+		handlers.ListKitchenTickets).Methods("GET")
+	adminRouter.HandleFunc("/admin/kitchen/tickets/{id}/reprint",
+		handlers.ReprintKitchenTicket).Methods("POST")
+	adminRouter.HandleFunc("/admin/audit", handlers.GetAuditLog).Methods("GET")
+	adminRouter.HandleFunc("/admin/api-keys", handlers.ListAPIKeys).Methods("GET")
+	adminRouter.HandleFunc("/admin/api-keys", handlers.CreateAPIKey).Methods("POST")
+	adminRouter.HandleFunc("/admin/api-keys/{id}",
+		handlers.RevokeAPIKey).Methods("DELETE")
+	adminRouter.HandleFunc("/admin/promotions",
+		handlers.ListPromotions).Methods("GET")
+	adminRouter.HandleFunc("/admin/promotions",
+		handlers.CreatePromotion).Methods("POST")
+	adminRouter.HandleFunc("/admin/coupons", handlers.ListCoupons).Methods("GET")
+	adminRouter.HandleFunc("/admin/coupons", handlers.CreateCoupon).Methods("POST")
+	adminRouter.HandleFunc("/admin/coupons/{id}",
+		handlers.GetCoupon).Methods("GET")
+	adminRouter.HandleFunc("/admin/coupons/{id}",
+		handlers.UpdateCoupon).Methods("PUT")
+	adminRouter.HandleFunc("/admin/coupons/{id}",
+		handlers.DeleteCoupon).Methods("DELETE")
+	adminRouter.HandleFunc("/admin/gift-cards",
+		handlers.ListGiftCards).Methods("GET")
+	adminRouter.HandleFunc("/admin/gift-cards",
+		handlers.IssueGiftCard).Methods("POST")
+	adminRouter.HandleFunc("/admin/gift-cards/liability",
+		handlers.GetGiftCardLiability).Methods("GET")
+	adminRouter.HandleFunc("/admin/gift-cards/{id}",
+		handlers.GetGiftCard).Methods("GET")
+	adminRouter.HandleFunc("/admin/gift-cards/{id}/void",
+		handlers.VoidGiftCard).Methods("POST")
+	adminRouter.HandleFunc("/admin/promotions/clients",
+		handlers.GetPromoClients).Methods("GET")
+	adminRouter.HandleFunc("/admin/promotions/{id}",
+		handlers.GetPromotion).Methods("GET")
+	adminRouter.HandleFunc("/admin/promotions/{id}",
+		handlers.UpdatePromotion).Methods("PUT")
+	adminRouter.HandleFunc("/admin/promotions/{id}",
+		handlers.DeletePromotion).Methods("DELETE")
 
 	// Apply CORS middleware
 	handler := enableCORS(r)
@@ -0,0 +1,235 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/gorilla/mux"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/oidc"
+	"restaurant-backend/internal/repository"
+)
+
+// oidcStateTTLMinutes bounds how long a user may take at the provider
+const oidcStateTTLMinutes = 10
+
+var oidcProviders map[string]*oidc.Provider
+
+// errOIDCLogin is shown to users for any failure they cannot act on
+var errOIDCLogin = errors.New("sign-in with the external provider failed")
+
+// oidcProvidersHandler handles GET /api/auth/oidc/providers so the frontend
+// knows which sign-in buttons to show
+func oidcProvidersHandler(w http.ResponseWriter, r *http.Request) {
+	names := make([]string, 0, len(oidcProviders))
+	for name := range oidcProviders {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(names)
+}
+
+// oidcLoginHandler handles GET /api/auth/oidc/{provider}/login and redirects
+// the browser to the provider
+func oidcLoginHandler(w http.ResponseWriter, r *http.Request) {
+	provider, ok := oidcProviders[mux.Vars(r)["provider"]]
+	if !ok {
+		http.Error(w, "Unknown provider", http.StatusNotFound)
+		return
+	}
+
+	state, err := oidc.RandomString(24)
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	nonce, err := oidc.RandomString(24)
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+	verifier, err := oidc.NewPKCEVerifier()
+	if err != nil {
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	if err := repository.SaveOIDCState(state, repository.OIDCLoginState{
+		Provider:     provider.Name,
+		Nonce:        nonce,
+		CodeVerifier: verifier,
+	}, oidcStateTTLMinutes); err != nil {
+		slog.Error("failed to save oidc state", "error", err)
+		http.Error(w, "Failed to start login", http.StatusInternalServerError)
+		return
+	}
+
+	authURL, err := provider.AuthCodeURL(r.Context(), state, nonce, verifier)
+	if err != nil {
+		slog.Error("oidc discovery failed", "provider", provider.Name, "error", err)
+		http.Error(w, "Provider unavailable", http.StatusBadGateway)
+		return
+	}
+
+	http.Redirect(w, r, authURL, http.StatusFound)
+}
+
+// oidcCallbackHandler handles GET /api/auth/oidc/{provider}/callback. It
+// verifies the provider's response, links or creates the local user and
+// then continues exactly like a password login.
+func oidcCallbackHandler(w http.ResponseWriter, r *http.Request) {
+	providerName := mux.Vars(r)["provider"]
+	provider, ok := oidcProviders[providerName]
+	if !ok {
+		http.Error(w, "Unknown provider", http.StatusNotFound)
+		return
+	}
+
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		slog.Warn("oidc provider returned error", "provider", providerName,
+			"error", e, "description", q.Get("error_description"))
+		oidcFail(w, r, http.StatusUnauthorized, errOIDCLogin)
+		return
+	}
+
+	state, err := repository.ConsumeOIDCState(q.Get("state"))
+	if err != nil || state.Provider != providerName {
+		oidcFail(w, r, http.StatusBadRequest,
+			errors.New("login session expired, please try again"))
+		return
+	}
+
+	claims, err := provider.Exchange(r.Context(), q.Get("code"),
+		state.CodeVerifier, state.Nonce)
+	if err != nil {
+		slog.Warn("oidc code exchange failed", "provider", providerName,
+			"error", err)
+		oidcFail(w, r, http.StatusUnauthorized, errOIDCLogin)
+		return
+	}
+
+	user, status, err := findOrCreateOIDCUser(providerName, claims)
+	if err != nil {
+		oidcFail(w, r, status, err)
+		return
+	}
+	if user.Disabled {
+		oidcFail(w, r, http.StatusForbidden, errors.New("account is disabled"))
+		return
+	}
+
+	slog.Info("oidc login", "provider", providerName, "user_id", user.ID)
+
+	frontend := os.Getenv("OIDC_FRONTEND_REDIRECT")
+	if frontend == "" {
+		writeLoginResult(w, user, "fed")
+		return
+	}
+
+	body, _, err := loginResult(user, "fed")
+	if err != nil {
+		oidcFail(w, r, http.StatusInternalServerError, errOIDCLogin)
+		return
+	}
+
+	// Hand the result to the SPA in the fragment so it never reaches logs
+	fragment := url.Values{}
+	switch res := body.(type) {
+	case models.AuthResponse:
+		fragment.Set("token", res.Token)
+	case models.LoginChallenge:
+		fragment.Set("interimToken", res.InterimToken)
+		if res.EnrollmentRequired {
+			fragment.Set("enrollmentRequired", "true")
+		} else {
+			fragment.Set("twoFactorRequired", "true")
+		}
+	}
+	http.Redirect(w, r, frontend+"#"+fragment.Encode(), http.StatusFound)
+}
+
+// findOrCreateOIDCUser resolves the local user for a verified ID token.
+// Existing links win; otherwise an account with the same, provider-verified
+// email is linked, and failing that a new customer account is created.
+func findOrCreateOIDCUser(provider string, claims *oidc.IDTokenClaims) (*models.User, int, error) {
+	user, err := repository.GetUserByIdentity(provider, claims.Subject)
+	if err == nil {
+		return user, http.StatusOK, nil
+	}
+	if err != sql.ErrNoRows {
+		slog.Error("failed to look up identity", "error", err)
+		return nil, http.StatusInternalServerError, errOIDCLogin
+	}
+
+	email := strings.TrimSpace(claims.Email)
+	if email == "" || !claims.IsEmailVerified() {
+		return nil, http.StatusForbidden,
+			errors.New("the provider did not share a verified email address")
+	}
+
+	if existing, _ := repository.GetUserByEmail(email); existing != nil {
+		if err := repository.LinkIdentity(existing.ID, provider, claims.Subject,
+			email); err != nil {
+			slog.Error("failed to link identity", "error", err)
+			return nil, http.StatusInternalServerError, errOIDCLogin
+		}
+		slog.Info("linked external identity", "provider", provider,
+			"user_id", existing.ID)
+		return existing, http.StatusOK, nil
+	}
+
+	// The account has no usable password until the user sets one
+	randomPassword, err := generateRandomToken(32)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errOIDCLogin
+	}
+	hashedPassword, err := hashPassword(randomPassword)
+	if err != nil {
+		return nil, http.StatusInternalServerError, errOIDCLogin
+	}
+
+	name := strings.TrimSpace(claims.Name)
+	if name == "" {
+		name, _, _ = strings.Cut(email, "@")
+	}
+	if runes := []rune(name); len(runes) > maxNameLength {
+		name = string(runes[:maxNameLength])
+	}
+
+	user = &models.User{
+		Email:    email,
+		Password: hashedPassword,
+		Name:     name,
+		Role:     "customer",
+	}
+	if err := repository.CreateUserWithIdentity(user, provider,
+		claims.Subject); err != nil {
+		slog.Error("failed to create user from identity", "error", err)
+		return nil, http.StatusInternalServerError, errOIDCLogin
+	}
+	return user, http.StatusOK, nil
+}
+
+// oidcFail reports a failed login, back to the SPA when one is configured
+func oidcFail(w http.ResponseWriter, r *http.Request, status int, err error) {
+	frontend := os.Getenv("OIDC_FRONTEND_REDIRECT")
+	if frontend == "" {
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	fragment := url.Values{}
+	fragment.Set("error", err.Error())
+	http.Redirect(w, r, frontend+"#"+fragment.Encode(), http.StatusFound)
+}
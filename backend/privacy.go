@@ -0,0 +1,243 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+const (
+	// exportAuditLimit bounds how much of the audit trail goes into an export
+	exportAuditLimit = 1000
+	// deleteReauthWindow is how recent a login must be to delete an account
+	// without re-entering the password (e.g. for social-login accounts)
+	deleteReauthWindow = 10 * time.Minute
+)
+
+// collectUserData gathers everything we hold about a user
+func collectUserData(userID int) (*models.DataExport, error) {
+	user, err := repository.GetUserByID(userID)
+	if err != nil {
+		return nil, err
+	}
+	user.Password = ""
+
+	orders, err := repository.FetchOrdersByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	if orders == nil {
+		orders = []models.Order{}
+	}
+	refunds := []models.Refund{}
+	payments := []models.PaymentIntent{}
+	for _, o := range orders {
+		orderRefunds, err := repository.FetchRefundsByOrderID(o.ID)
+		if err != nil {
+			return nil, err
+		}
+		refunds = append(refunds, orderRefunds...)
+		orderPayments, err := repository.FetchPaymentIntentsByOrderID(o.ID)
+		if err != nil {
+			return nil, err
+		}
+		payments = append(payments, orderPayments...)
+	}
+	redemptions, err := repository.FetchCouponRedemptionsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	feedback, err := repository.FetchFeedbackByEmail(user.Email)
+	if err != nil {
+		return nil, err
+	}
+	identities, err := repository.FetchIdentitiesByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	apiKeys, err := repository.ListAPIKeysByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	loyaltyLedger, err := repository.FetchLoyaltyLedger(userID, 0)
+	if err != nil {
+		return nil, err
+	}
+	giftCards, err := repository.FetchGiftCardsByPurchaser(userID)
+	if err != nil {
+		return nil, err
+	}
+	verifications, err := repository.FetchEmailVerificationsByUserID(userID)
+	if err != nil {
+		return nil, err
+	}
+	auditLog, err := repository.FetchAuditLog(userID, exportAuditLimit)
+	if err != nil {
+		return nil, err
+	}
+
+	return &models.DataExport{
+		ExportedAt:         time.Now().UTC().Format(time.RFC3339),
+		User:               *user,
+		Orders:             orders,
+		Refunds:            refunds,
+		Payments:           payments,
+		CouponRedemptions:  redemptions,
+		Feedback:           feedback,
+		Identities:         identities,
+		APIKeys:            apiKeys,
+		Loyalty:            loyaltyLedger,
+		GiftCards:          giftCards,
+		EmailVerifications: verifications,
+		AuditLog:           auditLog,
+	}, nil
+}
+
+// exportMeHandler handles GET /api/auth/me/export. The data is returned as a
+// ZIP of JSON files, or as a single JSON document with ?format=json.
+func exportMeHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	data, err := collectUserData(claims.UserID)
+	if err != nil {
+		slog.Error("failed to collect user data", "error", err, "user_id", claims.UserID)
+		http.Error(w, "Failed to export data", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("user data exported", "user_id", claims.UserID)
+
+	filename := fmt.Sprintf("user-%d-export-%s", claims.UserID,
+		time.Now().UTC().Format("20060102"))
+
+	if r.URL.Query().Get("format") == "json" {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Content-Disposition",
+			fmt.Sprintf(`attachment; filename="%s.json"`, filename))
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		enc.Encode(data)
+		return
+	}
+
+	files := []struct {
+		name string
+		v    any
+	}{
+		{"user.json", data.User},
+		{"orders.json", data.Orders},
+		{"refunds.json", data.Refunds},
+		{"payments.json", data.Payments},
+		{"coupon_redemptions.json", data.CouponRedemptions},
+		{"feedback.json", data.Feedback},
+		{"identities.json", data.Identities},
+		{"api_keys.json", data.APIKeys},
+		{"loyalty.json", data.Loyalty},
+		{"gift_cards.json", data.GiftCards},
+		{"email_verifications.json", data.EmailVerifications},
+		{"audit_log.json", data.AuditLog},
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition",
+		fmt.Sprintf(`attachment; filename="%s.zip"`, filename))
+
+	zw := zip.NewWriter(w)
+	for _, f := range files {
+		fw, err := zw.Create(f.name)
+		if err != nil {
+			slog.Error("failed to write export", "error", err)
+			return
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(f.v); err != nil {
+			slog.Error("failed to write export", "error", err)
+			return
+		}
+	}
+	if err := zw.Close(); err != nil {
+		slog.Error("failed to write export", "error", err)
+	}
+}
+
+// deleteMeHandler handles DELETE /api/auth/me. The user confirms with their
+// password or by having logged in within the last few minutes. Orders are
+// kept for revenue reporting but no longer point at the user.
+func deleteMeHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+	if claims.Scopes != nil {
+		http.Error(w, "Accounts cannot be deleted with an API key", http.StatusForbidden)
+		return
+	}
+
+	var req models.DeleteAccountRequest
+	if r.ContentLength != 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+
+	user, err := repository.GetUserByID(claims.UserID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.Role == "admin" {
+		http.Error(w, "Admin accounts must be removed by another admin",
+			http.StatusForbidden)
+		return
+	}
+
+	if req.Password != "" {
+		match, err := checkPassword(req.Password, user.Password)
+		if err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return
+		}
+		if !match {
+			http.Error(w, "Password is incorrect", http.StatusUnauthorized)
+			return
+		}
+	} else if claims.IssuedAt == nil ||
+		time.Since(claims.IssuedAt.Time) > deleteReauthWindow {
+		http.Error(w, "Confirm with your password or log in again",
+			http.StatusUnauthorized)
+		return
+	}
+
+	if err := repository.EraseUser(user.ID, user.Email); err != nil {
+		slog.Error("failed to delete account", "error", err, "user_id", user.ID)
+		http.Error(w, "Failed to delete account", http.StatusInternalServerError)
+		return
+	}
+
+	target := user.ID
+	if err := repository.InsertAuditEntry(&models.AuditEntry{
+		ActorID:      user.ID,
+		ActorEmail:   fmt.Sprintf("deleted-user-%d", user.ID),
+		Action:       "user.self_deleted",
+		TargetUserID: &target,
+	}); err != nil {
+		slog.Error("failed to write audit entry", "error", err,
+			"action", "user.self_deleted")
+	}
+
+	slog.Info("account deleted by user", "user_id", user.ID)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,319 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/mail"
+	"strings"
+	"unicode/utf8"
+
+	"restaurant-backend/internal/handlers"
+	"restaurant-backend/internal/mailer"
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+const (
+	maxNameLength          = 100
+	minPasswordLength      = 8
+	emailVerificationHours = 24
+)
+
+// normalizePhone converts a phone number to E.164 (+<country><number>).
+// Spaces, dashes, dots and parentheses are ignored; a leading "00" is
+// treated as "+". An empty string clears the phone number.
+func normalizePhone(phone string) (string, error) {
+	phone = strings.TrimSpace(phone)
+	if phone == "" {
+		return "", nil
+	}
+
+	if strings.HasPrefix(phone, "00") {
+		phone = "+" + phone[2:]
+	}
+	if !strings.HasPrefix(phone, "+") {
+		return "", errors.New("phone must include a country code, e.g. +14155550123")
+	}
+
+	var digits strings.Builder
+	for _, r := range phone[1:] {
+		switch {
+		case r >= '0' && r <= '9':
+			digits.WriteRune(r)
+		case r == ' ' || r == '-' || r == '.' || r == '(' || r == ')':
+		default:
+			return "", fmt.Errorf("phone contains invalid character %q", r)
+		}
+	}
+
+	d := digits.String()
+	if len(d) < 8 || len(d) > 15 || d[0] == '0' {
+		return "", errors.New("phone must have 8 to 15 digits and a valid country code")
+	}
+	return "+" + d, nil
+}
+
+// validateName trims the name and checks its length
+func validateName(name string) (string, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", errors.New("name is required")
+	}
+	if utf8.RuneCountInString(name) > maxNameLength {
+		return "", fmt.Errorf("name must be at most %d characters", maxNameLength)
+	}
+	return name, nil
+}
+
+// hashToken returns the hex SHA-256 of a one-time token for storage
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+// generateRandomToken returns n random bytes, hex encoded
+func generateRandomToken(n int) (string, error) {
+	buf := make([]byte, n)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(buf), nil
+}
+
+// updateMeHandler handles PATCH /api/auth/me
+func updateMeHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.UpdateProfileRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := repository.GetUserByID(claims.UserID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	name, phone := user.Name, user.Phone
+	if req.Name != nil {
+		if name, err = validateName(*req.Name); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+	if req.Phone != nil {
+		if phone, err = normalizePhone(*req.Phone); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+	}
+
+	var pendingEmail string
+	if req.Email != nil {
+		newEmail := strings.TrimSpace(*req.Email)
+		if addr, err := mail.ParseAddress(newEmail); err != nil ||
+			addr.Address != newEmail {
+			http.Error(w, "Invalid email address", http.StatusBadRequest)
+			return
+		}
+
+		if !strings.EqualFold(newEmail, user.Email) {
+			outbox := handlers.Mailer()
+			if outbox == nil {
+				http.Error(w, "Email is not configured, so the address cannot be verified",
+					http.StatusServiceUnavailable)
+				return
+			}
+			match, err := checkPassword(req.CurrentPassword, user.Password)
+			if err != nil {
+				http.Error(w, "Internal server error", http.StatusInternalServerError)
+				return
+			}
+			if !match {
+				http.Error(w, "Current password is incorrect", http.StatusUnauthorized)
+				return
+			}
+
+			if existing, _ := repository.GetUserByEmail(newEmail); existing != nil {
+				http.Error(w, "Email already registered", http.StatusConflict)
+				return
+			}
+
+			verificationToken, err := generateRandomToken(32)
+			if err != nil {
+				http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+				return
+			}
+			if err := repository.CreateEmailVerification(user.ID, newEmail,
+				hashToken(verificationToken), emailVerificationHours); err != nil {
+				slog.Error("failed to store email verification", "error", err)
+				http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+				return
+			}
+
+			ctx, cancel := context.WithTimeout(r.Context(), handlers.MailTimeout)
+			defer cancel()
+			err = outbox.Send(ctx, mailer.Message{
+				To:      newEmail,
+				Subject: "Confirm your new email address",
+				Text: fmt.Sprintf("Enter this code to confirm your new email "+
+					"address. It expires in %d hours:\n\n%s\n",
+					emailVerificationHours, verificationToken),
+			})
+			if err != nil {
+				slog.Error("failed to email verification code", "user_id", user.ID,
+					"error", err)
+				http.Error(w, "The verification email could not be sent; try again",
+					http.StatusBadGateway)
+				return
+			}
+			pendingEmail = newEmail
+		}
+	}
+
+	if err := repository.UpdateUserProfile(user.ID, name, phone); err != nil {
+		http.Error(w, "Failed to update profile", http.StatusInternalServerError)
+		return
+	}
+	user.Name, user.Phone = name, phone
+
+	if pendingEmail != "" {
+		slog.Info("email change verification pending", "user_id", user.ID)
+	}
+
+	user.Password = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.UpdateProfileResponse{
+		User:         *user,
+		PendingEmail: pendingEmail,
+	})
+}
+
+// verifyEmailHandler handles POST /api/auth/verify-email
+func verifyEmailHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.VerifyEmailRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Token == "" {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	userID, err := repository.ConfirmEmailVerification(hashToken(req.Token))
+	if err != nil {
+		if errors.Is(err, repository.ErrInvalidToken) {
+			http.Error(w, "Invalid or expired token", http.StatusBadRequest)
+			return
+		}
+		if errors.Is(err, repository.ErrEmailTaken) {
+			http.Error(w, "Email already registered", http.StatusConflict)
+			return
+		}
+		slog.Error("failed to confirm email change", "error", err)
+		http.Error(w, "Failed to verify email", http.StatusInternalServerError)
+		return
+	}
+
+	user, err := repository.GetUserByID(userID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	// The old token still carries the previous email, so hand out a new one
+	token, err := generateToken(user)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	user.Password = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.AuthResponse{Token: token, User: *user})
+}
+
+// changePasswordHandler handles POST /api/auth/change-password
+func changePasswordHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.ChangePasswordRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.CurrentPassword == "" || req.NewPassword == "" {
+		http.Error(w, "Current and new password are required",
+			http.StatusBadRequest)
+		return
+	}
+	if len(req.NewPassword) < minPasswordLength {
+		http.Error(w, fmt.Sprintf("New password must be at least %d characters",
+			minPasswordLength), http.StatusBadRequest)
+		return
+	}
+	if req.NewPassword == req.CurrentPassword {
+		http.Error(w, "New password must differ from the current password",
+			http.StatusBadRequest)
+		return
+	}
+
+	user, err := repository.GetUserByID(claims.UserID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+
+	match, err := checkPassword(req.CurrentPassword, user.Password)
+	if err != nil {
+		slog.Error("password check error", "error", err, "user_id", user.ID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !match {
+		slog.Warn("failed password change: invalid current password",
+			"user_id", user.ID)
+		http.Error(w, "Current password is incorrect", http.StatusUnauthorized)
+		return
+	}
+
+	hashedPassword, err := hashPassword(req.NewPassword)
+	if err != nil {
+		http.Error(w, "Failed to process password", http.StatusInternalServerError)
+		return
+	}
+
+	if err := repository.SetUserPassword(user.ID, hashedPassword, false); err != nil {
+		http.Error(w, "Failed to change password", http.StatusInternalServerError)
+		return
+	}
+
+	// Every earlier token is now revoked, including the caller's, so hand
+	// out a new one
+	token, err := generateToken(user, claims.AMR...)
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Password changed successfully",
+		"token":   token,
+	})
+}
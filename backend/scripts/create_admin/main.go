@@ -63,7 +63,11 @@ func main() {
 	fmt.Printf("  Email: %s\n", authResp.User.Email)
 	fmt.Printf("  Name: %s\n", authResp.User.Name)
 	fmt.Printf("  Role: %s\n", authResp.User.Role)
-	fmt.Printf("\nNote: User is created as 'customer'. To make admin, run:\n")
-	fmt.Printf("  sqlite3 restaurant_v4.db \"UPDATE users SET role='admin' WHERE email='%s'\"\n", *email)
+	if authResp.User.Role != "admin" {
+		fmt.Printf("\nNote: User is created as 'customer'. To make admin, have an existing admin run:\n")
+		fmt.Printf("  curl -X PUT %s/admin/users/%d/role \\\n", baseURL, authResp.User.ID)
+		fmt.Printf("    -H \"Authorization: Bearer <admin token>\" \\\n")
+		fmt.Printf("    -H \"Content-Type: application/json\" -d '{\"role\":\"admin\"}'\n")
+	}
 	fmt.Printf("\nToken: %s\n", authResp.Token)
 }
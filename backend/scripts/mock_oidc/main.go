@@ -0,0 +1,196 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+// pendingCode is an issued authorization code waiting to be exchanged
+type pendingCode struct {
+	clientID      string
+	redirectURI   string
+	codeChallenge string
+	nonce         string
+	email         string
+}
+
+var (
+	codes   = map[string]pendingCode{}
+	codesMu sync.Mutex
+	key     *rsa.PrivateKey
+)
+
+func main() {
+	addr := flag.String("addr", "127.0.0.1:9000", "Listen address")
+	email := flag.String("email", "oidc.user@example.com", "Email of the signed-in user")
+	name := flag.String("name", "OIDC User", "Name of the signed-in user")
+	sub := flag.String("sub", "mock-user-1", "Subject (stable user ID)")
+	flag.Parse()
+
+	var err error
+	key, err = rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		fmt.Printf("Error generating key: %v\n", err)
+		os.Exit(1)
+	}
+
+	issuer := "http://" + *addr
+
+	http.HandleFunc("/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{
+			"issuer":                                issuer,
+			"authorization_endpoint":                issuer + "/authorize",
+			"token_endpoint":                        issuer + "/token",
+			"jwks_uri":                              issuer + "/jwks",
+			"response_types_supported":              []string{"code"},
+			"subject_types_supported":               []string{"public"},
+			"id_token_signing_alg_values_supported": []string{"RS256"},
+			"code_challenge_methods_supported":      []string{"S256"},
+		})
+	})
+
+	http.HandleFunc("/jwks", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, map[string]any{"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": "mock",
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+		}}})
+	})
+
+	// Authorization is granted immediately; ?login_hint= overrides the email
+	http.HandleFunc("/authorize", func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+			http.Error(w, "only response_type=code with S256 PKCE is supported", http.StatusBadRequest)
+			return
+		}
+
+		userEmail := *email
+		if hint := q.Get("login_hint"); hint != "" {
+			userEmail = hint
+		}
+
+		code := randomString()
+		codesMu.Lock()
+		codes[code] = pendingCode{
+			clientID:      q.Get("client_id"),
+			redirectURI:   q.Get("redirect_uri"),
+			codeChallenge: q.Get("code_challenge"),
+			nonce:         q.Get("nonce"),
+			email:         userEmail,
+		}
+		codesMu.Unlock()
+
+		redirect, err := url.Parse(q.Get("redirect_uri"))
+		if err != nil {
+			http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+			return
+		}
+		rq := redirect.Query()
+		rq.Set("code", code)
+		rq.Set("state", q.Get("state"))
+		redirect.RawQuery = rq.Encode()
+		http.Redirect(w, r, redirect.String(), http.StatusFound)
+	})
+
+	http.HandleFunc("/token", func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseForm(); err != nil {
+			http.Error(w, "invalid form", http.StatusBadRequest)
+			return
+		}
+
+		codesMu.Lock()
+		pc, ok := codes[r.PostForm.Get("code")]
+		delete(codes, r.PostForm.Get("code"))
+		codesMu.Unlock()
+
+		sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+		switch {
+		case !ok:
+			tokenError(w, "invalid_grant", "unknown or used code")
+			return
+		case pc.clientID != r.PostForm.Get("client_id"):
+			tokenError(w, "invalid_client", "client_id mismatch")
+			return
+		case pc.redirectURI != r.PostForm.Get("redirect_uri"):
+			tokenError(w, "invalid_grant", "redirect_uri mismatch")
+			return
+		case base64.RawURLEncoding.EncodeToString(sum[:]) != pc.codeChallenge:
+			tokenError(w, "invalid_grant", "PKCE verification failed")
+			return
+		}
+
+		now := time.Now()
+		token := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+			"iss":            issuer,
+			"sub":            *sub,
+			"aud":            pc.clientID,
+			"iat":            now.Unix(),
+			"exp":            now.Add(5 * time.Minute).Unix(),
+			"nonce":          pc.nonce,
+			"email":          pc.email,
+			"email_verified": true,
+			"name":           *name,
+		})
+		token.Header["kid"] = "mock"
+		idToken, err := token.SignedString(key)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		writeJSON(w, map[string]any{
+			"access_token": randomString(),
+			"token_type":   "Bearer",
+			"expires_in":   300,
+			"id_token":     idToken,
+		})
+	})
+
+	fmt.Printf("Mock OIDC provider running at %s\n", issuer)
+	fmt.Printf("Configure the backend with:\n")
+	fmt.Printf("  OIDC_PROVIDERS=mock\n")
+	fmt.Printf("  OIDC_MOCK_ISSUER=%s\n", issuer)
+	fmt.Printf("  OIDC_MOCK_CLIENT_ID=restaurant\n")
+	fmt.Printf("  OIDC_MOCK_REDIRECT_URL=http://localhost:8080/api/auth/oidc/mock/callback\n")
+	if err := http.ListenAndServe(*addr, nil); err != nil {
+		fmt.Printf("Error: %v\n", err)
+		os.Exit(1)
+	}
+}
+
+func randomString() string {
+	buf := make([]byte, 16)
+	rand.Read(buf)
+	return base64.RawURLEncoding.EncodeToString(buf)
+}
+
+func tokenError(w http.ResponseWriter, code, description string) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(http.StatusBadRequest)
+	json.NewEncoder(w).Encode(map[string]string{
+		"error":             code,
+		"error_description": description,
+	})
+}
+
+func writeJSON(w http.ResponseWriter, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(v)
+}
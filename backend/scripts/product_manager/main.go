@@ -12,6 +12,10 @@ import (
 
 const baseURL = "http://localhost:8080/api"
 
+// apiKey authenticates write requests. It is read from RESTSTORE_API_KEY and
+// can be overridden with --api-key on each command.
+var apiKey = os.Getenv("RESTSTORE_API_KEY")
+
 type ImageAttribution struct {
 	Photographer string `json:"photographer"`
 	Source       string `json:"source"`
@@ -37,6 +41,12 @@ func main() {
 	importCmd := flag.NewFlagSet("import", flag.ExitOnError)
 	exportCmd := flag.NewFlagSet("export", flag.ExitOnError)
 
+	// Auth flags for commands that modify products
+	for _, fs := range []*flag.FlagSet{addCmd, deleteCmd, importCmd} {
+		fs.StringVar(&apiKey, "api-key", apiKey,
+			"API key with products:write scope (default $RESTSTORE_API_KEY)")
+	}
+
 	// Add flags
 	addName := addCmd.String("name", "", "Product name (required)")
 	addPrice := addCmd.Float64("price", 0, "Product price")
@@ -114,9 +124,29 @@ func printUsage() {
 	fmt.Println("  list     List all products")
 	fmt.Println("  import   Import products from JSON file")
 	fmt.Println("  export   Export products to JSON file")
+	fmt.Println("\nadd, delete and import need an API key with the products:write scope,")
+	fmt.Println("passed via RESTSTORE_API_KEY or --api-key")
 	fmt.Println("\nRun 'product_manager <command> -h' for command-specific help")
 }
 
+// doRequest sends an authenticated request to the API
+func doRequest(method, url string, body []byte) (*http.Response, error) {
+	if apiKey == "" {
+		fmt.Println("Error: an API key is required, set RESTSTORE_API_KEY or pass --api-key")
+		os.Exit(1)
+	}
+
+	req, err := http.NewRequest(method, url, bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+apiKey)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	return http.DefaultClient.Do(req)
+}
+
 func addProduct(name string, price float64, desc, category, image, detailed string) {
 	product := Product{
 		Name:                name,
@@ -128,7 +158,7 @@ func addProduct(name string, price float64, desc, category, image, detailed stri
 	}
 
 	data, _ := json.Marshal(product)
-	resp, err := http.Post(baseURL+"/products", "application/json", bytes.NewBuffer(data))
+	resp, err := doRequest("POST", baseURL+"/products", data)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
@@ -147,8 +177,7 @@ func addProduct(name string, price float64, desc, category, image, detailed stri
 }
 
 func deleteProduct(id int) {
-	req, _ := http.NewRequest("DELETE", fmt.Sprintf("%s/products/%d", baseURL, id), nil)
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := doRequest("DELETE", fmt.Sprintf("%s/products/%d", baseURL, id), nil)
 	if err != nil {
 		fmt.Printf("Error: %v\n", err)
 		os.Exit(1)
@@ -202,7 +231,7 @@ func importProducts(filename string) {
 	fmt.Printf("Importing %d products...\n", len(products))
 	for _, p := range products {
 		data, _ := json.Marshal(p)
-		resp, err := http.Post(baseURL+"/products", "application/json", bytes.NewBuffer(data))
+		resp, err := doRequest("POST", baseURL+"/products", data)
 		if err != nil {
 			fmt.Printf("  Error adding %s: %v\n", p.Name, err)
 			continue
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha1"
+	"encoding/base32"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"restaurant-backend/internal/models"
+	"restaurant-backend/internal/repository"
+)
+
+// RFC 6238 parameters. These are the defaults every authenticator app
+// understands, so they are not configurable.
+const (
+	totpPeriod        = 30
+	totpDigits        = 6
+	totpSkew          = 1 // accept codes one step either side of now
+	recoveryCodeCount = 10
+)
+
+var base32NoPad = base32.StdEncoding.WithPadding(base32.NoPadding)
+
+// totpCode computes the code for a secret at a given time step (RFC 4226)
+func totpCode(secret []byte, step int64) string {
+	var msg [8]byte
+	binary.BigEndian.PutUint64(msg[:], uint64(step))
+
+	mac := hmac.New(sha1.New, secret)
+	mac.Write(msg[:])
+	sum := mac.Sum(nil)
+
+	offset := sum[len(sum)-1] & 0x0f
+	value := binary.BigEndian.Uint32(sum[offset:offset+4]) & 0x7fffffff
+	return fmt.Sprintf("%0*d", totpDigits, value%1_000_000)
+}
+
+// verifyTOTP checks a code against a base32 secret and returns the matching
+// time step so the caller can reject replays
+func verifyTOTP(secret, code string, now time.Time) (int64, bool) {
+	key, err := base32NoPad.DecodeString(strings.ToUpper(secret))
+	if err != nil {
+		return 0, false
+	}
+
+	code = strings.ReplaceAll(strings.TrimSpace(code), " ", "")
+	if len(code) != totpDigits {
+		return 0, false
+	}
+
+	current := now.Unix() / totpPeriod
+	for step := current - totpSkew; step <= current+totpSkew; step++ {
+		if hmac.Equal([]byte(totpCode(key, step)), []byte(code)) {
+			return step, true
+		}
+	}
+	return 0, false
+}
+
+// checkTOTP verifies a code for the user and claims its time step
+func checkTOTP(user *models.User, code string) (bool, error) {
+	step, ok := verifyTOTP(user.TOTPSecret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+	return repository.ClaimTOTPStep(user.ID, step)
+}
+
+// otpauthURI builds the URI authenticator apps read from a QR code
+func otpauthURI(email, secret string) string {
+	issuer := os.Getenv("TOTP_ISSUER")
+	if issuer == "" {
+		issuer = "RestStore"
+	}
+
+	q := url.Values{}
+	q.Set("secret", secret)
+	q.Set("issuer", issuer)
+	q.Set("algorithm", "SHA1")
+	q.Set("digits", fmt.Sprint(totpDigits))
+	q.Set("period", fmt.Sprint(totpPeriod))
+
+	label := url.PathEscape(issuer + ":" + email)
+	return "otpauth://totp/" + label + "?" + q.Encode()
+}
+
+// normalizeRecoveryCode makes recovery codes case and dash insensitive
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToUpper(strings.TrimSpace(code))
+	return strings.ReplaceAll(code, "-", "")
+}
+
+// issueRecoveryCodes replaces the user's recovery codes and returns the new
+// plain-text codes, which are only ever shown this once
+func issueRecoveryCodes(userID int) ([]string, error) {
+	codes := make([]string, recoveryCodeCount)
+	hashes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		buf := make([]byte, 5)
+		if _, err := rand.Read(buf); err != nil {
+			return nil, err
+		}
+		raw := base32NoPad.EncodeToString(buf) // 8 characters
+		codes[i] = raw[:4] + "-" + raw[4:]
+		hashes[i] = hashToken(raw)
+	}
+
+	if err := repository.ReplaceRecoveryCodes(userID, hashes); err != nil {
+		return nil, err
+	}
+	return codes, nil
+}
+
+// enroll2FAHandler handles POST /api/auth/2fa/enroll
+func enroll2FAHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := repository.GetUserByID(claims.UserID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.TwoFactorEnabled {
+		http.Error(w, "Two-factor authentication is already enabled",
+			http.StatusConflict)
+		return
+	}
+
+	key := make([]byte, 20)
+	if _, err := rand.Read(key); err != nil {
+		http.Error(w, "Failed to generate secret", http.StatusInternalServerError)
+		return
+	}
+	secret := base32NoPad.EncodeToString(key)
+
+	if err := repository.SetPendingTOTPSecret(user.ID, secret); err != nil {
+		http.Error(w, "Failed to start enrollment", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.TOTPEnrollment{
+		Secret:     secret,
+		OTPAuthURI: otpauthURI(user.Email, secret),
+	})
+}
+
+// confirm2FAHandler handles POST /api/auth/2fa/confirm. It enables 2FA once
+// the user proves their authenticator works and returns recovery codes
+// together with a token that satisfies the admin 2FA policy.
+func confirm2FAHandler(w http.ResponseWriter, r *http.Request) {
+	claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return
+	}
+
+	var req models.TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	user, err := repository.GetUserByID(claims.UserID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return
+	}
+	if user.TwoFactorEnabled {
+		http.Error(w, "Two-factor authentication is already enabled",
+			http.StatusConflict)
+		return
+	}
+	if user.TOTPSecret == "" {
+		http.Error(w, "Start enrollment first", http.StatusBadRequest)
+		return
+	}
+
+	valid, err := checkTOTP(user, req.Code)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+
+	if err := repository.EnableTOTP(user.ID); err != nil {
+		http.Error(w, "Failed to enable two-factor authentication",
+			http.StatusInternalServerError)
+		return
+	}
+
+	codes, err := issueRecoveryCodes(user.ID)
+	if err != nil {
+		http.Error(w, "Failed to generate recovery codes",
+			http.StatusInternalServerError)
+		return
+	}
+
+	token, err := generateToken(user, "pwd", "otp")
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("two-factor authentication enabled", "user_id", user.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.RecoveryCodesResponse{
+		RecoveryCodes: codes,
+		Token:         token,
+	})
+}
+
+// disable2FAHandler handles POST /api/auth/2fa/disable
+func disable2FAHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := reauthenticate2FA(w, r)
+	if !ok {
+		return
+	}
+
+	if adminRequires2FA && user.Role == "admin" {
+		http.Error(w, "Admin accounts must keep two-factor authentication enabled",
+			http.StatusForbidden)
+		return
+	}
+
+	if err := repository.DisableTOTP(user.ID); err != nil {
+		http.Error(w, "Failed to disable two-factor authentication",
+			http.StatusInternalServerError)
+		return
+	}
+
+	slog.Info("two-factor authentication disabled", "user_id", user.ID)
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]string{
+		"message": "Two-factor authentication disabled",
+	})
+}
+
+// regenerateRecoveryCodesHandler handles POST /api/auth/2fa/recovery-codes
+func regenerateRecoveryCodesHandler(w http.ResponseWriter, r *http.Request) {
+	user, ok := reauthenticate2FA(w, r)
+	if !ok {
+		return
+	}
+
+	codes, err := issueRecoveryCodes(user.ID)
+	if err != nil {
+		http.Error(w, "Failed to generate recovery codes",
+			http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.RecoveryCodesResponse{RecoveryCodes: codes})
+}
+
+// reauthenticate2FA loads the current user and checks both their password
+// and a TOTP code, as required before changing 2FA settings
+func reauthenticate2FA(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	claims, ok := r.Context().Value(models.UserContextKey).(*models.Claims)
+	if !ok {
+		http.Error(w, "Unauthorized", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	var req models.TOTPCodeRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return nil, false
+	}
+
+	user, err := repository.GetUserByID(claims.UserID)
+	if err != nil {
+		http.Error(w, "User not found", http.StatusNotFound)
+		return nil, false
+	}
+	if !user.TwoFactorEnabled {
+		http.Error(w, "Two-factor authentication is not enabled",
+			http.StatusBadRequest)
+		return nil, false
+	}
+
+	match, err := checkPassword(req.Password, user.Password)
+	if err != nil {
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return nil, false
+	}
+	valid := false
+	if match {
+		if valid, err = checkTOTP(user, req.Code); err != nil {
+			http.Error(w, "Internal server error", http.StatusInternalServerError)
+			return nil, false
+		}
+	}
+	if !valid {
+		http.Error(w, "Invalid password or code", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	return user, true
+}
+
+// loginTwoFactorHandler handles POST /api/auth/login/2fa, the second step of
+// a login for users with 2FA enabled
+func loginTwoFactorHandler(w http.ResponseWriter, r *http.Request) {
+	var req models.TwoFactorLoginRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+
+	if req.Code == "" && req.RecoveryCode == "" {
+		http.Error(w, "Code or recovery code is required", http.StatusBadRequest)
+		return
+	}
+
+	claims, err := validateToken(req.InterimToken)
+	if err != nil || claims.Purpose != purposeTwoFactor {
+		http.Error(w, "Invalid or expired login session", http.StatusUnauthorized)
+		return
+	}
+
+	user, err := repository.GetUserByID(claims.UserID)
+	if err != nil || !user.TwoFactorEnabled || tokenRevoked(claims, user) {
+		http.Error(w, "Invalid or expired login session", http.StatusUnauthorized)
+		return
+	}
+	if user.Disabled {
+		http.Error(w, "Account is disabled", http.StatusForbidden)
+		return
+	}
+
+	err = repository.BeginTwoFactorAttempt(user.ID, maxTwoFactorAttempts,
+		twoFactorLockout)
+	if errors.Is(err, repository.ErrTwoFactorLocked) {
+		slog.Warn("two-factor login locked", "user_id", user.ID)
+		http.Error(w, "Too many failed codes; try again later",
+			http.StatusTooManyRequests)
+		return
+	}
+	if err != nil {
+		slog.Error("failed to record two-factor attempt", "error", err, "user_id", user.ID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+
+	var valid bool
+	if req.RecoveryCode != "" {
+		valid, err = repository.UseRecoveryCode(user.ID,
+			hashToken(normalizeRecoveryCode(req.RecoveryCode)))
+		if valid {
+			slog.Warn("recovery code used for login", "user_id", user.ID)
+		}
+	} else {
+		valid, err = checkTOTP(user, req.Code)
+	}
+	if err != nil {
+		slog.Error("two-factor check error", "error", err, "user_id", user.ID)
+		http.Error(w, "Internal server error", http.StatusInternalServerError)
+		return
+	}
+	if !valid {
+		slog.Warn("failed login attempt: invalid second factor", "user_id", user.ID)
+		http.Error(w, "Invalid code", http.StatusUnauthorized)
+		return
+	}
+	if err := repository.ResetTwoFactorAttempts(user.ID); err != nil {
+		slog.Error("failed to reset two-factor attempts", "error", err, "user_id", user.ID)
+	}
+
+	token, err := generateToken(user, "pwd", "otp")
+	if err != nil {
+		http.Error(w, "Failed to generate token", http.StatusInternalServerError)
+		return
+	}
+
+	user.Password = ""
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(models.AuthResponse{Token: token, User: *user})
+}
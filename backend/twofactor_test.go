@@ -0,0 +1,73 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+// rfc6238Secret is the SHA-1 key from RFC 6238 appendix B, base32 encoded
+const rfc6238Secret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestTOTPCode(t *testing.T) {
+	key, err := base32NoPad.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// RFC 6238 appendix B gives 8-digit codes; ours are their last 6 digits
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "287082"},
+		{1111111109, "081804"},
+		{1111111111, "050471"},
+		{1234567890, "005924"},
+		{2000000000, "279037"},
+		{20000000000, "353130"},
+	}
+	for _, tt := range tests {
+		if got := totpCode(key, tt.unix/totpPeriod); got != tt.want {
+			t.Errorf("code at %d = %s, want %s", tt.unix, got, tt.want)
+		}
+	}
+}
+
+func TestVerifyTOTP(t *testing.T) {
+	key, err := base32NoPad.DecodeString(rfc6238Secret)
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1111111111, 0)
+	step := now.Unix() / totpPeriod
+	codeAt := func(offset int64) string { return totpCode(key, step+offset) }
+
+	tests := []struct {
+		name     string
+		secret   string
+		code     string
+		wantStep int64
+		wantOK   bool
+	}{
+		{"current step", rfc6238Secret, codeAt(0), step, true},
+		{"previous step", rfc6238Secret, codeAt(-1), step - 1, true},
+		{"next step", rfc6238Secret, codeAt(1), step + 1, true},
+		{"outside the window before", rfc6238Secret, codeAt(-totpSkew - 1), 0, false},
+		{"outside the window after", rfc6238Secret, codeAt(totpSkew + 1), 0, false},
+		{"lower-case secret", "gezdgnbvgy3tqojqgezdgnbvgy3tqojq", codeAt(0), step, true},
+		{"spaces in the code", rfc6238Secret, codeAt(0)[:3] + " " + codeAt(0)[3:], step, true},
+		{"wrong code", rfc6238Secret, "000000", 0, false},
+		{"too short", rfc6238Secret, codeAt(0)[:5], 0, false},
+		{"8-digit RFC code", rfc6238Secret, "14050471", 0, false},
+		{"invalid secret", "not base32!", codeAt(0), 0, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotStep, ok := verifyTOTP(tt.secret, tt.code, now)
+			if ok != tt.wantOK || gotStep != tt.wantStep {
+				t.Errorf("verifyTOTP = %d, %v; want %d, %v", gotStep, ok, tt.wantStep,
+					tt.wantOK)
+			}
+		})
+	}
+}
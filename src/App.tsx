@@ -64,7 +64,7 @@ function App() {
     setCartItems(prev => prev.filter((_, i) => i !== index))
   }
 
-  const handleCheckout = async () => {
+  const handleCheckout = async (createPaymentMethod: () => Promise<string>) => {
     if (cartItems.length === 0) return;
 
     if (!user) {
@@ -78,6 +78,7 @@ function App() {
         const customizationsCost = item.customizations?.reduce((cSum, opt) => cSum + opt.price, 0) || 0;
         return sum + ((item.product.price + customizationsCost) * item.quantity);
       }, 0);
+      const paymentMethod = await createPaymentMethod();
 
       const orderData = {
         userId: user.id,
@@ -88,7 +89,8 @@ function App() {
           customizations: item.customizations || []
         })),
         totalPrice: totalPrice,
-        status: 'pending'
+        status: 'pending',
+        paymentMethod
       };
 
       const response = await fetch(`${API_URL}/orders`, {
@@ -1,5 +1,6 @@
-import React from 'react';
-import type { CartProps } from '../types';
+import React, { useRef } from 'react';
+import type { CartProps, PaymentFormHandle } from '../types';
+import PaymentForm from './PaymentForm';
 import styles from './Cart.module.css';
 
 const Cart: React.FC<CartProps & { onClose: () => void }> = ({ cartItems, onUpdateQuantity, onRemoveItem, onClose,
@@ -8,6 +9,11 @@ const Cart: React.FC<CartProps & { onClose: () => void }> = ({ cartItems, onUpda
         const customizationsCost = item.customizations?.reduce((cSum, opt) => cSum + opt.price, 0) || 0;
         return sum + ((item.product.price + customizationsCost) * item.quantity);
     }, 0);
+    const paymentRef = useRef<PaymentFormHandle>(null);
+
+    const createPaymentMethod = () => paymentRef.current
+        ? paymentRef.current.createPaymentMethod()
+        : Promise.reject(new Error('The card form is not ready'));
 
     return (
         <div className={styles['modal-overlay']} onClick={onClose}>
@@ -68,6 +74,7 @@ const Cart: React.FC<CartProps & { onClose: () => void }> = ({ cartItems, onUpda
                 </div>
 
                 <div className={styles['cart-footer']}>
+                    {cartItems.length > 0 && <PaymentForm ref={paymentRef} />}
                     <div className={styles['cart-total']}>
                         <span>Total:</span>
                         <span className={styles['total-amount']}>${total.toFixed(2)}</span>
@@ -75,7 +82,7 @@ const Cart: React.FC<CartProps & { onClose: () => void }> = ({ cartItems, onUpda
                     <button 
                         className={styles['checkout-btn']}
                         disabled={cartItems.length === 0}
-                        onClick={onCheckout}
+                        onClick={() => onCheckout(createPaymentMethod)}
                     >
                         Checkout
                     </button>
@@ -18,9 +18,13 @@ const InfoBar: React.FC<InfoBarProps> = ({
   const [fade, setFade] = useState(false);
 
   useEffect(() => {
-    const eventSource = new EventSource(`${env.REACT_APP_API_URL}/promos`);
+    // EventSource cannot send headers, so the token goes in the query string
+    // to get promos targeted at logged-in customers
+    const token = localStorage.getItem('token');
+    const query = token ? `?token=${encodeURIComponent(token)}` : '';
+    const eventSource = new EventSource(`${env.REACT_APP_API_URL}/promos${query}`);
 
-    eventSource.onmessage = (event) => {
+    eventSource.addEventListener('promo', (event) => {
       // Fade out
       setFade(true);
       
@@ -29,11 +33,11 @@ const InfoBar: React.FC<InfoBarProps> = ({
         setPromoMessage(event.data);
         setFade(false);
       }, 500); // 500ms should match CSS transition duration
-    };
+    });
 
+    // The browser reconnects on its own and resumes via Last-Event-ID
     eventSource.onerror = (error) => {
       console.error('SSE Error:', error);
-      eventSource.close();
     };
 
     return () => {
@@ -0,0 +1,133 @@
+import { useEffect, useRef, useState, useImperativeHandle, forwardRef } from 'react';
+import type { PaymentConfig, PaymentFormHandle } from '../types';
+import { env } from '../env';
+import styles from './Cart.module.css';
+
+const API_URL = env.REACT_APP_API_URL;
+const STRIPE_JS_URL = 'https://js.stripe.com/v3/';
+
+// The parts of Stripe.js used here; it is loaded from Stripe, not bundled
+interface StripeCardElement {
+    mount: (element: HTMLElement) => void;
+    destroy: () => void;
+}
+
+interface StripeClient {
+    elements: () => { create: (type: 'card') => StripeCardElement };
+    createPaymentMethod: (options: { type: 'card'; card: StripeCardElement }) =>
+        Promise<{ paymentMethod?: { id: string }; error?: { message?: string } }>;
+}
+
+declare global {
+    interface Window {
+        Stripe?: (publishableKey: string) => StripeClient;
+    }
+}
+
+let stripeScript: Promise<void> | null = null;
+
+const loadStripe = (): Promise<void> => {
+    if (window.Stripe) return Promise.resolve();
+    if (!stripeScript) {
+        stripeScript = new Promise((resolve, reject) => {
+            const script = document.createElement('script');
+            script.src = STRIPE_JS_URL;
+            script.onload = () => resolve();
+            script.onerror = () => {
+                stripeScript = null;
+                reject(new Error('Could not load the card form'));
+            };
+            document.head.appendChild(script);
+        });
+    }
+    return stripeScript;
+};
+
+// PaymentForm collects the card the order is paid with: Stripe's card form,
+// or a choice of test cards when the server uses the mock provider. Card
+// details go straight to the provider; only its token reaches our server.
+const PaymentForm = forwardRef<PaymentFormHandle>((_, ref) => {
+    const [config, setConfig] = useState<PaymentConfig | null>(null);
+    const [error, setError] = useState<string | null>(null);
+    const [testMethod, setTestMethod] = useState('');
+    const cardRef = useRef<HTMLDivElement>(null);
+    const stripeRef = useRef<StripeClient | null>(null);
+    const cardElementRef = useRef<StripeCardElement | null>(null);
+
+    useEffect(() => {
+        fetch(`${API_URL}/payments/config`)
+            .then(res => {
+                if (!res.ok) throw new Error('Card payments are unavailable');
+                return res.json();
+            })
+            .then((data: PaymentConfig) => {
+                setConfig(data);
+                setTestMethod(data.testPaymentMethods?.[0] || '');
+            })
+            .catch(err => setError(err instanceof Error ? err.message : 'Card payments are unavailable'));
+    }, []);
+
+    useEffect(() => {
+        if (!config?.publishableKey) return;
+        let cancelled = false;
+        loadStripe()
+            .then(() => {
+                if (cancelled || !window.Stripe || !cardRef.current) return;
+                const stripe = window.Stripe(config.publishableKey!);
+                const card = stripe.elements().create('card');
+                card.mount(cardRef.current);
+                stripeRef.current = stripe;
+                cardElementRef.current = card;
+            })
+            .catch(err => setError(err instanceof Error ? err.message : 'Could not load the card form'));
+        return () => {
+            cancelled = true;
+            cardElementRef.current?.destroy();
+            cardElementRef.current = null;
+            stripeRef.current = null;
+        };
+    }, [config]);
+
+    useImperativeHandle(ref, () => ({
+        createPaymentMethod: async () => {
+            if (config?.testPaymentMethods) {
+                return testMethod;
+            }
+            if (!stripeRef.current || !cardElementRef.current) {
+                throw new Error(error || 'The card form is still loading');
+            }
+            const { paymentMethod, error: stripeError } = await stripeRef.current.createPaymentMethod({
+                type: 'card',
+                card: cardElementRef.current
+            });
+            if (stripeError || !paymentMethod) {
+                throw new Error(stripeError?.message || 'Your card details could not be used');
+            }
+            return paymentMethod.id;
+        }
+    }), [config, testMethod, error]);
+
+    return (
+        <div className={styles['payment-form']}>
+            <span className={styles['payment-label']}>Pay by card</span>
+            {error && <p className={styles['payment-error']}>{error}</p>}
+            {config?.testPaymentMethods ? (
+                <select
+                    className={styles['payment-select']}
+                    value={testMethod}
+                    onChange={e => setTestMethod(e.target.value)}
+                >
+                    {config.testPaymentMethods.map((method, i) => (
+                        <option key={method} value={method}>
+                            {i === 0 ? 'Test card (approved)' : `Test card: ${method}`}
+                        </option>
+                    ))}
+                </select>
+            ) : (
+                <div ref={cardRef} className={styles['payment-card']} />
+            )}
+        </div>
+    );
+});
+
+export default PaymentForm;
@@ -116,11 +116,22 @@ export interface AuthModalProps {
     onSuccess: () => void;
 }
 
+export interface PaymentConfig {
+    provider: string;
+    currency: string;
+    publishableKey?: string;
+    testPaymentMethods?: string[];
+}
+
+export interface PaymentFormHandle {
+    createPaymentMethod: () => Promise<string>;
+}
+
 export interface CartProps {
     cartItems: CartItem[];
     onUpdateQuantity: (index: number, change: number) => void;
     onRemoveItem: (index: number) => void;
-    onCheckout: () => void;
+    onCheckout: (createPaymentMethod: () => Promise<string>) => void;
 }
 
 export interface CategoryProps {
@@ -130,7 +141,7 @@ export interface CategoryProps {
     onAddToCart: (product: Product, portion?: string, customizations?: CustomizationOption[]) => void;
     onUpdateQuantity: (index: number, change: number) => void;
     onRemoveItem: (index: number) => void;
-    onCheckout: () => void;
+    onCheckout: (createPaymentMethod: () => Promise<string>) => void;
 }
 
 export interface InfoBarProps {